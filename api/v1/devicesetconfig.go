@@ -16,12 +16,37 @@ limitations under the License.
 
 package v1
 
+import "strconv"
+
+// The keys of the Rook StorageClassDeviceSet config
+const (
+	osdsPerDeviceKey    = "osdsPerDevice"
+	crushDeviceClassKey = "deviceClass"
+	databaseSizeMBKey   = "databaseSizeMB"
+	walSizeMBKey        = "walSizeMB"
+)
+
 // ToMap converts a StorageDeviceSetConfig object to a map[string]string that
-// can be set in a Rook StorageClassDeviceSet object
-// This functions just returns `nil` right now as the StorageDeviceSetConfig
-// struct itself is empty. It will be updated to perform actual conversion and
-// return a proper map when the StorageDeviceSetConfig struct is updated.
-// TODO: Do actual conversion to map when StorageDeviceSetConfig has defined members
+// can be set in a Rook StorageClassDeviceSet object. Only the options that are
+// set are added, and nil is returned if none of them is set.
+// The tuning and encryption options have dedicated StorageClassDeviceSet
+// fields and are not part of the map.
 func (c *StorageDeviceSetConfig) ToMap() map[string]string {
-	return nil
+	config := map[string]string{}
+	if c.OSDsPerDevice > 0 {
+		config[osdsPerDeviceKey] = strconv.Itoa(c.OSDsPerDevice)
+	}
+	if c.CrushDeviceClass != "" {
+		config[crushDeviceClassKey] = c.CrushDeviceClass
+	}
+	if c.DatabaseSizeMB > 0 {
+		config[databaseSizeMBKey] = strconv.Itoa(c.DatabaseSizeMB)
+	}
+	if c.WalSizeMB > 0 {
+		config[walSizeMBKey] = strconv.Itoa(c.WalSizeMB)
+	}
+	if len(config) == 0 {
+		return nil
+	}
+	return config
 }
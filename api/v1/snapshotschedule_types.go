@@ -0,0 +1,130 @@
+/*
+Copyright 2020 Red Hat OpenShift Container Storage.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+)
+
+// SnapshotScheduleSpec defines the desired state of SnapshotSchedule
+type SnapshotScheduleSpec struct {
+	// PVCSelector selects the PersistentVolumeClaims in the namespace of the
+	// SnapshotSchedule that are snapshotted
+	PVCSelector metav1.LabelSelector `json:"pvcSelector"`
+
+	// Schedule is a cron expression with the minute, hour, day of month,
+	// month and day of week fields, e.g. "0 */6 * * *". The @hourly,
+	// @daily, @weekly, @monthly and @yearly shortcuts are accepted too, as
+	// well as "@every <duration>" with a duration of at least one minute.
+	// The schedule is evaluated in UTC, unless it is prefixed with a time
+	// zone, e.g. "CRON_TZ=Europe/Paris 0 2 * * *".
+	Schedule string `json:"schedule"`
+
+	// Retention defines which snapshots are deleted. Without a retention
+	// all snapshots are kept.
+	// +optional
+	Retention SnapshotRetentionSpec `json:"retention,omitempty"`
+
+	// Suspend stops taking new snapshots. The retention is still applied.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// SnapshotRetentionSpec defines how long the snapshots of a SnapshotSchedule
+// are kept. When both are set, a snapshot is deleted as soon as either limit
+// is exceeded.
+type SnapshotRetentionSpec struct {
+	// MaxCount is the number of snapshots kept per PersistentVolumeClaim
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxCount int `json:"maxCount,omitempty"`
+
+	// MaxAge is the age after which a snapshot is deleted, e.g. "168h"
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// SnapshotScheduleStatus defines the observed state of SnapshotSchedule
+type SnapshotScheduleStatus struct {
+	// Conditions describes the state of the SnapshotSchedule resource.
+	// +optional
+	Conditions []conditionsv1.Condition `json:"conditions,omitempty"`
+
+	// LastScheduleTime is the time the snapshots were last taken
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is the time the snapshots of all selected
+	// PersistentVolumeClaims were last taken successfully
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// NextScheduleTime is the time the snapshots will be taken next
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+}
+
+const (
+	// ConditionSnapshotScheduleValid communicates whether the schedule of a
+	// SnapshotSchedule can be parsed
+	ConditionSnapshotScheduleValid conditionsv1.ConditionType = "ScheduleValid"
+
+	// ConditionLastSnapshotSucceeded communicates whether the snapshots of
+	// all selected PersistentVolumeClaims were taken in the last run. When
+	// it is False, the message lists the failures.
+	ConditionLastSnapshotSucceeded conditionsv1.ConditionType = "LastSnapshotSucceeded"
+)
+
+// List of constants to show the state of a SnapshotSchedule
+const (
+	ScheduleValid         = "ScheduleValid"
+	ScheduleInvalid       = "ScheduleInvalid"
+	SnapshotsSucceeded    = "SnapshotsSucceeded"
+	SnapshotsFailed       = "SnapshotsFailed"
+	SnapshotsSucceededMsg = "Snapshots of all selected PersistentVolumeClaims were taken"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=.spec.schedule
+// +kubebuilder:printcolumn:name="Suspend",type=boolean,JSONPath=.spec.suspend
+// +kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=.status.lastScheduleTime
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=.metadata.creationTimestamp
+
+// SnapshotSchedule is the Schema for the snapshotschedules API
+type SnapshotSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SnapshotScheduleSpec   `json:"spec,omitempty"`
+	Status SnapshotScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SnapshotScheduleList contains a list of SnapshotSchedule
+type SnapshotScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SnapshotSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SnapshotSchedule{}, &SnapshotScheduleList{})
+}
@@ -47,7 +47,7 @@ type StorageClusterSpec struct {
 	// Version specifies the version of StorageCluster
 	Version string `json:"version,omitempty"`
 	// Network represents cluster network settings
-	Network *rook.NetworkSpec `json:"network,omitempty"`
+	Network *NetworkSpec `json:"network,omitempty"`
 	// ManagedResources specifies how to deal with auxiliary resources reconciled
 	// with the StorageCluster
 	ManagedResources ManagedResourcesSpec `json:"managedResources,omitempty"`
@@ -65,6 +65,62 @@ type StorageClusterSpec struct {
 	// ArbiterSpec specifies the storage cluster options related to arbiter.
 	// If Arbiter is enabled, ArbiterLocation in the NodeTopologies must be specified.
 	Arbiter ArbiterSpec `json:"arbiter,omitempty"`
+	// CephConfig holds ceph.conf overrides keyed by section (e.g. "global",
+	// "mon" or "osd.3") and then by option name. They are merged on top of
+	// the defaults set by the ocs-operator and take precedence over them.
+	// Within Ceph, options in a daemon section take precedence over the same
+	// options in the global section.
+	// +optional
+	CephConfig map[string]CephConfigSection `json:"cephConfig,omitempty"`
+	// Mirroring configures the RBD mirroring of the CephBlockPools to the
+	// peer clusters
+	// +optional
+	Mirroring MirroringSpec `json:"mirroring,omitempty"`
+}
+
+// MirroringSpec defines the RBD mirroring of the CephBlockPools
+type MirroringSpec struct {
+	// Enabled runs the rbd-mirror daemon and enables mirroring on all
+	// CephBlockPools created by the operator
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// Mode is the mirroring mode of the pools. In "image" mode every image
+	// has to be enabled for mirroring explicitly, in "pool" mode all images
+	// are mirrored. It defaults to "image".
+	// +kubebuilder:validation:Enum=image;pool
+	// +optional
+	Mode string `json:"mode,omitempty"`
+	// DaemonCount is the number of rbd-mirror daemons. It defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	DaemonCount int `json:"daemonCount,omitempty"`
+	// PeerSecretNames lists the Secrets that hold the bootstrap peer tokens
+	// of the peer clusters. Each Secret needs the "token" and "pool" keys.
+	// +optional
+	PeerSecretNames []string `json:"peerSecretNames,omitempty"`
+}
+
+// CephConfigSection maps ceph.conf option names to their values
+type CephConfigSection map[string]string
+
+// NetworkSpec defines the network settings of the Ceph cluster
+type NetworkSpec struct {
+	rook.NetworkSpec `json:",inline"`
+	// Encryption configures the encryption of the connections between the
+	// Ceph daemons and their clients
+	// +optional
+	Encryption *NetworkEncryptionSpec `json:"encryption,omitempty"`
+}
+
+// NetworkEncryptionSpec defines the in-transit encryption settings
+type NetworkEncryptionSpec struct {
+	// Enable switches the msgr2 connections of the Ceph daemons and the CSI
+	// kernel clients to the secure mode. The daemons still accept the crc
+	// mode from the clients that do not use the secure mode yet. It requires
+	// Ceph 16.2 and a kernel version of at least 5.11 on the storage nodes
+	// and on the nodes running the CSI plugins.
+	// +optional
+	Enable bool `json:"enable,omitempty"`
 }
 
 // KeyManagementServiceSpec provides a way to enable KMS
@@ -86,6 +142,66 @@ type ManageCephBlockPools struct {
 	ReconcileStrategy    string `json:"reconcileStrategy,omitempty"`
 	DisableStorageClass  bool   `json:"disableStorageClass,omitempty"`
 	DisableSnapshotClass bool   `json:"disableSnapshotClass,omitempty"`
+	// DisableVolumeReplicationClass disables the VolumeReplicationClass,
+	// which is only created when mirroring is enabled
+	// +optional
+	DisableVolumeReplicationClass bool `json:"disableVolumeReplicationClass,omitempty"`
+	// VolumeReplicationClass configures the RBD VolumeReplicationClass
+	// +optional
+	VolumeReplicationClass VolumeReplicationClassSpec `json:"volumeReplicationClass,omitempty"`
+	// AdditionalPools is a list of CephBlockPools that are created in
+	// addition to the default pool. Each of them gets its own StorageClass
+	// and SnapshotClass.
+	// +optional
+	AdditionalPools []AdditionalCephBlockPool `json:"additionalPools,omitempty"`
+}
+
+// VolumeReplicationClassSpec defines the replication settings of the RBD
+// VolumeReplicationClass
+type VolumeReplicationClassSpec struct {
+	// MirroringMode is the RBD image mirroring mode. It defaults to
+	// "snapshot".
+	// +kubebuilder:validation:Enum=snapshot;journal
+	// +optional
+	MirroringMode string `json:"mirroringMode,omitempty"`
+	// SchedulingInterval is the interval of the mirror snapshots in
+	// snapshot mode, in minutes (m), hours (h) or days (d). It defaults to
+	// "5m".
+	// +kubebuilder:validation:Pattern=`^[0-9]+[mhd]$`
+	// +optional
+	SchedulingInterval string `json:"schedulingInterval,omitempty"`
+}
+
+// AdditionalCephBlockPool defines a user-defined CephBlockPool
+type AdditionalCephBlockPool struct {
+	// Name is appended to the names of the default CephBlockPool,
+	// StorageClass and SnapshotClass to name the resources of this pool
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// FailureDomain is the failure domain of the pool. It defaults to the
+	// failure domain of the StorageCluster.
+	// +optional
+	FailureDomain string `json:"failureDomain,omitempty"`
+	// ReplicaSize is the number of replicas of the pool. It defaults to the
+	// replica size of the default pool.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ReplicaSize uint `json:"replicaSize,omitempty"`
+	// DeviceClass restricts the pool to the OSDs of the given device class
+	// +optional
+	DeviceClass string `json:"deviceClass,omitempty"`
+	// CompressionMode is the inline compression mode of the pool
+	// +kubebuilder:validation:Enum=none;passive;aggressive;force
+	// +optional
+	CompressionMode string `json:"compressionMode,omitempty"`
+	// MaxBytes is the quota on the bytes stored in the pool. The pool has
+	// no byte quota when it is 0.
+	// +optional
+	MaxBytes uint64 `json:"maxBytes,omitempty"`
+	// MaxObjects is the quota on the number of objects in the pool. The
+	// pool has no object quota when it is 0.
+	// +optional
+	MaxObjects uint64 `json:"maxObjects,omitempty"`
 }
 
 // ManageCephFilesystems defines how to reconcile CephFilesystems
@@ -93,6 +209,12 @@ type ManageCephFilesystems struct {
 	ReconcileStrategy    string `json:"reconcileStrategy,omitempty"`
 	DisableStorageClass  bool   `json:"disableStorageClass,omitempty"`
 	DisableSnapshotClass bool   `json:"disableSnapshotClass,omitempty"`
+	// ErasureCoded requests an erasure coded data pool for the
+	// CephFilesystem. The metadata pool and the default data pool stay
+	// replicated, and the StorageClass stores the file data in the erasure
+	// coded pool.
+	// +optional
+	ErasureCoded *ErasureCodedPoolSpec `json:"erasureCoded,omitempty"`
 }
 
 // ManageCephObjectStores defines how to reconcile CephObjectStores
@@ -100,6 +222,23 @@ type ManageCephObjectStores struct {
 	ReconcileStrategy   string `json:"reconcileStrategy,omitempty"`
 	DisableStorageClass bool   `json:"disableStorageClass,omitempty"`
 	GatewayInstances    int32  `json:"gatewayInstances,omitempty"`
+	// ErasureCoded requests an erasure coded data pool for the
+	// CephObjectStore. The metadata pool stays replicated.
+	// +optional
+	ErasureCoded *ErasureCodedPoolSpec `json:"erasureCoded,omitempty"`
+}
+
+// ErasureCodedPoolSpec defines the chunks of an erasure coded pool. Every
+// chunk is placed in a different failure domain, so the cluster needs at
+// least DataChunks + CodingChunks failure domains.
+type ErasureCodedPoolSpec struct {
+	// DataChunks is the number of chunks an object is split into
+	// +kubebuilder:validation:Minimum=2
+	DataChunks uint `json:"dataChunks"`
+	// CodingChunks is the number of coding chunks computed for an object,
+	// which is the number of chunks that can be lost without losing data
+	// +kubebuilder:validation:Minimum=1
+	CodingChunks uint `json:"codingChunks"`
 }
 
 // ManageCephObjectStoreUsers defines how to reconcile CephObjectStoreUsers
@@ -156,7 +295,6 @@ type StorageDeviceSet struct {
 }
 
 // StorageDeviceSetConfig defines Ceph OSD specific config options for the StorageDeviceSet
-// TODO: Fill in the members when the actual configurable options are defined in rook-ceph
 type StorageDeviceSetConfig struct {
 	// TuneSlowDeviceClass tunes the OSD when running on a slow Device Class
 	// +optional
@@ -165,6 +303,31 @@ type StorageDeviceSetConfig struct {
 	// TuneFastDeviceClass tunes the OSD when running on a fast Device Class
 	// +optional
 	TuneFastDeviceClass bool `json:"tuneFastDeviceClass,omitempty"`
+
+	// OSDsPerDevice is the number of OSDs created on each device
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	OSDsPerDevice int `json:"osdsPerDevice,omitempty"`
+
+	// CrushDeviceClass is the CRUSH device class assigned to the OSDs,
+	// overriding the class detected by Ceph and the DeviceType
+	// +optional
+	CrushDeviceClass string `json:"crushDeviceClass,omitempty"`
+
+	// DatabaseSizeMB is the size of the BlueStore RocksDB of each OSD
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	DatabaseSizeMB int `json:"databaseSizeMB,omitempty"`
+
+	// WalSizeMB is the size of the BlueStore write-ahead log of each OSD
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	WalSizeMB int `json:"walSizeMB,omitempty"`
+
+	// Encrypted overrides spec.encryption.enable for the OSDs of this
+	// StorageDeviceSet
+	// +optional
+	Encrypted *bool `json:"encrypted,omitempty"`
 }
 
 // MultiCloudGatewaySpec defines specific multi-cloud gateway configuration options
@@ -184,7 +347,16 @@ type MultiCloudGatewaySpec struct {
 // It is optional and defaults to false.
 type EncryptionSpec struct {
 	// +optional
-	Enable               bool                     `json:"enable,omitempty"`
+	Enable bool `json:"enable,omitempty"`
+	// StorageClass enables an additional RBD StorageClass, whose volumes are
+	// encrypted individually with keys from the KMS. It requires the KMS to
+	// be enabled.
+	// +optional
+	StorageClass bool `json:"storageClass,omitempty"`
+	// StorageClassName is the name of the encrypted RBD StorageClass. It
+	// defaults to "<StorageCluster name>-ceph-rbd-encrypted".
+	// +optional
+	StorageClassName     string                   `json:"storageClassName,omitempty"`
 	KeyManagementService KeyManagementServiceSpec `json:"kms,omitempty"`
 }
 
@@ -218,8 +390,256 @@ type StorageClusterStatus struct {
 	// ExternalSecretHash holds the checksum value of external secret data.
 	ExternalSecretHash string `json:"externalSecretHash,omitempty"`
 
+	// KMSSecretHash holds the checksum value of the KMS token and TLS
+	// secrets referenced by the KMS connection details.
+	// +optional
+	KMSSecretHash string `json:"kmsSecretHash,omitempty"`
+
 	// Images holds the image reconcile status for all images reconciled by the operator
 	Images ImagesStatus `json:"images,omitempty"`
+
+	// CephConfig holds the ceph.conf overrides currently passed on to Ceph
+	// +optional
+	CephConfig CephConfigStatus `json:"cephConfig,omitempty"`
+
+	// Mirroring holds the mirroring status of the CephBlockPools
+	// +optional
+	Mirroring *MirroringStatus `json:"mirroring,omitempty"`
+
+	// KMS holds the result of the last health check of the KMS
+	// +optional
+	KMS *KMSStatus `json:"kms,omitempty"`
+
+	// NetworkEncryptionMode is the msgr2 connection mode in effect, either
+	// "secure" or "crc"
+	// +optional
+	NetworkEncryptionMode string `json:"networkEncryptionMode,omitempty"`
+
+	// ExternalEndpoints holds the result of the last connectivity check of
+	// the endpoints of the external cluster
+	// +optional
+	ExternalEndpoints []ExternalEndpointStatus `json:"externalEndpoints,omitempty"`
+
+	// Components holds the status of the child resources of the
+	// StorageCluster. The Available, Progressing and Degraded conditions are
+	// aggregated from their conditions.
+	// +optional
+	Components []ComponentStatus `json:"components,omitempty"`
+
+	// ResourceManagers holds the result of the last run of each resource
+	// manager of the reconcile
+	// +optional
+	ResourceManagers []ResourceManagerStatus `json:"resourceManagers,omitempty"`
+
+	// Capacity holds the capacity and usage of the Ceph cluster
+	// +optional
+	Capacity *CapacityStatus `json:"capacity,omitempty"`
+
+	// StorageDeviceSets holds the OSDs and PVCs of each StorageDeviceSet
+	// +optional
+	StorageDeviceSets []StorageDeviceSetStatus `json:"storageDeviceSets,omitempty"`
+}
+
+// StorageDeviceSetStatus holds the OSDs and PVCs of a StorageDeviceSet
+type StorageDeviceSetStatus struct {
+	// Name is the name of the StorageDeviceSet
+	Name string `json:"name"`
+	// DesiredOSDs is the number of OSDs of the StorageDeviceSet, its Count
+	// for every replica
+	DesiredOSDs int `json:"desiredOSDs"`
+	// ReadyOSDs is the number of OSDs of the StorageDeviceSet that are ready
+	ReadyOSDs int `json:"readyOSDs"`
+	// BoundPVCs is the number of data PVCs that are bound
+	BoundPVCs int `json:"boundPVCs"`
+	// PendingPVCs is the number of data PVCs that are not bound yet
+	PendingPVCs int `json:"pendingPVCs"`
+	// FailingPVCs are the data PVCs that are lost, or whose OSD is not ready
+	// +optional
+	FailingPVCs []string `json:"failingPVCs,omitempty"`
+	// Encrypted is true if the OSDs of the StorageDeviceSet are encrypted
+	Encrypted bool `json:"encrypted"`
+	// ReplicaSets holds the OSDs and the failure domain placement of every
+	// replica of the StorageDeviceSet, a Rook StorageClassDeviceSet
+	// +optional
+	ReplicaSets []StorageDeviceSetReplicaStatus `json:"replicaSets,omitempty"`
+}
+
+// StorageDeviceSetReplicaStatus holds the OSDs and the failure domain
+// placement of a replica of a StorageDeviceSet
+type StorageDeviceSetReplicaStatus struct {
+	// Name is the name of the Rook StorageClassDeviceSet, "<name>-<index>"
+	Name string `json:"name"`
+	// DesiredOSDs is the number of OSDs of the replica
+	DesiredOSDs int `json:"desiredOSDs"`
+	// ReadyOSDs is the number of OSDs of the replica that are ready
+	ReadyOSDs int `json:"readyOSDs"`
+	// FailureDomainKey is the node label of the failure domain
+	// +optional
+	FailureDomainKey string `json:"failureDomainKey,omitempty"`
+	// FailureDomainValues are the failure domains of the replica. It is the
+	// failure domain the replica is pinned to, or else the failure domains of
+	// the nodes its ready OSDs run on.
+	// +optional
+	FailureDomainValues []string `json:"failureDomainValues,omitempty"`
+}
+
+// CapacityStatus holds the capacity and usage of the Ceph cluster, as
+// reported by the CephCluster and the Prometheus exporter of the Ceph mgr
+type CapacityStatus struct {
+	// RawCapacityBytes is the raw capacity of all OSDs
+	// +optional
+	RawCapacityBytes int64 `json:"rawCapacityBytes,omitempty"`
+	// RawUsedBytes is the raw capacity used on all OSDs, the replicas included
+	// +optional
+	RawUsedBytes int64 `json:"rawUsedBytes,omitempty"`
+	// RawAvailableBytes is the raw capacity available on all OSDs
+	// +optional
+	RawAvailableBytes int64 `json:"rawAvailableBytes,omitempty"`
+	// EstimatedUsableCapacityBytes is an estimate of the capacity that can be
+	// stored, the raw capacity divided by the replica count of the default
+	// CephBlockPool. The pools with another replica count or with erasure
+	// coding store more or less, their MaxAvailableBytes is exact. It is not
+	// set in external mode.
+	// +optional
+	EstimatedUsableCapacityBytes int64 `json:"estimatedUsableCapacityBytes,omitempty"`
+	// EstimatedUsableAvailableBytes is an estimate of the capacity that can
+	// still be stored, the raw available capacity divided by the replica
+	// count of the default CephBlockPool. It is not set in external mode.
+	// +optional
+	EstimatedUsableAvailableBytes int64 `json:"estimatedUsableAvailableBytes,omitempty"`
+	// State is the fullness of the cluster, one of "ok", "nearfull",
+	// "backfillfull" or "full"
+	// +optional
+	State string `json:"state,omitempty"`
+	// LastUpdated is the time the capacity was last reported by the CephCluster
+	// +optional
+	LastUpdated *metav1.Time `json:"lastUpdated,omitempty"`
+	// Pools holds the usage of the pools of the managed CephBlockPool,
+	// CephFilesystem and CephObjectStore. It is not set in external mode.
+	// +optional
+	Pools []PoolUsageStatus `json:"pools,omitempty"`
+	// PoolsLastUpdated is the time the usage of the pools was last read
+	// +optional
+	PoolsLastUpdated *metav1.Time `json:"poolsLastUpdated,omitempty"`
+}
+
+// PoolUsageStatus holds the usage of a Ceph pool
+type PoolUsageStatus struct {
+	// Name is the name of the Ceph pool
+	Name string `json:"name"`
+	// Kind is the kind of the resource the pool belongs to, one of
+	// "CephBlockPool", "CephFilesystem" or "CephObjectStore"
+	Kind string `json:"kind"`
+	// Resource is the name of the resource the pool belongs to
+	Resource string `json:"resource"`
+	// StoredBytes is the amount of data stored in the pool
+	// +optional
+	StoredBytes int64 `json:"storedBytes,omitempty"`
+	// UsedBytes is the raw capacity used by the pool, the replicas included
+	// +optional
+	UsedBytes int64 `json:"usedBytes,omitempty"`
+	// MaxAvailableBytes is the amount of data that can still be stored in the
+	// pool, given its replica count or erasure coding
+	// +optional
+	MaxAvailableBytes int64 `json:"maxAvailableBytes,omitempty"`
+}
+
+// ResourceManagerStatus holds the result of the last run of a resource
+// manager, that reconciles one kind of resource of the StorageCluster
+type ResourceManagerStatus struct {
+	// Name is the name of the resource manager
+	Name string `json:"name"`
+	// LastSuccessTime is the last time the resource manager succeeded
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+	// LastFailureTime is the last time the resource manager failed, or was
+	// skipped because a resource manager it depends on failed
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+	// Message holds the error of the last run, it is empty if the last run
+	// succeeded
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ComponentStatus is the status of a child resource of the StorageCluster
+type ComponentStatus struct {
+	// Kind is the kind of the child resource
+	Kind string `json:"kind"`
+	// Name is the name of the child resource
+	Name string `json:"name"`
+	// Phase is the phase or state reported by the child resource
+	// +optional
+	Phase string `json:"phase,omitempty"`
+	// Message describes the negative conditions of the child resource
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Conditions are the negative conditions of the StorageCluster that are
+	// caused by the child resource
+	// +optional
+	Conditions []conditionsv1.Condition `json:"conditions,omitempty"`
+	// LastTransitionTime is the last time the phase changed
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// ExternalEndpointStatus holds the result of the last connectivity check of
+// an endpoint of the external cluster
+type ExternalEndpointStatus struct {
+	// Type is the type of the endpoint, one of "mon", "mgr" or "rgw"
+	Type string `json:"type"`
+	// Address is the address of the endpoint that was checked
+	Address string `json:"address"`
+	// Reachable is whether the endpoint was reachable
+	Reachable bool `json:"reachable"`
+	// Message holds the error of an unreachable endpoint
+	// +optional
+	Message string `json:"message,omitempty"`
+	// LastCheckTime is the time of the last connectivity check
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+}
+
+// KMSStatus holds the result of the last health check of the KMS
+type KMSStatus struct {
+	// Provider is the KMS provider that was checked
+	Provider string `json:"provider,omitempty"`
+	// Address is the KMS address that was checked
+	Address string `json:"address,omitempty"`
+	// LastCheckTime is the time of the last health check
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+	// LastSuccessTime is the time of the last successful health check
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+	// AuthenticationChecked is true if the last health check authenticated
+	// to the KMS. Only the authentication to Vault is checked, the check of
+	// the other providers stops at the TLS handshake.
+	AuthenticationChecked bool `json:"authenticationChecked,omitempty"`
+}
+
+// MirroringStatus holds the mirroring status of the CephBlockPools
+type MirroringStatus struct {
+	// Pools holds the mirroring status of every mirrored CephBlockPool
+	Pools []PoolMirroringStatus `json:"pools,omitempty"`
+}
+
+// PoolMirroringStatus holds the mirroring status of a CephBlockPool
+type PoolMirroringStatus struct {
+	// Name is the name of the CephBlockPool
+	Name string `json:"name"`
+	// Health is the mirroring health reported by Rook, e.g. OK, WARNING or
+	// ERROR. It is empty until Rook reports it.
+	Health string `json:"health,omitempty"`
+	// BootstrapPeerSecretName is the Secret holding the bootstrap peer token
+	// of this pool, which the peer clusters have to import
+	BootstrapPeerSecretName string `json:"bootstrapPeerSecretName,omitempty"`
+}
+
+// CephConfigStatus holds the rendered ceph.conf overrides and their checksum
+type CephConfigStatus struct {
+	// Config is the ceph.conf content written to the rook-config-override ConfigMap
+	Config string `json:"config,omitempty"`
+	// Hash holds the checksum value of Config
+	Hash string `json:"hash,omitempty"`
 }
 
 // ImagesStatus maps every component image name it's reconciliation status information
@@ -268,6 +688,40 @@ const (
 	// ConditionExternalClusterConnecting type indicates that rook is still trying for
 	// an external connection
 	ConditionExternalClusterConnecting conditionsv1.ConditionType = "ExternalClusterConnecting"
+
+	// ConditionSpecValid communicates whether the StorageCluster spec passed
+	// validation. When it is False, the message lists every invalid field.
+	ConditionSpecValid conditionsv1.ConditionType = "SpecValid"
+
+	// ConditionMirroringHealthy communicates the RBD mirroring health of the
+	// CephBlockPools. It is only set when mirroring is enabled.
+	ConditionMirroringHealthy conditionsv1.ConditionType = "MirroringHealthy"
+
+	// ConditionKMSConnected communicates whether the KMS is reachable, and
+	// whether the operator can authenticate to it and access its secret
+	// engine. It is Unknown when the KMS is reachable but the authentication
+	// could not be checked. It is only set when the KMS is enabled.
+	ConditionKMSConnected conditionsv1.ConditionType = "KMSConnected"
+
+	// ConditionNetworkEncryptionSupported communicates whether the Ceph
+	// version and the kernels of the storage nodes and of the nodes running
+	// the CSI plugins support the network encryption. When it is False, the
+	// msgr2 connections stay in the crc mode, or stay in the secure mode if
+	// they were switched to it already. It is Unknown, with the connections
+	// in the crc mode, until the Ceph version is known. It is only set when
+	// the network encryption is enabled.
+	ConditionNetworkEncryptionSupported conditionsv1.ConditionType = "NetworkEncryptionSupported"
+
+	// ConditionExternalClusterConfigValid communicates whether the external
+	// cluster details passed validation. When it is False, the message lists
+	// every missing or malformed field. It is only set in external mode.
+	ConditionExternalClusterConfigValid conditionsv1.ConditionType = "ExternalClusterConfigValid"
+
+	// ConditionPoolQuotasApplied communicates whether the quotas of the
+	// additional CephBlockPools are set. When it is False, the message lists
+	// the pools whose quota failed to be set. It is only set when a pool has
+	// a quota.
+	ConditionPoolQuotasApplied conditionsv1.ConditionType = "PoolQuotasApplied"
 )
 
 // List of constants to show different different reconciliation messages and statuses.
@@ -278,6 +732,46 @@ const (
 	ReconcileCompletedMessage       = "Reconcile completed successfully"
 	ExternalClusterConnected        = "ExternalClusterConnected"
 	ExternalClusterConnectedMessage = "Connected successfully to an external cluster"
+	ExternalEndpointsUnreachable    = "ExternalEndpointsUnreachable"
+	SpecValidationSucceeded         = "SpecValidationSucceeded"
+	SpecValidationSucceededMessage  = "StorageCluster spec is valid"
+	SpecValidationFailed            = "SpecValidationFailed"
+	MirroringHealthy                = "MirroringHealthy"
+	MirroringHealthyMessage         = "Mirroring of all CephBlockPools is healthy"
+	MirroringDegraded               = "MirroringDegraded"
+	MirroringPending                = "MirroringPending"
+	KMSSecretsChanged               = "KMSSecretsChanged"
+	KMSConnected                    = "KMSConnected"
+	KMSConnectedMessage             = "Connected successfully to the KMS"
+	KMSUnreachable                  = "KMSUnreachable"
+	KMSTLSHandshakeFailed           = "KMSTLSHandshakeFailed"
+	KMSAuthenticationFailed         = "KMSAuthenticationFailed"
+	KMSAuthenticationNotChecked     = "KMSAuthenticationNotChecked"
+	KMSSecretEngineInaccessible     = "KMSSecretEngineInaccessible"
+	NetworkEncryptionSupported      = "NetworkEncryptionSupported"
+	NetworkEncryptionUnsupported    = "NetworkEncryptionUnsupported"
+	NetworkEncryptionModeSecure     = "secure"
+	NetworkEncryptionModeCRC        = "crc"
+	ExternalClusterDetailsChanged   = "ExternalClusterDetailsChanged"
+
+	NetworkEncryptionCephVersionUnknown = "NetworkEncryptionCephVersionUnknown"
+
+	ExternalClusterConfigValid        = "ExternalClusterConfigValid"
+	ExternalClusterConfigValidMessage = "External cluster details are valid"
+	ExternalClusterConfigInvalid      = "ExternalClusterConfigInvalid"
+
+	PoolQuotasApplied        = "PoolQuotasApplied"
+	PoolQuotasAppliedMessage = "The quotas of all CephBlockPools are set"
+	PoolQuotasPending        = "PoolQuotasPending"
+	PoolQuotasFailed         = "PoolQuotasFailed"
+)
+
+// The fullness states of the capacity of the Ceph cluster
+const (
+	CapacityStateOK           = "ok"
+	CapacityStateNearFull     = "nearfull"
+	CapacityStateBackfillFull = "backfillfull"
+	CapacityStateFull         = "full"
 )
 
 // +kubebuilder:object:root=true
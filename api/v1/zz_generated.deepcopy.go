@@ -29,6 +29,21 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalCephBlockPool) DeepCopyInto(out *AdditionalCephBlockPool) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalCephBlockPool.
+func (in *AdditionalCephBlockPool) DeepCopy() *AdditionalCephBlockPool {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalCephBlockPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ArbiterSpec) DeepCopyInto(out *ArbiterSpec) {
 	*out = *in
@@ -49,6 +64,70 @@ func (in *ArbiterSpec) DeepCopy() *ArbiterSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapacityStatus) DeepCopyInto(out *CapacityStatus) {
+	*out = *in
+	if in.LastUpdated != nil {
+		in, out := &in.LastUpdated, &out.LastUpdated
+		*out = (*in).DeepCopy()
+	}
+	if in.Pools != nil {
+		in, out := &in.Pools, &out.Pools
+		*out = make([]PoolUsageStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.PoolsLastUpdated != nil {
+		in, out := &in.PoolsLastUpdated, &out.PoolsLastUpdated
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapacityStatus.
+func (in *CapacityStatus) DeepCopy() *CapacityStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CapacityStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in CephConfigSection) DeepCopyInto(out *CephConfigSection) {
+	{
+		in := &in
+		*out = make(CephConfigSection, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CephConfigSection.
+func (in CephConfigSection) DeepCopy() CephConfigSection {
+	if in == nil {
+		return nil
+	}
+	out := new(CephConfigSection)
+	in.DeepCopyInto(out)
+	return *out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CephConfigStatus) DeepCopyInto(out *CephConfigStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CephConfigStatus.
+func (in *CephConfigStatus) DeepCopy() *CephConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CephConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComponentImageStatus) DeepCopyInto(out *ComponentImageStatus) {
 	*out = *in
@@ -64,6 +143,29 @@ func (in *ComponentImageStatus) DeepCopy() *ComponentImageStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentStatus) DeepCopyInto(out *ComponentStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]conditionsv1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentStatus.
+func (in *ComponentStatus) DeepCopy() *ComponentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EncryptionSpec) DeepCopyInto(out *EncryptionSpec) {
 	*out = *in
@@ -80,6 +182,40 @@ func (in *EncryptionSpec) DeepCopy() *EncryptionSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ErasureCodedPoolSpec) DeepCopyInto(out *ErasureCodedPoolSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ErasureCodedPoolSpec.
+func (in *ErasureCodedPoolSpec) DeepCopy() *ErasureCodedPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ErasureCodedPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalEndpointStatus) DeepCopyInto(out *ExternalEndpointStatus) {
+	*out = *in
+	if in.LastCheckTime != nil {
+		in, out := &in.LastCheckTime, &out.LastCheckTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalEndpointStatus.
+func (in *ExternalEndpointStatus) DeepCopy() *ExternalEndpointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalEndpointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExternalStorageClusterSpec) DeepCopyInto(out *ExternalStorageClusterSpec) {
 	*out = *in
@@ -125,6 +261,29 @@ func (in *ImagesStatus) DeepCopy() *ImagesStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSStatus) DeepCopyInto(out *KMSStatus) {
+	*out = *in
+	if in.LastCheckTime != nil {
+		in, out := &in.LastCheckTime, &out.LastCheckTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessTime != nil {
+		in, out := &in.LastSuccessTime, &out.LastSuccessTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSStatus.
+func (in *KMSStatus) DeepCopy() *KMSStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeyManagementServiceSpec) DeepCopyInto(out *KeyManagementServiceSpec) {
 	*out = *in
@@ -143,6 +302,12 @@ func (in *KeyManagementServiceSpec) DeepCopy() *KeyManagementServiceSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManageCephBlockPools) DeepCopyInto(out *ManageCephBlockPools) {
 	*out = *in
+	out.VolumeReplicationClass = in.VolumeReplicationClass
+	if in.AdditionalPools != nil {
+		in, out := &in.AdditionalPools, &out.AdditionalPools
+		*out = make([]AdditionalCephBlockPool, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManageCephBlockPools.
@@ -158,6 +323,11 @@ func (in *ManageCephBlockPools) DeepCopy() *ManageCephBlockPools {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManageCephFilesystems) DeepCopyInto(out *ManageCephFilesystems) {
 	*out = *in
+	if in.ErasureCoded != nil {
+		in, out := &in.ErasureCoded, &out.ErasureCoded
+		*out = new(ErasureCodedPoolSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManageCephFilesystems.
@@ -188,6 +358,11 @@ func (in *ManageCephObjectStoreUsers) DeepCopy() *ManageCephObjectStoreUsers {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManageCephObjectStores) DeepCopyInto(out *ManageCephObjectStores) {
 	*out = *in
+	if in.ErasureCoded != nil {
+		in, out := &in.ErasureCoded, &out.ErasureCoded
+		*out = new(ErasureCodedPoolSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManageCephObjectStores.
@@ -203,9 +378,9 @@ func (in *ManageCephObjectStores) DeepCopy() *ManageCephObjectStores {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManagedResourcesSpec) DeepCopyInto(out *ManagedResourcesSpec) {
 	*out = *in
-	out.CephBlockPools = in.CephBlockPools
-	out.CephFilesystems = in.CephFilesystems
-	out.CephObjectStores = in.CephObjectStores
+	in.CephBlockPools.DeepCopyInto(&out.CephBlockPools)
+	in.CephFilesystems.DeepCopyInto(&out.CephFilesystems)
+	in.CephObjectStores.DeepCopyInto(&out.CephObjectStores)
 	out.CephObjectStoreUsers = in.CephObjectStoreUsers
 }
 
@@ -219,6 +394,46 @@ func (in *ManagedResourcesSpec) DeepCopy() *ManagedResourcesSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirroringSpec) DeepCopyInto(out *MirroringSpec) {
+	*out = *in
+	if in.PeerSecretNames != nil {
+		in, out := &in.PeerSecretNames, &out.PeerSecretNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirroringSpec.
+func (in *MirroringSpec) DeepCopy() *MirroringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MirroringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirroringStatus) DeepCopyInto(out *MirroringStatus) {
+	*out = *in
+	if in.Pools != nil {
+		in, out := &in.Pools, &out.Pools
+		*out = make([]PoolMirroringStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirroringStatus.
+func (in *MirroringStatus) DeepCopy() *MirroringStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MirroringStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MultiCloudGatewaySpec) DeepCopyInto(out *MultiCloudGatewaySpec) {
 	*out = *in
@@ -239,6 +454,42 @@ func (in *MultiCloudGatewaySpec) DeepCopy() *MultiCloudGatewaySpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkEncryptionSpec) DeepCopyInto(out *NetworkEncryptionSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkEncryptionSpec.
+func (in *NetworkEncryptionSpec) DeepCopy() *NetworkEncryptionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkEncryptionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkSpec) DeepCopyInto(out *NetworkSpec) {
+	*out = *in
+	in.NetworkSpec.DeepCopyInto(&out.NetworkSpec)
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(NetworkEncryptionSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkSpec.
+func (in *NetworkSpec) DeepCopy() *NetworkSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeTopologyMap) DeepCopyInto(out *NodeTopologyMap) {
 	*out = *in
@@ -370,6 +621,189 @@ func (in *OCSInitializationStatus) DeepCopy() *OCSInitializationStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolMirroringStatus) DeepCopyInto(out *PoolMirroringStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolMirroringStatus.
+func (in *PoolMirroringStatus) DeepCopy() *PoolMirroringStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolMirroringStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolUsageStatus) DeepCopyInto(out *PoolUsageStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolUsageStatus.
+func (in *PoolUsageStatus) DeepCopy() *PoolUsageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolUsageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceManagerStatus) DeepCopyInto(out *ResourceManagerStatus) {
+	*out = *in
+	if in.LastSuccessTime != nil {
+		in, out := &in.LastSuccessTime, &out.LastSuccessTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceManagerStatus.
+func (in *ResourceManagerStatus) DeepCopy() *ResourceManagerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceManagerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotRetentionSpec) DeepCopyInto(out *SnapshotRetentionSpec) {
+	*out = *in
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotRetentionSpec.
+func (in *SnapshotRetentionSpec) DeepCopy() *SnapshotRetentionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotRetentionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotSchedule) DeepCopyInto(out *SnapshotSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotSchedule.
+func (in *SnapshotSchedule) DeepCopy() *SnapshotSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SnapshotSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotScheduleList) DeepCopyInto(out *SnapshotScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SnapshotSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotScheduleList.
+func (in *SnapshotScheduleList) DeepCopy() *SnapshotScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SnapshotScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotScheduleSpec) DeepCopyInto(out *SnapshotScheduleSpec) {
+	*out = *in
+	in.PVCSelector.DeepCopyInto(&out.PVCSelector)
+	in.Retention.DeepCopyInto(&out.Retention)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotScheduleSpec.
+func (in *SnapshotScheduleSpec) DeepCopy() *SnapshotScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotScheduleStatus) DeepCopyInto(out *SnapshotScheduleStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]conditionsv1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextScheduleTime != nil {
+		in, out := &in.NextScheduleTime, &out.NextScheduleTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotScheduleStatus.
+func (in *SnapshotScheduleStatus) DeepCopy() *SnapshotScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StorageCluster) DeepCopyInto(out *StorageCluster) {
 	*out = *in
@@ -472,16 +906,34 @@ func (in *StorageClusterSpec) DeepCopyInto(out *StorageClusterSpec) {
 	}
 	if in.Network != nil {
 		in, out := &in.Network, &out.Network
-		*out = new(rook_iov1.NetworkSpec)
+		*out = new(NetworkSpec)
 		(*in).DeepCopyInto(*out)
 	}
-	out.ManagedResources = in.ManagedResources
+	in.ManagedResources.DeepCopyInto(&out.ManagedResources)
 	if in.NodeTopologies != nil {
 		in, out := &in.NodeTopologies, &out.NodeTopologies
 		*out = new(NodeTopologyMap)
 		(*in).DeepCopyInto(*out)
 	}
 	in.Arbiter.DeepCopyInto(&out.Arbiter)
+	if in.CephConfig != nil {
+		in, out := &in.CephConfig, &out.CephConfig
+		*out = make(map[string]CephConfigSection, len(*in))
+		for key, val := range *in {
+			var outVal map[string]string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make(CephConfigSection, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
+	in.Mirroring.DeepCopyInto(&out.Mirroring)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageClusterSpec.
@@ -515,6 +967,50 @@ func (in *StorageClusterStatus) DeepCopyInto(out *StorageClusterStatus) {
 		(*in).DeepCopyInto(*out)
 	}
 	in.Images.DeepCopyInto(&out.Images)
+	out.CephConfig = in.CephConfig
+	if in.Mirroring != nil {
+		in, out := &in.Mirroring, &out.Mirroring
+		*out = new(MirroringStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KMS != nil {
+		in, out := &in.KMS, &out.KMS
+		*out = new(KMSStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExternalEndpoints != nil {
+		in, out := &in.ExternalEndpoints, &out.ExternalEndpoints
+		*out = make([]ExternalEndpointStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]ComponentStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ResourceManagers != nil {
+		in, out := &in.ResourceManagers, &out.ResourceManagers
+		*out = make([]ResourceManagerStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = new(CapacityStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StorageDeviceSets != nil {
+		in, out := &in.StorageDeviceSets, &out.StorageDeviceSets
+		*out = make([]StorageDeviceSetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageClusterStatus.
@@ -533,7 +1029,7 @@ func (in *StorageDeviceSet) DeepCopyInto(out *StorageDeviceSet) {
 	in.Resources.DeepCopyInto(&out.Resources)
 	in.PreparePlacement.DeepCopyInto(&out.PreparePlacement)
 	in.Placement.DeepCopyInto(&out.Placement)
-	out.Config = in.Config
+	in.Config.DeepCopyInto(&out.Config)
 	in.DataPVCTemplate.DeepCopyInto(&out.DataPVCTemplate)
 	if in.MetadataPVCTemplate != nil {
 		in, out := &in.MetadataPVCTemplate, &out.MetadataPVCTemplate
@@ -560,6 +1056,11 @@ func (in *StorageDeviceSet) DeepCopy() *StorageDeviceSet {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StorageDeviceSetConfig) DeepCopyInto(out *StorageDeviceSetConfig) {
 	*out = *in
+	if in.Encrypted != nil {
+		in, out := &in.Encrypted, &out.Encrypted
+		*out = new(bool)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageDeviceSetConfig.
@@ -572,6 +1073,53 @@ func (in *StorageDeviceSetConfig) DeepCopy() *StorageDeviceSetConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageDeviceSetReplicaStatus) DeepCopyInto(out *StorageDeviceSetReplicaStatus) {
+	*out = *in
+	if in.FailureDomainValues != nil {
+		in, out := &in.FailureDomainValues, &out.FailureDomainValues
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageDeviceSetReplicaStatus.
+func (in *StorageDeviceSetReplicaStatus) DeepCopy() *StorageDeviceSetReplicaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageDeviceSetReplicaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageDeviceSetStatus) DeepCopyInto(out *StorageDeviceSetStatus) {
+	*out = *in
+	if in.FailingPVCs != nil {
+		in, out := &in.FailingPVCs, &out.FailingPVCs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReplicaSets != nil {
+		in, out := &in.ReplicaSets, &out.ReplicaSets
+		*out = make([]StorageDeviceSetReplicaStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageDeviceSetStatus.
+func (in *StorageDeviceSetStatus) DeepCopy() *StorageDeviceSetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageDeviceSetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in TopologyLabelValues) DeepCopyInto(out *TopologyLabelValues) {
 	{
@@ -590,3 +1138,18 @@ func (in TopologyLabelValues) DeepCopy() TopologyLabelValues {
 	in.DeepCopyInto(out)
 	return *out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VolumeReplicationClassSpec) DeepCopyInto(out *VolumeReplicationClassSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VolumeReplicationClassSpec.
+func (in *VolumeReplicationClassSpec) DeepCopy() *VolumeReplicationClassSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VolumeReplicationClassSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -30,6 +30,14 @@ var (
 	DeviceSetReplica = 3
 	// CephObjectStoreGatewayInstances is the default number of RGW instances to create
 	CephObjectStoreGatewayInstances = 1
+	// CephRBDMirrorDaemonCount is the default number of rbd-mirror daemons to run
+	CephRBDMirrorDaemonCount = 1
+	// MirroringMode is the default mirroring mode of the CephBlockPools
+	MirroringMode = "image"
+	// VolumeReplicationMirroringMode is the default RBD image mirroring mode of the VolumeReplicationClass
+	VolumeReplicationMirroringMode = "snapshot"
+	// VolumeReplicationSchedulingInterval is the default interval of the mirror snapshots of the VolumeReplicationClass
+	VolumeReplicationSchedulingInterval = "5m"
 	// IsUnsupportedCephVersionAllowed is a string that determines if the CephCluster should allow unsupported ceph version image
 	IsUnsupportedCephVersionAllowed = ""
 	// ArbiterModeDeviceSetReplica is the default number of Rook-Ceph
@@ -102,6 +102,17 @@ var (
 				getOcsToleration(),
 			},
 		},
+
+		"rbd-mirror": {
+			Tolerations: []corev1.Toleration{
+				getOcsToleration(),
+			},
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+					getWeightedPodAffinityTerm(100, "rook-ceph-rbd-mirror"),
+				},
+			},
+		},
 	}
 )
 
@@ -0,0 +1,322 @@
+package snapshotschedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/v2/pkg/apis/volumesnapshot/v1beta1"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/util"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups=ocs.openshift.io,resources=snapshotschedules,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=ocs.openshift.io,resources=snapshotschedules/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch
+// +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshotclasses,verbs=get;list;watch
+
+// Reconcile takes the snapshots of a SnapshotSchedule when they are due,
+// applies its retention and requeues until the next scheduled time
+func (r *SnapshotScheduleReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+
+	prevLogger := r.Log
+	defer func() { r.Log = prevLogger }()
+	r.Log = r.Log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+
+	schedule := &ocsv1.SnapshotSchedule{}
+	err := r.Client.Get(context.TODO(), request.NamespacedName, schedule)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			r.Log.Info("SnapshotSchedule not found")
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Check GetDeletionTimestamp to determine if the object is under deletion
+	if !schedule.GetDeletionTimestamp().IsZero() {
+		r.Log.Info("Object is terminated, skipping reconciliation")
+		return reconcile.Result{}, nil
+	}
+
+	r.Log.Info("Reconciling SnapshotSchedule")
+
+	now := r.now().UTC()
+	cronSchedule, err := parseSchedule(schedule.Spec.Schedule)
+	if err != nil {
+		// the schedule is not retried until the spec changes
+		r.Log.Error(err, "Invalid schedule")
+		conditionsv1.SetStatusCondition(&schedule.Status.Conditions, conditionsv1.Condition{
+			Type:    ocsv1.ConditionSnapshotScheduleValid,
+			Status:  corev1.ConditionFalse,
+			Reason:  ocsv1.ScheduleInvalid,
+			Message: err.Error(),
+		})
+		schedule.Status.NextScheduleTime = nil
+		return reconcile.Result{}, r.Client.Status().Update(context.TODO(), schedule)
+	}
+	conditionsv1.SetStatusCondition(&schedule.Status.Conditions, conditionsv1.Condition{
+		Type:    ocsv1.ConditionSnapshotScheduleValid,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.ScheduleValid,
+		Message: fmt.Sprintf("Schedule %q is valid", schedule.Spec.Schedule),
+	})
+
+	if !schedule.Spec.Suspend {
+		if scheduled := lastMissedRun(cronSchedule, schedule, now); !scheduled.IsZero() {
+			r.runSchedule(schedule, scheduled)
+		}
+	}
+
+	pruneErr := r.pruneSnapshots(schedule, now)
+
+	var result reconcile.Result
+	schedule.Status.NextScheduleTime = nil
+	if next := cronSchedule.Next(now); !next.IsZero() {
+		schedule.Status.NextScheduleTime = &metav1.Time{Time: next}
+		result.RequeueAfter = next.Sub(now)
+	}
+
+	if err = r.Client.Status().Update(context.TODO(), schedule); err != nil {
+		r.Log.Error(err, "Failed to update SnapshotSchedule status")
+		return reconcile.Result{}, err
+	}
+	if pruneErr != nil {
+		return reconcile.Result{}, pruneErr
+	}
+	return result, nil
+}
+
+// parseSchedule parses a schedule in the standard cron format. The schedules
+// of the "@every" descriptor that are shorter than a minute are rejected, as
+// the names of the VolumeSnapshots only go down to the minute.
+func parseSchedule(spec string) (cron.Schedule, error) {
+	cronSchedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, err
+	}
+	if delaySchedule, ok := cronSchedule.(cron.ConstantDelaySchedule); ok && delaySchedule.Delay < time.Minute {
+		return nil, fmt.Errorf("schedule %q runs more than once a minute", spec)
+	}
+	return cronSchedule, nil
+}
+
+// lastMissedRun returns the latest scheduled time that has passed since the
+// last run of the given schedule, or the zero time if no run is due. Runs
+// missed while the operator was down are collapsed into one.
+func lastMissedRun(cronSchedule cron.Schedule, schedule *ocsv1.SnapshotSchedule, now time.Time) time.Time {
+	earliest := schedule.CreationTimestamp.Time
+	if schedule.Status.LastScheduleTime != nil {
+		earliest = schedule.Status.LastScheduleTime.Time
+	}
+
+	var scheduled time.Time
+	for t := cronSchedule.Next(earliest.UTC()); !t.IsZero() && !t.After(now); t = cronSchedule.Next(t) {
+		scheduled = t
+	}
+	return scheduled
+}
+
+// runSchedule takes the snapshots of the given scheduled time, and records
+// the result in the status of the schedule
+func (r *SnapshotScheduleReconciler) runSchedule(schedule *ocsv1.SnapshotSchedule, scheduled time.Time) {
+	failures := r.takeSnapshots(schedule, scheduled)
+
+	schedule.Status.LastScheduleTime = &metav1.Time{Time: scheduled}
+	if len(failures) > 0 {
+		msg := strings.Join(failures, "; ")
+		r.Log.Info("Failed to take snapshots", "failures", msg)
+		r.recorder.Event(schedule, corev1.EventTypeWarning, ocsv1.SnapshotsFailed, msg)
+		conditionsv1.SetStatusCondition(&schedule.Status.Conditions, conditionsv1.Condition{
+			Type:    ocsv1.ConditionLastSnapshotSucceeded,
+			Status:  corev1.ConditionFalse,
+			Reason:  ocsv1.SnapshotsFailed,
+			Message: msg,
+		})
+		return
+	}
+
+	schedule.Status.LastSuccessfulTime = &metav1.Time{Time: scheduled}
+	conditionsv1.SetStatusCondition(&schedule.Status.Conditions, conditionsv1.Condition{
+		Type:    ocsv1.ConditionLastSnapshotSucceeded,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.SnapshotsSucceeded,
+		Message: ocsv1.SnapshotsSucceededMsg,
+	})
+}
+
+// takeSnapshots creates a VolumeSnapshot of every PersistentVolumeClaim
+// selected by the schedule, and returns a message per failure
+func (r *SnapshotScheduleReconciler) takeSnapshots(schedule *ocsv1.SnapshotSchedule, scheduled time.Time) []string {
+	selector, err := metav1.LabelSelectorAsSelector(&schedule.Spec.PVCSelector)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid pvcSelector: %v", err)}
+	}
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	err = r.Client.List(context.TODO(), pvcs, client.InNamespace(schedule.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return []string{fmt.Sprintf("failed to list PersistentVolumeClaims: %v", err)}
+	}
+	if len(pvcs.Items) == 0 {
+		return []string{"no PersistentVolumeClaims match the pvcSelector"}
+	}
+	snapshotClasses := &snapapi.VolumeSnapshotClassList{}
+	err = r.Client.List(context.TODO(), snapshotClasses)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to list VolumeSnapshotClasses: %v", err)}
+	}
+
+	failures := []string{}
+	for _, pvc := range pvcs.Items {
+		if !pvc.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		if pvc.Status.Phase != corev1.ClaimBound {
+			failures = append(failures, fmt.Sprintf("%s: PersistentVolumeClaim is not bound", pvc.Name))
+			continue
+		}
+		className, err := r.getSnapshotClassName(&pvc, snapshotClasses.Items)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", pvc.Name, err))
+			continue
+		}
+
+		pvcName := pvc.Name
+		snapshot := &snapapi.VolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      getSnapshotName(pvc.Name, schedule.Name, scheduled),
+				Namespace: schedule.Namespace,
+				Labels: map[string]string{
+					scheduleLabel: util.ShortenName(schedule.Name, validation.LabelValueMaxLength),
+					pvcLabel:      util.ShortenName(pvc.Name, validation.LabelValueMaxLength),
+				},
+				Annotations: map[string]string{
+					scheduleTimeAnnotation: scheduled.Format(time.RFC3339),
+				},
+			},
+			Spec: snapapi.VolumeSnapshotSpec{
+				Source: snapapi.VolumeSnapshotSource{
+					PersistentVolumeClaimName: &pvcName,
+				},
+				VolumeSnapshotClassName: &className,
+			},
+		}
+		r.Log.Info("Creating VolumeSnapshot", "VolumeSnapshot", snapshot.Name)
+		err = r.Client.Create(context.TODO(), snapshot)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			failures = append(failures, fmt.Sprintf("%s: failed to create VolumeSnapshot %s: %v", pvc.Name, snapshot.Name, err))
+		}
+	}
+	return failures
+}
+
+// getSnapshotClassName returns the name of the VolumeSnapshotClass of the
+// OCS CSI driver that provisioned the given PersistentVolumeClaim. The driver
+// is shared by the internal and the external clusters, so the class has to be
+// of the same Ceph cluster as the StorageClass too.
+func (r *SnapshotScheduleReconciler) getSnapshotClassName(pvc *corev1.PersistentVolumeClaim, snapshotClasses []snapapi.VolumeSnapshotClass) (string, error) {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return "", fmt.Errorf("PersistentVolumeClaim has no StorageClass")
+	}
+	sc := &storagev1.StorageClass{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: *pvc.Spec.StorageClassName}, sc)
+	if err != nil {
+		return "", fmt.Errorf("failed to get StorageClass %s: %v", *pvc.Spec.StorageClassName, err)
+	}
+	if !strings.HasSuffix(sc.Provisioner, csiRBDDriverSuffix) && !strings.HasSuffix(sc.Provisioner, csiCephFSDriverSuffix) {
+		return "", fmt.Errorf("StorageClass %s is not provisioned by OCS", sc.Name)
+	}
+
+	clusterID := sc.Parameters[clusterIDParameter]
+	names := []string{}
+	for _, class := range snapshotClasses {
+		if class.Driver == sc.Provisioner && class.Parameters[clusterIDParameter] == clusterID {
+			names = append(names, class.Name)
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no VolumeSnapshotClass found for driver %s and clusterID %q", sc.Provisioner, clusterID)
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// pruneSnapshots deletes the VolumeSnapshots of the given schedule that are
+// not kept by its retention
+func (r *SnapshotScheduleReconciler) pruneSnapshots(schedule *ocsv1.SnapshotSchedule, now time.Time) error {
+	retention := schedule.Spec.Retention
+	if retention.MaxCount == 0 && retention.MaxAge == nil {
+		return nil
+	}
+
+	snapshots := &snapapi.VolumeSnapshotList{}
+	err := r.Client.List(context.TODO(), snapshots, client.InNamespace(schedule.Namespace), client.MatchingLabels{scheduleLabel: util.ShortenName(schedule.Name, validation.LabelValueMaxLength)})
+	if err != nil {
+		return err
+	}
+
+	byPVC := map[string][]snapapi.VolumeSnapshot{}
+	for _, snapshot := range snapshots.Items {
+		pvcName := snapshot.Labels[pvcLabel]
+		if snapshot.Spec.Source.PersistentVolumeClaimName != nil {
+			pvcName = *snapshot.Spec.Source.PersistentVolumeClaimName
+		}
+		byPVC[pvcName] = append(byPVC[pvcName], snapshot)
+	}
+
+	var lastErr error
+	for _, pvcSnapshots := range byPVC {
+		// newest first
+		sort.Slice(pvcSnapshots, func(i, j int) bool {
+			return snapshotTime(&pvcSnapshots[i]).After(snapshotTime(&pvcSnapshots[j]))
+		})
+		for i := range pvcSnapshots {
+			snapshot := &pvcSnapshots[i]
+			expired := retention.MaxAge != nil && now.Sub(snapshotTime(snapshot)) > retention.MaxAge.Duration
+			if (retention.MaxCount == 0 || i < retention.MaxCount) && !expired {
+				continue
+			}
+			if !snapshot.GetDeletionTimestamp().IsZero() {
+				continue
+			}
+			r.Log.Info("Deleting VolumeSnapshot", "VolumeSnapshot", snapshot.Name)
+			err = r.Client.Delete(context.TODO(), snapshot)
+			if err != nil && !errors.IsNotFound(err) {
+				r.Log.Error(err, "Failed to delete VolumeSnapshot", "VolumeSnapshot", snapshot.Name)
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
+
+// snapshotTime returns the scheduled time of a VolumeSnapshot, falling back to
+// its creation time
+func snapshotTime(snapshot *snapapi.VolumeSnapshot) time.Time {
+	if t, err := time.Parse(time.RFC3339, snapshot.Annotations[scheduleTimeAnnotation]); err == nil {
+		return t
+	}
+	return snapshot.CreationTimestamp.Time
+}
+
+// getSnapshotName returns the name of the VolumeSnapshot of a PVC taken at the
+// given scheduled time, "<pvc>-<schedule>-<time>". The PVC and schedule part
+// is shortened so that the name stays a valid DNS subdomain.
+func getSnapshotName(pvcName, scheduleName string, scheduled time.Time) string {
+	suffix := "-" + scheduled.Format("200601021504")
+	return util.ShortenName(pvcName+"-"+scheduleName, validation.DNS1123SubdomainMaxLength-len(suffix)) + suffix
+}
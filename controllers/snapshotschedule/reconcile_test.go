@@ -0,0 +1,254 @@
+package snapshotschedule
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/v2/pkg/apis/volumesnapshot/v1beta1"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/util"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	testNamespace   = "test-ns"
+	testRBDDriver   = "openshift-storage.rbd.csi.ceph.com"
+	testRBDSC       = "ocs-storagecluster-ceph-rbd"
+	testSnapClass   = "ocs-storagecluster-rbdplugin-snapclass"
+	testForeignSC   = "gp2"
+	testSchedule    = "hourly"
+	testScheduleStr = "0 * * * *"
+)
+
+var testNow = time.Date(2021, time.March, 10, 10, 5, 0, 0, time.UTC)
+
+func mockPVC(name, storageClassName string, phase corev1.PersistentVolumeClaimPhase, labels map[string]string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClassName,
+		},
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase: phase,
+		},
+	}
+}
+
+func mockSnapshot(pvcName string, scheduled time.Time) *snapapi.VolumeSnapshot {
+	return &snapapi.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pvcName + "-" + testSchedule + "-" + scheduled.Format("200601021504"),
+			Namespace: testNamespace,
+			Labels: map[string]string{
+				scheduleLabel: testSchedule,
+				pvcLabel:      pvcName,
+			},
+			Annotations: map[string]string{
+				scheduleTimeAnnotation: scheduled.Format(time.RFC3339),
+			},
+		},
+	}
+}
+
+func mockObjects() []runtime.Object {
+	appLabels := map[string]string{"app": "db"}
+	return []runtime.Object{
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: testRBDSC},
+			Provisioner: testRBDDriver,
+			Parameters:  map[string]string{"clusterID": "openshift-storage"},
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: testForeignSC},
+			Provisioner: "kubernetes.io/aws-ebs",
+		},
+		&snapapi.VolumeSnapshotClass{
+			ObjectMeta: metav1.ObjectMeta{Name: testSnapClass},
+			Driver:     testRBDDriver,
+			Parameters: map[string]string{"clusterID": "openshift-storage"},
+		},
+		// the class of an external cluster, with the same driver
+		&snapapi.VolumeSnapshotClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "external-rbdplugin-snapclass"},
+			Driver:     testRBDDriver,
+			Parameters: map[string]string{"clusterID": "external-cluster"},
+		},
+		mockPVC("db-data", testRBDSC, corev1.ClaimBound, appLabels),
+		mockPVC("db-ebs", testForeignSC, corev1.ClaimBound, appLabels),
+		mockPVC("db-pending", testRBDSC, corev1.ClaimPending, appLabels),
+		mockPVC("other", testRBDSC, corev1.ClaimBound, map[string]string{"app": "web"}),
+	}
+}
+
+func mockSnapshotSchedule(schedule string) *api.SnapshotSchedule {
+	return &api.SnapshotSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              testSchedule,
+			Namespace:         testNamespace,
+			CreationTimestamp: metav1.Time{Time: testNow.Add(-35 * time.Minute)},
+		},
+		Spec: api.SnapshotScheduleSpec{
+			PVCSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "db"},
+			},
+			Schedule: schedule,
+			Retention: api.SnapshotRetentionSpec{
+				MaxCount: 2,
+			},
+		},
+	}
+}
+
+func TestSnapshotScheduleReconcile(t *testing.T) {
+	schedule := mockSnapshotSchedule(testScheduleStr)
+	objs := append(mockObjects(), schedule,
+		mockSnapshot("db-data", testNow.Add(-185*time.Minute)),
+		mockSnapshot("db-data", testNow.Add(-125*time.Minute)),
+		mockSnapshot("db-data", testNow.Add(-65*time.Minute)),
+	)
+	reconciler := createFakeSnapshotScheduleReconciler(t, objs...)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: testSchedule, Namespace: testNamespace}}
+
+	result, err := reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	assert.Equal(t, 55*time.Minute, result.RequeueAfter)
+
+	// the snapshot of the bound OCS volume is taken, and the two oldest
+	// snapshots are deleted
+	snapshots := &snapapi.VolumeSnapshotList{}
+	err = reconciler.Client.List(context.TODO(), snapshots, client.InNamespace(testNamespace))
+	assert.NoError(t, err)
+	names := []string{}
+	for _, snapshot := range snapshots.Items {
+		names = append(names, snapshot.Name)
+	}
+	assert.ElementsMatch(t, []string{"db-data-hourly-202103100900", "db-data-hourly-202103101000"}, names)
+
+	actual := &snapapi.VolumeSnapshot{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "db-data-hourly-202103101000", Namespace: testNamespace}, actual)
+	assert.NoError(t, err)
+	assert.Equal(t, "db-data", *actual.Spec.Source.PersistentVolumeClaimName)
+	assert.Equal(t, testSnapClass, *actual.Spec.VolumeSnapshotClassName)
+
+	// the failures are recorded on the schedule
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, schedule)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, time.March, 10, 10, 0, 0, 0, time.UTC), schedule.Status.LastScheduleTime.Time.UTC())
+	assert.Nil(t, schedule.Status.LastSuccessfulTime)
+	assert.Equal(t, time.Date(2021, time.March, 10, 11, 0, 0, 0, time.UTC), schedule.Status.NextScheduleTime.Time.UTC())
+	condition := conditionsv1.FindStatusCondition(schedule.Status.Conditions, api.ConditionLastSnapshotSucceeded)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Contains(t, condition.Message, "db-ebs: StorageClass gp2 is not provisioned by OCS")
+	assert.Contains(t, condition.Message, "db-pending: PersistentVolumeClaim is not bound")
+	assert.NotContains(t, condition.Message, "other")
+
+	// no snapshots are taken before the next scheduled time
+	reconciler.now = func() time.Time { return testNow.Add(10 * time.Minute) }
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	err = reconciler.Client.List(context.TODO(), snapshots, client.InNamespace(testNamespace))
+	assert.NoError(t, err)
+	assert.Len(t, snapshots.Items, 2)
+}
+
+func TestSnapshotScheduleInvalidSchedule(t *testing.T) {
+	schedule := mockSnapshotSchedule("every hour")
+	reconciler := createFakeSnapshotScheduleReconciler(t, append(mockObjects(), schedule)...)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: testSchedule, Namespace: testNamespace}}
+
+	result, err := reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, result)
+
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, schedule)
+	assert.NoError(t, err)
+	assert.True(t, conditionsv1.IsStatusConditionFalse(schedule.Status.Conditions, api.ConditionSnapshotScheduleValid))
+	assert.Nil(t, schedule.Status.LastScheduleTime)
+
+	snapshots := &snapapi.VolumeSnapshotList{}
+	err = reconciler.Client.List(context.TODO(), snapshots, client.InNamespace(testNamespace))
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots.Items)
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{testScheduleStr, "*/5 * * * *", "@hourly", "@every 1m", "@every 90s"} {
+		_, err := parseSchedule(spec)
+		assert.NoErrorf(t, err, "schedule %q", spec)
+	}
+	for _, spec := range []string{"every hour", "@every 30s", "@every 59s"} {
+		_, err := parseSchedule(spec)
+		assert.Errorf(t, err, "schedule %q", spec)
+	}
+}
+
+func TestGetSnapshotName(t *testing.T) {
+	scheduled := time.Date(2021, time.March, 10, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, "db-data-hourly-202103101000", getSnapshotName("db-data", "hourly", scheduled))
+
+	// long names are shortened to a valid DNS subdomain, and stay distinct
+	longPVC := strings.Repeat("a", 200)
+	name := getSnapshotName(longPVC+"-1", "hourly-"+strings.Repeat("b", 100), scheduled)
+	other := getSnapshotName(longPVC+"-2", "hourly-"+strings.Repeat("b", 100), scheduled)
+	assert.Len(t, name, validation.DNS1123SubdomainMaxLength)
+	assert.Empty(t, validation.IsDNS1123Subdomain(name))
+	assert.True(t, strings.HasSuffix(name, "-202103101000"))
+	assert.NotEqual(t, name, other)
+
+	label := util.ShortenName(longPVC, validation.LabelValueMaxLength)
+	assert.Len(t, label, validation.LabelValueMaxLength)
+	assert.Empty(t, validation.IsValidLabelValue(label))
+}
+
+func createFakeScheme(t *testing.T) *runtime.Scheme {
+	scheme, err := api.SchemeBuilder.Build()
+	if err != nil {
+		assert.Fail(t, "unable to build scheme")
+	}
+	err = corev1.AddToScheme(scheme)
+	if err != nil {
+		assert.Fail(t, "failed to add corev1 scheme")
+	}
+	err = storagev1.AddToScheme(scheme)
+	if err != nil {
+		assert.Fail(t, "failed to add storagev1 scheme")
+	}
+	err = snapapi.AddToScheme(scheme)
+	if err != nil {
+		assert.Fail(t, "failed to add volume-snapshot scheme")
+	}
+	return scheme
+}
+
+func createFakeSnapshotScheduleReconciler(t *testing.T, obj ...runtime.Object) SnapshotScheduleReconciler {
+	scheme := createFakeScheme(t)
+	client := fake.NewFakeClientWithScheme(scheme, obj...)
+
+	return SnapshotScheduleReconciler{
+		Client:   client,
+		Scheme:   scheme,
+		Log:      logf.Log.WithName("controller_snapshotschedule_test"),
+		recorder: record.NewFakeRecorder(10),
+		now:      func() time.Time { return testNow },
+	}
+}
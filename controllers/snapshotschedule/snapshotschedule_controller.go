@@ -0,0 +1,54 @@
+package snapshotschedule
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// scheduleLabel is set on every VolumeSnapshot to the name of the
+	// SnapshotSchedule that created it
+	scheduleLabel = "snapshotschedule.ocs.openshift.io/schedule"
+	// pvcLabel is set on every VolumeSnapshot to the name of its source
+	// PersistentVolumeClaim
+	pvcLabel = "snapshotschedule.ocs.openshift.io/pvc"
+	// scheduleTimeAnnotation holds the scheduled time of a VolumeSnapshot,
+	// which the retention is based on
+	scheduleTimeAnnotation = "snapshotschedule.ocs.openshift.io/schedule-time"
+
+	csiRBDDriverSuffix    = ".rbd.csi.ceph.com"
+	csiCephFSDriverSuffix = ".cephfs.csi.ceph.com"
+	// clusterIDParameter is the parameter of the StorageClasses and
+	// VolumeSnapshotClasses with the ID of their Ceph cluster
+	clusterIDParameter = "clusterID"
+)
+
+// SnapshotScheduleReconciler reconciles a SnapshotSchedule object
+//nolint
+type SnapshotScheduleReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Log      logr.Logger
+	recorder record.EventRecorder
+
+	// now returns the current time, and is replaced in tests
+	now func() time.Time
+}
+
+// SetupWithManager sets up a controller with a manager
+func (r *SnapshotScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.recorder = mgr.GetEventRecorderFor("controller_snapshotschedule")
+	r.now = time.Now
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ocsv1.SnapshotSchedule{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,265 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// poolUsageRefreshInterval is the interval between two reads of the usage
+	// of the pools from the Prometheus exporter of the mgr
+	poolUsageRefreshInterval = 5 * time.Minute
+	// cephMgrMetricsTimeout is the timeout of a read of the Prometheus
+	// exporter of the mgr
+	cephMgrMetricsTimeout = 10 * time.Second
+)
+
+// cephMgrMetricsURL returns the URL of the Prometheus exporter of the mgr of
+// the internal Ceph cluster, it is replaced in tests
+var cephMgrMetricsURL = func(namespace string) string {
+	return fmt.Sprintf("http://rook-ceph-mgr.%s.svc:9283/metrics", namespace)
+}
+
+// ocsCapacity reports the capacity and usage of the Ceph cluster in the
+// status of the StorageCluster
+type ocsCapacity struct{}
+
+// ensureCreated sets the capacity of the CephCluster in the status, along
+// with the last usage of the managed pools read by the pool usage collector.
+// The last usage is kept until the collector reads it.
+func (obj *ocsCapacity) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	cephCluster := &cephv1.CephCluster{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephCluster(sc), Namespace: sc.Namespace}, cephCluster)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	capacity := newCapacityStatus(sc, cephCluster)
+	if capacity == nil {
+		// the CephCluster does not report its capacity yet
+		return nil
+	}
+	if previous := sc.Status.Capacity; previous != nil {
+		capacity.Pools = previous.Pools
+		capacity.PoolsLastUpdated = previous.PoolsLastUpdated
+	}
+	sc.Status.Capacity = capacity
+
+	if sc.Spec.ExternalStorage.Enable || r.poolUsage == nil {
+		return nil
+	}
+	pools, readTime, found := getPoolUsageResult(r.poolUsage, types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace})
+	if found {
+		capacity.Pools = pools
+		capacity.PoolsLastUpdated = &readTime
+	}
+	return nil
+}
+
+// poolUsageResult is the usage of the managed pools of a StorageCluster
+type poolUsageResult struct {
+	pools    []ocsv1.PoolUsageStatus
+	readTime metav1.Time
+}
+
+// newPoolUsageCollector returns the checker that periodically reads the usage
+// of the pools of every internal StorageCluster from the Prometheus exporter of
+// its mgr, so that the reconcile does not wait on the mgr. It requeues a
+// StorageCluster when the usage of its pools changed, the reconcile then sets
+// it in the status. Failing to read it keeps the last usage.
+func newPoolUsageCollector(r *StorageClusterReconciler) *periodicChecker {
+	c := newPeriodicChecker(r, "pool usage collection", poolUsageRefreshInterval, cephMgrMetricsTimeout)
+	c.selects = func(sc *ocsv1.StorageCluster) bool {
+		return !sc.Spec.ExternalStorage.Enable
+	}
+	c.run = func(sc *ocsv1.StorageCluster, timeout time.Duration) (interface{}, error) {
+		pools, err := getPoolUsage(cephMgrMetricsURL(sc.Namespace), timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the usage of the pools from the Ceph mgr: %v", err)
+		}
+		return poolUsageResult{pools: filterManagedPools(sc, pools), readTime: metav1.Now()}, nil
+	}
+	c.changed = func(previous, current interface{}) bool {
+		return !reflect.DeepEqual(previous.(poolUsageResult).pools, current.(poolUsageResult).pools)
+	}
+	return c
+}
+
+// getPoolUsageResult returns the last usage of the pools of the StorageCluster
+// read by the collector and the time it was read, and whether it was read
+// already
+func getPoolUsageResult(c *periodicChecker, key types.NamespacedName) ([]ocsv1.PoolUsageStatus, metav1.Time, bool) {
+	result, found := c.getResult(key)
+	if !found {
+		return nil, metav1.Time{}, false
+	}
+	usage := result.(poolUsageResult)
+	pools := make([]ocsv1.PoolUsageStatus, len(usage.pools))
+	copy(pools, usage.pools)
+	return pools, usage.readTime, true
+}
+
+// ensureDeleted is dummy func for the ocsCapacity
+func (obj *ocsCapacity) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	return nil
+}
+
+// newCapacityStatus returns the capacity reported by the CephCluster, or nil
+// if it is not reported yet
+func newCapacityStatus(sc *ocsv1.StorageCluster, cephCluster *cephv1.CephCluster) *ocsv1.CapacityStatus {
+	cephStatus := cephCluster.Status.CephStatus
+	if cephStatus == nil || cephStatus.Capacity.TotalBytes == 0 {
+		return nil
+	}
+	capacity := &ocsv1.CapacityStatus{
+		RawCapacityBytes:  int64(cephStatus.Capacity.TotalBytes),
+		RawUsedBytes:      int64(cephStatus.Capacity.UsedBytes),
+		RawAvailableBytes: int64(cephStatus.Capacity.AvailableBytes),
+		State:             getCapacityState(cephStatus),
+	}
+	if !sc.Spec.ExternalStorage.Enable {
+		// only an estimate, the pools may have another replica count or
+		// use erasure coding
+		replicas := int64(generateCephReplicatedSpec(sc).Size)
+		capacity.EstimatedUsableCapacityBytes = capacity.RawCapacityBytes / replicas
+		capacity.EstimatedUsableAvailableBytes = capacity.RawAvailableBytes / replicas
+	}
+	if lastUpdated, err := time.Parse(time.RFC3339, cephStatus.Capacity.LastUpdated); err == nil {
+		capacity.LastUpdated = &metav1.Time{Time: lastUpdated}
+	}
+	return capacity
+}
+
+// getCapacityState returns the fullness of the cluster from the health checks
+// of the OSDs and the pools
+func getCapacityState(cephStatus *cephv1.CephStatus) string {
+	for _, check := range []struct {
+		suffix string
+		state  string
+	}{
+		{"_FULL", ocsv1.CapacityStateFull},
+		{"_BACKFILLFULL", ocsv1.CapacityStateBackfillFull},
+		{"_NEARFULL", ocsv1.CapacityStateNearFull},
+	} {
+		for _, prefix := range []string{"OSD", "POOL"} {
+			if _, found := cephStatus.Details[prefix+check.suffix]; found {
+				return check.state
+			}
+		}
+	}
+	return ocsv1.CapacityStateOK
+}
+
+// getPoolUsage reads the usage of every pool from the Prometheus exporter of
+// the mgr. The kind and resource of the pools are not set.
+func getPoolUsage(url string, timeout time.Duration) ([]ocsv1.PoolUsageStatus, error) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from %s: %s", url, resp.Status)
+	}
+	return parsePoolUsage(resp.Body)
+}
+
+// parsePoolUsage parses the pool metrics of the Prometheus exporter of the
+// mgr. The pools are identified by their id, and named by ceph_pool_metadata.
+func parsePoolUsage(metrics io.Reader) ([]ocsv1.PoolUsageStatus, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(metrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the Ceph mgr metrics: %v", err)
+	}
+
+	pools := map[string]*ocsv1.PoolUsageStatus{}
+	if family, found := families["ceph_pool_metadata"]; found {
+		for _, metric := range family.GetMetric() {
+			poolID := getMetricLabel(metric, "pool_id")
+			pools[poolID] = &ocsv1.PoolUsageStatus{Name: getMetricLabel(metric, "name")}
+		}
+	}
+	for name, set := range map[string]func(*ocsv1.PoolUsageStatus, int64){
+		"ceph_pool_stored":     func(pool *ocsv1.PoolUsageStatus, value int64) { pool.StoredBytes = value },
+		"ceph_pool_stored_raw": func(pool *ocsv1.PoolUsageStatus, value int64) { pool.UsedBytes = value },
+		"ceph_pool_max_avail":  func(pool *ocsv1.PoolUsageStatus, value int64) { pool.MaxAvailableBytes = value },
+	} {
+		family, found := families[name]
+		if !found {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if pool, found := pools[getMetricLabel(metric, "pool_id")]; found {
+				set(pool, int64(getMetricValue(metric)))
+			}
+		}
+	}
+
+	usage := []ocsv1.PoolUsageStatus{}
+	for _, pool := range pools {
+		usage = append(usage, *pool)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Name < usage[j].Name })
+	return usage, nil
+}
+
+func getMetricLabel(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+func getMetricValue(metric *dto.Metric) float64 {
+	if metric.GetGauge() != nil {
+		return metric.GetGauge().GetValue()
+	}
+	if metric.GetCounter() != nil {
+		return metric.GetCounter().GetValue()
+	}
+	return metric.GetUntyped().GetValue()
+}
+
+// filterManagedPools returns the pools of the managed CephBlockPool,
+// CephFilesystem and CephObjectStore, with the resource they belong to
+func filterManagedPools(sc *ocsv1.StorageCluster, pools []ocsv1.PoolUsageStatus) []ocsv1.PoolUsageStatus {
+	blockPool := generateNameForCephBlockPool(sc)
+	filesystem := generateNameForCephFilesystem(sc)
+	objectStore := generateNameForCephObjectStore(sc)
+
+	managed := []ocsv1.PoolUsageStatus{}
+	for _, pool := range pools {
+		switch {
+		case pool.Name == blockPool:
+			pool.Kind, pool.Resource = "CephBlockPool", blockPool
+		case strings.HasPrefix(pool.Name, filesystem+"-"):
+			pool.Kind, pool.Resource = "CephFilesystem", filesystem
+		case strings.HasPrefix(pool.Name, objectStore+"."):
+			pool.Kind, pool.Resource = "CephObjectStore", objectStore
+		default:
+			continue
+		}
+		managed = append(managed, pool)
+	}
+	return managed
+}
@@ -0,0 +1,149 @@
+package storagecluster
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	rookCephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+const mockCephMgrPoolMetrics = `# HELP ceph_pool_metadata POOL Metadata
+# TYPE ceph_pool_metadata untyped
+ceph_pool_metadata{pool_id="1",name="storage-test-cephblockpool"} 1.0
+ceph_pool_metadata{pool_id="2",name="storage-test-cephfilesystem-metadata"} 1.0
+ceph_pool_metadata{pool_id="3",name="storage-test-cephfilesystem-data0"} 1.0
+ceph_pool_metadata{pool_id="4",name="storage-test-cephobjectstore.rgw.buckets.data"} 1.0
+ceph_pool_metadata{pool_id="5",name="device_health_metrics"} 1.0
+# HELP ceph_pool_stored DF pool stored
+# TYPE ceph_pool_stored gauge
+ceph_pool_stored{pool_id="1"} 1000.0
+ceph_pool_stored{pool_id="2"} 20.0
+ceph_pool_stored{pool_id="3"} 300.0
+ceph_pool_stored{pool_id="4"} 400.0
+ceph_pool_stored{pool_id="5"} 5.0
+# HELP ceph_pool_stored_raw DF pool stored_raw
+# TYPE ceph_pool_stored_raw gauge
+ceph_pool_stored_raw{pool_id="1"} 3000.0
+ceph_pool_stored_raw{pool_id="3"} 900.0
+# HELP ceph_pool_max_avail DF pool max_avail
+# TYPE ceph_pool_max_avail gauge
+ceph_pool_max_avail{pool_id="1"} 9000.0
+ceph_pool_max_avail{pool_id="3"} 9000.0
+`
+
+func TestParsePoolUsage(t *testing.T) {
+	pools, err := parsePoolUsage(strings.NewReader(mockCephMgrPoolMetrics))
+	assert.NoError(t, err)
+	assert.Len(t, pools, 5)
+
+	managed := filterManagedPools(mockStorageCluster, pools)
+	assert.Equal(t, []api.PoolUsageStatus{
+		{Name: "storage-test-cephblockpool", Kind: "CephBlockPool", Resource: "storage-test-cephblockpool", StoredBytes: 1000, UsedBytes: 3000, MaxAvailableBytes: 9000},
+		{Name: "storage-test-cephfilesystem-data0", Kind: "CephFilesystem", Resource: "storage-test-cephfilesystem", StoredBytes: 300, UsedBytes: 900, MaxAvailableBytes: 9000},
+		{Name: "storage-test-cephfilesystem-metadata", Kind: "CephFilesystem", Resource: "storage-test-cephfilesystem", StoredBytes: 20},
+		{Name: "storage-test-cephobjectstore.rgw.buckets.data", Kind: "CephObjectStore", Resource: "storage-test-cephobjectstore", StoredBytes: 400},
+	}, managed)
+
+	_, err = parsePoolUsage(strings.NewReader("not metrics {"))
+	assert.Error(t, err)
+}
+
+func TestGetCapacityState(t *testing.T) {
+	cases := []struct {
+		details  []string
+		expected string
+	}{
+		{details: nil, expected: api.CapacityStateOK},
+		{details: []string{"MON_DISK_LOW"}, expected: api.CapacityStateOK},
+		{details: []string{"OSD_NEARFULL"}, expected: api.CapacityStateNearFull},
+		{details: []string{"POOL_NEARFULL", "OSD_BACKFILLFULL"}, expected: api.CapacityStateBackfillFull},
+		{details: []string{"OSD_NEARFULL", "POOL_FULL"}, expected: api.CapacityStateFull},
+	}
+	for _, c := range cases {
+		cephStatus := &rookCephv1.CephStatus{Details: map[string]rookCephv1.CephHealthMessage{}}
+		for _, detail := range c.details {
+			cephStatus.Details[detail] = rookCephv1.CephHealthMessage{Severity: "HEALTH_WARN"}
+		}
+		assert.Equal(t, c.expected, getCapacityState(cephStatus), "health checks %v", c.details)
+	}
+}
+
+func TestEnsureCapacity(t *testing.T) {
+	requests := 0
+	mgr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		fmt.Fprint(w, mockCephMgrPoolMetrics)
+	}))
+	defer mgr.Close()
+	defer func(f func(string) string) { cephMgrMetricsURL = f }(cephMgrMetricsURL)
+	cephMgrMetricsURL = func(namespace string) string { return mgr.URL }
+
+	cephCluster := &rookCephv1.CephCluster{}
+	mockCephCluster.DeepCopyInto(cephCluster)
+	lastUpdated := time.Now().Add(-time.Minute).Truncate(time.Second)
+	cephCluster.Status.CephStatus = &rookCephv1.CephStatus{
+		Health: "HEALTH_WARN",
+		Details: map[string]rookCephv1.CephHealthMessage{
+			"OSD_NEARFULL": {Severity: "HEALTH_WARN", Message: "1 nearfull osd(s)"},
+		},
+		Capacity: rookCephv1.Capacity{
+			TotalBytes:     3000,
+			UsedBytes:      2700,
+			AvailableBytes: 300,
+			LastUpdated:    lastUpdated.Format(time.RFC3339),
+		},
+	}
+	sc := &api.StorageCluster{}
+	mockStorageCluster.DeepCopyInto(sc)
+	reconciler := createFakeStorageClusterReconciler(t, cephCluster, sc.DeepCopy())
+
+	// the reconcile does not read the usage of the pools itself
+	var obj ocsCapacity
+	err := obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, requests)
+	capacity := sc.Status.Capacity
+	if assert.NotNil(t, capacity) {
+		assert.Equal(t, int64(3000), capacity.RawCapacityBytes)
+		assert.Equal(t, int64(2700), capacity.RawUsedBytes)
+		assert.Equal(t, int64(300), capacity.RawAvailableBytes)
+		assert.Equal(t, int64(1000), capacity.EstimatedUsableCapacityBytes)
+		assert.Equal(t, int64(100), capacity.EstimatedUsableAvailableBytes)
+		assert.Equal(t, api.CapacityStateNearFull, capacity.State)
+		assert.True(t, lastUpdated.Equal(capacity.LastUpdated.Time))
+		assert.Nil(t, capacity.Pools)
+	}
+
+	// the collector requeues the StorageCluster once it read the usage
+	collector := newPoolUsageCollector(&reconciler)
+	reconciler.poolUsage = collector
+	stop := make(chan struct{})
+	defer close(stop)
+	collector.check(stop)
+	assert.Equal(t, 1, requests)
+	assert.Len(t, collector.events, 1)
+	<-collector.events
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	assert.Len(t, sc.Status.Capacity.Pools, 4)
+	assert.NotNil(t, sc.Status.Capacity.PoolsLastUpdated)
+
+	// the StorageCluster is not requeued as long as the usage is the same
+	collector.check(stop)
+	assert.Equal(t, 2, requests)
+	assert.Len(t, collector.events, 0)
+
+	// a failing mgr keeps the last usage
+	mgr.Close()
+	collector.check(stop)
+	assert.Len(t, collector.events, 0)
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	assert.Len(t, sc.Status.Capacity.Pools, 4)
+}
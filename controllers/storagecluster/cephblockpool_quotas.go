@@ -0,0 +1,352 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// poolQuotaAnnotation records on a CephBlockPool the quota last applied
+	// to the pool, and on a pool quota Job the quota it applies
+	poolQuotaAnnotation = "ocs.openshift.io/pool-quota"
+
+	// poolQuotaErrorAnnotation records on a CephBlockPool why the last Job
+	// setting its quota failed, until a Job succeeds
+	poolQuotaErrorAnnotation = "ocs.openshift.io/pool-quota-error"
+
+	// poolQuotaKeyPath is where the key of the pool quota CephClient is
+	// mounted in the pool quota Jobs
+	poolQuotaKeyPath = "/etc/ceph-client"
+
+	// poolQuotaScript configures the ceph CLI from the mon endpoints, and sets
+	// the quota of the pool as the pool quota CephClient. A quota of 0
+	// removes it.
+	poolQuotaScript = `set -e
+MON_HOST=$(echo "${ROOK_MON_ENDPOINTS}" | sed 's/[a-z0-9_-]*=//g')
+cat <<EOF > /etc/ceph/ceph.conf
+[global]
+mon_host = ${MON_HOST}
+EOF
+ceph --id "${CEPH_CLIENT_ID}" --keyfile "${CEPH_CLIENT_KEYFILE}" osd pool set-quota "${POOL_NAME}" max_bytes "${MAX_BYTES}"
+ceph --id "${CEPH_CLIENT_ID}" --keyfile "${CEPH_CLIENT_KEYFILE}" osd pool set-quota "${POOL_NAME}" max_objects "${MAX_OBJECTS}"
+`
+)
+
+// generatePoolQuota returns the quota of a pool in the format of the
+// poolQuotaAnnotation
+func generatePoolQuota(pool ocsv1.AdditionalCephBlockPool) string {
+	return fmt.Sprintf("max_bytes=%d,max_objects=%d", pool.MaxBytes, pool.MaxObjects)
+}
+
+// newPoolQuotaCephClient returns the CephClient the pool quota Jobs
+// authenticate as. It is only allowed to read the cluster maps and to set pool
+// quotas.
+func newPoolQuotaCephClient(sc *ocsv1.StorageCluster) *cephv1.CephClient {
+	return &cephv1.CephClient{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForPoolQuotaCephClient(sc),
+			Namespace: sc.Namespace,
+		},
+		Spec: cephv1.ClientSpec{
+			Caps: map[string]string{
+				"mon": `allow r, allow command "osd pool set-quota"`,
+			},
+		},
+	}
+}
+
+// ensurePoolQuotaCephClient creates the pool quota CephClient, and returns
+// whether Rook created the Secret with its key
+func (r *StorageClusterReconciler) ensurePoolQuotaCephClient(sc *ocsv1.StorageCluster) (bool, error) {
+	cephClient := newPoolQuotaCephClient(sc)
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: cephClient.Name, Namespace: sc.Namespace}, &cephv1.CephClient{})
+	if errors.IsNotFound(err) {
+		if err := controllerutil.SetControllerReference(sc, cephClient, r.Scheme); err != nil {
+			return false, err
+		}
+		r.Log.Info("Creating the CephClient setting the pool quotas", "CephClient", cephClient.Name)
+		return false, r.Client.Create(context.TODO(), cephClient)
+	} else if err != nil {
+		return false, err
+	}
+
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephClientSecret(cephClient.Name), Namespace: sc.Namespace}, &corev1.Secret{})
+	if errors.IsNotFound(err) {
+		r.Log.Info("Waiting on the key of the CephClient setting the pool quotas", "CephClient", cephClient.Name)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deletePoolQuotaCephClient deletes the pool quota CephClient
+func (r *StorageClusterReconciler) deletePoolQuotaCephClient(sc *ocsv1.StorageCluster) error {
+	err := r.Client.Delete(context.TODO(), newPoolQuotaCephClient(sc))
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("Uninstall: Failed to delete CephClient %v: %v", generateNameForPoolQuotaCephClient(sc), err)
+	}
+	return nil
+}
+
+// ensureCephBlockPoolQuotas applies the quotas of the additional pools. Rook
+// does not set pool quotas, so they are set by a Job running the ceph CLI once
+// the pool is Ready, and again whenever the quota changes. The Job
+// authenticates as a CephClient restricted to setting pool quotas. The quota
+// applied by the Job is recorded on the CephBlockPool, and the progress of
+// the quotas is reported by the PoolQuotasApplied condition.
+func (r *StorageClusterReconciler) ensureCephBlockPoolQuotas(sc *ocsv1.StorageCluster) error {
+	var pending, failed []string
+	hasQuotas, clientChecked, clientReady := false, false, false
+	for _, pool := range getAdditionalCephBlockPools(sc) {
+		cephBlockPool := &cephv1.CephBlockPool{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForAdditionalCephBlockPool(sc, pool.Name), Namespace: sc.Namespace}, cephBlockPool)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		quota := generatePoolQuota(pool)
+		applied := cephBlockPool.Annotations[poolQuotaAnnotation]
+		if applied == "" && pool.MaxBytes == 0 && pool.MaxObjects == 0 {
+			continue
+		}
+		hasQuotas = true
+		if applied == quota {
+			continue
+		}
+
+		if err := r.runPoolQuota(sc, cephBlockPool, pool, quota, &clientChecked, &clientReady); err != nil {
+			return err
+		}
+		switch {
+		case cephBlockPool.Annotations[poolQuotaAnnotation] == quota:
+		case cephBlockPool.Annotations[poolQuotaErrorAnnotation] != "":
+			failed = append(failed, fmt.Sprintf("%s: %s", cephBlockPool.Name, cephBlockPool.Annotations[poolQuotaErrorAnnotation]))
+		default:
+			pending = append(pending, cephBlockPool.Name)
+		}
+	}
+
+	if !hasQuotas {
+		conditionsv1.RemoveStatusCondition(&sc.Status.Conditions, ocsv1.ConditionPoolQuotasApplied)
+		return nil
+	}
+	condition := conditionsv1.Condition{
+		Type:    ocsv1.ConditionPoolQuotasApplied,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.PoolQuotasApplied,
+		Message: ocsv1.PoolQuotasAppliedMessage,
+	}
+	switch {
+	case len(failed) != 0:
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = ocsv1.PoolQuotasFailed
+		condition.Message = fmt.Sprintf("failed to set the quotas of the pools %s", strings.Join(failed, "; "))
+	case len(pending) != 0:
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = ocsv1.PoolQuotasPending
+		condition.Message = fmt.Sprintf("waiting to set the quotas of the pools %s", strings.Join(pending, ", "))
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, condition)
+	return nil
+}
+
+// runPoolQuota makes progress on setting the quota of a CephBlockPool. The
+// pool quota CephClient is only checked once per reconcile, through
+// clientChecked and clientReady. The outcome of the pool quota Job is
+// recorded in the annotations of the CephBlockPool: the quota once it is
+// applied, or the failure of the last Job. A failed Job is deleted, so that
+// it is retried with a new Job.
+func (r *StorageClusterReconciler) runPoolQuota(sc *ocsv1.StorageCluster, cephBlockPool *cephv1.CephBlockPool, pool ocsv1.AdditionalCephBlockPool, quota string, clientChecked, clientReady *bool) error {
+	if cephBlockPool.Status == nil || cephBlockPool.Status.Phase != cephv1.ConditionReady {
+		r.Log.Info("Waiting on the CephBlockPool to be ready before setting its quota", "CephBlockPool", cephBlockPool.Name)
+		return nil
+	}
+	if !*clientChecked {
+		ready, err := r.ensurePoolQuotaCephClient(sc)
+		if err != nil {
+			return err
+		}
+		*clientChecked, *clientReady = true, ready
+	}
+	if !*clientReady {
+		return nil
+	}
+
+	done, failure, err := r.runPoolQuotaJob(sc, cephBlockPool.Name, pool, quota)
+	if err != nil || (!done && failure == "") {
+		return err
+	}
+	if cephBlockPool.Annotations == nil {
+		cephBlockPool.Annotations = map[string]string{}
+	}
+	if done {
+		cephBlockPool.Annotations[poolQuotaAnnotation] = quota
+		delete(cephBlockPool.Annotations, poolQuotaErrorAnnotation)
+		r.Log.Info("Set the quota of the CephBlockPool", "CephBlockPool", cephBlockPool.Name, "Quota", quota)
+	} else {
+		cephBlockPool.Annotations[poolQuotaErrorAnnotation] = failure
+		r.Log.Info("Failed to set the quota of the CephBlockPool, retrying", "CephBlockPool", cephBlockPool.Name, "Quota", quota, "Reason", failure)
+		r.recorder.Event(sc, corev1.EventTypeWarning, ocsv1.PoolQuotasFailed,
+			fmt.Sprintf("failed to set the quota of the CephBlockPool %s: %s", cephBlockPool.Name, failure))
+	}
+	return r.Client.Update(context.TODO(), cephBlockPool)
+}
+
+// runPoolQuotaJob runs the Job setting the given quota on a pool. It returns
+// true once the Job succeeded, or the reason of its failure once it failed.
+// A Job applying a different quota is replaced, and a Job that succeeded or
+// failed is removed. The retries of the Job back off, so a failed Job is not
+// recreated more often than the Job retries its pods.
+func (r *StorageClusterReconciler) runPoolQuotaJob(sc *ocsv1.StorageCluster, poolName string, pool ocsv1.AdditionalCephBlockPool, quota string) (bool, string, error) {
+	job := &batchv1.Job{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForPoolQuotaJob(poolName), Namespace: sc.Namespace}, job)
+	if errors.IsNotFound(err) {
+		job = newPoolQuotaJob(sc, poolName, pool, quota, r.images.Ceph)
+		if err := controllerutil.SetControllerReference(sc, job, r.Scheme); err != nil {
+			return false, "", err
+		}
+		r.Log.Info("Creating the Job setting the quota of the CephBlockPool", "CephBlockPool", poolName, "Quota", quota)
+		return false, "", r.Client.Create(context.TODO(), job)
+	} else if err != nil {
+		return false, "", err
+	}
+
+	if job.Annotations[poolQuotaAnnotation] != quota {
+		// the Job is recreated with the new quota once it is deleted
+		return false, "", r.deletePoolQuotaJob(job)
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, "", r.deletePoolQuotaJob(job)
+		case batchv1.JobFailed:
+			failure := condition.Message
+			if failure == "" {
+				failure = condition.Reason
+			}
+			return false, failure, r.deletePoolQuotaJob(job)
+		}
+	}
+	return false, "", nil
+}
+
+// deletePoolQuotaJob deletes a pool quota Job along with its pods
+func (r *StorageClusterReconciler) deletePoolQuotaJob(job *batchv1.Job) error {
+	err := r.Client.Delete(context.TODO(), job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// newPoolQuotaJob returns the Job setting the given quota on a pool
+func newPoolQuotaJob(sc *ocsv1.StorageCluster, poolName string, pool ocsv1.AdditionalCephBlockPool, quota string, image string) *batchv1.Job {
+	cephClientName := generateNameForPoolQuotaCephClient(sc)
+	placement := getPlacement(sc, "mon")
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForPoolQuotaJob(poolName),
+			Namespace: sc.Namespace,
+			Annotations: map[string]string{
+				poolQuotaAnnotation: quota,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					Tolerations:   placement.Tolerations,
+					Volumes: []corev1.Volume{
+						{
+							Name:         "ceph-conf-emptydir",
+							VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+						},
+						{
+							Name: "ceph-client-key",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: generateNameForCephClientSecret(cephClientName),
+									Items: []corev1.KeyToPath{
+										{
+											Key:  cephClientName,
+											Path: "key",
+										},
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "set-quota",
+							Image:   image,
+							Command: []string{"/bin/bash", "-c", poolQuotaScript},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ceph-conf-emptydir",
+									MountPath: "/etc/ceph",
+								},
+								{
+									Name:      "ceph-client-key",
+									MountPath: poolQuotaKeyPath,
+									ReadOnly:  true,
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "ROOK_MON_ENDPOINTS",
+									ValueFrom: &corev1.EnvVarSource{
+										ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+											Key:                  "data",
+											LocalObjectReference: corev1.LocalObjectReference{Name: "rook-ceph-mon-endpoints"},
+										},
+									},
+								},
+								{
+									Name:  "CEPH_CLIENT_ID",
+									Value: cephClientName,
+								},
+								{
+									Name:  "CEPH_CLIENT_KEYFILE",
+									Value: poolQuotaKeyPath + "/key",
+								},
+								{
+									Name:  "POOL_NAME",
+									Value: poolName,
+								},
+								{
+									Name:  "MAX_BYTES",
+									Value: strconv.FormatUint(pool.MaxBytes, 10),
+								},
+								{
+									Name:  "MAX_OBJECTS",
+									Value: strconv.FormatUint(pool.MaxObjects, 10),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -3,17 +3,27 @@ package storagecluster
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 type ocsCephBlockPools struct{}
 
+// additionalCephBlockPoolLabel marks the CephBlockPools of the additional
+// pools, and their StorageClasses and SnapshotClasses, with the name of the
+// StorageCluster, so that they are deleted once the pool is removed
+const additionalCephBlockPoolLabel = "ocs.openshift.io/additional-cephblockpool"
+
 func generateCephReplicatedSpec(initData *ocsv1.StorageCluster) cephv1.ReplicatedSpec {
 	if arbiterEnabled(initData) {
 		return cephv1.ReplicatedSpec{
@@ -28,6 +38,100 @@ func generateCephReplicatedSpec(initData *ocsv1.StorageCluster) cephv1.Replicate
 	}
 }
 
+// generateMirroringSpec returns the mirroring settings of the CephBlockPools
+func generateMirroringSpec(initData *ocsv1.StorageCluster) cephv1.MirroringSpec {
+	if !initData.Spec.Mirroring.Enabled {
+		return cephv1.MirroringSpec{}
+	}
+	mode := initData.Spec.Mirroring.Mode
+	if mode == "" {
+		mode = defaults.MirroringMode
+	}
+	return cephv1.MirroringSpec{
+		Enabled: true,
+		Mode:    mode,
+	}
+}
+
+// getAdditionalCephBlockPools returns the user-defined CephBlockPools and,
+// when the StorageDeviceSets have more than one device class, a pool pinned to
+// each of the device classes. The user-defined pools named like the pool of a
+// device class are rejected by the validation of the spec.
+func getAdditionalCephBlockPools(initData *ocsv1.StorageCluster) []ocsv1.AdditionalCephBlockPool {
+	pools := initData.Spec.ManagedResources.CephBlockPools.AdditionalPools
+	names := map[string]bool{}
+	for _, pool := range pools {
+		names[pool.Name] = true
+	}
+
+	deviceClasses := getDeviceClasses(initData)
+	if len(deviceClasses) < 2 {
+		return pools
+	}
+	ret := append([]ocsv1.AdditionalCephBlockPool{}, pools...)
+	for _, deviceClass := range deviceClasses {
+		// the DeviceType is matched case insensitively, but the pool name
+		// has to be lower case
+		name := strings.ToLower(deviceClass)
+		if names[name] {
+			continue
+		}
+		names[name] = true
+		ret = append(ret, ocsv1.AdditionalCephBlockPool{
+			Name:        name,
+			DeviceClass: deviceClass,
+		})
+	}
+	return ret
+}
+
+// getDeviceClasses returns the sorted list of the distinct device classes of
+// the StorageDeviceSets
+func getDeviceClasses(initData *ocsv1.StorageCluster) []string {
+	deviceClasses := []string{}
+	found := map[string]bool{}
+	for _, ds := range initData.Spec.StorageDeviceSets {
+		deviceClass := getDeviceClass(ds)
+		if deviceClass == "" || found[deviceClass] {
+			continue
+		}
+		found[deviceClass] = true
+		deviceClasses = append(deviceClasses, deviceClass)
+	}
+	sort.Strings(deviceClasses)
+	return deviceClasses
+}
+
+// newAdditionalCephBlockPool returns the CephBlockPool for a user-defined
+// pool. The options that are not set default to the ones of the default pool.
+func newAdditionalCephBlockPool(initData *ocsv1.StorageCluster, pool ocsv1.AdditionalCephBlockPool) *cephv1.CephBlockPool {
+	failureDomain := pool.FailureDomain
+	if failureDomain == "" {
+		failureDomain = determineFailureDomain(initData)
+	}
+	replicatedSpec := generateCephReplicatedSpec(initData)
+	// the target size ratio of the default pool assumes it shares the
+	// cluster with the CephFilesystem only
+	replicatedSpec.TargetSizeRatio = 0
+	if pool.ReplicaSize != 0 {
+		replicatedSpec = cephv1.ReplicatedSpec{Size: pool.ReplicaSize}
+	}
+	return &cephv1.CephBlockPool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForAdditionalCephBlockPool(initData, pool.Name),
+			Namespace: initData.Namespace,
+			Labels:    map[string]string{additionalCephBlockPoolLabel: initData.Name},
+		},
+		Spec: cephv1.PoolSpec{
+			FailureDomain:   failureDomain,
+			DeviceClass:     pool.DeviceClass,
+			CompressionMode: pool.CompressionMode,
+			Replicated:      replicatedSpec,
+			EnableRBDStats:  true,
+		},
+	}
+}
+
 // newCephBlockPoolInstances returns the cephBlockPool instances that should be created
 // on first run.
 func (r *StorageClusterReconciler) newCephBlockPoolInstances(initData *ocsv1.StorageCluster) ([]*cephv1.CephBlockPool, error) {
@@ -44,6 +148,12 @@ func (r *StorageClusterReconciler) newCephBlockPoolInstances(initData *ocsv1.Sto
 			},
 		},
 	}
+	for _, pool := range getAdditionalCephBlockPools(initData) {
+		ret = append(ret, newAdditionalCephBlockPool(initData, pool))
+	}
+	for _, obj := range ret {
+		obj.Spec.Mirroring = generateMirroringSpec(initData)
+	}
 	for _, obj := range ret {
 		err := controllerutil.SetControllerReference(initData, obj, r.Scheme)
 		if err != nil {
@@ -72,7 +182,7 @@ func (obj *ocsCephBlockPools) ensureCreated(r *StorageClusterReconciler, instanc
 		switch {
 		case err == nil:
 			if reconcileStrategy == ReconcileStrategyInit {
-				return nil
+				continue
 			}
 			if existing.DeletionTimestamp != nil {
 				r.Log.Info(fmt.Sprintf("Unable to restore init object because %s is marked for deletion", existing.Name))
@@ -81,6 +191,12 @@ func (obj *ocsCephBlockPools) ensureCreated(r *StorageClusterReconciler, instanc
 
 			r.Log.Info(fmt.Sprintf("Restoring original cephBlockPool %s", cephBlockPool.Name))
 			existing.ObjectMeta.OwnerReferences = cephBlockPool.ObjectMeta.OwnerReferences
+			for k, v := range cephBlockPool.Labels {
+				if existing.Labels == nil {
+					existing.Labels = map[string]string{}
+				}
+				existing.Labels[k] = v
+			}
 			cephBlockPool.ObjectMeta = existing.ObjectMeta
 			err = r.Client.Update(context.TODO(), cephBlockPool)
 			if err != nil {
@@ -95,11 +211,73 @@ func (obj *ocsCephBlockPools) ensureCreated(r *StorageClusterReconciler, instanc
 		}
 	}
 
+	if err = r.deleteRemovedCephBlockPools(instance, cephBlockPools); err != nil {
+		return err
+	}
+	return r.ensureCephBlockPoolQuotas(instance)
+}
+
+// deleteRemovedCephBlockPools deletes the CephBlockPools of the additional
+// pools that were removed from the StorageCluster. A pool is kept as long as
+// a PersistentVolume is provisioned from it.
+func (r *StorageClusterReconciler) deleteRemovedCephBlockPools(sc *ocsv1.StorageCluster, cephBlockPools []*cephv1.CephBlockPool) error {
+	desired := map[string]bool{}
+	for _, cephBlockPool := range cephBlockPools {
+		desired[cephBlockPool.Name] = true
+	}
+	existing := &cephv1.CephBlockPoolList{}
+	err := r.Client.List(context.TODO(), existing, client.InNamespace(sc.Namespace), client.MatchingLabels{additionalCephBlockPoolLabel: sc.Name})
+	if err != nil {
+		return err
+	}
+	var inUse map[string]bool
+	for i := range existing.Items {
+		cephBlockPool := &existing.Items[i]
+		if desired[cephBlockPool.Name] || cephBlockPool.DeletionTimestamp != nil {
+			continue
+		}
+		if inUse == nil {
+			if inUse, err = r.getCephBlockPoolsInUse(sc); err != nil {
+				return err
+			}
+		}
+		if inUse[cephBlockPool.Name] {
+			r.Log.Info(fmt.Sprintf("not deleting the removed cephBlockPool %s, PersistentVolumes are provisioned from it", cephBlockPool.Name))
+			continue
+		}
+		r.Log.Info(fmt.Sprintf("deleting the removed cephBlockPool %s", cephBlockPool.Name))
+		if err = r.Client.Delete(context.TODO(), cephBlockPool); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
 	return nil
 }
 
+// getCephBlockPoolsInUse returns the names of the CephBlockPools of the
+// StorageCluster that PersistentVolumes are provisioned from
+func (r *StorageClusterReconciler) getCephBlockPoolsInUse(sc *ocsv1.StorageCluster) (map[string]bool, error) {
+	pvs := &corev1.PersistentVolumeList{}
+	if err := r.Client.List(context.TODO(), pvs); err != nil {
+		return nil, err
+	}
+	driver := fmt.Sprintf("%s.rbd.csi.ceph.com", sc.Namespace)
+	inUse := map[string]bool{}
+	for _, pv := range pvs.Items {
+		csi := pv.Spec.CSI
+		if csi == nil || csi.Driver != driver || csi.VolumeAttributes["clusterID"] != sc.Namespace {
+			continue
+		}
+		inUse[csi.VolumeAttributes["pool"]] = true
+	}
+	return inUse, nil
+}
+
 // ensureDeleted deletes the CephBlockPools owned by the StorageCluster
 func (obj *ocsCephBlockPools) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	if err := r.deletePoolQuotaCephClient(sc); err != nil {
+		return err
+	}
+
 	foundCephBlockPool := &cephv1.CephBlockPool{}
 	cephBlockPools, err := r.newCephBlockPoolInstances(sc)
 	if err != nil {
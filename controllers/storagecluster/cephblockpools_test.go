@@ -2,12 +2,22 @@ package storagecluster
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
+	snapapi "github.com/kubernetes-csi/external-snapshotter/v2/pkg/apis/volumesnapshot/v1beta1"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	api "github.com/openshift/ocs-operator/api/v1"
@@ -56,3 +66,361 @@ func assertCephBlockPools(t *testing.T, reconciler StorageClusterReconciler, cr
 	assert.Equal(t, expectedCbp[0].ObjectMeta.Name, actualCbp.ObjectMeta.Name)
 	assert.Equal(t, expectedCbp[0].Spec, actualCbp.Spec)
 }
+
+func TestAdditionalCephBlockPools(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []api.AdditionalCephBlockPool{
+		{
+			Name:        "ssd",
+			DeviceClass: "ssd",
+		},
+		{
+			Name:            "scratch",
+			FailureDomain:   "host",
+			ReplicaSize:     2,
+			CompressionMode: "aggressive",
+		},
+	}
+	reconciler := createFakeStorageClusterReconciler(t)
+
+	var pools ocsCephBlockPools
+	err := pools.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	var storageClasses ocsStorageClass
+	err = storageClasses.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	var snapshotClasses ocsSnapshotClass
+	err = snapshotClasses.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+
+	ssdPool := &cephv1.CephBlockPool{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-ssd"}, ssdPool)
+	assert.NoError(t, err)
+	assert.Equal(t, cephv1.PoolSpec{
+		FailureDomain:  "zone",
+		DeviceClass:    "ssd",
+		Replicated:     cephv1.ReplicatedSpec{Size: 3},
+		EnableRBDStats: true,
+	}, ssdPool.Spec)
+
+	scratchPool := &cephv1.CephBlockPool{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-scratch"}, scratchPool)
+	assert.NoError(t, err)
+	assert.Equal(t, cephv1.PoolSpec{
+		FailureDomain:   "host",
+		CompressionMode: "aggressive",
+		Replicated:      cephv1.ReplicatedSpec{Size: 2},
+		EnableRBDStats:  true,
+	}, scratchPool.Spec)
+
+	for _, pool := range sc.Spec.ManagedResources.CephBlockPools.AdditionalPools {
+		storageClass := &storagev1.StorageClass{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-" + pool.Name}, storageClass)
+		assert.NoError(t, err)
+		assert.Equal(t, "ocsinit-cephblockpool-"+pool.Name, storageClass.Parameters["pool"])
+
+		snapshotClass := &snapapi.VolumeSnapshotClass{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-rbdplugin-snapclass-" + pool.Name}, snapshotClass)
+		assert.NoError(t, err)
+	}
+}
+
+func TestRemovedAdditionalCephBlockPools(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []api.AdditionalCephBlockPool{
+		{Name: "kept"},
+		{Name: "removed"},
+		{Name: "used"},
+	}
+	// a volume is provisioned from the used pool
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver: fmt.Sprintf("%s.rbd.csi.ceph.com", sc.Namespace),
+					VolumeAttributes: map[string]string{
+						"clusterID": sc.Namespace,
+						"pool":      "ocsinit-cephblockpool-used",
+					},
+				},
+			},
+		},
+	}
+	reconciler := createFakeStorageClusterReconciler(t, pv)
+
+	var pools ocsCephBlockPools
+	var storageClasses ocsStorageClass
+	var snapshotClasses ocsSnapshotClass
+	ensureCreated := func() {
+		assert.NoError(t, pools.ensureCreated(&reconciler, sc))
+		assert.NoError(t, storageClasses.ensureCreated(&reconciler, sc))
+		assert.NoError(t, snapshotClasses.ensureCreated(&reconciler, sc))
+	}
+	ensureCreated()
+
+	sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []api.AdditionalCephBlockPool{{Name: "kept"}}
+	ensureCreated()
+
+	for name, expected := range map[string]bool{"kept": true, "removed": false} {
+		err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-" + name}, &cephv1.CephBlockPool{})
+		assert.Equal(t, expected, err == nil, name)
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-" + name}, &storagev1.StorageClass{})
+		assert.Equal(t, expected, err == nil, name)
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-rbdplugin-snapclass-" + name}, &snapapi.VolumeSnapshotClass{})
+		assert.Equal(t, expected, err == nil, name)
+	}
+	// the pool is kept as long as volumes are provisioned from it, but no
+	// new volumes are provisioned from it
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-used"}, &cephv1.CephBlockPool{}))
+	err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-used"}, &storagev1.StorageClass{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// the default pool is not an additional pool
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool"}, &cephv1.CephBlockPool{}))
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd"}, &storagev1.StorageClass{}))
+
+	assert.NoError(t, reconciler.Client.Delete(context.TODO(), pv))
+	ensureCreated()
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-used"}, &cephv1.CephBlockPool{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestCephBlockPoolQuotas(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []api.AdditionalCephBlockPool{
+		{Name: "scratch", MaxBytes: 1 << 30},
+		{Name: "unlimited"},
+		{Name: "capped", MaxObjects: 1000},
+	}
+	reconciler := createFakeStorageClusterReconciler(t)
+	reconciler.images.Ceph = "ceph"
+
+	var pools ocsCephBlockPools
+	assert.NoError(t, pools.ensureCreated(&reconciler, sc))
+
+	// the quota is only set once the pool is ready
+	jobName := types.NamespacedName{Name: "ocsinit-cephblockpool-scratch-quota"}
+	err := reconciler.Client.Get(context.TODO(), jobName, &batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err))
+
+	for _, name := range []string{"ocsinit-cephblockpool-scratch", "ocsinit-cephblockpool-unlimited", "ocsinit-cephblockpool-capped"} {
+		pool := &cephv1.CephBlockPool{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name}, pool))
+		pool.Status = &cephv1.CephBlockPoolStatus{Phase: cephv1.ConditionReady}
+		assert.NoError(t, reconciler.Client.Update(context.TODO(), pool))
+	}
+
+	// the Job waits on the key of the restricted CephClient
+	assert.NoError(t, reconciler.ensureCephBlockPoolQuotas(sc))
+	cephClient := &cephv1.CephClient{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-pool-quota"}, cephClient))
+	assert.Equal(t, `allow r, allow command "osd pool set-quota"`, cephClient.Spec.Caps["mon"])
+	err = reconciler.Client.Get(context.TODO(), jobName, &batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err))
+	keySecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-client-ocsinit-pool-quota"},
+		StringData: map[string]string{"ocsinit-pool-quota": "key"},
+	}
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), keySecret))
+	assert.NoError(t, reconciler.ensureCephBlockPoolQuotas(sc))
+
+	// a pool without quota does not run a Job, and a pending Job does not
+	// hold back the quotas of the other pools
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-unlimited-quota"}, &batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err))
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-capped-quota"}, &batchv1.Job{}))
+	condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionPoolQuotasApplied)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionUnknown, condition.Status)
+	assert.Equal(t, "waiting to set the quotas of the pools ocsinit-cephblockpool-scratch, ocsinit-cephblockpool-capped", condition.Message)
+
+	job := &batchv1.Job{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), jobName, job))
+	assert.Equal(t, "max_bytes=1073741824,max_objects=0", job.Annotations[poolQuotaAnnotation])
+	env := map[string]string{}
+	for _, envVar := range job.Spec.Template.Spec.Containers[0].Env {
+		env[envVar.Name] = envVar.Value
+	}
+	assert.Equal(t, "ocsinit-cephblockpool-scratch", env["POOL_NAME"])
+	assert.Equal(t, "1073741824", env["MAX_BYTES"])
+	assert.Equal(t, "0", env["MAX_OBJECTS"])
+	assert.Equal(t, "ocsinit-pool-quota", env["CEPH_CLIENT_ID"])
+	// the key is mounted from the Secret of the CephClient, not passed in
+	// the environment
+	for _, envVar := range job.Spec.Template.Spec.Containers[0].Env {
+		assert.True(t, envVar.ValueFrom == nil || envVar.ValueFrom.SecretKeyRef == nil)
+	}
+	assert.Equal(t, "rook-ceph-client-ocsinit-pool-quota", job.Spec.Template.Spec.Volumes[1].Secret.SecretName)
+
+	// the quota is recorded on the pool once the Job completed
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), job))
+	assert.NoError(t, reconciler.ensureCephBlockPoolQuotas(sc))
+	err = reconciler.Client.Get(context.TODO(), jobName, &batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err))
+	pool := &cephv1.CephBlockPool{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-scratch"}, pool))
+	assert.Equal(t, "max_bytes=1073741824,max_objects=0", pool.Annotations[poolQuotaAnnotation])
+
+	// removing the quota runs a Job setting it to 0
+	sc.Spec.ManagedResources.CephBlockPools.AdditionalPools[0].MaxBytes = 0
+	assert.NoError(t, reconciler.ensureCephBlockPoolQuotas(sc))
+	job = &batchv1.Job{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), jobName, job))
+	assert.Equal(t, "max_bytes=0,max_objects=0", job.Annotations[poolQuotaAnnotation])
+
+	// a failed Job is reported and deleted, so that it is retried
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"}}
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), job))
+	assert.NoError(t, reconciler.ensureCephBlockPoolQuotas(sc))
+	err = reconciler.Client.Get(context.TODO(), jobName, &batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err))
+	pool = &cephv1.CephBlockPool{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-scratch"}, pool))
+	assert.Equal(t, "Job has reached the specified backoff limit", pool.Annotations[poolQuotaErrorAnnotation])
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionPoolQuotasApplied)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, "failed to set the quotas of the pools ocsinit-cephblockpool-scratch: Job has reached the specified backoff limit", condition.Message)
+
+	// the failure is reported until the retry succeeds
+	assert.NoError(t, reconciler.ensureCephBlockPoolQuotas(sc))
+	job = &batchv1.Job{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), jobName, job))
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionPoolQuotasApplied)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+
+	for _, name := range []string{jobName.Name, "ocsinit-cephblockpool-capped-quota"} {
+		job = &batchv1.Job{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name}, job))
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		assert.NoError(t, reconciler.Client.Update(context.TODO(), job))
+	}
+	assert.NoError(t, reconciler.ensureCephBlockPoolQuotas(sc))
+	pool = &cephv1.CephBlockPool{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-scratch"}, pool))
+	assert.Equal(t, "max_bytes=0,max_objects=0", pool.Annotations[poolQuotaAnnotation])
+	assert.NotContains(t, pool.Annotations, poolQuotaErrorAnnotation)
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionPoolQuotasApplied)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+}
+
+func TestPoolQuotaJobName(t *testing.T) {
+	assert.Equal(t, "ocsinit-cephblockpool-scratch-quota", generateNameForPoolQuotaJob("ocsinit-cephblockpool-scratch"))
+
+	// the name of the Job is the value of the job-name label of its pods
+	poolName := "ocsinit-cephblockpool-" + strings.Repeat("a", 50)
+	name := generateNameForPoolQuotaJob(poolName)
+	assert.Empty(t, validation.IsValidLabelValue(name))
+	assert.NotEqual(t, name, generateNameForPoolQuotaJob(poolName+"b"))
+}
+
+func TestDeviceClassCephBlockPools(t *testing.T) {
+	cases := []struct {
+		label           string
+		deviceTypes     []string
+		additionalPools []api.AdditionalCephBlockPool
+		expectedPools   []api.AdditionalCephBlockPool
+	}{
+		{
+			label:         "case 1: a single device class",
+			deviceTypes:   []string{"ssd", "ssd"},
+			expectedPools: nil,
+		},
+		{
+			label:       "case 2: a pool per device class",
+			deviceTypes: []string{"ssd", "HDD", "ssd"},
+			expectedPools: []api.AdditionalCephBlockPool{
+				{Name: "hdd", DeviceClass: "HDD"},
+				{Name: "ssd", DeviceClass: "ssd"},
+			},
+		},
+		{
+			label:           "case 3: user-defined pools are not duplicated",
+			deviceTypes:     []string{"ssd", "hdd"},
+			additionalPools: []api.AdditionalCephBlockPool{{Name: "ssd", DeviceClass: "ssd", ReplicaSize: 2}},
+			expectedPools: []api.AdditionalCephBlockPool{
+				{Name: "ssd", DeviceClass: "ssd", ReplicaSize: 2},
+				{Name: "hdd", DeviceClass: "hdd"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		for i, deviceType := range c.deviceTypes {
+			ds := api.StorageDeviceSet{}
+			mockDeviceSets[0].DeepCopyInto(&ds)
+			ds.Name = fmt.Sprintf("mock-sds-%d", i)
+			ds.DeviceType = deviceType
+			sc.Spec.StorageDeviceSets = append(sc.Spec.StorageDeviceSets, ds)
+		}
+		sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = c.additionalPools
+
+		assert.Equalf(t, c.expectedPools, getAdditionalCephBlockPools(sc), "[%s]: unexpected pools", c.label)
+	}
+
+	sc := createDefaultStorageCluster()
+	for _, deviceType := range []string{"ssd", "hdd"} {
+		ds := api.StorageDeviceSet{}
+		mockDeviceSets[0].DeepCopyInto(&ds)
+		ds.Name = deviceType
+		ds.DeviceType = deviceType
+		sc.Spec.StorageDeviceSets = append(sc.Spec.StorageDeviceSets, ds)
+	}
+	reconciler := createFakeStorageClusterReconciler(t)
+	sccs, err := reconciler.newStorageClassConfigurations(sc)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, scc := range sccs {
+		names = append(names, scc.storageClass.Name)
+	}
+	assert.Contains(t, names, "ocsinit-ceph-rbd-ssd")
+	assert.Contains(t, names, "ocsinit-ceph-rbd-hdd")
+}
+
+func TestRemovedDeviceClassCephBlockPools(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	for _, deviceType := range []string{"ssd", "hdd", "nvme"} {
+		ds := api.StorageDeviceSet{}
+		mockDeviceSets[0].DeepCopyInto(&ds)
+		ds.Name = deviceType
+		ds.DeviceType = deviceType
+		sc.Spec.StorageDeviceSets = append(sc.Spec.StorageDeviceSets, ds)
+	}
+	reconciler := createFakeStorageClusterReconciler(t)
+
+	var pools ocsCephBlockPools
+	var storageClasses ocsStorageClass
+	var snapshotClasses ocsSnapshotClass
+	ensureCreated := func() {
+		assert.NoError(t, pools.ensureCreated(&reconciler, sc))
+		assert.NoError(t, storageClasses.ensureCreated(&reconciler, sc))
+		assert.NoError(t, snapshotClasses.ensureCreated(&reconciler, sc))
+	}
+	ensureCreated()
+
+	// the nvme device set is removed, the pools of the other device classes
+	// are kept
+	sc.Spec.StorageDeviceSets = sc.Spec.StorageDeviceSets[:2]
+	ensureCreated()
+	for name, expected := range map[string]bool{"ssd": true, "hdd": true, "nvme": false} {
+		err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-" + name}, &cephv1.CephBlockPool{})
+		assert.Equal(t, expected, err == nil, name)
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-" + name}, &storagev1.StorageClass{})
+		assert.Equal(t, expected, err == nil, name)
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-rbdplugin-snapclass-" + name}, &snapapi.VolumeSnapshotClass{})
+		assert.Equal(t, expected, err == nil, name)
+	}
+
+	// with a single device class left, no pool is created per device class
+	sc.Spec.StorageDeviceSets = sc.Spec.StorageDeviceSets[:1]
+	ensureCreated()
+	for _, name := range []string{"ssd", "hdd"} {
+		err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool-" + name}, &cephv1.CephBlockPool{})
+		assert.True(t, errors.IsNotFound(err), name)
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-" + name}, &storagev1.StorageClass{})
+		assert.True(t, errors.IsNotFound(err), name)
+	}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool"}, &cephv1.CephBlockPool{}))
+}
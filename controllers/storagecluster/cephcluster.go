@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/go-logr/logr"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	objectreferencesv1 "github.com/openshift/custom-resource-status/objectreferences/v1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
@@ -53,9 +54,7 @@ var knownDiskTypes = []knownDiskType{
 
 const (
 	// Hardcoding networkProvider to multus and this can be changed later to accomodate other providers
-	networkProvider           = "multus"
-	publicNetworkSelectorKey  = "public"
-	clusterNetworkSelectorKey = "cluster"
+	networkProvider = "multus"
 )
 
 func arbiterEnabled(sc *ocsv1.StorageCluster) bool {
@@ -65,10 +64,6 @@ func arbiterEnabled(sc *ocsv1.StorageCluster) bool {
 // ensureCreated ensures that a CephCluster resource exists with its Spec in
 // the desired state.
 func (obj *ocsCephCluster) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
-	if sc.Spec.ExternalStorage.Enable && len(sc.Spec.StorageDeviceSets) != 0 {
-		return fmt.Errorf("'StorageDeviceSets' should not be initialized in an external CephCluster")
-	}
-
 	for i, ds := range sc.Spec.StorageDeviceSets {
 		sc.Spec.StorageDeviceSets[i].Config.TuneSlowDeviceClass = false
 		sc.Spec.StorageDeviceSets[i].Config.TuneFastDeviceClass = false
@@ -86,17 +81,15 @@ func (obj *ocsCephCluster) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.
 		}
 	}
 
-	if isMultus(sc.Spec.Network) {
-		err := validateMultusSelectors(sc.Spec.Network.Selectors)
-		if err != nil {
-			return err
-		}
-	}
-
 	var cephCluster *cephv1.CephCluster
 	// Define a new CephCluster object
 	if sc.Spec.ExternalStorage.Enable {
-		cephCluster = newExternalCephCluster(sc, r.images.Ceph, r.monitoringIP)
+		monitoringEndpoints, err := r.getExternalMonitoringEndpoints(sc)
+		if err != nil {
+			r.Log.Error(err, "failed to get the mgr endpoints of the external cluster")
+			return err
+		}
+		cephCluster = newExternalCephCluster(sc, r.images.Ceph, monitoringEndpoints)
 	} else {
 		kmsConfigMap, err := getKMSConfigMap(sc, r.Client, reachKMSProvider)
 		if err != nil {
@@ -104,6 +97,23 @@ func (obj *ocsCephCluster) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.
 			return err
 		}
 		cephCluster = newCephCluster(sc, r.images.Ceph, r.nodeCount, r.serverVersion, kmsConfigMap, r.Log)
+		if kmsConfigMap != nil {
+			same, err := r.sameKMSSecretData(sc, kmsConfigMap)
+			if err != nil {
+				r.Log.Error(err, "failed to procure KMS secrets")
+				return err
+			}
+			if !same {
+				r.Log.Info("KMS secrets changed")
+				r.recorder.Event(sc, corev1.EventTypeNormal, ocsv1.KMSSecretsChanged,
+					"KMS secrets changed, propagating them to the CephCluster and NooBaa")
+			}
+			// the OSDs read the KMS secrets when they start, the hash in
+			// their pod annotations restarts them once the secrets rotate
+			cephCluster.Spec.Annotations = rook.AnnotationsSpec{
+				cephv1.KeyOSD: rook.Annotations{kmsSecretHashAnnotation: sc.Status.KMSSecretHash},
+			}
+		}
 	}
 
 	// Set StorageCluster instance as the owner and controller
@@ -172,28 +182,22 @@ func (obj *ocsCephCluster) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.
 	}
 
 	// Handle CephCluster resource status
+	var conditions []conditionsv1.Condition
 	if found.Status.State == "" {
 		r.Log.Info("CephCluster resource is not reporting status.")
 		// What does this mean to OCS status? Assuming progress.
 		reason := "CephClusterStatus"
 		message := "CephCluster resource is not reporting status"
-		statusutil.MapCephClusterNoConditions(&r.conditions, reason, message)
+		statusutil.MapCephClusterNoConditions(&conditions, reason, message)
 	} else {
 		// Interpret CephCluster status and set any negative conditions
 		if sc.Spec.ExternalStorage.Enable {
-			statusutil.MapExternalCephClusterNegativeConditions(&r.conditions, found)
+			statusutil.MapExternalCephClusterNegativeConditions(&conditions, found)
 		} else {
-			statusutil.MapCephClusterNegativeConditions(&r.conditions, found)
+			statusutil.MapCephClusterNegativeConditions(&conditions, found)
 		}
 	}
-
-	// When phase is expanding, wait for CephCluster state to be updating
-	// this means expansion is in progress and overall system is progressing
-	// else expansion is not yet triggered
-	if sc.Status.Phase == statusutil.PhaseClusterExpanding &&
-		found.Status.State != cephv1.ClusterStateUpdating {
-		r.phase = statusutil.PhaseClusterExpanding
-	}
+	r.setComponentStatus("CephCluster", found.Name, string(found.Status.State), conditions)
 
 	if sc.Spec.ExternalStorage.Enable {
 		if found.Status.State == cephv1.ClusterStateConnecting {
@@ -316,50 +320,37 @@ func newCephCluster(sc *ocsv1.StorageCluster, cephImage string, nodeCount int, s
 		reqLogger.Info(fmt.Sprintf("No monDataDirHostPath, monPVCTemplate or storageDeviceSets configured for storageCluster %s", sc.GetName()))
 	}
 	if isMultus(sc.Spec.Network) {
-		cephCluster.Spec.Network.NetworkSpec = *sc.Spec.Network
+		cephCluster.Spec.Network.NetworkSpec = sc.Spec.Network.NetworkSpec
 	}
 	// if kmsConfig is not 'nil', add the KMS details to CephCluster spec
 	if kmsConfigMap != nil {
-		cephCluster.Spec.Security.KeyManagementService.ConnectionDetails = kmsConfigMap.Data
-		cephCluster.Spec.Security.KeyManagementService.TokenSecretName = KMSTokenSecretName
+		connectionDetails := getKMSConnectionDetails(kmsConfigMap)
+		cephCluster.Spec.Security.KeyManagementService.ConnectionDetails = connectionDetails
+		cephCluster.Spec.Security.KeyManagementService.TokenSecretName = getKMSTokenSecretName(connectionDetails)
 	}
 	return cephCluster
 }
 
-func isMultus(nwSpec *rook.NetworkSpec) bool {
+func isMultus(nwSpec *ocsv1.NetworkSpec) bool {
 	if nwSpec != nil {
 		return nwSpec.IsMultus()
 	}
 	return false
 }
 
-func validateMultusSelectors(selectors map[string]string) error {
-	publicNetwork, validPublicNetworkKey := selectors[publicNetworkSelectorKey]
-	clusterNetwork, validClusterNetworkKey := selectors[clusterNetworkSelectorKey]
-	if !validPublicNetworkKey && !validClusterNetworkKey {
-		return fmt.Errorf("invalid value of the keys for the network selectors. keys should be public and cluster only")
-	}
-	if publicNetwork == "" && clusterNetwork == "" {
-		return fmt.Errorf("Both public and cluster network selector values can't be empty")
-	}
-	if publicNetwork == "" {
-		return fmt.Errorf("public network selector values can't be empty")
-	}
-	return nil
-}
-
-func newExternalCephCluster(sc *ocsv1.StorageCluster, cephImage string, monitoringIP string) *cephv1.CephCluster {
+func newExternalCephCluster(sc *ocsv1.StorageCluster, cephImage string, monitoringEndpoints *externalMgrEndpoints) *cephv1.CephCluster {
 	labels := map[string]string{
 		"app": sc.Name,
 	}
 
 	var monitoringSpec = cephv1.MonitoringSpec{Enabled: false}
 
-	if monitoringIP != "" {
+	if monitoringEndpoints != nil {
 		monitoringSpec = cephv1.MonitoringSpec{
-			Enabled:              true,
-			RulesNamespace:       sc.Namespace,
-			ExternalMgrEndpoints: []corev1.EndpointAddress{{IP: monitoringIP}},
+			Enabled:                   true,
+			RulesNamespace:            sc.Namespace,
+			ExternalMgrEndpoints:      monitoringEndpoints.endpointAddresses(),
+			ExternalMgrPrometheusPort: monitoringEndpoints.port,
 		}
 	}
 
@@ -559,7 +550,7 @@ func newStorageClassDeviceSets(sc *ocsv1.StorageCluster, serverVersion *version.
 
 			// Annotation crushDeviceClass ensures osd with different CRUSH device class than the one detected by Ceph
 			annotations := map[string]string{
-				"crushDeviceClass": ds.DeviceType,
+				"crushDeviceClass": getDeviceClass(ds),
 			}
 			ds.DataPVCTemplate.Annotations = annotations
 
@@ -576,6 +567,9 @@ func newStorageClassDeviceSets(sc *ocsv1.StorageCluster, serverVersion *version.
 				TuneFastDeviceClass:  ds.Config.TuneFastDeviceClass,
 				Encrypted:            sc.Spec.Encryption.Enable,
 			}
+			if ds.Config.Encrypted != nil {
+				set.Encrypted = *ds.Config.Encrypted
+			}
 
 			if ds.MetadataPVCTemplate != nil {
 				ds.MetadataPVCTemplate.ObjectMeta.Name = metadataPVCName
@@ -593,6 +587,15 @@ func newStorageClassDeviceSets(sc *ocsv1.StorageCluster, serverVersion *version.
 	return storageClassDeviceSets
 }
 
+// getDeviceClass returns the CRUSH device class of the OSDs of the given
+// StorageDeviceSet
+func getDeviceClass(ds ocsv1.StorageDeviceSet) string {
+	if ds.Config.CrushDeviceClass != "" {
+		return ds.Config.CrushDeviceClass
+	}
+	return ds.DeviceType
+}
+
 func newCephDaemonResources(custom map[string]corev1.ResourceRequirements) map[string]corev1.ResourceRequirements {
 	resources := map[string]corev1.ResourceRequirements{
 		"mon": defaults.GetDaemonResources("mon", custom),
@@ -9,6 +9,7 @@ import (
 	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	api "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
 	rookCephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
@@ -72,6 +73,7 @@ func TestEnsureCephCluster(t *testing.T) {
 
 		err := obj.ensureCreated(&reconciler, sc)
 		assert.NoError(t, err)
+		conditions := statusutil.AggregateComponentConditions(reconciler.components)
 		if c.condition == "" {
 			expected := newCephCluster(sc, "", 3, reconciler.serverVersion, nil, log)
 			actual := newCephCluster(sc, "", 3, reconciler.serverVersion, nil, log)
@@ -82,8 +84,8 @@ func TestEnsureCephCluster(t *testing.T) {
 			assert.Equal(t, expected.Spec, actual.Spec)
 		} else if c.condition == "noCondition" {
 
-			assert.NotEmpty(t, reconciler.conditions)
-			assert.Len(t, reconciler.conditions, 3)
+			assert.NotEmpty(t, conditions)
+			assert.Len(t, conditions, 3)
 
 			expectedConditions := map[conditionsv1.ConditionType]corev1.ConditionStatus{
 				conditionsv1.ConditionAvailable:   corev1.ConditionFalse,
@@ -91,12 +93,12 @@ func TestEnsureCephCluster(t *testing.T) {
 				conditionsv1.ConditionUpgradeable: corev1.ConditionFalse,
 			}
 			for cType, status := range expectedConditions {
-				found := assertCondition(reconciler.conditions, cType, status)
+				found := assertCondition(conditions, cType, status)
 				assert.True(t, found, "expected status condition not found", cType, status)
 			}
 
 		} else {
-			assert.Empty(t, reconciler.conditions)
+			assert.Empty(t, conditions)
 		}
 
 	}
@@ -360,6 +362,67 @@ func TestStorageClassDeviceSetCreation(t *testing.T) {
 
 }
 
+func TestStorageDeviceSetConfig(t *testing.T) {
+	serverVersion := &version.Info{}
+	encrypted := false
+	cases := []struct {
+		label                    string
+		config                   api.StorageDeviceSetConfig
+		expectedConfig           map[string]string
+		expectedCrushDeviceClass string
+		expectedEncrypted        bool
+	}{
+		{
+			label:                    "case 1: empty config",
+			config:                   api.StorageDeviceSetConfig{},
+			expectedConfig:           nil,
+			expectedCrushDeviceClass: "ssd",
+			expectedEncrypted:        true,
+		},
+		{
+			label: "case 2: all options set",
+			config: api.StorageDeviceSetConfig{
+				OSDsPerDevice:    2,
+				CrushDeviceClass: "fast",
+				DatabaseSizeMB:   1024,
+				WalSizeMB:        512,
+				Encrypted:        &encrypted,
+			},
+			expectedConfig: map[string]string{
+				"osdsPerDevice":  "2",
+				"deviceClass":    "fast",
+				"databaseSizeMB": "1024",
+				"walSizeMB":      "512",
+			},
+			expectedCrushDeviceClass: "fast",
+			expectedEncrypted:        false,
+		},
+	}
+
+	for _, c := range cases {
+		sc := &api.StorageCluster{}
+		mockStorageCluster.DeepCopyInto(sc)
+		sc.Spec.Encryption.Enable = true
+		sc.Status.NodeTopologies = &api.NodeTopologyMap{}
+		sc.Spec.StorageDeviceSets = []api.StorageDeviceSet{}
+		for _, ds := range mockDeviceSets {
+			ds.DeviceType = "ssd"
+			ds.Config = c.config
+			sc.Spec.StorageDeviceSets = append(sc.Spec.StorageDeviceSets, ds)
+		}
+
+		cephCluster := newCephCluster(sc, "", 3, serverVersion, nil, log)
+		actual := cephCluster.Spec.Storage.StorageClassDeviceSets
+		assert.Equalf(t, defaults.DeviceSetReplica, len(actual), "[%s]: unexpected number of StorageClassDeviceSets", c.label)
+		for _, scds := range actual {
+			assert.Equalf(t, c.expectedConfig, scds.Config, "[%s]: unexpected config", c.label)
+			assert.Equalf(t, c.expectedCrushDeviceClass, scds.VolumeClaimTemplates[0].Annotations["crushDeviceClass"],
+				"[%s]: unexpected crushDeviceClass", c.label)
+			assert.Equalf(t, c.expectedEncrypted, scds.Encrypted, "[%s]: unexpected encryption", c.label)
+		}
+	}
+}
+
 func createDummyKMSConfigMap(kmsProvider, kmsAddr string) *corev1.ConfigMap {
 	cm := &corev1.ConfigMap{}
 	cm.Name = KMSConfigMapName
@@ -371,6 +434,13 @@ func createDummyKMSConfigMap(kmsProvider, kmsAddr string) *corev1.ConfigMap {
 	return cm
 }
 
+func createDummyKMSTokenSecret() *corev1.Secret {
+	secret := &corev1.Secret{}
+	secret.Name = KMSTokenSecretName
+	secret.Data = map[string][]byte{"token": []byte("s.dummytoken")}
+	return secret
+}
+
 func TestKMSConfigChanges(t *testing.T) {
 	validKMSArgs := []struct {
 		testLabel       string
@@ -380,10 +450,12 @@ func TestKMSConfigChanges(t *testing.T) {
 	}{
 		{testLabel: "case 1", kmsProvider: "vault", kmsAddress: "http://localhost:5050"},
 		{testLabel: "case 2", kmsProvider: "vault", kmsAddress: "http://localhost:12321"},
-		// ocs-operator is agnostic to KMS Provider, here rook should be throwing error
-		{testLabel: "case 3", kmsProvider: "newKMSProvider", kmsAddress: "http://127.0.0.1:1553"},
+		// unknown KMS providers are rejected
+		{testLabel: "case 3", kmsProvider: "newKMSProvider", kmsAddress: "http://127.0.0.1:1553", failureExpected: true},
 		// invalid test cases, make sure label has a prefix 'invalid'
 		{testLabel: "case 4", kmsProvider: "vault", kmsAddress: "http://unearchable.url.location:3366", failureExpected: true},
+		{testLabel: "case 5", kmsProvider: "kmip", kmsAddress: "127.0.0.1:1554"},
+		{testLabel: "case 6", kmsProvider: "azure", kmsAddress: "http://127.0.0.1:1555"},
 	}
 	for _, kmsArgs := range validKMSArgs {
 		assertCephClusterKMSConfiguration(t, kmsArgs)
@@ -403,6 +475,10 @@ func assertCephClusterKMSConfiguration(t *testing.T, kmsArgs struct {
 		t.Errorf("Unable to create KMS configmap: %v", err)
 		t.FailNow()
 	}
+	if err := reconciler.Client.Create(ctxTodo, createDummyKMSTokenSecret()); err != nil {
+		t.Errorf("Unable to create KMS token secret: %v", err)
+		t.FailNow()
+	}
 	// create a cephcluster CR and enable the KMS
 	cr := createDefaultStorageCluster()
 	cr.Spec.Encryption.KeyManagementService.Enable = true
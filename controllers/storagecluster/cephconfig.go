@@ -0,0 +1,150 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/validation"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type ocsCephConfig struct{}
+
+const cephConfigGlobalSection = "global"
+
+// defaultCephConfig holds the ceph.conf options set by the ocs-operator. The
+// overrides from the StorageCluster spec are merged on top of these.
+var defaultCephConfig = map[string]ocsv1.CephConfigSection{
+	cephConfigGlobalSection: {
+		"mon_osd_full_ratio":         ".85",
+		"mon_osd_backfillfull_ratio": ".8",
+		"mon_osd_nearfull_ratio":     ".75",
+		"mon_max_pg_per_osd":         "300",
+	},
+	"osd": {
+		"osd_memory_target_cgroup_limit_ratio": "0.5",
+	},
+}
+
+// ensureCreated ensures that a ConfigMap resource exists with its Spec in
+// the desired state.
+func (obj *ocsCephConfig) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	config := renderCephConfig(mergeCephConfig(defaultCephConfig, sc.Spec.CephConfig, newNetworkEncryptionCephConfig(sc)))
+	configHash, err := sha512sum([]byte(config))
+	if err != nil {
+		return err
+	}
+
+	ownerRef := metav1.OwnerReference{
+		UID:        sc.UID,
+		APIVersion: sc.APIVersion,
+		Kind:       sc.Kind,
+		Name:       sc.Name,
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            rookConfigMapName,
+			Namespace:       sc.Namespace,
+			OwnerReferences: []metav1.OwnerReference{ownerRef},
+		},
+		Data: map[string]string{
+			"config": config,
+		},
+	}
+
+	found := &corev1.ConfigMap{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			r.Log.Info("Creating Ceph ConfigMap")
+			err = r.Client.Create(context.TODO(), cm)
+			if err != nil {
+				return err
+			}
+			setCephConfigStatus(sc, config, configHash)
+		}
+		return err
+	}
+
+	ownerRefFound := false
+	for _, ownerRef := range found.OwnerReferences {
+		if ownerRef.UID == sc.UID {
+			ownerRefFound = true
+		}
+	}
+	val, ok := found.Data["config"]
+	if !ok || val != config || !ownerRefFound {
+		r.Log.Info("Updating Ceph ConfigMap")
+		cm.ResourceVersion = found.ResourceVersion
+		if err = r.Client.Update(context.TODO(), cm); err != nil {
+			return err
+		}
+	}
+	setCephConfigStatus(sc, config, configHash)
+	return nil
+}
+
+// ensureDeleted is dummy func for the ocsCephConfig
+func (obj *ocsCephConfig) ensureDeleted(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
+	return nil
+}
+
+func setCephConfigStatus(sc *ocsv1.StorageCluster, config, configHash string) {
+	sc.Status.CephConfig.Config = config
+	sc.Status.CephConfig.Hash = configHash
+}
+
+// mergeCephConfig merges the given ceph.conf layers in order, so that an
+// option in a later layer replaces the same option of the same section in the
+// earlier ones
+func mergeCephConfig(layers ...map[string]ocsv1.CephConfigSection) map[string]ocsv1.CephConfigSection {
+	merged := map[string]ocsv1.CephConfigSection{}
+	for _, layer := range layers {
+		for section, options := range layer {
+			section = strings.TrimSpace(section)
+			if merged[section] == nil {
+				merged[section] = ocsv1.CephConfigSection{}
+			}
+			for name, value := range options {
+				merged[section][validation.NormalizeCephConfigOption(name)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return merged
+}
+
+// renderCephConfig renders the given sections in the ceph.conf format. The
+// global section comes first, and the other sections and all options are
+// sorted by name, so that the same config always renders the same way.
+func renderCephConfig(config map[string]ocsv1.CephConfigSection) string {
+	sections := []string{}
+	for section := range config {
+		if section != cephConfigGlobalSection {
+			sections = append(sections, section)
+		}
+	}
+	sort.Strings(sections)
+	if _, ok := config[cephConfigGlobalSection]; ok {
+		sections = append([]string{cephConfigGlobalSection}, sections...)
+	}
+
+	var b strings.Builder
+	for _, section := range sections {
+		fmt.Fprintf(&b, "[%s]\n", section)
+		names := []string{}
+		for name := range config[section] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "%s = %s\n", name, config[section][name])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+)
+
+func TestRenderCephConfig(t *testing.T) {
+	cases := []struct {
+		label     string
+		overrides map[string]api.CephConfigSection
+		expected  string
+	}{
+		{
+			label: "case 1: defaults only",
+			expected: `[global]
+mon_max_pg_per_osd = 300
+mon_osd_backfillfull_ratio = .8
+mon_osd_full_ratio = .85
+mon_osd_nearfull_ratio = .75
+[osd]
+osd_memory_target_cgroup_limit_ratio = 0.5
+`,
+		},
+		{
+			label: "case 2: overrides take precedence over the defaults",
+			overrides: map[string]api.CephConfigSection{
+				"global": {
+					"mon osd full ratio": ".9",
+					"mon-max-pg-per-osd": "400",
+				},
+				"osd.3": {
+					"osd_memory_target": "4294967296",
+				},
+				"mon": {
+					"mon_warn_on_pool_no_redundancy": "false",
+				},
+			},
+			expected: `[global]
+mon_max_pg_per_osd = 400
+mon_osd_backfillfull_ratio = .8
+mon_osd_full_ratio = .9
+mon_osd_nearfull_ratio = .75
+[mon]
+mon_warn_on_pool_no_redundancy = false
+[osd]
+osd_memory_target_cgroup_limit_ratio = 0.5
+[osd.3]
+osd_memory_target = 4294967296
+`,
+		},
+	}
+
+	for _, c := range cases {
+		actual := renderCephConfig(mergeCephConfig(defaultCephConfig, c.overrides))
+		assert.Equalf(t, c.expected, actual, "[%s]: unexpected ceph.conf", c.label)
+	}
+}
+
+func TestCephConfigOverrides(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.CephConfig = map[string]api.CephConfigSection{
+		"osd": {"osd_memory_target_cgroup_limit_ratio": "0.8"},
+	}
+	reconciler := createFakeStorageClusterReconciler(t)
+
+	var obj ocsCephConfig
+	err := obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+
+	cm := &corev1.ConfigMap{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, cm)
+	assert.NoError(t, err)
+	assert.Contains(t, cm.Data["config"], "osd_memory_target_cgroup_limit_ratio = 0.8\n")
+	assert.Equal(t, cm.Data["config"], sc.Status.CephConfig.Config)
+	firstHash := sc.Status.CephConfig.Hash
+	assert.NotEmpty(t, firstHash)
+
+	// an edit of the ConfigMap is reverted to the rendered config
+	cm.Data["config"] = "[global]\n"
+	err = reconciler.Client.Update(context.TODO(), cm)
+	assert.NoError(t, err)
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, cm)
+	assert.NoError(t, err)
+	assert.Equal(t, sc.Status.CephConfig.Config, cm.Data["config"])
+	assert.Equal(t, firstHash, sc.Status.CephConfig.Hash)
+
+	// a change of the overrides changes the hash
+	sc.Spec.CephConfig["osd"]["osd_memory_target_cgroup_limit_ratio"] = "0.6"
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	assert.NotEqual(t, firstHash, sc.Status.CephConfig.Hash)
+}
@@ -49,6 +49,14 @@ func (r *StorageClusterReconciler) newCephFilesystemInstances(initData *ocsv1.St
 			},
 		},
 	}
+	if ec := initData.Spec.ManagedResources.CephFilesystems.ErasureCoded; ec != nil {
+		// CephFS keeps the inode backtraces in the default data pool, which
+		// should be replicated, so the file data goes to a second pool
+		for _, obj := range ret {
+			obj.Spec.DataPools[0].Replicated.TargetSizeRatio = 0
+			obj.Spec.DataPools = append(obj.Spec.DataPools, newErasureCodedPoolSpec(initData, ec))
+		}
+	}
 	for _, obj := range ret {
 		err := controllerutil.SetControllerReference(initData, obj, r.Scheme)
 		if err != nil {
@@ -66,6 +74,11 @@ func (obj *ocsCephFilesystems) ensureCreated(r *StorageClusterReconciler, instan
 		return nil
 	}
 
+	err := verifyErasureCodedFailureDomains(instance, instance.Spec.ManagedResources.CephFilesystems.ErasureCoded)
+	if err != nil {
+		return err
+	}
+
 	cephFilesystems, err := r.newCephFilesystemInstances(instance)
 	if err != nil {
 		return err
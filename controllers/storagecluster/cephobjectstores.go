@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,6 +33,11 @@ func (obj *ocsCephObjectStores) ensureCreated(r *StorageClusterReconciler, insta
 		return nil
 	}
 
+	err = verifyErasureCodedFailureDomains(instance, instance.Spec.ManagedResources.CephObjectStores.ErasureCoded)
+	if err != nil {
+		return err
+	}
+
 	cephObjectStores, err := r.newCephObjectStoreInstances(instance)
 	if err != nil {
 		return err
@@ -90,6 +97,14 @@ func (r *StorageClusterReconciler) createCephObjectStores(cephObjectStores []*ce
 		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: cephObjectStore.Name, Namespace: cephObjectStore.Namespace}, &existing)
 		switch {
 		case err == nil:
+			var conditions []conditionsv1.Condition
+			statusutil.MapCephObjectStoreNegativeConditions(&conditions, &existing)
+			phase := ""
+			if existing.Status != nil {
+				phase = string(existing.Status.Phase)
+			}
+			r.setComponentStatus("CephObjectStore", existing.Name, phase, conditions)
+
 			reconcileStrategy := ReconcileStrategy(instance.Spec.ManagedResources.CephObjectStores.ReconcileStrategy)
 			if reconcileStrategy == ReconcileStrategyInit {
 				return nil
@@ -115,6 +130,9 @@ func (r *StorageClusterReconciler) createCephObjectStores(cephObjectStores []*ce
 				r.Log.Error(err, fmt.Sprintf("failed to create CephObjectStore object: %s", cephObjectStore.Name))
 				return err
 			}
+			var conditions []conditionsv1.Condition
+			statusutil.MapCephObjectStoreNegativeConditions(&conditions, cephObjectStore)
+			r.setComponentStatus("CephObjectStore", cephObjectStore.Name, "", conditions)
 		}
 	}
 	return nil
@@ -157,6 +175,11 @@ func (r *StorageClusterReconciler) newCephObjectStoreInstances(initData *ocsv1.S
 			},
 		},
 	}
+	if ec := initData.Spec.ManagedResources.CephObjectStores.ErasureCoded; ec != nil {
+		for _, obj := range ret {
+			obj.Spec.DataPool = newErasureCodedPoolSpec(initData, ec)
+		}
+	}
 	for _, obj := range ret {
 		err := controllerutil.SetControllerReference(initData, obj, r.Scheme)
 		if err != nil {
@@ -0,0 +1,275 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// rbdMirrorBootstrapPeerSecretNameKey is the key of the CephBlockPool
+	// status info under which Rook records the bootstrap peer Secret
+	rbdMirrorBootstrapPeerSecretNameKey = "rbdMirrorBootstrapPeerSecretName"
+
+	mirroringHealthOK = "OK"
+)
+
+// peerSecretKeys are the keys Rook expects in a bootstrap peer Secret
+var peerSecretKeys = []string{"token", "pool"}
+
+type ocsCephRBDMirrors struct{}
+
+// newCephRBDMirrorInstance returns the CephRBDMirror that runs the rbd-mirror
+// daemons for the given peer Secrets
+func (r *StorageClusterReconciler) newCephRBDMirrorInstance(initData *ocsv1.StorageCluster, peerSecretNames []string) (*cephv1.CephRBDMirror, error) {
+	count := initData.Spec.Mirroring.DaemonCount
+	if count == 0 {
+		count = defaults.CephRBDMirrorDaemonCount
+	}
+	ret := &cephv1.CephRBDMirror{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForCephRBDMirror(initData),
+			Namespace: initData.Namespace,
+		},
+		Spec: cephv1.RBDMirroringSpec{
+			Count: count,
+			Peers: cephv1.RBDMirroringPeerSpec{
+				SecretNames: peerSecretNames,
+			},
+			Placement: getPlacement(initData, "rbd-mirror"),
+			Resources: defaults.GetDaemonResources("rbd-mirror", initData.Spec.Resources),
+		},
+	}
+	err := controllerutil.SetControllerReference(initData, ret, r.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ensureCreated ensures that the CephRBDMirror exists in the desired state
+// when mirroring is enabled, and records the mirroring health of the
+// CephBlockPools
+func (obj *ocsCephRBDMirrors) ensureCreated(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
+	if !instance.Spec.Mirroring.Enabled {
+		instance.Status.Mirroring = nil
+		conditionsv1.RemoveStatusCondition(&instance.Status.Conditions, ocsv1.ConditionMirroringHealthy)
+		return obj.ensureDeleted(r, instance)
+	}
+
+	peerSecretNames, peerSecretErrs := r.getMirroringPeerSecrets(instance)
+	for _, msg := range peerSecretErrs {
+		r.recorder.Event(instance, corev1.EventTypeWarning, ocsv1.MirroringDegraded, msg)
+	}
+
+	cephRBDMirror, err := r.newCephRBDMirrorInstance(instance, peerSecretNames)
+	if err != nil {
+		return err
+	}
+	existing := &cephv1.CephRBDMirror{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: cephRBDMirror.Name, Namespace: cephRBDMirror.Namespace}, existing)
+	switch {
+	case err == nil:
+		if existing.DeletionTimestamp != nil {
+			return fmt.Errorf("failed to restore cephRBDMirror %s because it is marked for deletion", existing.Name)
+		}
+		if !reflect.DeepEqual(cephRBDMirror.Spec, existing.Spec) {
+			r.Log.Info(fmt.Sprintf("Updating cephRBDMirror %s", cephRBDMirror.Name))
+			existing.ObjectMeta.OwnerReferences = cephRBDMirror.ObjectMeta.OwnerReferences
+			cephRBDMirror.ObjectMeta = existing.ObjectMeta
+			err = r.Client.Update(context.TODO(), cephRBDMirror)
+			if err != nil {
+				return err
+			}
+		}
+	case errors.IsNotFound(err):
+		r.Log.Info(fmt.Sprintf("Creating cephRBDMirror %s", cephRBDMirror.Name))
+		err = r.Client.Create(context.TODO(), cephRBDMirror)
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	return r.setMirroringStatus(instance, peerSecretErrs)
+}
+
+// ensureDeleted deletes the CephRBDMirror owned by the StorageCluster
+func (obj *ocsCephRBDMirrors) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	found := &cephv1.CephRBDMirror{}
+	name := generateNameForCephRBDMirror(sc)
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("Uninstall: Unable to retrieve cephRBDMirror %v: %v", name, err)
+	}
+	if found.GetDeletionTimestamp().IsZero() {
+		r.Log.Info("Uninstall: Deleting cephRBDMirror", "CephRBDMirror Name", name)
+		err = r.Client.Delete(context.TODO(), found)
+		if err != nil {
+			return fmt.Errorf("Uninstall: Failed to delete cephRBDMirror %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// getMirroringPeerSecrets returns the names of the usable bootstrap peer
+// Secrets, and a message for every Secret that is missing or incomplete. An
+// unusable Secret does not stop the mirroring to the other peers.
+func (r *StorageClusterReconciler) getMirroringPeerSecrets(sc *ocsv1.StorageCluster) ([]string, []string) {
+	names := []string{}
+	errs := []string{}
+	for _, name := range sc.Spec.Mirroring.PeerSecretNames {
+		secret := &corev1.Secret{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, secret)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to get the bootstrap peer Secret %q: %v", name, err))
+			continue
+		}
+		missing := []string{}
+		for _, key := range peerSecretKeys {
+			if len(secret.Data[key]) == 0 {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) != 0 {
+			errs = append(errs, fmt.Sprintf("the bootstrap peer Secret %q is missing the keys %v", name, missing))
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, errs
+}
+
+// setMirroringStatus records the mirroring status of the CephBlockPools and
+// sets the MirroringHealthy condition from the health reported by Rook
+func (r *StorageClusterReconciler) setMirroringStatus(sc *ocsv1.StorageCluster, peerSecretErrs []string) error {
+	cephBlockPools, err := r.newCephBlockPoolInstances(sc)
+	if err != nil {
+		return err
+	}
+
+	status := &ocsv1.MirroringStatus{}
+	unhealthy := []string{}
+	pending := []string{}
+	for _, cephBlockPool := range cephBlockPools {
+		found := &cephv1.CephBlockPool{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: cephBlockPool.Name, Namespace: cephBlockPool.Namespace}, found)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		poolStatus := ocsv1.PoolMirroringStatus{
+			Name:   cephBlockPool.Name,
+			Health: getPoolMirroringHealth(found),
+		}
+		if found.Status != nil {
+			poolStatus.BootstrapPeerSecretName = found.Status.Info[rbdMirrorBootstrapPeerSecretNameKey]
+		}
+		status.Pools = append(status.Pools, poolStatus)
+
+		switch poolStatus.Health {
+		case mirroringHealthOK:
+		case "":
+			pending = append(pending, poolStatus.Name)
+		default:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", poolStatus.Name, poolStatus.Health))
+		}
+	}
+	sc.Status.Mirroring = status
+
+	condition := conditionsv1.Condition{
+		Type:    ocsv1.ConditionMirroringHealthy,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.MirroringHealthy,
+		Message: ocsv1.MirroringHealthyMessage,
+	}
+	switch {
+	case len(unhealthy) != 0 || len(peerSecretErrs) != 0:
+		messages := append([]string{}, peerSecretErrs...)
+		if len(unhealthy) != 0 {
+			messages = append(messages, fmt.Sprintf("mirroring is unhealthy for the pools %s", strings.Join(unhealthy, ", ")))
+		}
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = ocsv1.MirroringDegraded
+		condition.Message = strings.Join(messages, "; ")
+	case len(pending) != 0:
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = ocsv1.MirroringPending
+		condition.Message = fmt.Sprintf("waiting for the mirroring status of the pools %s", strings.Join(pending, ", "))
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, condition)
+	return nil
+}
+
+// getPoolMirroringHealth returns the mirroring health Rook reported for the
+// given CephBlockPool, or an empty string if it has not reported it yet
+func getPoolMirroringHealth(cephBlockPool *cephv1.CephBlockPool) string {
+	if cephBlockPool.Status == nil || cephBlockPool.Status.MirroringStatus == nil {
+		return ""
+	}
+	summary := map[string]interface{}(cephBlockPool.Status.MirroringStatus.Summary)
+	// depending on the Rook version the summary of "rbd mirror pool status"
+	// is stored as is or nested under a "summary" key
+	if nested, ok := summary["summary"].(map[string]interface{}); ok {
+		summary = nested
+	}
+	health, _ := summary["health"].(string)
+	return health
+}
+
+// cephBlockPoolStatusChanged returns whether the status the StorageCluster
+// follows changed between two versions of a CephBlockPool: its phase, its
+// mirroring health, and its bootstrap peer Secret
+func cephBlockPoolStatusChanged(oldObject, newObject runtime.Object) bool {
+	oldObj, ok := oldObject.(*cephv1.CephBlockPool)
+	if !ok {
+		return true
+	}
+	newObj, ok := newObject.(*cephv1.CephBlockPool)
+	if !ok {
+		return true
+	}
+	var oldPhase, newPhase cephv1.ConditionType
+	var oldPeerSecret, newPeerSecret string
+	if oldObj.Status != nil {
+		oldPhase = oldObj.Status.Phase
+		oldPeerSecret = oldObj.Status.Info[rbdMirrorBootstrapPeerSecretNameKey]
+	}
+	if newObj.Status != nil {
+		newPhase = newObj.Status.Phase
+		newPeerSecret = newObj.Status.Info[rbdMirrorBootstrapPeerSecretNameKey]
+	}
+	return oldPhase != newPhase || oldPeerSecret != newPeerSecret ||
+		getPoolMirroringHealth(oldObj) != getPoolMirroringHealth(newObj)
+}
+
+// newCephBlockPoolPredicate filters the events of the CephBlockPools, so that
+// only their creation, deletion, spec changes, and the changes of the status
+// the StorageCluster follows requeue it. Rook refreshes the mirroring status
+// of the pools periodically, which would requeue it on every refresh.
+func newCephBlockPoolPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.MetaOld == nil || e.MetaNew == nil ||
+				e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration() ||
+				cephBlockPoolStatusChanged(e.ObjectOld, e.ObjectNew)
+		},
+	}
+}
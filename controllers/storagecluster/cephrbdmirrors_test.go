@@ -0,0 +1,133 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+)
+
+func TestCephRBDMirror(t *testing.T) {
+	peerSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "peer-a",
+		},
+		Data: map[string][]byte{
+			"token": []byte("dG9rZW4="),
+			"pool":  []byte("ocsinit-cephblockpool"),
+		},
+	}
+	reconciler := createFakeStorageClusterReconciler(t, peerSecret)
+	sc := createDefaultStorageCluster()
+	sc.Spec.Mirroring = api.MirroringSpec{
+		Enabled:         true,
+		PeerSecretNames: []string{"peer-a", "peer-b"},
+	}
+
+	var pools ocsCephBlockPools
+	err := pools.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	cephBlockPool := &cephv1.CephBlockPool{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephblockpool"}, cephBlockPool)
+	assert.NoError(t, err)
+	assert.Equal(t, cephv1.MirroringSpec{Enabled: true, Mode: "image"}, cephBlockPool.Spec.Mirroring)
+
+	// the missing peer Secret is reported, but does not stop the mirroring
+	// to the other peer
+	var mirrors ocsCephRBDMirrors
+	err = mirrors.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	cephRBDMirror := &cephv1.CephRBDMirror{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephrbdmirror"}, cephRBDMirror)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cephRBDMirror.Spec.Count)
+	assert.Equal(t, []string{"peer-a"}, cephRBDMirror.Spec.Peers.SecretNames)
+	condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionMirroringHealthy)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.Equal(t, api.MirroringDegraded, condition.Reason)
+
+	// the condition is unknown until Rook reports the mirroring health
+	sc.Spec.Mirroring.PeerSecretNames = []string{"peer-a"}
+	err = mirrors.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionMirroringHealthy)
+	assert.Equal(t, corev1.ConditionUnknown, condition.Status)
+	assert.Equal(t, api.MirroringPending, condition.Reason)
+
+	cephBlockPool.Status = &cephv1.CephBlockPoolStatus{
+		MirroringStatus: &cephv1.MirroringStatusSpec{
+			Summary: cephv1.SummarySpec{"summary": map[string]interface{}{"health": "OK"}},
+		},
+		Info: map[string]string{rbdMirrorBootstrapPeerSecretNameKey: "pool-peer-token-ocsinit-cephblockpool"},
+	}
+	err = reconciler.Client.Update(context.TODO(), cephBlockPool)
+	assert.NoError(t, err)
+	err = mirrors.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionMirroringHealthy)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, []api.PoolMirroringStatus{
+		{
+			Name:                    "ocsinit-cephblockpool",
+			Health:                  "OK",
+			BootstrapPeerSecretName: "pool-peer-token-ocsinit-cephblockpool",
+		},
+	}, sc.Status.Mirroring.Pools)
+
+	// disabling mirroring removes the daemon and the condition
+	sc.Spec.Mirroring.Enabled = false
+	err = mirrors.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephrbdmirror"}, cephRBDMirror)
+	assert.True(t, errors.IsNotFound(err))
+	assert.Nil(t, conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionMirroringHealthy))
+	assert.Nil(t, sc.Status.Mirroring)
+}
+
+func TestCephBlockPoolPredicate(t *testing.T) {
+	poolPredicate := newCephBlockPoolPredicate()
+	pool := &cephv1.CephBlockPool{
+		ObjectMeta: metav1.ObjectMeta{Name: "ocsinit-cephblockpool", Generation: 1},
+		Status:     &cephv1.CephBlockPoolStatus{Phase: cephv1.ConditionProgressing},
+	}
+	update := func(oldPool, newPool *cephv1.CephBlockPool) bool {
+		return poolPredicate.Update(event.UpdateEvent{MetaOld: oldPool, ObjectOld: oldPool, MetaNew: newPool, ObjectNew: newPool})
+	}
+	assert.True(t, poolPredicate.Create(event.CreateEvent{Meta: pool, Object: pool}))
+	assert.True(t, poolPredicate.Delete(event.DeleteEvent{Meta: pool, Object: pool}))
+
+	// the spec and phase changes are followed
+	changed := pool.DeepCopy()
+	changed.Generation = 2
+	assert.True(t, update(pool, changed))
+	ready := pool.DeepCopy()
+	ready.Status.Phase = cephv1.ConditionReady
+	assert.True(t, update(pool, ready))
+
+	// the mirroring health and bootstrap peer Secret changes are followed
+	healthy := ready.DeepCopy()
+	healthy.Status.MirroringStatus = &cephv1.MirroringStatusSpec{
+		Summary:     cephv1.SummarySpec{"health": mirroringHealthOK},
+		LastChecked: "2021-01-01T00:00:00Z",
+	}
+	assert.True(t, update(ready, healthy))
+	peered := healthy.DeepCopy()
+	peered.Status.Info = map[string]string{rbdMirrorBootstrapPeerSecretNameKey: "pool-peer-token"}
+	assert.True(t, update(healthy, peered))
+
+	// the periodic refresh of the mirroring status and metadata changes are ignored
+	refreshed := peered.DeepCopy()
+	refreshed.Status.MirroringStatus.LastChecked = "2021-01-01T00:01:00Z"
+	refreshed.Annotations = map[string]string{"foo": "bar"}
+	assert.False(t, update(peered, refreshed))
+}
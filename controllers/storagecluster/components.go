@@ -0,0 +1,111 @@
+package storagecluster
+
+import (
+	"strings"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setComponentStatus records the status of a child resource for this
+// reconcile, along with the negative conditions it maps to
+func (r *StorageClusterReconciler) setComponentStatus(kind, name, phase string, conditions []conditionsv1.Condition) {
+	messages := []string{}
+	for _, condition := range conditions {
+		if !contains(messages, condition.Message) {
+			messages = append(messages, condition.Message)
+		}
+	}
+	component := ocsv1.ComponentStatus{
+		Kind:       kind,
+		Name:       name,
+		Phase:      phase,
+		Message:    strings.Join(messages, "; "),
+		Conditions: conditions,
+	}
+	for i := range r.components {
+		if r.components[i].Kind == kind && r.components[i].Name == name {
+			r.components[i] = component
+			return
+		}
+	}
+	r.components = append(r.components, component)
+}
+
+// componentResourceManagers are the resource managers that report the
+// components of each kind
+var componentResourceManagers = map[string][]string{
+	"CephCluster":     {"cephCluster"},
+	"CephObjectStore": {"cephObjectStores", "externalResources"},
+	"NooBaa":          {"noobaaSystem"},
+}
+
+// isComponentReported returns whether the components of the given kind are
+// all reported in this reconcile, that is if one of their resource managers
+// succeeded. The components of a kind that no resource manager of this
+// reconcile reports are not kept either.
+func (r *StorageClusterReconciler) isComponentReported(kind string) bool {
+	ran := false
+	for _, name := range componentResourceManagers[kind] {
+		succeeded, found := r.managerResults[name]
+		if succeeded {
+			return true
+		}
+		ran = ran || found
+	}
+	return !ran
+}
+
+// setComponentsStatus writes the components recorded in this reconcile to the
+// status. The components whose resource managers failed or were skipped keep
+// their previous status. The transition times of the phases and conditions
+// that did not change are kept.
+func (r *StorageClusterReconciler) setComponentsStatus(sc *ocsv1.StorageCluster) {
+	now := metav1.Now()
+	components := make([]ocsv1.ComponentStatus, 0, len(r.components))
+	for _, previous := range sc.Status.Components {
+		if r.isComponentReported(previous.Kind) {
+			continue
+		}
+		found := false
+		for _, component := range r.components {
+			if component.Kind == previous.Kind && component.Name == previous.Name {
+				found = true
+			}
+		}
+		if !found {
+			components = append(components, previous)
+		}
+	}
+	for _, component := range r.components {
+		component.LastTransitionTime = now
+		var previous *ocsv1.ComponentStatus
+		for i := range sc.Status.Components {
+			if sc.Status.Components[i].Kind == component.Kind && sc.Status.Components[i].Name == component.Name {
+				previous = &sc.Status.Components[i]
+			}
+		}
+		conditions := []conditionsv1.Condition{}
+		if previous != nil {
+			if previous.Phase == component.Phase {
+				component.LastTransitionTime = previous.LastTransitionTime
+			}
+			// only the conditions that are still reported are kept
+			for _, condition := range previous.Conditions {
+				if conditionsv1.FindStatusCondition(component.Conditions, condition.Type) != nil {
+					conditions = append(conditions, condition)
+				}
+			}
+		}
+		for _, condition := range component.Conditions {
+			conditionsv1.SetStatusCondition(&conditions, condition)
+		}
+		if len(conditions) == 0 {
+			conditions = nil
+		}
+		component.Conditions = conditions
+		components = append(components, component)
+	}
+	sc.Status.Components = components
+}
@@ -0,0 +1,92 @@
+package storagecluster
+
+import (
+	"testing"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetComponentsStatus(t *testing.T) {
+	past := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	progressing := conditionsv1.Condition{
+		Type:    conditionsv1.ConditionProgressing,
+		Status:  corev1.ConditionTrue,
+		Reason:  "NoobaaInitializing",
+		Message: "Waiting on Nooba instance to finish initialization",
+	}
+	sc := &api.StorageCluster{}
+	sc.Status.Components = []api.ComponentStatus{
+		{
+			Kind:               "CephCluster",
+			Name:               "ocsinit-cephcluster",
+			Phase:              "Created",
+			LastTransitionTime: past,
+		},
+		{
+			Kind:  "NooBaa",
+			Name:  "noobaa",
+			Phase: "Creating",
+			Conditions: []conditionsv1.Condition{{
+				Type:               progressing.Type,
+				Status:             progressing.Status,
+				Reason:             progressing.Reason,
+				Message:            progressing.Message,
+				LastTransitionTime: past,
+			}},
+			LastTransitionTime: past,
+		},
+		{
+			Kind:  "CephObjectStore",
+			Name:  "removed",
+			Phase: "Ready",
+		},
+	}
+
+	reconciler := &StorageClusterReconciler{}
+	reconciler.setComponentStatus("CephCluster", "ocsinit-cephcluster", "Created", nil)
+	reconciler.setComponentStatus("NooBaa", "noobaa", "Configuring", []conditionsv1.Condition{progressing})
+	reconciler.setComponentsStatus(sc)
+
+	// the components that are no longer reported are removed
+	assert.Len(t, sc.Status.Components, 2)
+	cephCluster := sc.Status.Components[0]
+	assert.Equal(t, past, cephCluster.LastTransitionTime)
+	assert.Empty(t, cephCluster.Conditions)
+
+	// the phase changed, but the condition did not
+	noobaa := sc.Status.Components[1]
+	assert.Equal(t, "Configuring", noobaa.Phase)
+	assert.NotEqual(t, past, noobaa.LastTransitionTime)
+	assert.Equal(t, progressing.Message, noobaa.Message)
+	if assert.Len(t, noobaa.Conditions, 1) {
+		assert.Equal(t, past, noobaa.Conditions[0].LastTransitionTime)
+	}
+
+	// the components of a resource manager that failed keep their status
+	sc.Status.Components = append(sc.Status.Components, api.ComponentStatus{
+		Kind:  "CephObjectStore",
+		Name:  "ocsinit-cephobjectstore",
+		Phase: "Connected",
+	})
+	reconciler = &StorageClusterReconciler{
+		managerResults: map[string]bool{"cephCluster": true, "cephObjectStores": false, "noobaaSystem": false},
+	}
+	reconciler.setComponentStatus("CephCluster", "ocsinit-cephcluster", "Created", nil)
+	reconciler.setComponentsStatus(sc)
+	assert.Len(t, sc.Status.Components, 3)
+	kept := map[string]string{}
+	for _, component := range sc.Status.Components {
+		kept[component.Kind] = component.Phase
+	}
+	assert.Equal(t, map[string]string{"CephCluster": "Created", "NooBaa": "Configuring", "CephObjectStore": "Connected"}, kept)
+
+	// and are removed once it succeeds without reporting them
+	reconciler.managerResults["cephObjectStores"] = true
+	reconciler.setComponentsStatus(sc)
+	assert.Len(t, sc.Status.Components, 2)
+}
@@ -0,0 +1,40 @@
+package storagecluster
+
+import (
+	"fmt"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+)
+
+// newErasureCodedPoolSpec returns the spec of an erasure coded data pool that
+// spreads its chunks across the failure domain of the StorageCluster
+func newErasureCodedPoolSpec(initData *ocsv1.StorageCluster, ec *ocsv1.ErasureCodedPoolSpec) cephv1.PoolSpec {
+	return cephv1.PoolSpec{
+		FailureDomain: determineFailureDomain(initData),
+		ErasureCoded: cephv1.ErasureCodedSpec{
+			DataChunks:   ec.DataChunks,
+			CodingChunks: ec.CodingChunks,
+		},
+	}
+}
+
+// verifyErasureCodedFailureDomains makes sure the node topology has a failure
+// domain for every chunk of the given erasure coded pool. Ceph cannot place
+// the chunks otherwise, and the pool would never become active.
+func verifyErasureCodedFailureDomains(initData *ocsv1.StorageCluster, ec *ocsv1.ErasureCodedPoolSpec) error {
+	if ec == nil {
+		return nil
+	}
+	failureDomain := determineFailureDomain(initData)
+	var values []string
+	if initData.Status.NodeTopologies != nil {
+		_, values = initData.Status.NodeTopologies.GetKeyValues(failureDomain)
+	}
+	chunks := ec.DataChunks + ec.CodingChunks
+	if uint(len(values)) < chunks {
+		return fmt.Errorf("an erasure coded pool with %d data and %d coding chunks needs %d failure domains of type %q, found %d",
+			ec.DataChunks, ec.CodingChunks, chunks, failureDomain, len(values))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package storagecluster
+
+import (
+	"testing"
+
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+)
+
+func TestErasureCodedDataPools(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	ec := &api.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}
+	sc.Spec.ManagedResources.CephFilesystems.ErasureCoded = ec
+	sc.Spec.ManagedResources.CephObjectStores.ErasureCoded = ec
+	reconciler := createFakeStorageClusterReconciler(t)
+
+	expectedPool := cephv1.PoolSpec{
+		FailureDomain: "zone",
+		ErasureCoded:  cephv1.ErasureCodedSpec{DataChunks: 2, CodingChunks: 1},
+	}
+
+	cephFilesystems, err := reconciler.newCephFilesystemInstances(sc)
+	assert.NoError(t, err)
+	fs := cephFilesystems[0]
+	assert.Equal(t, cephv1.ReplicatedSpec{Size: 3}, fs.Spec.MetadataPool.Replicated)
+	assert.Equal(t, 2, len(fs.Spec.DataPools))
+	assert.Equal(t, cephv1.ReplicatedSpec{Size: 3}, fs.Spec.DataPools[0].Replicated)
+	assert.Equal(t, expectedPool, fs.Spec.DataPools[1])
+
+	cephObjectStores, err := reconciler.newCephObjectStoreInstances(sc)
+	assert.NoError(t, err)
+	assert.Equal(t, cephv1.ReplicatedSpec{Size: 3}, cephObjectStores[0].Spec.MetadataPool.Replicated)
+	assert.Equal(t, expectedPool, cephObjectStores[0].Spec.DataPool)
+
+	scc := newCephFilesystemStorageClassConfiguration(sc)
+	assert.Equal(t, "ocsinit-cephfilesystem-data1", scc.storageClass.Parameters["pool"])
+}
+
+func TestVerifyErasureCodedFailureDomains(t *testing.T) {
+	cases := []struct {
+		label       string
+		ec          *api.ErasureCodedPoolSpec
+		expectError bool
+	}{
+		{
+			label:       "case 1: replicated pool",
+			ec:          nil,
+			expectError: false,
+		},
+		{
+			label:       "case 2: a zone for every chunk",
+			ec:          &api.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1},
+			expectError: false,
+		},
+		{
+			label:       "case 3: not enough zones",
+			ec:          &api.ErasureCodedPoolSpec{DataChunks: 4, CodingChunks: 2},
+			expectError: true,
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		err := verifyErasureCodedFailureDomains(sc, c.ec)
+		if c.expectError {
+			assert.Errorf(t, err, "[%s]: expected an error", c.label)
+		} else {
+			assert.NoErrorf(t, err, "[%s]: unexpected error", c.label)
+		}
+	}
+}
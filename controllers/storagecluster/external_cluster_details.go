@@ -0,0 +1,464 @@
+package storagecluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// externalClusterDetailsV1 is the version of the external cluster details
+	// exported as a list of resources, either bare as before they were
+	// versioned or along with the version
+	externalClusterDetailsV1 = "v1"
+	// externalClusterDetailsV2 is the version of the external cluster details
+	// exported in the typed schema of ExternalClusterDetailsV2
+	externalClusterDetailsV2 = "v2"
+)
+
+var (
+	// supportedExternalClusterDetailsVersions are the schema versions of the
+	// external cluster details that can be read
+	supportedExternalClusterDetailsVersions = []string{externalClusterDetailsV1, externalClusterDetailsV2}
+
+	// supportedExternalResourceKinds are the kinds of the resources of the
+	// external cluster details
+	supportedExternalResourceKinds = []string{"CephCluster", "ConfigMap", "Secret", "StorageClass"}
+
+	// cephPoolNameRegexp matches the pool and filesystem names created by the
+	// Ceph tools
+	cephPoolNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	// cephFSIDRegexp matches the UUID of a Ceph cluster
+	cephFSIDRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// ExternalClusterDetails is the versioned export of an external Ceph cluster,
+// that is stored in the external cluster details secret. A bare list of
+// resources is read as version v1. The resources of the later versions are
+// generated from their typed schema.
+type ExternalClusterDetails struct {
+	Version   string             `json:"version"`
+	Resources []ExternalResource `json:"resources,omitempty"`
+
+	// bare is set for the details exported as a bare list of resources
+	bare bool
+	// v2 is the typed export the resources of version v2 are generated from
+	v2 *ExternalClusterDetailsV2
+}
+
+// externalValueValidator returns the problems of a value of the external
+// cluster details, or nil if it is valid
+type externalValueValidator func(value string) []string
+
+// externalResourceSchema describes the data of a resource of the external
+// cluster details
+type externalResourceSchema struct {
+	// required resources must be part of the external cluster details
+	required bool
+	// keys maps the keys the data must contain to the validation of their
+	// values
+	keys map[string]externalValueValidator
+	// optionalKeys maps the keys the data may contain to the validation of
+	// their values
+	optionalKeys map[string]externalValueValidator
+}
+
+// externalResourceSchemas holds the schemas of the resources of the external
+// cluster details by kind and name. The data of the resources without a schema
+// is passed on as it is.
+var externalResourceSchemas = map[string]map[string]externalResourceSchema{
+	"ConfigMap": {
+		"rook-ceph-mon-endpoints": {
+			required: true,
+			keys: map[string]externalValueValidator{
+				"data":     validateMonEndpoints,
+				"maxMonId": validateInteger,
+			},
+			optionalKeys: map[string]externalValueValidator{
+				"mapping": validateJSON,
+			},
+		},
+	},
+	"Secret": {
+		"rook-ceph-mon": {
+			keys: map[string]externalValueValidator{
+				"fsid":         validateCephFSID,
+				"admin-secret": validateNotEmpty,
+				"mon-secret":   validateNotEmpty,
+			},
+		},
+		"rook-ceph-operator-creds": {
+			keys: map[string]externalValueValidator{
+				"userID":  validateNotEmpty,
+				"userKey": validateNotEmpty,
+			},
+		},
+		"rook-csi-rbd-node": {
+			required: true,
+			keys: map[string]externalValueValidator{
+				"userID":  validateNotEmpty,
+				"userKey": validateNotEmpty,
+			},
+		},
+		"rook-csi-rbd-provisioner": {
+			required: true,
+			keys: map[string]externalValueValidator{
+				"userID":  validateNotEmpty,
+				"userKey": validateNotEmpty,
+			},
+		},
+		"rook-csi-cephfs-node": {
+			required: true,
+			keys: map[string]externalValueValidator{
+				"adminID":  validateNotEmpty,
+				"adminKey": validateNotEmpty,
+			},
+		},
+		"rook-csi-cephfs-provisioner": {
+			required: true,
+			keys: map[string]externalValueValidator{
+				"adminID":  validateNotEmpty,
+				"adminKey": validateNotEmpty,
+			},
+		},
+	},
+	"StorageClass": {
+		cephRbdStorageClassName: {
+			keys: map[string]externalValueValidator{
+				"pool": validateCephPoolName,
+			},
+			optionalKeys: map[string]externalValueValidator{
+				externalRadosNamespaceKey: validateCephPoolName,
+			},
+		},
+		cephFsStorageClassName: {
+			keys: map[string]externalValueValidator{
+				"fsName": validateCephPoolName,
+				"pool":   validateCephPoolName,
+			},
+			optionalKeys: map[string]externalValueValidator{
+				externalSubvolumeGroupKey: validateCephPoolName,
+			},
+		},
+		cephRgwStorageClassName: {
+			keys: map[string]externalValueValidator{
+				externalCephRgwEndpointKey: validateRGWEndpoints,
+			},
+			optionalKeys: map[string]externalValueValidator{
+				externalCephRgwCABundleSecretKey: validateSecretName,
+			},
+		},
+	},
+	"CephCluster": {
+		"monitoring-endpoint": {
+			required: true,
+			keys: map[string]externalValueValidator{
+				externalMonitoringEndpointKey: validateMonitoringEndpoints,
+				externalMonitoringPortKey:     validatePort,
+			},
+		},
+	},
+}
+
+// getExternalResourceSchema returns the schema of a resource of the external
+// cluster details. The additional RBD pools and CephFS filesystems share the
+// schema of the first one.
+func getExternalResourceSchema(kind, name string) (externalResourceSchema, bool) {
+	if kind == "StorageClass" {
+		if isExternalRBDStorageClass(name) {
+			name = cephRbdStorageClassName
+		} else if isExternalCephFSStorageClass(name) {
+			name = cephFsStorageClassName
+		}
+	}
+	schema, ok := externalResourceSchemas[kind][name]
+	return schema, ok
+}
+
+// unmarshalExternalClusterDetails reads the external cluster details, either
+// versioned or as a bare list of resources
+func unmarshalExternalClusterDetails(data []byte) (*ExternalClusterDetails, error) {
+	details := &ExternalClusterDetails{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		details.Version = externalClusterDetailsV1
+		details.bare = true
+		err := json.Unmarshal(data, &details.Resources)
+		return details, err
+	}
+	if err := json.Unmarshal(data, details); err != nil {
+		return details, err
+	}
+	if details.Version == externalClusterDetailsV2 {
+		v2, err := unmarshalExternalClusterDetailsV2(data)
+		if err != nil {
+			return details, err
+		}
+		details.v2 = v2
+		details.Resources = v2.resources()
+	}
+	return details, nil
+}
+
+// validateExternalClusterDetails returns every missing or malformed field of
+// the external cluster details
+func validateExternalClusterDetails(details *ExternalClusterDetails, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if !contains(supportedExternalClusterDetailsVersions, details.Version) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("version"), details.Version, supportedExternalClusterDetailsVersions))
+		return allErrs
+	}
+	if details.v2 != nil {
+		return validateExternalClusterDetailsV2(details.v2, fldPath)
+	}
+
+	resourcesPath := fldPath.Child("resources")
+	if details.bare {
+		resourcesPath = fldPath
+	}
+	found := map[string]bool{}
+	for i, resource := range details.Resources {
+		resourcePath := resourcesPath.Index(i)
+		if !contains(supportedExternalResourceKinds, resource.Kind) {
+			allErrs = append(allErrs, field.NotSupported(resourcePath.Child("kind"), resource.Kind, supportedExternalResourceKinds))
+			continue
+		}
+		if resource.Name == "" {
+			allErrs = append(allErrs, field.Required(resourcePath.Child("name"), fmt.Sprintf("the %s has no name", resource.Kind)))
+			continue
+		}
+		if found[resource.Kind+"/"+resource.Name] {
+			allErrs = append(allErrs, field.Duplicate(resourcePath.Child("name"), resource.Name))
+			continue
+		}
+		found[resource.Kind+"/"+resource.Name] = true
+
+		schema, ok := getExternalResourceSchema(resource.Kind, resource.Name)
+		if resource.Kind == "StorageClass" {
+			// the name of the StorageClass is derived from the name of the entry
+			for _, msg := range validation.IsDNS1123Subdomain(resource.Name) {
+				allErrs = append(allErrs, field.Invalid(resourcePath.Child("name"), resource.Name, msg))
+			}
+			if !ok {
+				allErrs = append(allErrs, field.Invalid(resourcePath.Child("name"), resource.Name,
+					fmt.Sprintf("must be %s, %s[-<suffix>] or %s[-<suffix>]", cephRgwStorageClassName,
+						cephRbdStorageClassName, cephFsStorageClassName)))
+				continue
+			}
+		}
+		if !ok {
+			continue
+		}
+		dataPath := resourcePath.Child("data")
+		for _, key := range sortedValidatorKeys(schema.keys) {
+			value, ok := resource.Data[key]
+			if !ok {
+				allErrs = append(allErrs, field.Required(dataPath.Key(key),
+					fmt.Sprintf("the %s %s needs the %s", resource.Kind, resource.Name, key)))
+				continue
+			}
+			allErrs = append(allErrs, validateExternalValue(schema.keys[key], value, dataPath.Key(key))...)
+		}
+		for _, key := range sortedValidatorKeys(schema.optionalKeys) {
+			if value, ok := resource.Data[key]; ok {
+				allErrs = append(allErrs, validateExternalValue(schema.optionalKeys[key], value, dataPath.Key(key))...)
+			}
+		}
+	}
+
+	for _, kind := range supportedExternalResourceKinds {
+		missing := []string{}
+		for name, schema := range externalResourceSchemas[kind] {
+			if schema.required && !found[kind+"/"+name] {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+		for _, name := range missing {
+			allErrs = append(allErrs, field.Required(resourcesPath, fmt.Sprintf("the %s %s is missing", kind, name)))
+		}
+	}
+	return allErrs
+}
+
+func validateExternalValue(validator externalValueValidator, value string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, msg := range validator(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+func validateNotEmpty(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return []string{"must not be empty"}
+	}
+	return nil
+}
+
+func validateInteger(value string) []string {
+	if _, err := strconv.Atoi(value); err != nil {
+		return []string{"must be an integer"}
+	}
+	return nil
+}
+
+func validateJSON(value string) []string {
+	if !json.Valid([]byte(value)) {
+		return []string{"must be valid JSON"}
+	}
+	return nil
+}
+
+func validateCephFSID(value string) []string {
+	if !cephFSIDRegexp.MatchString(value) {
+		return []string{"must be the UUID of the Ceph cluster"}
+	}
+	return nil
+}
+
+func validateCephPoolName(value string) []string {
+	if !cephPoolNameRegexp.MatchString(value) {
+		return []string{"must consist of alphanumeric characters, '_', '.' or '-'"}
+	}
+	return nil
+}
+
+// validateHost accepts an IP address or a DNS subdomain
+func validateHost(value string) []string {
+	if net.ParseIP(value) != nil {
+		return nil
+	}
+	if len(validation.IsDNS1123Subdomain(value)) != 0 {
+		return []string{"must be an IP address or a hostname"}
+	}
+	return nil
+}
+
+func validatePort(value string) []string {
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return []string{"must be a port number"}
+	}
+	return validation.IsValidPortNum(port)
+}
+
+// validateHostPort accepts a host and port, and an optional http(s) scheme
+func validateHostPort(value string) []string {
+	hostPort := strings.TrimPrefix(strings.TrimPrefix(value, "http://"), "https://")
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return []string{"must be a host and port"}
+	}
+	return append(validateHost(host), validatePort(port)...)
+}
+
+// validateRGWEndpoints accepts the comma separated RGW endpoints of the form
+// [http[s]://]<host>:<port> with the same scheme and port
+func validateRGWEndpoints(value string) []string {
+	rgwEndpoints, err := parseExternalRGWEndpoints(value)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if len(rgwEndpoints) == 0 {
+		return []string{"must list at least one rgw endpoint"}
+	}
+	problems := []string{}
+	for _, rgwEndpoint := range rgwEndpoints {
+		for _, problem := range validateHost(rgwEndpoint.host) {
+			problems = append(problems, fmt.Sprintf("rgw endpoint %q %s", rgwEndpoint, problem))
+		}
+	}
+	return problems
+}
+
+func validateSecretName(value string) []string {
+	return validation.IsDNS1123Subdomain(value)
+}
+
+// validateMonEndpoints accepts the comma separated mons of the form
+// <name>=<host>:<port>
+func validateMonEndpoints(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return []string{"must list at least one mon endpoint"}
+	}
+	problems := []string{}
+	for _, mon := range strings.Split(value, ",") {
+		nameEndpoint := strings.SplitN(mon, "=", 2)
+		if len(nameEndpoint) != 2 || nameEndpoint[0] == "" {
+			problems = append(problems, fmt.Sprintf("mon %q must be of the form <name>=<host>:<port>", mon))
+			continue
+		}
+		for _, problem := range validateHostPort(nameEndpoint[1]) {
+			problems = append(problems, fmt.Sprintf("mon %q %s", nameEndpoint[0], problem))
+		}
+	}
+	return problems
+}
+
+// sortedValidatorKeys returns the sorted keys of the given validators
+func sortedValidatorKeys(validators map[string]externalValueValidator) []string {
+	keys := make([]string, 0, len(validators))
+	for k := range validators {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateExternalClusterConfig validates the external cluster details before
+// any resource is created from them, and sets the ExternalClusterConfigValid
+// condition. An event is emitted for every invalid field when the result of
+// the validation changes.
+func (r *StorageClusterReconciler) validateExternalClusterConfig(sc *ocsv1.StorageCluster) error {
+	fldPath := field.NewPath("secret").Key(externalClusterDetailsSecret).Child("data").Key(externalClusterDetailsKey)
+	allErrs := field.ErrorList{}
+
+	found, err := r.retrieveSecret(externalClusterDetailsSecret, sc)
+	if errors.IsNotFound(err) {
+		allErrs = append(allErrs, field.Required(fldPath,
+			fmt.Sprintf("the external cluster details secret %q is missing", externalClusterDetailsSecret)))
+	} else if err != nil {
+		return err
+	} else if details, err := unmarshalExternalClusterDetails(found.Data[externalClusterDetailsKey]); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", fmt.Sprintf("could not parse the external cluster details: %v", err)))
+	} else {
+		allErrs = validateExternalClusterDetails(details, fldPath)
+	}
+
+	condition := conditionsv1.Condition{
+		Type:    ocsv1.ConditionExternalClusterConfigValid,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.ExternalClusterConfigValid,
+		Message: ocsv1.ExternalClusterConfigValidMessage,
+	}
+	if len(allErrs) != 0 {
+		err = allErrs.ToAggregate()
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = ocsv1.ExternalClusterConfigInvalid
+		condition.Message = err.Error()
+	}
+	previous := conditionsv1.FindStatusCondition(sc.Status.Conditions, ocsv1.ConditionExternalClusterConfigValid)
+	if previous == nil || previous.Status != condition.Status || previous.Message != condition.Message {
+		for _, fieldErr := range allErrs {
+			r.recorder.Event(sc, corev1.EventTypeWarning, ocsv1.ExternalClusterConfigInvalid, fieldErr.Error())
+		}
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, condition)
+	if len(allErrs) != 0 {
+		return err
+	}
+	return nil
+}
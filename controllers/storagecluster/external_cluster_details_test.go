@@ -0,0 +1,341 @@
+package storagecluster
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestValidateExternalClusterDetails(t *testing.T) {
+	validResources := func() []ExternalResource {
+		return []ExternalResource{
+			{
+				Kind: "ConfigMap",
+				Name: "rook-ceph-mon-endpoints",
+				Data: map[string]string{"data": "a=10.20.30.40:6789,b=mon-b.example.com:6789", "maxMonId": "1", "mapping": "{}"},
+			},
+			{
+				Kind: "Secret",
+				Name: "rook-ceph-mon",
+				Data: map[string]string{"fsid": "5b1c9a44-6e5c-4b1e-9a1f-2a6a7c5d3e21", "admin-secret": "admin-secret", "mon-secret": "mon-secret"},
+			},
+			{
+				Kind: "Secret",
+				Name: "rook-csi-rbd-node",
+				Data: map[string]string{"userID": "csi-rbd-node", "userKey": "someUserKeyRBD=="},
+			},
+			{
+				Kind: "StorageClass",
+				Name: "ceph-rbd",
+				Data: map[string]string{"pool": "replicapool"},
+			},
+			{
+				Kind: "StorageClass",
+				Name: "ceph-rgw",
+				Data: map[string]string{"endpoint": "https://rgw.example.com:443,https://10.20.30.42:443", "caBundleSecret": "rgw-ca"},
+			},
+			{
+				Kind: "CephCluster",
+				Name: "monitoring-endpoint",
+				Data: map[string]string{"MonitoringEndpoint": "10.20.30.41,[fd00::41],mgr-b.example.com", "MonitoringPort": "9283"},
+			},
+			{
+				Kind: "Secret",
+				Name: "some-other-secret",
+				Data: map[string]string{"anything": ""},
+			},
+			{
+				Kind: "Secret",
+				Name: "rook-csi-rbd-provisioner",
+				Data: map[string]string{"userID": "csi-rbd-provisioner", "userKey": "someUserKeyRBD=="},
+			},
+			{
+				Kind: "Secret",
+				Name: "rook-csi-cephfs-node",
+				Data: map[string]string{"adminID": "csi-cephfs-node", "adminKey": "someAdminKeyCephFS=="},
+			},
+			{
+				Kind: "Secret",
+				Name: "rook-csi-cephfs-provisioner",
+				Data: map[string]string{"adminID": "csi-cephfs-provisioner", "adminKey": "someAdminKeyCephFS=="},
+			},
+		}
+	}
+
+	cases := []struct {
+		label          string
+		blob           func() []byte
+		expectedFields []string
+	}{
+		{
+			label: "case 1: valid unversioned details",
+			blob: func() []byte {
+				blob, _ := json.Marshal(validResources())
+				return blob
+			},
+		},
+		{
+			label: "case 2: valid versioned details",
+			blob: func() []byte {
+				blob, _ := json.Marshal(ExternalClusterDetails{Version: externalClusterDetailsV1, Resources: validResources()})
+				return blob
+			},
+		},
+		{
+			label: "case 3: unsupported version",
+			blob: func() []byte {
+				blob, _ := json.Marshal(ExternalClusterDetails{Version: "v99", Resources: validResources()})
+				return blob
+			},
+			expectedFields: []string{"details.version"},
+		},
+		{
+			label: "case 4: every missing or malformed field is reported",
+			blob: func() []byte {
+				resources := validResources()
+				resources[0].Data["data"] = "a=10.20.30.40,b=10.20.30.41:6789"
+				resources[0].Data["maxMonId"] = "one"
+				resources[1].Data["fsid"] = "not-a-uuid"
+				delete(resources[2].Data, "userKey")
+				resources[3].Data["pool"] = "replica pool"
+				resources[4].Data["endpoint"] = "https://rgw.example.com:443,http://10.20.30.42:443"
+				resources[4].Data["caBundleSecret"] = "RGW CA"
+				delete(resources[5].Data, "MonitoringEndpoint")
+				resources[5].Data["MonitoringPort"] = "70000"
+				resources = append(resources,
+					ExternalResource{Kind: "Deployment", Name: "some-deployment"},
+					ExternalResource{Kind: "Secret", Name: "rook-csi-rbd-node"})
+				blob, _ := json.Marshal(resources)
+				return blob
+			},
+			expectedFields: []string{
+				"details[0].data[data]",
+				"details[0].data[maxMonId]",
+				"details[1].data[fsid]",
+				"details[2].data[userKey]",
+				"details[3].data[pool]",
+				"details[4].data[endpoint]",
+				"details[4].data[caBundleSecret]",
+				"details[5].data[MonitoringEndpoint]",
+				"details[5].data[MonitoringPort]",
+				"details[10].kind",
+				"details[11].name",
+			},
+		},
+		{
+			label: "case 5: additional pools and filesystems",
+			blob: func() []byte {
+				resources := append(validResources(),
+					ExternalResource{Kind: "StorageClass", Name: "ceph-rbd-tenant-a", Data: map[string]string{"pool": "replicapool", "radosNamespace": "tenant a"}},
+					ExternalResource{Kind: "StorageClass", Name: "cephfs-tenant-a", Data: map[string]string{"fsName": "myfs", "pool": "myfs-data0", "subvolumeGroup": "tenant-a"}},
+					ExternalResource{Kind: "StorageClass", Name: "cephfs-Tenant-B", Data: map[string]string{"fsName": "myfs"}},
+					ExternalResource{Kind: "StorageClass", Name: "ceph-nfs", Data: map[string]string{}})
+				blob, _ := json.Marshal(resources)
+				return blob
+			},
+			expectedFields: []string{
+				"details[10].data[radosNamespace]",
+				"details[12].name",
+				"details[12].data[pool]",
+				"details[13].name",
+			},
+		},
+		{
+			label: "case 6: missing mon endpoints",
+			blob: func() []byte {
+				blob, _ := json.Marshal(validResources()[1:])
+				return blob
+			},
+			expectedFields: []string{"details"},
+		},
+		{
+			label: "case 7: missing CSI secrets and monitoring endpoint",
+			blob: func() []byte {
+				resources := validResources()
+				blob, _ := json.Marshal(append(resources[:5], resources[6]))
+				return blob
+			},
+			expectedFields: []string{"details", "details", "details", "details"},
+		},
+		{
+			label: "case 8: fields of versioned v1 details",
+			blob: func() []byte {
+				resources := validResources()
+				resources[3].Data["pool"] = "replica pool"
+				blob, _ := json.Marshal(ExternalClusterDetails{Version: externalClusterDetailsV1, Resources: resources[1:]})
+				return blob
+			},
+			expectedFields: []string{"details.resources[2].data[pool]", "details.resources"},
+		},
+		{
+			label: "case 9: valid v2 details",
+			blob: func() []byte {
+				blob, _ := json.Marshal(validDetailsV2())
+				return blob
+			},
+		},
+		{
+			label: "case 10: every missing or malformed field of v2 details is reported",
+			blob: func() []byte {
+				details := validDetailsV2()
+				details.Mons[0].Endpoint = "10.20.30.40"
+				details.Mons[1].Name = "a"
+				details.MaxMonID = -1
+				details.Cluster.FSID = "not-a-uuid"
+				details.CSI.RBDNode.Key = ""
+				details.CSI.CephFSProvisioner.ID = ""
+				details.RBDPools = append(details.RBDPools, ExternalRBDPool{Pool: "replica pool"})
+				details.CephFilesystems[1].Suffix = "Tenant-B"
+				details.CephFilesystems[1].SubvolumeGroup = "tenant b"
+				details.RGW.Endpoints = append(details.RGW.Endpoints, "http://10.20.30.42:443")
+				details.Monitoring.Port = 70000
+				blob, _ := json.Marshal(details)
+				return blob
+			},
+			expectedFields: []string{
+				"details.mons[0].endpoint",
+				"details.mons[1].name",
+				"details.maxMonId",
+				"details.cluster.fsid",
+				"details.csi.rbdNode.key",
+				"details.csi.cephfsProvisioner.id",
+				"details.rbdPools[1].suffix",
+				"details.rbdPools[1].pool",
+				"details.cephFilesystems[1].suffix",
+				"details.cephFilesystems[1].subvolumeGroup",
+				"details.rgw.endpoints",
+				"details.monitoring.port",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Log(c.label)
+		details, err := unmarshalExternalClusterDetails(c.blob())
+		assert.NoError(t, err)
+		allErrs := validateExternalClusterDetails(details, field.NewPath("details"))
+		actualFields := []string{}
+		for _, fieldErr := range allErrs {
+			actualFields = append(actualFields, fieldErr.Field)
+		}
+		assert.ElementsMatchf(t, c.expectedFields, actualFields, "[%s]: unexpected errors: %v", c.label, allErrs)
+	}
+
+	// the resources generated from v2 details are the ones of v1
+	blob, _ := json.Marshal(validDetailsV2())
+	details, err := unmarshalExternalClusterDetails(blob)
+	assert.NoError(t, err)
+	assert.Empty(t, validateExternalClusterDetails(&ExternalClusterDetails{Version: externalClusterDetailsV1, Resources: details.Resources}, field.NewPath("details")))
+	storageClasses := []string{}
+	for _, resource := range details.Resources {
+		if resource.Kind == "StorageClass" {
+			storageClasses = append(storageClasses, resource.Name)
+		}
+	}
+	assert.ElementsMatch(t, []string{"ceph-rbd", "cephfs", "cephfs-tenant-a", "ceph-rgw"}, storageClasses)
+
+	// unknown fields of v2 details are rejected
+	_, err = unmarshalExternalClusterDetails([]byte(`{"version":"v2","monitoring":{"endpoint":"10.20.30.41"}}`))
+	assert.Error(t, err)
+}
+
+// validDetailsV2 returns valid external cluster details of version v2
+func validDetailsV2() *ExternalClusterDetailsV2 {
+	return &ExternalClusterDetailsV2{
+		Version:  externalClusterDetailsV2,
+		Mons:     []ExternalMon{{Name: "a", Endpoint: "10.20.30.40:6789"}, {Name: "b", Endpoint: "mon-b.example.com:6789"}},
+		MaxMonID: 1,
+		Cluster: &ExternalCephClusterKeys{
+			FSID:        "5b1c9a44-6e5c-4b1e-9a1f-2a6a7c5d3e21",
+			AdminSecret: "admin-secret",
+			MonSecret:   "mon-secret",
+		},
+		CSI: ExternalCSIUsers{
+			RBDNode:           ExternalCephUser{ID: "csi-rbd-node", Key: "someUserKeyRBD=="},
+			RBDProvisioner:    ExternalCephUser{ID: "csi-rbd-provisioner", Key: "someUserKeyRBD=="},
+			CephFSNode:        ExternalCephUser{ID: "csi-cephfs-node", Key: "someAdminKeyCephFS=="},
+			CephFSProvisioner: ExternalCephUser{ID: "csi-cephfs-provisioner", Key: "someAdminKeyCephFS=="},
+		},
+		RBDPools: []ExternalRBDPool{{Pool: "replicapool"}},
+		CephFilesystems: []ExternalCephFilesystem{
+			{FSName: "myfs", Pool: "myfs-data0"},
+			{Suffix: "tenant-a", FSName: "myfs", Pool: "myfs-data0", SubvolumeGroup: "tenant-a"},
+		},
+		RGW:        &ExternalRGW{Endpoints: []string{"https://rgw.example.com:443"}, CABundleSecret: "rgw-ca"},
+		Monitoring: ExternalMonitoring{Endpoints: []string{"10.20.30.41", "mgr-b.example.com"}, Port: 9283},
+	}
+}
+
+func TestExternalClusterConfigValidCondition(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "ocsinit",
+			Namespace: "",
+		},
+	}
+	extResources := []ExternalResource{
+		{
+			Kind: "ConfigMap",
+			Name: "rook-ceph-mon-endpoints",
+			Data: map[string]string{"data": "a=10.20.30.40:6789", "maxMonId": "0"},
+		},
+		{
+			Kind: "Secret",
+			Name: "rook-csi-rbd-node",
+			Data: map[string]string{"userID": "csi-rbd-node"},
+		},
+	}
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, withRequiredExternalResources(extResources))
+	_, err := reconciler.Reconcile(request)
+	assert.Error(t, err)
+
+	sc := &api.StorageCluster{}
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, sc)
+	assert.NoError(t, err)
+	condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterConfigValid)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, api.ExternalClusterConfigInvalid, condition.Reason)
+		assert.Contains(t, condition.Message, "[1].data[userKey]")
+	}
+	// nothing is created from invalid details
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rook-ceph-mon-endpoints"}, &corev1.ConfigMap{})
+	assert.True(t, errors.IsNotFound(err), "unexpected ConfigMap: %v", err)
+
+	// the invalid fields are only reported again when they change
+	recorder := reconciler.recorder.(*record.FakeRecorder)
+	assert.Len(t, recorder.Events, 1)
+	<-recorder.Events
+	_, err = reconciler.Reconcile(request)
+	assert.Error(t, err)
+	assert.Len(t, recorder.Events, 0)
+
+	// the condition turns True once the details are fixed
+	extResources[1].Data["userKey"] = "someUserKeyRBD=="
+	extSecret, err := createExternalCephClusterSecret(withRequiredExternalResources(extResources))
+	assert.NoError(t, err)
+	secret := &corev1.Secret{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalClusterDetailsSecret}, secret)
+	assert.NoError(t, err)
+	secret.Data = extSecret.Data
+	err = reconciler.Client.Update(context.TODO(), secret)
+	assert.NoError(t, err)
+
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, sc)
+	assert.NoError(t, err)
+	assert.True(t, conditionsv1.IsStatusConditionTrue(sc.Status.Conditions, api.ConditionExternalClusterConfigValid))
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rook-ceph-mon-endpoints"}, &corev1.ConfigMap{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,297 @@
+package storagecluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ExternalClusterDetailsV2 is the typed export of an external Ceph cluster of
+// version v2. The resources the operator creates are generated from it.
+type ExternalClusterDetailsV2 struct {
+	Version string `json:"version"`
+	// Mons are the mon endpoints of the external cluster
+	Mons     []ExternalMon `json:"mons"`
+	MaxMonID int           `json:"maxMonId"`
+	// Cluster holds the FSID and the keys of the external cluster, if they
+	// are exported
+	Cluster *ExternalCephClusterKeys `json:"cluster,omitempty"`
+	// OperatorUser is the Ceph user of the Rook operator, if it is exported
+	OperatorUser *ExternalCephUser `json:"operatorUser,omitempty"`
+	// CSI holds the Ceph users of the ceph-csi drivers
+	CSI ExternalCSIUsers `json:"csi"`
+	// RBDPools are the pools of the RBD StorageClasses
+	RBDPools []ExternalRBDPool `json:"rbdPools,omitempty"`
+	// CephFilesystems are the filesystems of the CephFS StorageClasses
+	CephFilesystems []ExternalCephFilesystem `json:"cephFilesystems,omitempty"`
+	// RGW is the object store of the external cluster, if any
+	RGW *ExternalRGW `json:"rgw,omitempty"`
+	// Monitoring is the Prometheus exporter of the mgrs
+	Monitoring ExternalMonitoring `json:"monitoring"`
+}
+
+// ExternalMon is a mon of the external cluster
+type ExternalMon struct {
+	Name string `json:"name"`
+	// Endpoint is the <host>:<port> of the mon
+	Endpoint string `json:"endpoint"`
+}
+
+// ExternalCephClusterKeys are the FSID and the keys of the external cluster
+type ExternalCephClusterKeys struct {
+	FSID        string `json:"fsid"`
+	AdminSecret string `json:"adminSecret"`
+	MonSecret   string `json:"monSecret"`
+}
+
+// ExternalCephUser is a Ceph user and its key
+type ExternalCephUser struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+}
+
+// ExternalCSIUsers are the Ceph users of the RBD and CephFS ceph-csi drivers
+type ExternalCSIUsers struct {
+	RBDNode           ExternalCephUser `json:"rbdNode"`
+	RBDProvisioner    ExternalCephUser `json:"rbdProvisioner"`
+	CephFSNode        ExternalCephUser `json:"cephfsNode"`
+	CephFSProvisioner ExternalCephUser `json:"cephfsProvisioner"`
+}
+
+// ExternalRBDPool is the pool of an RBD StorageClass. The StorageClass is
+// named ceph-rbd, or ceph-rbd-<suffix> when a suffix is set.
+type ExternalRBDPool struct {
+	Suffix         string `json:"suffix,omitempty"`
+	Pool           string `json:"pool"`
+	RadosNamespace string `json:"radosNamespace,omitempty"`
+}
+
+// ExternalCephFilesystem is the filesystem of a CephFS StorageClass. The
+// StorageClass is named cephfs, or cephfs-<suffix> when a suffix is set.
+type ExternalCephFilesystem struct {
+	Suffix         string `json:"suffix,omitempty"`
+	FSName         string `json:"fsName"`
+	Pool           string `json:"pool"`
+	SubvolumeGroup string `json:"subvolumeGroup,omitempty"`
+}
+
+// ExternalRGW is the object store of the external cluster
+type ExternalRGW struct {
+	// Endpoints are the [http[s]://]<host>:<port> of the RGWs
+	Endpoints      []string `json:"endpoints"`
+	CABundleSecret string   `json:"caBundleSecret,omitempty"`
+}
+
+// ExternalMonitoring is the Prometheus exporter of the mgrs of the external
+// cluster
+type ExternalMonitoring struct {
+	// Endpoints are the hosts of the mgrs
+	Endpoints []string `json:"endpoints"`
+	Port      int      `json:"port"`
+}
+
+// unmarshalExternalClusterDetailsV2 reads the external cluster details of
+// version v2. Unknown fields are rejected, as they would be ignored otherwise.
+func unmarshalExternalClusterDetailsV2(data []byte) (*ExternalClusterDetailsV2, error) {
+	details := &ExternalClusterDetailsV2{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(details)
+	return details, err
+}
+
+// externalStorageClassName returns the name of the StorageClass entry of an
+// RBD pool or a CephFS filesystem with the given suffix
+func externalStorageClassName(name, suffix string) string {
+	if suffix == "" {
+		return name
+	}
+	return name + "-" + suffix
+}
+
+// resources returns the resources of the external cluster details, as they
+// are exported in version v1
+func (d *ExternalClusterDetailsV2) resources() []ExternalResource {
+	mons := make([]string, 0, len(d.Mons))
+	for _, mon := range d.Mons {
+		mons = append(mons, mon.Name+"="+mon.Endpoint)
+	}
+	cephUser := func(name, idKey, keyKey string, user ExternalCephUser) ExternalResource {
+		return ExternalResource{Kind: "Secret", Name: name, Data: map[string]string{idKey: user.ID, keyKey: user.Key}}
+	}
+
+	resources := []ExternalResource{
+		{
+			Kind: "ConfigMap",
+			Name: externalMonEndpointsConfigMap,
+			Data: map[string]string{
+				"data":     strings.Join(mons, ","),
+				"maxMonId": strconv.Itoa(d.MaxMonID),
+				"mapping":  "{}",
+			},
+		},
+		cephUser("rook-csi-rbd-node", "userID", "userKey", d.CSI.RBDNode),
+		cephUser("rook-csi-rbd-provisioner", "userID", "userKey", d.CSI.RBDProvisioner),
+		cephUser("rook-csi-cephfs-node", "adminID", "adminKey", d.CSI.CephFSNode),
+		cephUser("rook-csi-cephfs-provisioner", "adminID", "adminKey", d.CSI.CephFSProvisioner),
+		{
+			Kind: "CephCluster",
+			Name: "monitoring-endpoint",
+			Data: map[string]string{
+				externalMonitoringEndpointKey: strings.Join(d.Monitoring.Endpoints, ","),
+				externalMonitoringPortKey:     strconv.Itoa(d.Monitoring.Port),
+			},
+		},
+	}
+	if d.Cluster != nil {
+		resources = append(resources, ExternalResource{
+			Kind: "Secret",
+			Name: "rook-ceph-mon",
+			Data: map[string]string{
+				"fsid":         d.Cluster.FSID,
+				"admin-secret": d.Cluster.AdminSecret,
+				"mon-secret":   d.Cluster.MonSecret,
+			},
+		})
+	}
+	if d.OperatorUser != nil {
+		resources = append(resources, cephUser("rook-ceph-operator-creds", "userID", "userKey", *d.OperatorUser))
+	}
+	for _, pool := range d.RBDPools {
+		data := map[string]string{"pool": pool.Pool}
+		if pool.RadosNamespace != "" {
+			data[externalRadosNamespaceKey] = pool.RadosNamespace
+		}
+		resources = append(resources, ExternalResource{
+			Kind: "StorageClass",
+			Name: externalStorageClassName(cephRbdStorageClassName, pool.Suffix),
+			Data: data,
+		})
+	}
+	for _, fs := range d.CephFilesystems {
+		data := map[string]string{"fsName": fs.FSName, "pool": fs.Pool}
+		if fs.SubvolumeGroup != "" {
+			data[externalSubvolumeGroupKey] = fs.SubvolumeGroup
+		}
+		resources = append(resources, ExternalResource{
+			Kind: "StorageClass",
+			Name: externalStorageClassName(cephFsStorageClassName, fs.Suffix),
+			Data: data,
+		})
+	}
+	if d.RGW != nil {
+		data := map[string]string{externalCephRgwEndpointKey: strings.Join(d.RGW.Endpoints, ",")}
+		if d.RGW.CABundleSecret != "" {
+			data[externalCephRgwCABundleSecretKey] = d.RGW.CABundleSecret
+		}
+		resources = append(resources, ExternalResource{Kind: "StorageClass", Name: cephRgwStorageClassName, Data: data})
+	}
+	return resources
+}
+
+// validateExternalClusterDetailsV2 returns every missing or malformed field of
+// the external cluster details of version v2
+func validateExternalClusterDetailsV2(d *ExternalClusterDetailsV2, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	monsPath := fldPath.Child("mons")
+	if len(d.Mons) == 0 {
+		allErrs = append(allErrs, field.Required(monsPath, "must list at least one mon"))
+	}
+	monNames := map[string]bool{}
+	for i, mon := range d.Mons {
+		monPath := monsPath.Index(i)
+		if mon.Name == "" {
+			allErrs = append(allErrs, field.Required(monPath.Child("name"), "the mon has no name"))
+		} else if monNames[mon.Name] {
+			allErrs = append(allErrs, field.Duplicate(monPath.Child("name"), mon.Name))
+		}
+		monNames[mon.Name] = true
+		allErrs = append(allErrs, validateExternalValue(validateHostPort, mon.Endpoint, monPath.Child("endpoint"))...)
+	}
+	if d.MaxMonID < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxMonId"), d.MaxMonID, "must not be negative"))
+	}
+
+	if d.Cluster != nil {
+		clusterPath := fldPath.Child("cluster")
+		allErrs = append(allErrs, validateExternalValue(validateCephFSID, d.Cluster.FSID, clusterPath.Child("fsid"))...)
+		allErrs = append(allErrs, validateExternalRequired(d.Cluster.AdminSecret, clusterPath.Child("adminSecret"))...)
+		allErrs = append(allErrs, validateExternalRequired(d.Cluster.MonSecret, clusterPath.Child("monSecret"))...)
+	}
+	if d.OperatorUser != nil {
+		allErrs = append(allErrs, validateExternalCephUser(*d.OperatorUser, fldPath.Child("operatorUser"))...)
+	}
+	csiPath := fldPath.Child("csi")
+	allErrs = append(allErrs, validateExternalCephUser(d.CSI.RBDNode, csiPath.Child("rbdNode"))...)
+	allErrs = append(allErrs, validateExternalCephUser(d.CSI.RBDProvisioner, csiPath.Child("rbdProvisioner"))...)
+	allErrs = append(allErrs, validateExternalCephUser(d.CSI.CephFSNode, csiPath.Child("cephfsNode"))...)
+	allErrs = append(allErrs, validateExternalCephUser(d.CSI.CephFSProvisioner, csiPath.Child("cephfsProvisioner"))...)
+
+	suffixes := map[string]bool{}
+	for i, pool := range d.RBDPools {
+		poolPath := fldPath.Child("rbdPools").Index(i)
+		allErrs = append(allErrs, validateExternalSuffix(cephRbdStorageClassName, pool.Suffix, suffixes, poolPath.Child("suffix"))...)
+		allErrs = append(allErrs, validateExternalValue(validateCephPoolName, pool.Pool, poolPath.Child("pool"))...)
+		if pool.RadosNamespace != "" {
+			allErrs = append(allErrs, validateExternalValue(validateCephPoolName, pool.RadosNamespace, poolPath.Child("radosNamespace"))...)
+		}
+	}
+	suffixes = map[string]bool{}
+	for i, fs := range d.CephFilesystems {
+		fsPath := fldPath.Child("cephFilesystems").Index(i)
+		allErrs = append(allErrs, validateExternalSuffix(cephFsStorageClassName, fs.Suffix, suffixes, fsPath.Child("suffix"))...)
+		allErrs = append(allErrs, validateExternalValue(validateCephPoolName, fs.FSName, fsPath.Child("fsName"))...)
+		allErrs = append(allErrs, validateExternalValue(validateCephPoolName, fs.Pool, fsPath.Child("pool"))...)
+		if fs.SubvolumeGroup != "" {
+			allErrs = append(allErrs, validateExternalValue(validateCephPoolName, fs.SubvolumeGroup, fsPath.Child("subvolumeGroup"))...)
+		}
+	}
+
+	if d.RGW != nil {
+		rgwPath := fldPath.Child("rgw")
+		allErrs = append(allErrs, validateExternalValue(validateRGWEndpoints, strings.Join(d.RGW.Endpoints, ","), rgwPath.Child("endpoints"))...)
+		if d.RGW.CABundleSecret != "" {
+			allErrs = append(allErrs, validateExternalValue(validateSecretName, d.RGW.CABundleSecret, rgwPath.Child("caBundleSecret"))...)
+		}
+	}
+
+	monitoringPath := fldPath.Child("monitoring")
+	allErrs = append(allErrs, validateExternalValue(validateMonitoringEndpoints, strings.Join(d.Monitoring.Endpoints, ","), monitoringPath.Child("endpoints"))...)
+	for _, msg := range validation.IsValidPortNum(d.Monitoring.Port) {
+		allErrs = append(allErrs, field.Invalid(monitoringPath.Child("port"), d.Monitoring.Port, msg))
+	}
+	return allErrs
+}
+
+func validateExternalRequired(value string, fldPath *field.Path) field.ErrorList {
+	if strings.TrimSpace(value) == "" {
+		return field.ErrorList{field.Required(fldPath, "must not be empty")}
+	}
+	return nil
+}
+
+func validateExternalCephUser(user ExternalCephUser, fldPath *field.Path) field.ErrorList {
+	allErrs := validateExternalRequired(user.ID, fldPath.Child("id"))
+	return append(allErrs, validateExternalRequired(user.Key, fldPath.Child("key"))...)
+}
+
+// validateExternalSuffix validates the suffix of the StorageClass entry of an
+// RBD pool or a CephFS filesystem, whose name must be unique and a valid
+// StorageClass name
+func validateExternalSuffix(name, suffix string, suffixes map[string]bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if suffixes[suffix] {
+		allErrs = append(allErrs, field.Duplicate(fldPath, suffix))
+	}
+	suffixes[suffix] = true
+	for _, msg := range validation.IsDNS1123Subdomain(externalStorageClassName(name, suffix)) {
+		allErrs = append(allErrs, field.Invalid(fldPath, suffix, fmt.Sprintf("the StorageClass name is invalid: %s", msg)))
+	}
+	return allErrs
+}
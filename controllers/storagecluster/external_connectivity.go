@@ -0,0 +1,251 @@
+package storagecluster
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// externalConnectivityCheckInterval is the interval between two
+	// connectivity checks of the endpoints of the external cluster
+	externalConnectivityCheckInterval = time.Minute
+	// externalConnectivityCheckTimeout is the timeout of the connection to an
+	// endpoint of the external cluster
+	externalConnectivityCheckTimeout = 5 * time.Second
+
+	externalEndpointMon = "mon"
+	externalEndpointMgr = "mgr"
+	externalEndpointRGW = "rgw"
+)
+
+// externalEndpoint is an endpoint of the external cluster details that is
+// probed by the connectivity checker
+type externalEndpoint struct {
+	kind    string
+	address string
+	// rgw is set for the RGW endpoints, whose certificate is verified
+	rgw *externalRGWEndpoint
+}
+
+// getExternalEndpoints returns the mon, mgr and RGW endpoints of the external
+// cluster details
+func getExternalEndpoints(resources []ExternalResource) (endpoints []externalEndpoint, caBundleSecret string) {
+	for _, resource := range resources {
+		switch {
+		case resource.Kind == "ConfigMap" && resource.Name == externalMonEndpointsConfigMap:
+			for _, mon := range parseMonEndpoints(resource.Data["data"]) {
+				endpoints = append(endpoints, externalEndpoint{kind: externalEndpointMon, address: mon})
+			}
+		case resource.Kind == "CephCluster":
+			for _, host := range parseExternalMgrHosts(resource.Data[externalMonitoringEndpointKey]) {
+				endpoints = append(endpoints, externalEndpoint{
+					kind:    externalEndpointMgr,
+					address: net.JoinHostPort(host, resource.Data[externalMonitoringPortKey]),
+				})
+			}
+		case resource.Kind == "StorageClass" && resource.Name == cephRgwStorageClassName:
+			rgwEndpoints, err := parseExternalRGWEndpoints(resource.Data[externalCephRgwEndpointKey])
+			if err != nil {
+				continue
+			}
+			for i := range rgwEndpoints {
+				endpoints = append(endpoints, externalEndpoint{
+					kind:    externalEndpointRGW,
+					address: rgwEndpoints[i].String(),
+					rgw:     &rgwEndpoints[i],
+				})
+			}
+			caBundleSecret = resource.Data[externalCephRgwCABundleSecretKey]
+		}
+	}
+	return endpoints, caBundleSecret
+}
+
+// newExternalConnectivityChecker returns the checker that periodically probes
+// the endpoints of the external cluster of every external StorageCluster. It
+// requeues a StorageCluster when the reachability of its endpoints changes,
+// the reconcile then sets the connection conditions from the last results.
+func newExternalConnectivityChecker(r *StorageClusterReconciler) *periodicChecker {
+	c := newPeriodicChecker(r, "external connectivity check", externalConnectivityCheckInterval, externalConnectivityCheckTimeout)
+	c.selects = func(sc *ocsv1.StorageCluster) bool {
+		return sc.Spec.ExternalStorage.Enable
+	}
+	c.run = func(sc *ocsv1.StorageCluster, timeout time.Duration) (interface{}, error) {
+		return r.checkExternalConnectivity(sc, timeout)
+	}
+	c.changed = func(previous, current interface{}) bool {
+		return externalReachabilityChanged(previous.([]ocsv1.ExternalEndpointStatus), current.([]ocsv1.ExternalEndpointStatus))
+	}
+	return c
+}
+
+// checkExternalConnectivity probes the endpoints of the external cluster of
+// the StorageCluster concurrently
+func (r *StorageClusterReconciler) checkExternalConnectivity(sc *ocsv1.StorageCluster, timeout time.Duration) ([]ocsv1.ExternalEndpointStatus, error) {
+	resources, err := r.retrieveExternalSecretData(sc)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, caBundleSecret := getExternalEndpoints(resources)
+	rootCAs, caErr := r.getExternalRGWRootCAs(sc, caBundleSecret)
+
+	now := metav1.Now()
+	statuses := make([]ocsv1.ExternalEndpointStatus, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint externalEndpoint) {
+			defer wg.Done()
+			var err error
+			switch {
+			case endpoint.rgw == nil:
+				err = checkEndpointReachable(endpoint.address, timeout)
+			case endpoint.rgw.secure && caErr != nil:
+				err = caErr
+			default:
+				err = checkRGWEndpointReachable(*endpoint.rgw, rootCAs, timeout)
+			}
+			statuses[i] = ocsv1.ExternalEndpointStatus{
+				Type:          endpoint.kind,
+				Address:       endpoint.address,
+				Reachable:     err == nil,
+				LastCheckTime: &now,
+			}
+			if err != nil {
+				statuses[i].Message = err.Error()
+			}
+		}(i, endpoint)
+	}
+	wg.Wait()
+	return statuses, nil
+}
+
+// getExternalConnectivityResult returns the last results of the connectivity
+// check of the StorageCluster, and whether it was checked already
+func getExternalConnectivityResult(c *periodicChecker, key types.NamespacedName) ([]ocsv1.ExternalEndpointStatus, bool) {
+	result, found := c.getResult(key)
+	if !found {
+		return nil, false
+	}
+	statuses := result.([]ocsv1.ExternalEndpointStatus)
+	copied := make([]ocsv1.ExternalEndpointStatus, len(statuses))
+	for i := range statuses {
+		statuses[i].DeepCopyInto(&copied[i])
+	}
+	return copied, true
+}
+
+// externalReachabilityChanged returns whether an endpoint was added, removed,
+// or became reachable or unreachable between two connectivity checks
+func externalReachabilityChanged(previous, current []ocsv1.ExternalEndpointStatus) bool {
+	if len(previous) != len(current) {
+		return true
+	}
+	reachable := map[string]bool{}
+	for _, status := range previous {
+		reachable[status.Type+"/"+status.Address] = status.Reachable
+	}
+	for _, status := range current {
+		wasReachable, found := reachable[status.Type+"/"+status.Address]
+		if !found || wasReachable != status.Reachable {
+			return true
+		}
+	}
+	return false
+}
+
+// setExternalConnectivityStatus sets the ExternalClusterConnected and
+// ExternalClusterConnecting conditions and the endpoint statuses from the last
+// connectivity check. The cluster is not connected as long as no endpoint of
+// a type is reachable. A negative state reported by the CephCluster is kept
+// when every type of endpoint is reachable.
+func (r *StorageClusterReconciler) setExternalConnectivityStatus(sc *ocsv1.StorageCluster) {
+	if r.externalChecker == nil {
+		return
+	}
+	statuses, found := getExternalConnectivityResult(r.externalChecker, types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace})
+	if !found {
+		return
+	}
+	sc.Status.ExternalEndpoints = statuses
+
+	available := map[string]bool{}
+	unreachable := []string{}
+	for _, status := range statuses {
+		available[status.Type] = available[status.Type] || status.Reachable
+		if !status.Reachable {
+			unreachable = append(unreachable, fmt.Sprintf("%s %s: %s", status.Type, status.Address, status.Message))
+		}
+	}
+	unavailable := []string{}
+	for kind, reachable := range available {
+		if !reachable {
+			unavailable = append(unavailable, kind)
+		}
+	}
+	sort.Strings(unavailable)
+
+	if len(unavailable) != 0 {
+		message := fmt.Sprintf("No %s endpoint of the external cluster is reachable: %s",
+			strings.Join(unavailable, ", "), strings.Join(unreachable, "; "))
+		r.setExternalConnectedCondition(sc, corev1.ConditionFalse, ocsv1.ExternalEndpointsUnreachable, message)
+		conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+			Type:    ocsv1.ConditionExternalClusterConnecting,
+			Status:  corev1.ConditionTrue,
+			Reason:  ocsv1.ExternalEndpointsUnreachable,
+			Message: message,
+		})
+		// an error of the reconcile is not hidden by the connecting phase
+		if sc.Status.Phase != statusutil.PhaseError {
+			sc.Status.Phase = statusutil.PhaseConnecting
+		}
+		return
+	}
+
+	for _, condition := range r.conditions {
+		if condition.Type == ocsv1.ConditionExternalClusterConnected && condition.Status == corev1.ConditionFalse {
+			return
+		}
+	}
+	message := ocsv1.ExternalClusterConnectedMessage
+	if len(unreachable) != 0 {
+		message = fmt.Sprintf("%s, unreachable endpoints: %s", message, strings.Join(unreachable, "; "))
+	}
+	r.setExternalConnectedCondition(sc, corev1.ConditionTrue, ocsv1.ExternalClusterConnected, message)
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+		Type:    ocsv1.ConditionExternalClusterConnecting,
+		Status:  corev1.ConditionFalse,
+		Reason:  ocsv1.ExternalClusterConnected,
+		Message: message,
+	})
+}
+
+// setExternalConnectedCondition sets the ExternalClusterConnected condition,
+// and emits an event when its status changes
+func (r *StorageClusterReconciler) setExternalConnectedCondition(sc *ocsv1.StorageCluster, status corev1.ConditionStatus, reason, message string) {
+	previous := conditionsv1.FindStatusCondition(sc.Status.Conditions, ocsv1.ConditionExternalClusterConnected)
+	if previous == nil || previous.Status != status || previous.Reason != reason {
+		eventType := corev1.EventTypeNormal
+		if status != corev1.ConditionTrue {
+			eventType = corev1.EventTypeWarning
+		}
+		r.recorder.Event(sc, eventType, reason, message)
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+		Type:    ocsv1.ConditionExternalClusterConnected,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
@@ -0,0 +1,161 @@
+package storagecluster
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestGetExternalEndpoints(t *testing.T) {
+	resources := []ExternalResource{
+		{
+			Kind: "ConfigMap",
+			Name: "rook-ceph-mon-endpoints",
+			Data: map[string]string{"data": "b=10.20.30.41:6789,a=10.20.30.40:6789", "maxMonId": "1"},
+		},
+		{
+			Kind: "CephCluster",
+			Name: "monitoring-endpoint",
+			Data: map[string]string{"MonitoringEndpoint": "10.20.30.42", "MonitoringPort": "9283"},
+		},
+		{
+			Kind: "StorageClass",
+			Name: "ceph-rgw",
+			Data: map[string]string{"endpoint": "https://rgw.example.com:443", "caBundleSecret": "rgw-ca"},
+		},
+	}
+	endpoints, caBundleSecret := getExternalEndpoints(resources)
+	assert.Equal(t, "rgw-ca", caBundleSecret)
+	actual := []string{}
+	for _, endpoint := range endpoints {
+		actual = append(actual, endpoint.kind+" "+endpoint.address)
+	}
+	assert.Equal(t, []string{
+		"mon 10.20.30.40:6789",
+		"mon 10.20.30.41:6789",
+		"mgr 10.20.30.42:9283",
+		"rgw https://rgw.example.com:443",
+	}, actual)
+}
+
+func TestExternalConnectivityCheck(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "ocsinit",
+			Namespace: "",
+		},
+	}
+	mon, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer mon.Close()
+	mgr, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer mgr.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	closedAddress := closed.Addr().String()
+	assert.NoError(t, closed.Close())
+	mgrHost, mgrPort, err := net.SplitHostPort(mgr.Addr().String())
+	assert.NoError(t, err)
+
+	extResources := []ExternalResource{
+		{
+			Kind: "ConfigMap",
+			Name: "rook-ceph-mon-endpoints",
+			Data: map[string]string{"data": "a=" + mon.Addr().String() + ",b=" + closedAddress, "maxMonId": "1"},
+		},
+		{
+			Kind: "CephCluster",
+			Name: "monitoring-endpoint",
+			Data: map[string]string{"MonitoringEndpoint": mgrHost, "MonitoringPort": mgrPort},
+		},
+	}
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, withRequiredExternalResources(extResources))
+	checker := newExternalConnectivityChecker(&reconciler)
+	checker.timeout = time.Second
+	reconciler.externalChecker = checker
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// the first check requeues the StorageCluster
+	checker.check(stop)
+	assert.Len(t, checker.events, 1)
+	<-checker.events
+	statuses, found := getExternalConnectivityResult(checker, request.NamespacedName)
+	assert.True(t, found)
+	assert.Len(t, statuses, 3)
+
+	// a single reachable mon is enough to connect
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	sc := &api.StorageCluster{}
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, sc)
+	assert.NoError(t, err)
+	assert.Len(t, sc.Status.ExternalEndpoints, 3)
+	condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterConnected)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Contains(t, condition.Message, "mon "+closedAddress)
+	}
+	assert.True(t, conditionsv1.IsStatusConditionFalse(sc.Status.Conditions, api.ConditionExternalClusterConnecting))
+
+	// the StorageCluster is not requeued as long as the reachability is the same
+	checker.check(stop)
+	assert.Len(t, checker.events, 0)
+
+	// the cluster is not connected once no mon is reachable
+	assert.NoError(t, mon.Close())
+	checker.check(stop)
+	assert.Len(t, checker.events, 1)
+	<-checker.events
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, sc)
+	assert.NoError(t, err)
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterConnected)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, api.ExternalEndpointsUnreachable, condition.Reason)
+		assert.Contains(t, condition.Message, "No mon endpoint")
+	}
+	assert.True(t, conditionsv1.IsStatusConditionTrue(sc.Status.Conditions, api.ConditionExternalClusterConnecting))
+	assert.Equal(t, statusutil.PhaseConnecting, sc.Status.Phase)
+	for _, status := range sc.Status.ExternalEndpoints {
+		assert.Equal(t, status.Type == externalEndpointMgr, status.Reachable, "unexpected reachability of %s", status.Address)
+	}
+
+	// the last results are applied even if the reconcile fails early
+	assert.NoError(t, mgr.Close())
+	checker.check(stop)
+	<-checker.events
+	extSecret, err := createExternalCephClusterSecret(removeNamedResourceFromArray(withRequiredExternalResources(extResources), "rook-csi-rbd-node"))
+	assert.NoError(t, err)
+	secret := &corev1.Secret{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalClusterDetailsSecret}, secret)
+	assert.NoError(t, err)
+	secret.Data = extSecret.Data
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), secret))
+	_, err = reconciler.Reconcile(request)
+	assert.Error(t, err)
+	sc = &api.StorageCluster{}
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, sc)
+	assert.NoError(t, err)
+	for _, status := range sc.Status.ExternalEndpoints {
+		assert.False(t, status.Reachable, "unexpected reachability of %s", status.Address)
+	}
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterConnected)
+	if assert.NotNil(t, condition) {
+		assert.Contains(t, condition.Message, "No mgr, mon endpoint")
+	}
+	// the failure of the validation is not hidden by the connecting phase
+	assert.Equal(t, statusutil.PhaseError, sc.Status.Phase)
+}
@@ -0,0 +1,234 @@
+package storagecluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// csiConfigMapName is the ConfigMap of the ceph-csi cluster configuration
+	// maintained by Rook
+	csiConfigMapName = "rook-ceph-csi-config"
+	csiConfigMapKey  = "csi-cluster-config-json"
+	// externalCSIClusterIDsAnnotation lists the clusterIDs of the ceph-csi
+	// cluster configuration that were added for the external cluster details
+	externalCSIClusterIDsAnnotation = "ocs.openshift.io/external-csi-cluster-ids"
+
+	externalMonEndpointsConfigMap = "rook-ceph-mon-endpoints"
+	externalRadosNamespaceKey     = "radosNamespace"
+	externalSubvolumeGroupKey     = "subvolumeGroup"
+)
+
+// csiClusterConfigEntry is an entry of the ceph-csi cluster configuration
+type csiClusterConfigEntry struct {
+	ClusterID      string           `json:"clusterID"`
+	Monitors       []string         `json:"monitors"`
+	RadosNamespace string           `json:"radosNamespace,omitempty"`
+	CephFS         *csiCephFSConfig `json:"cephFS,omitempty"`
+}
+
+// csiCephFSConfig holds the CephFS options of a ceph-csi cluster configuration entry
+type csiCephFSConfig struct {
+	SubvolumeGroup string `json:"subvolumeGroup,omitempty"`
+}
+
+// isExternalRBDStorageClass returns whether the StorageClass entry of the
+// external cluster details is backed by an RBD pool. It is named 'ceph-rbd',
+// or 'ceph-rbd-<suffix>' for every additional pool.
+func isExternalRBDStorageClass(name string) bool {
+	return name == cephRbdStorageClassName || strings.HasPrefix(name, cephRbdStorageClassName+"-")
+}
+
+// isExternalCephFSStorageClass returns whether the StorageClass entry of the
+// external cluster details is backed by a CephFS filesystem. It is named
+// 'cephfs', or 'cephfs-<suffix>' for every additional filesystem.
+func isExternalCephFSStorageClass(name string) bool {
+	return name == cephFsStorageClassName || strings.HasPrefix(name, cephFsStorageClassName+"-")
+}
+
+// generateExternalCSIClusterID returns the ceph-csi clusterID of a
+// StorageClass entry of the external cluster details that is isolated in a
+// RADOS namespace or a subvolume group. It has the 32 characters of the
+// clusterIDs Rook generates.
+func generateExternalCSIClusterID(initData *ocsv1.StorageCluster, entryName string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(initData.Namespace+"/"+initData.Name+"/"+entryName)))[:32]
+}
+
+// getExternalCSIClusterID returns the ceph-csi clusterID of the given
+// StorageClass entry, or an empty string if it uses the clusterID of the
+// CephCluster
+func getExternalCSIClusterID(initData *ocsv1.StorageCluster, resource ExternalResource) string {
+	if resource.Data[externalRadosNamespaceKey] == "" && resource.Data[externalSubvolumeGroupKey] == "" {
+		return ""
+	}
+	return generateExternalCSIClusterID(initData, resource.Name)
+}
+
+// parseMonEndpoints returns the mon addresses of the mon endpoints of the
+// form <name>=<host>:<port>, sorted by the name of the mons
+func parseMonEndpoints(monEndpoints string) []string {
+	mons := map[string]string{}
+	names := []string{}
+	for _, mon := range strings.Split(monEndpoints, ",") {
+		nameEndpoint := strings.SplitN(mon, "=", 2)
+		if len(nameEndpoint) != 2 {
+			continue
+		}
+		mons[nameEndpoint[0]] = nameEndpoint[1]
+		names = append(names, nameEndpoint[0])
+	}
+	sort.Strings(names)
+	monitors := []string{}
+	for _, name := range names {
+		monitors = append(monitors, mons[name])
+	}
+	return monitors
+}
+
+// newExternalCSIClusterConfigEntries returns the ceph-csi cluster
+// configuration entries of the StorageClass entries that are isolated in a
+// RADOS namespace or a subvolume group
+func newExternalCSIClusterConfigEntries(initData *ocsv1.StorageCluster, resources []ExternalResource) []csiClusterConfigEntry {
+	monitors := []string{}
+	for _, resource := range resources {
+		if resource.Kind == "ConfigMap" && resource.Name == externalMonEndpointsConfigMap {
+			monitors = parseMonEndpoints(resource.Data["data"])
+		}
+	}
+
+	entries := []csiClusterConfigEntry{}
+	for _, resource := range resources {
+		if resource.Kind != "StorageClass" {
+			continue
+		}
+		clusterID := getExternalCSIClusterID(initData, resource)
+		if clusterID == "" {
+			continue
+		}
+		entry := csiClusterConfigEntry{ClusterID: clusterID, Monitors: monitors}
+		if isExternalRBDStorageClass(resource.Name) {
+			entry.RadosNamespace = resource.Data[externalRadosNamespaceKey]
+		} else if isExternalCephFSStorageClass(resource.Name) {
+			entry.CephFS = &csiCephFSConfig{SubvolumeGroup: resource.Data[externalSubvolumeGroupKey]}
+		} else {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ClusterID < entries[j].ClusterID })
+	return entries
+}
+
+// ensureExternalCSIClusterConfig adds the ceph-csi cluster configuration
+// entries of the RADOS namespaces and subvolume groups of the external cluster
+// details, and removes the entries that are no longer needed. The entries of
+// Rook are kept. As Rook rewrites the configuration when the mons change, this
+// runs on every reconcile.
+func (r *StorageClusterReconciler) ensureExternalCSIClusterConfig(instance *ocsv1.StorageCluster, resources []ExternalResource) error {
+	entries := newExternalCSIClusterConfigEntries(instance, resources)
+
+	cm := &corev1.ConfigMap{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: csiConfigMapName, Namespace: instance.Namespace}, cm)
+	if errors.IsNotFound(err) {
+		if len(entries) == 0 {
+			return nil
+		}
+		// Rook keeps the ConfigMap if it already exists when it starts
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: csiConfigMapName, Namespace: instance.Namespace},
+			Data:       map[string]string{csiConfigMapKey: "[]"},
+		}
+		if err = r.Client.Create(context.TODO(), cm); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// the entries are kept as they are, so that no field of Rook is lost
+	current := []map[string]interface{}{}
+	if data := strings.TrimSpace(cm.Data[csiConfigMapKey]); data != "" {
+		if err = json.Unmarshal([]byte(data), &current); err != nil {
+			return fmt.Errorf("failed to parse the ceph-csi cluster configuration: %v", err)
+		}
+	}
+	owned := strings.Split(cm.Annotations[externalCSIClusterIDsAnnotation], ",")
+	desired := []map[string]interface{}{}
+	for _, entry := range current {
+		if clusterID, ok := entry["clusterID"].(string); ok && contains(owned, clusterID) {
+			continue
+		}
+		desired = append(desired, entry)
+	}
+	clusterIDs := []string{}
+	for _, entry := range entries {
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		desiredEntry := map[string]interface{}{}
+		if err = json.Unmarshal(raw, &desiredEntry); err != nil {
+			return err
+		}
+		desired = append(desired, desiredEntry)
+		clusterIDs = append(clusterIDs, entry.ClusterID)
+	}
+
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	desiredJSON, err := json.Marshal(desired)
+	if err != nil {
+		return err
+	}
+	annotation := strings.Join(clusterIDs, ",")
+	if string(currentJSON) == string(desiredJSON) && cm.Annotations[externalCSIClusterIDsAnnotation] == annotation {
+		return nil
+	}
+
+	r.Log.Info("Updating the ceph-csi cluster configuration of the external cluster details")
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[csiConfigMapKey] = string(desiredJSON)
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	if annotation == "" {
+		delete(cm.Annotations, externalCSIClusterIDsAnnotation)
+	} else {
+		cm.Annotations[externalCSIClusterIDsAnnotation] = annotation
+	}
+	return r.Client.Update(context.TODO(), cm)
+}
+
+// isCSIConfigMap returns whether the object is the ceph-csi cluster
+// configuration of Rook in the watched namespace
+func (r *StorageClusterReconciler) isCSIConfigMap(meta metav1.Object, object runtime.Object) bool {
+	if r.watchNamespace != "" && meta.GetNamespace() != r.watchNamespace {
+		return false
+	}
+	return meta.GetName() == csiConfigMapName
+}
+
+// csiConfigToStorageClusters maps the ceph-csi cluster configuration to the
+// external StorageClusters in its namespace, so that their entries are added
+// back as soon as Rook rewrites it. The events of other ConfigMaps are
+// filtered out by isCSIConfigMap.
+func (r *StorageClusterReconciler) csiConfigToStorageClusters(obj handler.MapObject) []reconcile.Request {
+	return r.externalStorageClusterRequests(obj.Meta.GetNamespace())
+}
@@ -0,0 +1,160 @@
+package storagecluster
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// externalMonitoringEndpointKey holds the comma separated hosts of the
+	// mgrs of the external cluster, the active one and the standbys
+	externalMonitoringEndpointKey = "MonitoringEndpoint"
+	// externalMonitoringPortKey holds the port of the Prometheus exporter of
+	// the mgrs, that is shared by all of them
+	externalMonitoringPortKey = "MonitoringPort"
+)
+
+// externalMgrEndpoints are the mgr endpoints of the external cluster that are
+// scraped by Prometheus
+type externalMgrEndpoints struct {
+	// ips are the addresses of every mgr, the standbys included, so that the
+	// scraping follows a failover of the active mgr
+	ips  []string
+	port uint16
+}
+
+// parseExternalMgrHosts parses the comma separated mgr hosts of the
+// MonitoringEndpoint. A host is an IPv4 address, an IPv6 address with or
+// without brackets, or a hostname.
+func parseExternalMgrHosts(value string) []string {
+	hosts := []string{}
+	for _, host := range strings.Split(value, ",") {
+		host = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(host), "["), "]")
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// resolveHost returns the IP addresses of a host, an IP address is returned
+// as it is
+func resolveHost(host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	return lookupHost(host)
+}
+
+// resolveExternalMgrEndpoints resolves the mgr hosts of the external cluster
+// details. A host that cannot be resolved is skipped, but at least one must
+// be. Kubernetes endpoints only accept IP addresses, so this runs on every
+// reconcile to follow the addresses of the hostnames.
+func resolveExternalMgrEndpoints(monitoringEndpoint, monitoringPort string, reqLogger logr.Logger) (*externalMgrEndpoints, error) {
+	port, err := strconv.ParseUint(monitoringPort, 10, 16)
+	if err != nil || port == 0 {
+		return nil, fmt.Errorf("invalid mgr monitoring port %q", monitoringPort)
+	}
+	hosts := parseExternalMgrHosts(monitoringEndpoint)
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no mgr monitoring endpoint provided")
+	}
+
+	ips := []string{}
+	failures := []string{}
+	for _, host := range hosts {
+		resolved, err := resolveHost(host)
+		if err != nil {
+			reqLogger.Error(err, "Failed to resolve the mgr monitoring endpoint", "MgrHost", host)
+			failures = append(failures, fmt.Sprintf("%s: %v", host, err))
+			continue
+		}
+		ips = append(ips, resolved...)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("none of the mgr monitoring endpoints could be resolved: %s", strings.Join(failures, "; "))
+	}
+
+	sort.Strings(ips)
+	endpoints := &externalMgrEndpoints{port: uint16(port)}
+	for i, ip := range ips {
+		if i == 0 || ips[i-1] != ip {
+			endpoints.ips = append(endpoints.ips, ip)
+		}
+	}
+	return endpoints, nil
+}
+
+// getExternalMgrEndpoints resolves the mgr hosts of the external cluster
+// details and checks them on the Prometheus port. An unreachable mgr is kept
+// as a standby, but at least one mgr must be reachable.
+func getExternalMgrEndpoints(monitoringEndpoint, monitoringPort string, timeout time.Duration, reqLogger logr.Logger) (*externalMgrEndpoints, error) {
+	endpoints, err := resolveExternalMgrEndpoints(monitoringEndpoint, monitoringPort, reqLogger)
+	if err != nil {
+		return nil, err
+	}
+	reachable := 0
+	failures := []string{}
+	for _, ip := range endpoints.ips {
+		endpoint := net.JoinHostPort(ip, monitoringPort)
+		if err := checkEndpointReachable(endpoint, timeout); err != nil {
+			reqLogger.Info("Mgr monitoring endpoint is not reachable, keeping it as a standby", "MgrEndpoint", endpoint, "Error", err.Error())
+			failures = append(failures, fmt.Sprintf("%s: %v", endpoint, err))
+			continue
+		}
+		reachable++
+	}
+	if reachable == 0 {
+		return nil, fmt.Errorf("none of the mgr monitoring endpoints is reachable: %s", strings.Join(failures, "; "))
+	}
+	return endpoints, nil
+}
+
+// getExternalMonitoringEndpoints returns the mgr endpoints of the external
+// cluster details, or nil if they have none. They are derived from the
+// external cluster details on every reconcile, so that the monitoring of the
+// CephCluster does not depend on the state of the operator.
+func (r *StorageClusterReconciler) getExternalMonitoringEndpoints(sc *ocsv1.StorageCluster) (*externalMgrEndpoints, error) {
+	data, err := r.retrieveExternalSecretData(sc)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range data {
+		if d.Kind == "CephCluster" {
+			return resolveExternalMgrEndpoints(d.Data[externalMonitoringEndpointKey], d.Data[externalMonitoringPortKey], r.Log)
+		}
+	}
+	return nil, nil
+}
+
+// endpointAddresses returns the mgr addresses of the external CephCluster
+func (e *externalMgrEndpoints) endpointAddresses() []corev1.EndpointAddress {
+	addresses := []corev1.EndpointAddress{}
+	for _, ip := range e.ips {
+		addresses = append(addresses, corev1.EndpointAddress{IP: ip})
+	}
+	return addresses
+}
+
+// validateMonitoringEndpoints accepts the comma separated mgr hosts
+func validateMonitoringEndpoints(value string) []string {
+	hosts := parseExternalMgrHosts(value)
+	if len(hosts) == 0 {
+		return []string{"must list at least one mgr host"}
+	}
+	problems := []string{}
+	for _, host := range hosts {
+		for _, problem := range validateHost(host) {
+			problems = append(problems, fmt.Sprintf("mgr host %q %s", host, problem))
+		}
+	}
+	return problems
+}
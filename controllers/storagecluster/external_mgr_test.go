@@ -0,0 +1,89 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestParseExternalMgrHosts(t *testing.T) {
+	assert.Equal(t, []string{"10.20.30.40", "fd00::10", "fd00::11", "mgr-b.example.com"},
+		parseExternalMgrHosts("10.20.30.40, [fd00::10],fd00::11,mgr-b.example.com,"))
+	assert.Equal(t, []string{}, parseExternalMgrHosts(""))
+}
+
+func TestGetExternalMgrEndpoints(t *testing.T) {
+	defer func(f func(string) ([]string, error)) { lookupHost = f }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		if host == "mgr-b.example.com" {
+			return []string{"127.0.0.2", "127.0.0.1"}, nil
+		}
+		return nil, fmt.Errorf("no such host %q", host)
+	}
+	mgr, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer mgr.Close()
+	port := strconv.Itoa(mgr.Addr().(*net.TCPAddr).Port)
+	reqLogger := logf.Log.WithName("external_mgr_test")
+
+	// the unreachable mgrs are kept as standbys
+	endpoints, err := getExternalMgrEndpoints("127.0.0.1,[::1],mgr-b.example.com,mgr-c.example.com", port, time.Second, reqLogger)
+	assert.NoError(t, err)
+	if assert.NotNil(t, endpoints) {
+		assert.Equal(t, []string{"127.0.0.1", "127.0.0.2", "::1"}, endpoints.ips)
+		assert.Equal(t, strconv.Itoa(int(endpoints.port)), port)
+		assert.Equal(t, []corev1.EndpointAddress{{IP: "127.0.0.1"}, {IP: "127.0.0.2"}, {IP: "::1"}}, endpoints.endpointAddresses())
+	}
+
+	// at least one mgr must be reachable
+	_, err = getExternalMgrEndpoints("127.0.0.2,mgr-c.example.com", port, time.Second, reqLogger)
+	assert.Error(t, err)
+	_, err = getExternalMgrEndpoints("127.0.0.1", "not-a-port", time.Second, reqLogger)
+	assert.Error(t, err)
+}
+
+func TestGetExternalMonitoringEndpoints(t *testing.T) {
+	addresses := []string{"10.20.30.41"}
+	defer func(f func(string) ([]string, error)) { lookupHost = f }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		return addresses, nil
+	}
+	extResources := []ExternalResource{
+		{
+			Kind: "CephCluster",
+			Name: "monitoring-endpoint",
+			Data: map[string]string{"MonitoringEndpoint": "mgr.example.com", "MonitoringPort": "9283"},
+		},
+	}
+	// a new reconciler, as after a restart of the operator
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, withRequiredExternalResources(extResources))
+	sc := &api.StorageCluster{}
+	err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit"}, sc)
+	assert.NoError(t, err)
+
+	endpoints, err := reconciler.getExternalMonitoringEndpoints(sc)
+	assert.NoError(t, err)
+	if assert.NotNil(t, endpoints) {
+		assert.Equal(t, []string{"10.20.30.41"}, endpoints.ips)
+		assert.Equal(t, uint16(9283), endpoints.port)
+	}
+	cephCluster := newExternalCephCluster(sc, "", endpoints)
+	assert.True(t, cephCluster.Spec.Monitoring.Enabled)
+
+	// the hostname is resolved again when its address changes
+	addresses = []string{"10.20.30.42"}
+	endpoints, err = reconciler.getExternalMonitoringEndpoints(sc)
+	assert.NoError(t, err)
+	if assert.NotNil(t, endpoints) {
+		assert.Equal(t, []string{"10.20.30.42"}, endpoints.ips)
+	}
+}
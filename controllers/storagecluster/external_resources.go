@@ -3,21 +3,23 @@ package storagecluster
 import (
 	"context"
 	"crypto/sha512"
-	"encoding/json"
 	"fmt"
 	"net"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/go-logr/logr"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 const (
@@ -27,6 +29,13 @@ const (
 	cephRbdStorageClassName      = "ceph-rbd"
 	cephRgwStorageClassName      = "ceph-rgw"
 	externalCephRgwEndpointKey   = "endpoint"
+	// externalClusterDetailsLabel marks the ConfigMaps and Secrets created
+	// from the external cluster details with the name of their StorageCluster
+	externalClusterDetailsLabel = "ocs.openshift.io/external-cluster-details"
+	// externalClusterDetailsKeysAnnotation records the keys of the ConfigMaps
+	// and Secrets that come from the external cluster details, so that the
+	// keys added by Rook are kept when they are updated
+	externalClusterDetailsKeysAnnotation = "ocs.openshift.io/external-cluster-details-keys"
 )
 
 const (
@@ -91,18 +100,41 @@ func (r *StorageClusterReconciler) externalSecretDataChecksum(instance *ocsv1.St
 	return sha512sum(found.Data[externalClusterDetailsKey])
 }
 
-func (r *StorageClusterReconciler) sameExternalSecretData(instance *ocsv1.StorageCluster) bool {
-	extSecretChecksum, err := r.externalSecretDataChecksum(instance)
-	if err != nil {
+// isExternalClusterDetailsSecret returns true for the external cluster
+// details secret in the namespace watched by the operator
+func (r *StorageClusterReconciler) isExternalClusterDetailsSecret(meta metav1.Object, object runtime.Object) bool {
+	if r.watchNamespace != "" && meta.GetNamespace() != r.watchNamespace {
 		return false
 	}
-	// if the 'ExternalSecretHash' and fetched hash are same, then return true
-	if instance.Status.ExternalSecretHash == extSecretChecksum {
-		return true
+	_, ok := object.(*corev1.Secret)
+	return ok && meta.GetName() == externalClusterDetailsSecret
+}
+
+// externalSecretToStorageClusters maps the external cluster details secret
+// to the reconcile requests of the external StorageClusters in its namespace.
+// The events of other secrets are filtered out by
+// isExternalClusterDetailsSecret.
+func (r *StorageClusterReconciler) externalSecretToStorageClusters(obj handler.MapObject) []reconcile.Request {
+	return r.externalStorageClusterRequests(obj.Meta.GetNamespace())
+}
+
+// externalStorageClusterRequests returns the reconcile requests of the
+// external StorageClusters in the given namespace
+func (r *StorageClusterReconciler) externalStorageClusterRequests(namespace string) []reconcile.Request {
+	storageClusters := &ocsv1.StorageClusterList{}
+	if err := r.Client.List(context.TODO(), storageClusters, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "failed to list StorageClusters")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, sc := range storageClusters.Items {
+		if sc.Spec.ExternalStorage.Enable {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace},
+			})
+		}
 	}
-	// at this point the checksums are different, so update it
-	instance.Status.ExternalSecretHash = extSecretChecksum
-	return false
+	return requests
 }
 
 // retrieveSecret function retrieves the secret object with the specified name
@@ -125,50 +157,26 @@ func (r *StorageClusterReconciler) retrieveExternalSecretData(
 		r.Log.Error(err, "could not find the external secret resource")
 		return nil, err
 	}
-	var data []ExternalResource
-	err = json.Unmarshal(found.Data[externalClusterDetailsKey], &data)
+	details, err := unmarshalExternalClusterDetails(found.Data[externalClusterDetailsKey])
 	if err != nil {
 		r.Log.Error(err, "could not parse json blob")
 		return nil, err
 	}
-	return data, nil
-}
-
-func newExternalGatewaySpec(rgwEndpoint string, reqLogger logr.Logger) (*cephv1.GatewaySpec, error) {
-	var gateWay cephv1.GatewaySpec
-	hostIP, portStr, err := net.SplitHostPort(rgwEndpoint)
-	if err != nil {
-		reqLogger.Error(err,
-			fmt.Sprintf("invalid rgw endpoint provided: %s", rgwEndpoint))
-		return nil, err
-	}
-	if hostIP == "" {
-		err := fmt.Errorf("An empty rgw host 'IP' address found")
-		reqLogger.Error(err, "Host IP should not be empty in rgw endpoint")
-		return nil, err
-	}
-	gateWay.ExternalRgwEndpoints = []corev1.EndpointAddress{{IP: hostIP}}
-	var portInt64 int64
-	if portInt64, err = strconv.ParseInt(portStr, 10, 32); err != nil {
-		reqLogger.Error(err,
-			fmt.Sprintf("invalid rgw 'port' provided: %s", portStr))
-		return nil, err
-	}
-	gateWay.Port = int32(portInt64)
-	return &gateWay, nil
+	return details.Resources, nil
 }
 
 // newExternalCephObjectStoreInstances returns a set of CephObjectStores
 // needed for external cluster mode
 func (r *StorageClusterReconciler) newExternalCephObjectStoreInstances(
-	initData *ocsv1.StorageCluster, rgwEndpoint string) ([]*cephv1.CephObjectStore, error) {
+	initData *ocsv1.StorageCluster, rgwEndpoints []externalRGWEndpoint) ([]*cephv1.CephObjectStore, error) {
 	// check whether the provided rgw endpoint is empty
-	if rgwEndpoint = strings.TrimSpace(rgwEndpoint); rgwEndpoint == "" {
+	if len(rgwEndpoints) == 0 {
 		r.Log.Info("WARNING: Empty RGW Endpoint specified, external CephObjectStore won't be created")
 		return nil, nil
 	}
-	gatewaySpec, err := newExternalGatewaySpec(rgwEndpoint, r.Log)
+	gatewaySpec, err := newExternalGatewaySpec(rgwEndpoints)
 	if err != nil {
+		r.Log.Error(err, "invalid rgw endpoints provided")
 		return nil, err
 	}
 	// enable bucket healthcheck
@@ -197,17 +205,59 @@ func (r *StorageClusterReconciler) newExternalCephObjectStoreInstances(
 // ensureCreated ensures that requested resources for the external cluster
 // being created
 func (obj *ocsExternalResources) ensureCreated(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
-	if r.sameExternalSecretData(instance) {
-		return nil
+	extSecretChecksum, err := r.externalSecretDataChecksum(instance)
+	if err != nil || instance.Status.ExternalSecretHash != extSecretChecksum {
+		err = r.createExternalStorageClusterResources(instance)
+		if err != nil {
+			r.Log.Error(err, "could not create ExternalStorageClusterResource")
+			return err
+		}
+		// the checksum is only recorded once all the resources are reconciled,
+		// so that a failed update is retried with the same external secret data
+		instance.Status.ExternalSecretHash = extSecretChecksum
 	}
-	err := r.createExternalStorageClusterResources(instance)
+
+	// Rook rewrites the ceph-csi cluster configuration, so its entries for
+	// the external cluster details are checked on every reconcile
+	data, err := r.retrieveExternalSecretData(instance)
 	if err != nil {
-		r.Log.Error(err, "could not create ExternalStorageClusterResource")
+		return err
+	}
+	if err = r.ensureExternalCSIClusterConfig(instance, data); err != nil {
+		r.Log.Error(err, "could not update the ceph-csi cluster configuration")
+		return err
+	}
+	// the addresses of the RGW hostnames may change, so they are resolved on
+	// every reconcile as well
+	if err = r.ensureExternalCephObjectStores(instance, data); err != nil {
+		r.Log.Error(err, "could not update the external CephObjectStore")
 		return err
 	}
 	return nil
 }
 
+// ensureExternalCephObjectStores creates or updates the CephObjectStore of the
+// RGW endpoints of the external cluster details
+func (r *StorageClusterReconciler) ensureExternalCephObjectStores(instance *ocsv1.StorageCluster, data []ExternalResource) error {
+	for _, d := range data {
+		if d.Kind != "StorageClass" || d.Name != cephRgwStorageClassName {
+			continue
+		}
+		rgwEndpoints, err := parseExternalRGWEndpoints(d.Data[externalCephRgwEndpointKey])
+		if err != nil {
+			return err
+		}
+		extCephObjectStores, err := r.newExternalCephObjectStoreInstances(instance, rgwEndpoints)
+		if err != nil {
+			return err
+		}
+		if extCephObjectStores != nil {
+			return r.createCephObjectStores(extCephObjectStores, instance)
+		}
+	}
+	return nil
+}
+
 // ensureDeleted is dummy func for the ocsExternalResources
 func (obj *ocsExternalResources) ensureDeleted(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
 	return nil
@@ -230,46 +280,34 @@ func (r *StorageClusterReconciler) createExternalStorageClusterResources(instanc
 		r.Log.Error(err, "failed to retrieve external resources")
 		return err
 	}
-	var extCephObjectStores []*cephv1.CephObjectStore
+	// the ConfigMaps and Secrets of the external cluster details, by kind and name
+	externalObjects := map[string]bool{}
 	for _, d := range data {
 		objectMeta := metav1.ObjectMeta{
 			Name:            d.Name,
 			Namespace:       instance.Namespace,
+			Labels:          map[string]string{externalClusterDetailsLabel: instance.Name},
 			OwnerReferences: []metav1.OwnerReference{ownerRef},
 		}
-		objectKey := types.NamespacedName{Name: d.Name, Namespace: instance.Namespace}
 		switch d.Kind {
 		case "CephCluster":
-			monitoringIP, ok := d.Data["MonitoringEndpoint"]
-			if !ok {
-				err := fmt.Errorf(
-					"Monitoring Endpoint not present in the external cluster secret %s",
-					externalClusterDetailsSecret)
-				r.Log.Error(err, "Failed to get Monitoring IP.")
-				return err
-			}
-			monitoringPort, ok := d.Data["MonitoringPort"]
-			if !ok {
-				err := fmt.Errorf(
-					"Monitoring Port not present in the external cluster secret %s",
-					externalClusterDetailsSecret)
-				r.Log.Error(err, "Failed to get Monitoring Port.")
-				return err
-			}
-			err := validateMonitoringEndpoint(monitoringIP, monitoringPort, r.Log)
+			// the monitoring endpoints and port are checked by the validation
+			// of the external cluster details, one mgr must be reachable.
+			// The CephCluster resolves them again on every reconcile.
+			_, err := getExternalMgrEndpoints(d.Data[externalMonitoringEndpointKey],
+				d.Data[externalMonitoringPortKey], 5*time.Second, r.Log)
 			if err != nil {
 				r.Log.Error(err, "Monitoring validation failed")
 				return err
 			}
 			r.Log.Info("Monitoring Information found. Monitoring will be enabled on the external cluster")
-			r.monitoringIP = monitoringIP
 		case "ConfigMap":
 			cm := &corev1.ConfigMap{
 				ObjectMeta: objectMeta,
 				Data:       d.Data,
 			}
-			found := &corev1.ConfigMap{ObjectMeta: objectMeta}
-			err := r.createExternalStorageClusterConfigMap(cm, found, objectKey)
+			externalObjects[d.Kind+"/"+d.Name] = true
+			err := r.createExternalStorageClusterConfigMap(instance, cm)
 			if err != nil {
 				r.Log.Error(err, "could not create ExternalStorageClusterConfigMap")
 				return err
@@ -282,36 +320,70 @@ func (r *StorageClusterReconciler) createExternalStorageClusterResources(instanc
 			for k, v := range d.Data {
 				sec.Data[k] = []byte(v)
 			}
-			found := &corev1.Secret{ObjectMeta: objectMeta}
-			err := r.createExternalStorageClusterSecret(sec, found, objectKey)
+			externalObjects[d.Kind+"/"+d.Name] = true
+			err := r.createExternalStorageClusterSecret(instance, sec)
 			if err != nil {
 				r.Log.Error(err, "could not create ExternalStorageClusterSecret")
 				return err
 			}
 		case "StorageClass":
 			var scc StorageClassConfiguration
-			if d.Name == cephFsStorageClassName {
-				scc = newCephFilesystemStorageClassConfiguration(instance)
-				enableRookCSICephFS = true
-			} else if d.Name == cephRbdStorageClassName {
-				scc = newCephBlockPoolStorageClassConfiguration(instance)
+			if isExternalCephFSStorageClass(d.Name) || isExternalRBDStorageClass(d.Name) {
+				if isExternalCephFSStorageClass(d.Name) {
+					scc = newCephFilesystemStorageClassConfiguration(instance)
+					enableRookCSICephFS = true
+				} else {
+					scc = newCephBlockPoolStorageClassConfiguration(instance)
+				}
+				// every pool and filesystem gets its own StorageClass, the
+				// ones isolated in a RADOS namespace or a subvolume group
+				// refer to their own ceph-csi cluster configuration
+				scc.storageClass.Name = generateNameForExternalSC(instance, d.Name)
+				// the StorageClasses are labelled to be deleted when their
+				// entry is removed from the external cluster details
+				scc.storageClass.Labels = map[string]string{externalClusterDetailsLabel: instance.Name}
+				if clusterID := getExternalCSIClusterID(instance, d); clusterID != "" {
+					scc.storageClass.Parameters["clusterID"] = clusterID
+				}
+				delete(d.Data, externalRadosNamespaceKey)
+				delete(d.Data, externalSubvolumeGroupKey)
 			} else if d.Name == cephRgwStorageClassName {
-				rgwEndpoint := d.Data[externalCephRgwEndpointKey]
-				if err := checkEndpointReachable(rgwEndpoint, 5*time.Second); err != nil {
-					r.Log.Error(err, fmt.Sprintf("RGW endpoint, %q, is not reachable", rgwEndpoint))
+				rgwEndpoints, err := parseExternalRGWEndpoints(d.Data[externalCephRgwEndpointKey])
+				if err != nil {
+					r.Log.Error(err, "invalid rgw endpoints provided")
 					return err
 				}
-				extCephObjectStores, err = r.newExternalCephObjectStoreInstances(instance, rgwEndpoint)
+				caBundleSecret := d.Data[externalCephRgwCABundleSecretKey]
+				rootCAs, err := r.getExternalRGWRootCAs(instance, caBundleSecret)
 				if err != nil {
+					r.Log.Error(err, "failed to get the rgw CA bundle")
 					return err
 				}
-				// rgw-endpoint is no longer needed in the 'd.Data' dictionary,
-				// and can be deleted
+				// the endpoints are load balanced, one of them is enough
+				if len(rgwEndpoints) != 0 {
+					if err = r.checkAnyRGWEndpointReachable(rgwEndpoints, rootCAs, 5*time.Second); err != nil {
+						r.Log.Error(err, "RGW is not reachable")
+						return err
+					}
+				}
+				// the rgw endpoints are no longer needed in the 'd.Data'
+				// dictionary, the OBC StorageClass refers to the
+				// CephObjectStore that holds them
 				// created an issue in rook to add `CephObjectStore` type directly in the JSON output
 				// https://github.com/rook/rook/issues/6165
 				delete(d.Data, externalCephRgwEndpointKey)
+				delete(d.Data, externalCephRgwCABundleSecretKey)
 
 				scc = newCephOBCStorageClassConfiguration(instance)
+				// the clients of the buckets verify the certificate of the
+				// RGW with the CA bundle the StorageClass refers to
+				if caBundleSecret != "" {
+					scc.storageClass.Parameters[obcCABundleSecretNameKey] = caBundleSecret
+					scc.storageClass.Parameters[obcCABundleSecretNamespaceKey] = instance.Namespace
+				}
+			} else {
+				r.Log.Info(fmt.Sprintf("WARNING: unknown StorageClass %q in the external cluster details is skipped", d.Name))
+				continue
 			}
 			// now sc is pointing to appropriate StorageClass,
 			// whose parameters have to be updated
@@ -321,81 +393,253 @@ func (r *StorageClusterReconciler) createExternalStorageClusterResources(instanc
 			availableSCCs = append(availableSCCs, scc)
 		}
 	}
+	if err = r.deleteRemovedExternalResources(instance, externalObjects); err != nil {
+		r.Log.Error(err, "could not delete the resources removed from the external cluster details")
+		return err
+	}
 	// creating only the available storageClasses
 	err = r.createStorageClasses(availableSCCs)
 	if err != nil {
 		r.Log.Error(err, "failed to create needed StorageClasses")
 		return err
 	}
+	if err = r.deleteRemovedExternalStorageClasses(instance, availableSCCs); err != nil {
+		r.Log.Error(err, "could not delete the StorageClasses removed from the external cluster details")
+		return err
+	}
 	if err = r.setRookCSICephFS(enableRookCSICephFS, instance); err != nil {
 		r.Log.Error(err,
 			fmt.Sprintf("failed to set '%s' to %v", rookEnableCephFSCSIKey, enableRookCSICephFS))
 		return err
 	}
-	if extCephObjectStores != nil {
-		if err = r.createCephObjectStores(extCephObjectStores, instance); err != nil {
-			return err
-		}
-	}
 	return nil
 }
 
-// createExternalStorageClusterConfigMap creates configmap for external cluster
-func (r *StorageClusterReconciler) createExternalStorageClusterConfigMap(cm *corev1.ConfigMap, found *corev1.ConfigMap, objectKey types.NamespacedName) error {
-	err := r.Client.Get(context.TODO(), objectKey, found)
+// createExternalStorageClusterConfigMap creates the configmap for external
+// cluster, or updates it if its data changed
+func (r *StorageClusterReconciler) createExternalStorageClusterConfigMap(instance *ocsv1.StorageCluster, cm *corev1.ConfigMap) error {
+	found := &corev1.ConfigMap{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, found)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			r.Log.Info(fmt.Sprintf("creating configmap: %s", cm.Name))
+			setExternalResourceKeys(&cm.ObjectMeta, cm.Data)
 			err = r.Client.Create(context.TODO(), cm)
 			if err != nil {
 				r.Log.Error(err, "creation of configmap failed")
 				return err
 			}
-		} else {
-			r.Log.Error(err, "unable the get the configmap")
-			return err
+			return nil
 		}
+		r.Log.Error(err, "unable the get the configmap")
+		return err
 	}
+
+	previousKeys := getExternalResourceKeys(&found.ObjectMeta)
+	changedKeys := changedExternalResourceKeys(found.Data, cm.Data, previousKeys)
+	if len(changedKeys) == 0 && found.Labels[externalClusterDetailsLabel] == instance.Name &&
+		found.Annotations[externalClusterDetailsKeysAnnotation] == externalResourceKeysValue(cm.Data) {
+		return nil
+	}
+	r.Log.Info(fmt.Sprintf("updating configmap: %s", cm.Name))
+	// only the keys of the external cluster details are updated, the ones
+	// added by Rook are kept
+	if found.Data == nil {
+		found.Data = map[string]string{}
+	}
+	for _, k := range previousKeys {
+		if _, ok := cm.Data[k]; !ok {
+			delete(found.Data, k)
+		}
+	}
+	for k, v := range cm.Data {
+		found.Data[k] = v
+	}
+	setExternalClusterDetailsLabel(instance, &found.ObjectMeta)
+	setExternalResourceKeys(&found.ObjectMeta, cm.Data)
+	err = r.Client.Update(context.TODO(), found)
+	if err != nil {
+		r.Log.Error(err, "update of configmap failed")
+		return err
+	}
+	r.recordExternalResourceUpdate(instance, "ConfigMap", cm.Name, changedKeys)
 	return nil
 }
 
-// createExternalStorageClusterSecret creates secret for external cluster
-func (r *StorageClusterReconciler) createExternalStorageClusterSecret(sec *corev1.Secret, found *corev1.Secret, objectKey types.NamespacedName) error {
-	err := r.Client.Get(context.TODO(), objectKey, found)
+// createExternalStorageClusterSecret creates the secret for external
+// cluster, or updates it if its data changed
+func (r *StorageClusterReconciler) createExternalStorageClusterSecret(instance *ocsv1.StorageCluster, sec *corev1.Secret) error {
+	found := &corev1.Secret{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: sec.Name, Namespace: sec.Namespace}, found)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			r.Log.Info(fmt.Sprintf("creating secret: %s", sec.Name))
+			setExternalResourceKeys(&sec.ObjectMeta, secretDataToStrings(sec.Data))
 			err = r.Client.Create(context.TODO(), sec)
 			if err != nil {
 				r.Log.Error(err, "creation of secret failed")
 				return err
 			}
-		} else {
-			r.Log.Error(err, "unable the get the secret")
-			return err
+			return nil
+		}
+		r.Log.Error(err, "unable the get the secret")
+		return err
+	}
+
+	desiredData := secretDataToStrings(sec.Data)
+	previousKeys := getExternalResourceKeys(&found.ObjectMeta)
+	changedKeys := changedExternalResourceKeys(secretDataToStrings(found.Data), desiredData, previousKeys)
+	if len(changedKeys) == 0 && found.Labels[externalClusterDetailsLabel] == instance.Name &&
+		found.Annotations[externalClusterDetailsKeysAnnotation] == externalResourceKeysValue(desiredData) {
+		return nil
+	}
+	r.Log.Info(fmt.Sprintf("updating secret: %s", sec.Name))
+	// only the keys of the external cluster details are updated, the ones
+	// added by Rook are kept
+	if found.Data == nil {
+		found.Data = map[string][]byte{}
+	}
+	for _, k := range previousKeys {
+		if _, ok := sec.Data[k]; !ok {
+			delete(found.Data, k)
 		}
 	}
+	for k, v := range sec.Data {
+		found.Data[k] = v
+	}
+	found.StringData = nil
+	setExternalClusterDetailsLabel(instance, &found.ObjectMeta)
+	setExternalResourceKeys(&found.ObjectMeta, desiredData)
+	err = r.Client.Update(context.TODO(), found)
+	if err != nil {
+		r.Log.Error(err, "update of secret failed")
+		return err
+	}
+	r.recordExternalResourceUpdate(instance, "Secret", sec.Name, changedKeys)
 	return nil
 }
 
-// To check if endpoint is a VALID ip and is REACHABLE or not
-func validateMonitoringEndpoint(monitoringIP string, monitoringPort string, reqLogger logr.Logger) error {
-	_, err := net.LookupIP(monitoringIP)
-	if err != nil {
-		reqLogger.Error(err, "Monitoring endpoint is not a valid IPv4 IP")
+// deleteRemovedExternalResources deletes the ConfigMaps and Secrets that were
+// created from entries that are no longer in the external cluster details.
+// Only the objects labeled with the name of the StorageCluster are deleted.
+func (r *StorageClusterReconciler) deleteRemovedExternalResources(instance *ocsv1.StorageCluster, externalObjects map[string]bool) error {
+	listOpts := []client.ListOption{
+		client.InNamespace(instance.Namespace),
+		client.MatchingLabels{externalClusterDetailsLabel: instance.Name},
+	}
+	toBeDeleted := []runtime.Object{}
+
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.Client.List(context.TODO(), configMaps, listOpts...); err != nil {
 		return err
 	}
-	endpoint := net.JoinHostPort(monitoringIP, monitoringPort)
-	con, err := net.DialTimeout("tcp", endpoint, 5*time.Second)
-	if err != nil {
-		reqLogger.Error(err, fmt.Sprintf("Monitoring Endpoint (%s) is not reachable", endpoint))
+	for i := range configMaps.Items {
+		if !externalObjects["ConfigMap/"+configMaps.Items[i].Name] {
+			toBeDeleted = append(toBeDeleted, &configMaps.Items[i])
+		}
+	}
+	secrets := &corev1.SecretList{}
+	if err := r.Client.List(context.TODO(), secrets, listOpts...); err != nil {
 		return err
 	}
-	defer func() {
-		err := con.Close()
-		if err != nil {
-			reqLogger.Error(err, "")
+	for i := range secrets.Items {
+		if !externalObjects["Secret/"+secrets.Items[i].Name] {
+			toBeDeleted = append(toBeDeleted, &secrets.Items[i])
+		}
+	}
+
+	for _, obj := range toBeDeleted {
+		kind := "ConfigMap"
+		if _, ok := obj.(*corev1.Secret); ok {
+			kind = "Secret"
+		}
+		name := obj.(metav1.Object).GetName()
+		r.Log.Info(fmt.Sprintf("deleting %s %s removed from the external cluster details", strings.ToLower(kind), name))
+		if err := r.Client.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+			return err
 		}
-	}()
+		r.recorder.Event(instance, corev1.EventTypeNormal, ocsv1.ExternalClusterDetailsChanged,
+			fmt.Sprintf("Deleted %s %s, it was removed from the external cluster details", kind, name))
+	}
 	return nil
 }
+
+// recordExternalResourceUpdate emits an event with the keys of an external
+// resource that changed. The values are not included, as they can be secret.
+func (r *StorageClusterReconciler) recordExternalResourceUpdate(instance *ocsv1.StorageCluster, kind, name string, changedKeys []string) {
+	if len(changedKeys) == 0 {
+		return
+	}
+	r.recorder.Event(instance, corev1.EventTypeNormal, ocsv1.ExternalClusterDetailsChanged,
+		fmt.Sprintf("Updated %s %s from the external cluster details, changed keys: %s", kind, name, strings.Join(changedKeys, ", ")))
+}
+
+// setExternalClusterDetailsLabel labels an object created from the external
+// cluster details, so that it is deleted once it is removed from them
+func setExternalClusterDetailsLabel(instance *ocsv1.StorageCluster, objectMeta *metav1.ObjectMeta) {
+	if objectMeta.Labels == nil {
+		objectMeta.Labels = map[string]string{}
+	}
+	objectMeta.Labels[externalClusterDetailsLabel] = instance.Name
+}
+
+// setExternalResourceKeys records the keys of an object that come from the
+// external cluster details
+func setExternalResourceKeys(objectMeta *metav1.ObjectMeta, data map[string]string) {
+	if objectMeta.Annotations == nil {
+		objectMeta.Annotations = map[string]string{}
+	}
+	objectMeta.Annotations[externalClusterDetailsKeysAnnotation] = externalResourceKeysValue(data)
+}
+
+// getExternalResourceKeys returns the keys of an object that came from the
+// external cluster details. Nothing is returned for the objects created
+// before the keys were recorded, so that none of their keys is removed.
+func getExternalResourceKeys(objectMeta *metav1.ObjectMeta) []string {
+	value := objectMeta.Annotations[externalClusterDetailsKeysAnnotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// externalResourceKeysValue returns the sorted keys of the data, separated by
+// commas, which are not allowed in the keys of ConfigMaps and Secrets
+func externalResourceKeysValue(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// changedExternalResourceKeys returns the sorted keys that were added or
+// changed in the desired data, and the previous keys that were removed from it
+func changedExternalResourceKeys(found, desired map[string]string, previousKeys []string) []string {
+	changedKeys := []string{}
+	for k, v := range desired {
+		if foundValue, ok := found[k]; !ok || foundValue != v {
+			changedKeys = append(changedKeys, k)
+		}
+	}
+	for _, k := range previousKeys {
+		if _, ok := desired[k]; ok {
+			continue
+		}
+		if _, ok := found[k]; ok {
+			changedKeys = append(changedKeys, k)
+		}
+	}
+	sort.Strings(changedKeys)
+	return changedKeys
+}
+
+// secretDataToStrings converts the data of a secret to strings
+func secretDataToStrings(data map[string][]byte) map[string]string {
+	stringData := make(map[string]string, len(data))
+	for k, v := range data {
+		stringData[k] = string(v)
+	}
+	return stringData
+}
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	snapapi "github.com/kubernetes-csi/external-snapshotter/v2/pkg/apis/volumesnapshot/v1beta1"
 	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
 	api "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
@@ -17,12 +18,39 @@ import (
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// mockMgrPort is the port of a listener that stands in for the mgr
+// monitoring endpoint of the external cluster
+var mockMgrPort = startMockMgr()
+
+// startMockMgr accepts connections on a local port for the lifetime of the
+// tests and returns the port
+func startMockMgr() string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
 var ExternalResources = []ExternalResource{
 	{
 		Kind: "ConfigMap",
@@ -41,6 +69,38 @@ var ExternalResources = []ExternalResource{
 		},
 		Name: "rook-csi-rbd-node",
 	},
+	{
+		Kind: "Secret",
+		Data: map[string]string{
+			"userKey": "someUserKeyRBD==",
+			"userID":  "csi-rbd-provisioner",
+		},
+		Name: "rook-csi-rbd-provisioner",
+	},
+	{
+		Kind: "Secret",
+		Data: map[string]string{
+			"adminKey": "someAdminKeyCephFS==",
+			"adminID":  "csi-cephfs-node",
+		},
+		Name: "rook-csi-cephfs-node",
+	},
+	{
+		Kind: "Secret",
+		Data: map[string]string{
+			"adminKey": "someAdminKeyCephFS==",
+			"adminID":  "csi-cephfs-provisioner",
+		},
+		Name: "rook-csi-cephfs-provisioner",
+	},
+	{
+		Kind: "CephCluster",
+		Data: map[string]string{
+			"MonitoringEndpoint": "127.0.0.1",
+			"MonitoringPort":     mockMgrPort,
+		},
+		Name: "monitoring-endpoint",
+	},
 	{
 		Kind: "StorageClass",
 		Data: map[string]string{
@@ -115,6 +175,23 @@ func createExternalCephClusterSecret(extResources []ExternalResource) (*corev1.S
 	return externalSecret, err
 }
 
+// withRequiredExternalResources adds the required resources of the external
+// cluster details that are missing from the given resources, taken from
+// ExternalResources
+func withRequiredExternalResources(extResources []ExternalResource) []ExternalResource {
+	found := map[string]bool{}
+	for _, resource := range extResources {
+		found[resource.Kind+"/"+resource.Name] = true
+	}
+	for _, resource := range ExternalResources {
+		schema, ok := getExternalResourceSchema(resource.Kind, resource.Name)
+		if ok && schema.required && !found[resource.Kind+"/"+resource.Name] {
+			extResources = append(extResources, resource)
+		}
+	}
+	return extResources
+}
+
 func createExternalClusterReconciler(t *testing.T) StorageClusterReconciler {
 	return createExternalClusterReconcilerFromCustomResources(t, ExternalResources)
 }
@@ -301,7 +378,7 @@ func TestOptionalExternalStorageClusterResources(t *testing.T) {
 
 	for _, testParam := range optionalTestParams {
 		extResources := removeNamedResourceFromArray(ExternalResources, testParam.resourceToBeRemoved)
-		reconciler := createExternalClusterReconcilerFromCustomResources(t, extResources)
+		reconciler := createExternalClusterReconcilerFromCustomResources(t, withRequiredExternalResources(extResources))
 		result, err := reconciler.Reconcile(request)
 		assert.NoError(t, err)
 		assert.Equal(t, reconcile.Result{}, result)
@@ -396,8 +473,12 @@ func assertCephObjectStore(t *testing.T, reconciler StorageClusterReconciler, re
 		assert.Equal(t, portFound, fmt.Sprintf("%d", cObjS.Spec.Gateway.Port))
 		// length of 'ExternalRgwEndpoints' should be atleast 1
 		assert.True(t, len(cObjS.Spec.Gateway.ExternalRgwEndpoints) > 0, true)
-		// and the first IP should be that of the host we passed from 'ceph-rgw' resource
-		assert.Equal(t, hostFound, cObjS.Spec.Gateway.ExternalRgwEndpoints[0].IP)
+		// and the IPs should be those of the host we passed from 'ceph-rgw' resource
+		resolved, err := net.LookupHost(hostFound)
+		assert.NoError(t, err)
+		for _, address := range cObjS.Spec.Gateway.ExternalRgwEndpoints {
+			assert.Contains(t, resolved, address.IP)
+		}
 	}
 }
 
@@ -474,3 +555,268 @@ func assertReconciliationOfExternalResource(t *testing.T, reconciler StorageClus
 	assert.Equal(t, secondExtSecretChecksum, thirdExtSecretChecksum)
 
 }
+
+func TestExternalResourceUpdates(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "ocsinit",
+			Namespace: "",
+		},
+	}
+	newExternalResources := func(userKey string, mapping bool, operatorSecret bool) []ExternalResource {
+		monEndpoints := ExternalResource{
+			Kind: "ConfigMap",
+			Data: map[string]string{"maxMonId": "0", "data": "a=10.20.30.40:1234"},
+			Name: "rook-ceph-mon-endpoints",
+		}
+		if mapping {
+			monEndpoints.Data["mapping"] = "{}"
+		}
+		extResources := []ExternalResource{
+			monEndpoints,
+			{
+				Kind: "Secret",
+				Data: map[string]string{"userKey": userKey, "userID": "csi-rbd-node"},
+				Name: "rook-csi-rbd-node",
+			},
+			{
+				Kind: "StorageClass",
+				Data: map[string]string{"pool": "device_health_metrics"},
+				Name: "ceph-rbd",
+			},
+		}
+		if operatorSecret {
+			extResources = append(extResources, ExternalResource{
+				Kind: "Secret",
+				Data: map[string]string{"userKey": "someUserKey==", "userID": "client.healthchecker"},
+				Name: "rook-ceph-operator-creds",
+			})
+		}
+		return withRequiredExternalResources(extResources)
+	}
+
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, newExternalResources("someUserKeyRBD==", true, true))
+	_, err := reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	assertExpectedExternalResources(t, reconciler)
+	recorder := reconciler.recorder.(*record.FakeRecorder)
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+
+	// Rook adds its own keys to the mon endpoints ConfigMap
+	cm := &corev1.ConfigMap{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rook-ceph-mon-endpoints"}, cm)
+	assert.NoError(t, err)
+	assert.Equal(t, "data,mapping,maxMonId", cm.Annotations[externalClusterDetailsKeysAnnotation])
+	cm.Data["csi-cluster-config-json"] = "[]"
+	err = reconciler.Client.Update(context.TODO(), cm)
+	assert.NoError(t, err)
+
+	// rotate a key, drop a ConfigMap entry and remove a Secret
+	extSecret, err := createExternalCephClusterSecret(newExternalResources("rotatedUserKeyRBD==", false, false))
+	assert.NoError(t, err)
+	secret := &corev1.Secret{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalClusterDetailsSecret}, secret)
+	assert.NoError(t, err)
+	secret.Data = extSecret.Data
+	err = reconciler.Client.Update(context.TODO(), secret)
+	assert.NoError(t, err)
+
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	assertExpectedExternalResources(t, reconciler)
+
+	cm = &corev1.ConfigMap{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rook-ceph-mon-endpoints"}, cm)
+	assert.NoError(t, err)
+	assert.NotContains(t, cm.Data, "mapping")
+	assert.Equal(t, "[]", cm.Data["csi-cluster-config-json"])
+	assert.Equal(t, "data,maxMonId", cm.Annotations[externalClusterDetailsKeysAnnotation])
+	assert.Equal(t, "ocsinit", cm.Labels[externalClusterDetailsLabel])
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rook-ceph-operator-creds"}, &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err), "removed secret was not deleted: %v", err)
+
+	events := []string{}
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	assert.ElementsMatch(t, []string{
+		"Normal ExternalClusterDetailsChanged Updated ConfigMap rook-ceph-mon-endpoints from the external cluster details, changed keys: mapping",
+		"Normal ExternalClusterDetailsChanged Updated Secret rook-csi-rbd-node from the external cluster details, changed keys: userKey",
+		"Normal ExternalClusterDetailsChanged Deleted Secret rook-ceph-operator-creds, it was removed from the external cluster details",
+	}, events)
+
+	// no update without a change of the external cluster details
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	assert.Len(t, recorder.Events, 0)
+}
+
+func TestExternalMultipleStorageClasses(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "ocsinit",
+			Namespace: "",
+		},
+	}
+	extResources := []ExternalResource{
+		{
+			Kind: "ConfigMap",
+			Data: map[string]string{"maxMonId": "1", "data": "b=10.20.30.41:6789,a=10.20.30.40:6789"},
+			Name: "rook-ceph-mon-endpoints",
+		},
+		{
+			Kind: "StorageClass",
+			Data: map[string]string{"pool": "replicapool"},
+			Name: "ceph-rbd",
+		},
+		{
+			Kind: "StorageClass",
+			Data: map[string]string{"pool": "tenants", "radosNamespace": "tenant-a"},
+			Name: "ceph-rbd-tenant-a",
+		},
+		{
+			Kind: "StorageClass",
+			Data: map[string]string{"fsName": "myfs", "pool": "myfs-data0", "subvolumeGroup": "tenant-a"},
+			Name: "cephfs-tenant-a",
+		},
+	}
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, withRequiredExternalResources(extResources))
+	rookEntry := `{"clusterID":"openshift-storage","monitors":["10.20.30.40:6789"]}`
+	err := reconciler.Client.Create(context.TODO(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: csiConfigMapName},
+		Data:       map[string]string{csiConfigMapKey: "[" + rookEntry + "]"},
+	})
+	assert.NoError(t, err)
+
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	sc := &api.StorageCluster{}
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, sc)
+	assert.NoError(t, err)
+	rbdClusterID := generateExternalCSIClusterID(sc, "ceph-rbd-tenant-a")
+	cephfsClusterID := generateExternalCSIClusterID(sc, "cephfs-tenant-a")
+
+	// one StorageClass per pool and filesystem, named after its entry
+	expectedParameters := map[string]map[string]string{
+		"ocsinit-ceph-rbd":          {"pool": "replicapool", "clusterID": ""},
+		"ocsinit-ceph-rbd-tenant-a": {"pool": "tenants", "clusterID": rbdClusterID},
+		"ocsinit-cephfs-tenant-a":   {"fsName": "myfs", "pool": "myfs-data0", "clusterID": cephfsClusterID},
+	}
+	for name, parameters := range expectedParameters {
+		actual := &storagev1.StorageClass{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name}, actual)
+		if assert.NoError(t, err) {
+			for k, v := range parameters {
+				assert.Equalf(t, v, actual.Parameters[k], "unexpected parameter %s of StorageClass %s", k, name)
+			}
+			assert.NotContains(t, actual.Parameters, externalRadosNamespaceKey)
+			assert.NotContains(t, actual.Parameters, externalSubvolumeGroupKey)
+			assert.Equal(t, "ocsinit", actual.Labels[externalClusterDetailsLabel])
+		}
+	}
+	assertRookCephOperatorConfigValue(t, reconciler, "true")
+
+	// the isolated entries get their own SnapshotClass as well
+	expectedSnapshotClasses := map[string]string{
+		"ocsinit-ceph-rbd-tenant-a-snapclass": rbdClusterID,
+		"ocsinit-cephfs-tenant-a-snapclass":   cephfsClusterID,
+	}
+	for name, clusterID := range expectedSnapshotClasses {
+		actual := &snapapi.VolumeSnapshotClass{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name}, actual)
+		if assert.NoError(t, err) {
+			assert.Equal(t, clusterID, actual.Parameters["clusterID"])
+			assert.Equal(t, "ocsinit", actual.Labels[externalClusterDetailsLabel])
+		}
+	}
+
+	// the ceph-csi cluster configuration keeps the entry of Rook
+	csiConfig := &corev1.ConfigMap{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: csiConfigMapName}, csiConfig)
+	assert.NoError(t, err)
+	monitors := []interface{}{"10.20.30.40:6789", "10.20.30.41:6789"}
+	expectedEntries := []map[string]interface{}{
+		{"clusterID": "openshift-storage", "monitors": []interface{}{"10.20.30.40:6789"}},
+		{"clusterID": rbdClusterID, "monitors": monitors, "radosNamespace": "tenant-a"},
+		{"clusterID": cephfsClusterID, "monitors": monitors, "cephFS": map[string]interface{}{"subvolumeGroup": "tenant-a"}},
+	}
+	entries := []map[string]interface{}{}
+	err = json.Unmarshal([]byte(csiConfig.Data[csiConfigMapKey]), &entries)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, expectedEntries, entries)
+
+	// Rook rewrites the configuration, the entries are added back
+	csiConfig.Data[csiConfigMapKey] = "[" + rookEntry + "]"
+	err = reconciler.Client.Update(context.TODO(), csiConfig)
+	assert.NoError(t, err)
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: csiConfigMapName}, csiConfig)
+	assert.NoError(t, err)
+	err = json.Unmarshal([]byte(csiConfig.Data[csiConfigMapKey]), &entries)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, expectedEntries, entries)
+
+	// the entry of a removed RADOS namespace is removed
+	extSecret, err := createExternalCephClusterSecret(withRequiredExternalResources(removeNamedResourceFromArray(extResources, "ceph-rbd-tenant-a")))
+	assert.NoError(t, err)
+	secret := &corev1.Secret{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalClusterDetailsSecret}, secret)
+	assert.NoError(t, err)
+	secret.Data = extSecret.Data
+	err = reconciler.Client.Update(context.TODO(), secret)
+	assert.NoError(t, err)
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: csiConfigMapName}, csiConfig)
+	assert.NoError(t, err)
+	entries = nil
+	err = json.Unmarshal([]byte(csiConfig.Data[csiConfigMapKey]), &entries)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []map[string]interface{}{expectedEntries[0], expectedEntries[2]}, entries)
+	assert.Equal(t, cephfsClusterID, csiConfig.Annotations[externalCSIClusterIDsAnnotation])
+	// and so are its StorageClass and SnapshotClass
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-tenant-a"}, &storagev1.StorageClass{})
+	assert.True(t, errors.IsNotFound(err))
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephfs-tenant-a"}, &storagev1.StorageClass{})
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-tenant-a-snapclass"}, &snapapi.VolumeSnapshotClass{})
+	assert.True(t, errors.IsNotFound(err))
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephfs-tenant-a-snapclass"}, &snapapi.VolumeSnapshotClass{})
+	assert.NoError(t, err)
+
+	// a rewrite of the ceph-csi cluster configuration requeues the external
+	// StorageClusters
+	assert.True(t, reconciler.isCSIConfigMap(&csiConfig.ObjectMeta, csiConfig))
+	assert.False(t, reconciler.isCSIConfigMap(&metav1.ObjectMeta{Name: KMSConfigMapName}, &corev1.ConfigMap{}))
+	requests := reconciler.csiConfigToStorageClusters(handler.MapObject{Meta: &csiConfig.ObjectMeta, Object: csiConfig})
+	assert.Equal(t, []reconcile.Request{request}, requests)
+
+	// the StorageClasses of the entries are removed on uninstall
+	var storageClasses ocsStorageClass
+	err = storageClasses.ensureDeleted(&reconciler, sc)
+	assert.NoError(t, err)
+	for _, name := range []string{"ocsinit-ceph-rbd", "ocsinit-cephfs-tenant-a"} {
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name}, &storagev1.StorageClass{})
+		assert.Truef(t, errors.IsNotFound(err), "StorageClass %s is not deleted", name)
+	}
+}
+
+func TestExternalClusterDetailsSecretPredicate(t *testing.T) {
+	reconciler := createFakeStorageClusterReconciler(t)
+	reconciler.watchNamespace = "openshift-storage"
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: externalClusterDetailsSecret, Namespace: "openshift-storage"}}
+	assert.True(t, reconciler.isExternalClusterDetailsSecret(secret, secret))
+
+	// other secrets, and the secrets outside of the watched namespace, do
+	// not requeue the external StorageClusters
+	other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "openshift-storage"}}
+	assert.False(t, reconciler.isExternalClusterDetailsSecret(other, other))
+	elsewhere := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: externalClusterDetailsSecret, Namespace: "default"}}
+	assert.False(t, reconciler.isExternalClusterDetailsSecret(elsewhere, elsewhere))
+	configMap := &corev1.ConfigMap{ObjectMeta: secret.ObjectMeta}
+	assert.False(t, reconciler.isExternalClusterDetailsSecret(configMap, configMap))
+}
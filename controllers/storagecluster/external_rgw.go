@@ -0,0 +1,177 @@
+package storagecluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// externalCephRgwCABundleSecretKey holds the name of the secret with the
+	// CA bundle of HTTPS RGW endpoints
+	externalCephRgwCABundleSecretKey = "caBundleSecret"
+	// rgwCABundleKey is the key of the CA bundle in its secret
+	rgwCABundleKey = "cabundle"
+	// obcCABundleSecretNameKey and obcCABundleSecretNamespaceKey are the
+	// parameters of the OBC StorageClass that refer to the CA bundle secret
+	// of HTTPS RGW endpoints
+	obcCABundleSecretNameKey      = "caBundleSecretName"
+	obcCABundleSecretNamespaceKey = "caBundleSecretNamespace"
+)
+
+// lookupHost resolves the hostnames of the RGW endpoints, it is replaced in tests
+var lookupHost = net.LookupHost
+
+// externalRGWEndpoint is an RGW endpoint of the external cluster details
+type externalRGWEndpoint struct {
+	secure bool
+	host   string
+	port   int32
+}
+
+func (e externalRGWEndpoint) String() string {
+	scheme := "http"
+	if e.secure {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(e.host, strconv.Itoa(int(e.port))))
+}
+
+// parseExternalRGWEndpoints parses the comma separated RGW endpoints of the
+// form [http[s]://]<host>:<port>. The host is an IP address or a hostname.
+// The gateway of the CephObjectStore has a single port, so all endpoints
+// must use the same scheme and port.
+func parseExternalRGWEndpoints(value string) ([]externalRGWEndpoint, error) {
+	endpoints := []externalRGWEndpoint{}
+	for _, endpoint := range strings.Split(value, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		rgwEndpoint := externalRGWEndpoint{}
+		if strings.HasPrefix(endpoint, "https://") {
+			rgwEndpoint.secure = true
+			endpoint = strings.TrimPrefix(endpoint, "https://")
+		} else {
+			endpoint = strings.TrimPrefix(endpoint, "http://")
+		}
+		host, portStr, err := net.SplitHostPort(strings.TrimSuffix(endpoint, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rgw endpoint %q: %v", endpoint, err)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("invalid rgw endpoint %q: the host is empty", endpoint)
+		}
+		port, err := strconv.ParseInt(portStr, 10, 32)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid rgw endpoint %q: invalid port %q", endpoint, portStr)
+		}
+		rgwEndpoint.host = host
+		rgwEndpoint.port = int32(port)
+		if len(endpoints) != 0 && (endpoints[0].secure != rgwEndpoint.secure || endpoints[0].port != rgwEndpoint.port) {
+			return nil, fmt.Errorf("rgw endpoint %q does not use the scheme and port of %q", rgwEndpoint, endpoints[0])
+		}
+		endpoints = append(endpoints, rgwEndpoint)
+	}
+	return endpoints, nil
+}
+
+// newExternalGatewaySpec returns the gateway of the external CephObjectStore.
+// Kubernetes endpoints only accept IP addresses, so the hostnames are
+// resolved. As their addresses may change, this runs on every reconcile. The
+// hostnames that cannot be resolved are skipped as long as one endpoint has an
+// address.
+func newExternalGatewaySpec(rgwEndpoints []externalRGWEndpoint) (*cephv1.GatewaySpec, error) {
+	if len(rgwEndpoints) == 0 {
+		return nil, fmt.Errorf("no rgw endpoint provided")
+	}
+	var gateWay cephv1.GatewaySpec
+	ips := []string{}
+	errs := []string{}
+	for _, rgwEndpoint := range rgwEndpoints {
+		resolved, err := resolveHost(rgwEndpoint.host)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to resolve rgw endpoint %q: %v", rgwEndpoint, err))
+			continue
+		}
+		ips = append(ips, resolved...)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no rgw endpoint could be resolved: %s", strings.Join(errs, ", "))
+	}
+	sort.Strings(ips)
+	for i, ip := range ips {
+		if i == 0 || ips[i-1] != ip {
+			gateWay.ExternalRgwEndpoints = append(gateWay.ExternalRgwEndpoints, corev1.EndpointAddress{IP: ip})
+		}
+	}
+	// the certificate of the RGW is not managed by the operator, its CA
+	// bundle is passed to the clients by the OBC StorageClass
+	if rgwEndpoints[0].secure {
+		gateWay.SecurePort = rgwEndpoints[0].port
+	} else {
+		gateWay.Port = rgwEndpoints[0].port
+	}
+	return &gateWay, nil
+}
+
+// checkAnyRGWEndpointReachable returns an error if none of the RGW endpoints
+// is reachable. The unreachable endpoints are logged.
+func (r *StorageClusterReconciler) checkAnyRGWEndpointReachable(rgwEndpoints []externalRGWEndpoint, rootCAs *x509.CertPool, timeout time.Duration) error {
+	errs := []string{}
+	for _, rgwEndpoint := range rgwEndpoints {
+		err := checkRGWEndpointReachable(rgwEndpoint, rootCAs, timeout)
+		if err == nil {
+			return nil
+		}
+		r.Log.Info(fmt.Sprintf("WARNING: RGW endpoint, %q, is not reachable: %v", rgwEndpoint, err))
+		errs = append(errs, fmt.Sprintf("%s: %v", rgwEndpoint, err))
+	}
+	return fmt.Errorf("no rgw endpoint is reachable: %s", strings.Join(errs, ", "))
+}
+
+// getExternalRGWRootCAs returns the CA bundle of the HTTPS RGW endpoints. It
+// is nil if no CA bundle secret is given, the system CAs are used then.
+func (r *StorageClusterReconciler) getExternalRGWRootCAs(instance *ocsv1.StorageCluster, caBundleSecret string) (*x509.CertPool, error) {
+	if caBundleSecret == "" {
+		return nil, nil
+	}
+	secret, err := r.retrieveSecret(caBundleSecret, instance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the rgw CA bundle secret %q: %v", caBundleSecret, err)
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(secret.Data[rgwCABundleKey]) {
+		return nil, fmt.Errorf("the rgw CA bundle secret %q has no PEM certificate in %q", caBundleSecret, rgwCABundleKey)
+	}
+	return rootCAs, nil
+}
+
+// checkRGWEndpointReachable connects to the RGW endpoint. For HTTPS endpoints
+// it performs a TLS handshake, that verifies the certificate of the endpoint
+// against the given CAs.
+func checkRGWEndpointReachable(rgwEndpoint externalRGWEndpoint, rootCAs *x509.CertPool, timeout time.Duration) error {
+	address := net.JoinHostPort(rgwEndpoint.host, strconv.Itoa(int(rgwEndpoint.port)))
+	if !rgwEndpoint.secure {
+		return checkEndpointReachable(address, timeout)
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		RootCAs:    rootCAs,
+		ServerName: rgwEndpoint.host,
+		MinVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,238 @@
+package storagecluster
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestParseExternalRGWEndpoints(t *testing.T) {
+	cases := []struct {
+		label     string
+		value     string
+		expected  []externalRGWEndpoint
+		expectErr bool
+	}{
+		{
+			label:    "IP address without scheme",
+			value:    "10.20.30.40:8080",
+			expected: []externalRGWEndpoint{{host: "10.20.30.40", port: 8080}},
+		},
+		{
+			label: "multiple HTTPS hostnames",
+			value: "https://rgw-a.example.com:443, https://rgw-b.example.com:443/",
+			expected: []externalRGWEndpoint{
+				{secure: true, host: "rgw-a.example.com", port: 443},
+				{secure: true, host: "rgw-b.example.com", port: 443},
+			},
+		},
+		{
+			label:    "IPv6 address",
+			value:    "http://[fd00::10]:8080",
+			expected: []externalRGWEndpoint{{host: "fd00::10", port: 8080}},
+		},
+		{
+			label:     "missing port",
+			value:     "https://rgw.example.com",
+			expectErr: true,
+		},
+		{
+			label:     "mixed schemes",
+			value:     "https://rgw-a.example.com:443,http://rgw-b.example.com:443",
+			expectErr: true,
+		},
+		{
+			label:     "different ports",
+			value:     "10.20.30.40:8080,10.20.30.41:8081",
+			expectErr: true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Case %d: %s\n", i+1, c.label)
+		actual, err := parseExternalRGWEndpoints(c.value)
+		if c.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, actual)
+	}
+}
+
+func TestNewExternalGatewaySpec(t *testing.T) {
+	defer func(f func(string) ([]string, error)) { lookupHost = f }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		switch host {
+		case "rgw-a.example.com":
+			return []string{"10.20.30.41", "10.20.30.42"}, nil
+		case "rgw-b.example.com":
+			return []string{"10.20.30.42"}, nil
+		}
+		return nil, fmt.Errorf("no such host %q", host)
+	}
+
+	rgwEndpoints, err := parseExternalRGWEndpoints("https://rgw-a.example.com:443,https://rgw-b.example.com:443,https://10.20.30.40:443")
+	assert.NoError(t, err)
+	gateway, err := newExternalGatewaySpec(rgwEndpoints)
+	assert.NoError(t, err)
+	assert.Equal(t, []corev1.EndpointAddress{{IP: "10.20.30.40"}, {IP: "10.20.30.41"}, {IP: "10.20.30.42"}}, gateway.ExternalRgwEndpoints)
+	assert.Equal(t, int32(443), gateway.SecurePort)
+	assert.Equal(t, int32(0), gateway.Port)
+	// the CA bundle is not the certificate of the gateway
+	assert.Equal(t, "", gateway.SSLCertificateRef)
+
+	// a hostname that cannot be resolved is skipped
+	rgwEndpoints, err = parseExternalRGWEndpoints("rgw-b.example.com:8080,rgw-c.example.com:8080")
+	assert.NoError(t, err)
+	gateway, err = newExternalGatewaySpec(rgwEndpoints)
+	assert.NoError(t, err)
+	assert.Equal(t, []corev1.EndpointAddress{{IP: "10.20.30.42"}}, gateway.ExternalRgwEndpoints)
+
+	rgwEndpoints, err = parseExternalRGWEndpoints("rgw-c.example.com:8080")
+	assert.NoError(t, err)
+	_, err = newExternalGatewaySpec(rgwEndpoints)
+	assert.Error(t, err)
+}
+
+func TestEnsureExternalCephObjectStores(t *testing.T) {
+	addresses := []string{"10.20.30.41"}
+	defer func(f func(string) ([]string, error)) { lookupHost = f }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		return addresses, nil
+	}
+	sc := createDefaultStorageCluster()
+	reconciler := createFakeStorageClusterReconciler(t, sc)
+	data := []ExternalResource{
+		{
+			Kind: "StorageClass",
+			Data: map[string]string{"endpoint": "rgw.example.com:8080"},
+			Name: "ceph-rgw",
+		},
+	}
+
+	err := reconciler.ensureExternalCephObjectStores(sc, data)
+	assert.NoError(t, err)
+	objectStore := &cephv1.CephObjectStore{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephObjectStore(sc), Namespace: sc.Namespace}, objectStore)
+	assert.NoError(t, err)
+	assert.Equal(t, []corev1.EndpointAddress{{IP: "10.20.30.41"}}, objectStore.Spec.Gateway.ExternalRgwEndpoints)
+
+	// the hostname is resolved again when its address changes
+	addresses = []string{"10.20.30.42"}
+	err = reconciler.ensureExternalCephObjectStores(sc, data)
+	assert.NoError(t, err)
+	objectStore = &cephv1.CephObjectStore{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephObjectStore(sc), Namespace: sc.Namespace}, objectStore)
+	assert.NoError(t, err)
+	assert.Equal(t, []corev1.EndpointAddress{{IP: "10.20.30.42"}}, objectStore.Spec.Gateway.ExternalRgwEndpoints)
+}
+
+func TestCheckRGWEndpointReachable(t *testing.T) {
+	rgw := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer rgw.Close()
+	rgwURL, err := url.Parse(rgw.URL)
+	assert.NoError(t, err)
+	rgwEndpoints, err := parseExternalRGWEndpoints(rgw.URL)
+	assert.NoError(t, err)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(rgw.Certificate())
+
+	// the certificate is verified against the CA bundle
+	assert.NoError(t, checkRGWEndpointReachable(rgwEndpoints[0], rootCAs, 5*time.Second))
+	assert.Error(t, checkRGWEndpointReachable(rgwEndpoints[0], x509.NewCertPool(), 5*time.Second))
+
+	// an HTTP endpoint is only dialed
+	rgwEndpoints, err = parseExternalRGWEndpoints("http://" + rgwURL.Host)
+	assert.NoError(t, err)
+	assert.NoError(t, checkRGWEndpointReachable(rgwEndpoints[0], nil, 5*time.Second))
+
+	// a closed port is unreachable
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+	rgwEndpoints, err = parseExternalRGWEndpoints("https://" + address)
+	assert.NoError(t, err)
+	assert.Error(t, checkRGWEndpointReachable(rgwEndpoints[0], rootCAs, 5*time.Second))
+}
+
+func TestExternalHTTPSRGW(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "ocsinit",
+			Namespace: "",
+		},
+	}
+	rgw := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer rgw.Close()
+	rgwURL, err := url.Parse(rgw.URL)
+	assert.NoError(t, err)
+
+	extResources := []ExternalResource{
+		{
+			Kind: "ConfigMap",
+			Data: map[string]string{"maxMonId": "0", "data": "a=10.20.30.40:6789"},
+			Name: "rook-ceph-mon-endpoints",
+		},
+		{
+			Kind: "StorageClass",
+			// the second endpoint is unreachable, one is enough
+			Data: map[string]string{"endpoint": rgw.URL + ",https://127.0.0.2:" + rgwURL.Port(), "caBundleSecret": "rgw-ca"},
+			Name: "ceph-rgw",
+		},
+	}
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, withRequiredExternalResources(extResources))
+
+	// the handshake fails without the CA bundle of the endpoint
+	err = reconciler.Client.Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "rgw-ca"},
+		Data:       map[string][]byte{rgwCABundleKey: []byte("not a certificate")},
+	})
+	assert.NoError(t, err)
+	_, err = reconciler.Reconcile(request)
+	assert.Error(t, err)
+
+	caSecret := &corev1.Secret{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rgw-ca"}, caSecret)
+	assert.NoError(t, err)
+	caSecret.Data[rgwCABundleKey] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rgw.Certificate().Raw})
+	err = reconciler.Client.Update(context.TODO(), caSecret)
+	assert.NoError(t, err)
+	_, err = reconciler.Reconcile(request)
+	assert.NoError(t, err)
+
+	sc := &api.StorageCluster{}
+	err = reconciler.Client.Get(context.TODO(), request.NamespacedName, sc)
+	assert.NoError(t, err)
+	objectStore := &cephv1.CephObjectStore{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephObjectStore(sc)}, objectStore)
+	assert.NoError(t, err)
+	assert.Equal(t, []corev1.EndpointAddress{{IP: rgwURL.Hostname()}, {IP: "127.0.0.2"}}, objectStore.Spec.Gateway.ExternalRgwEndpoints)
+	assert.Equal(t, rgwURL.Port(), fmt.Sprintf("%d", objectStore.Spec.Gateway.SecurePort))
+	assert.Equal(t, "", objectStore.Spec.Gateway.SSLCertificateRef)
+
+	// the OBC StorageClass refers to the CA bundle
+	obcStorageClass := &storagev1.StorageClass{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephRgwSC(sc)}, obcStorageClass)
+	assert.NoError(t, err)
+	assert.Equal(t, "rgw-ca", obcStorageClass.Parameters[obcCABundleSecretNameKey])
+	assert.Equal(t, sc.Namespace, obcStorageClass.Parameters[obcCABundleSecretNamespaceKey])
+	assert.NotContains(t, obcStorageClass.Parameters, externalCephRgwCABundleSecretKey)
+}
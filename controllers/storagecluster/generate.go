@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/util"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 func generateNameForCephCluster(initData *ocsv1.StorageCluster) string {
@@ -18,6 +20,12 @@ func generateNameForCephFilesystem(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-cephfilesystem", initData.Name)
 }
 
+// generateNameForCephFilesystemDataPool returns the name Rook gives to the
+// data pool at the given index of the CephFilesystem
+func generateNameForCephFilesystemDataPool(initData *ocsv1.StorageCluster, index int) string {
+	return fmt.Sprintf("%s-data%d", generateNameForCephFilesystem(initData), index)
+}
+
 func generateNameForCephObjectStoreUser(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-cephobjectstoreuser", initData.Name)
 }
@@ -26,6 +34,33 @@ func generateNameForCephBlockPool(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-cephblockpool", initData.Name)
 }
 
+func generateNameForAdditionalCephBlockPool(initData *ocsv1.StorageCluster, poolName string) string {
+	return fmt.Sprintf("%s-%s", generateNameForCephBlockPool(initData), poolName)
+}
+
+// generateNameForPoolQuotaJob returns the name of the Job setting the quota
+// of a CephBlockPool. The name of a Job is also the value of the job-name label
+// of its pods, so it is shortened to the length of a label value.
+func generateNameForPoolQuotaJob(poolName string) string {
+	return util.ShortenName(fmt.Sprintf("%s-quota", poolName), validation.LabelValueMaxLength)
+}
+
+// generateNameForPoolQuotaCephClient returns the name of the CephClient the
+// pool quota Jobs authenticate as
+func generateNameForPoolQuotaCephClient(initData *ocsv1.StorageCluster) string {
+	return fmt.Sprintf("%s-pool-quota", initData.Name)
+}
+
+// generateNameForCephClientSecret returns the name of the Secret Rook creates
+// with the key of a CephClient
+func generateNameForCephClientSecret(clientName string) string {
+	return fmt.Sprintf("rook-ceph-client-%s", clientName)
+}
+
+func generateNameForCephRBDMirror(initData *ocsv1.StorageCluster) string {
+	return fmt.Sprintf("%s-cephrbdmirror", initData.Name)
+}
+
 func generateNameForCephObjectStore(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-%s", initData.Name, "cephobjectstore")
 }
@@ -42,12 +77,43 @@ func generateNameForCephBlockPoolSC(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-ceph-rbd", initData.Name)
 }
 
+// generateNameForExternalSC returns the name of the StorageClass of an entry
+// of the external cluster details
+func generateNameForExternalSC(initData *ocsv1.StorageCluster, entryName string) string {
+	return fmt.Sprintf("%s-%s", initData.Name, entryName)
+}
+
+func generateNameForAdditionalCephBlockPoolSC(initData *ocsv1.StorageCluster, poolName string) string {
+	return fmt.Sprintf("%s-%s", generateNameForCephBlockPoolSC(initData), poolName)
+}
+
+func generateNameForEncryptedCephBlockPoolSC(initData *ocsv1.StorageCluster) string {
+	if initData.Spec.Encryption.StorageClassName != "" {
+		return initData.Spec.Encryption.StorageClassName
+	}
+	return fmt.Sprintf("%s-encrypted", generateNameForCephBlockPoolSC(initData))
+}
+
 // generateNameForSnapshotClass function generates 'SnapshotClass' name.
 // 'snapshotType' can be: 'rbdSnapshotter' or 'cephfsSnapshotter'
 func generateNameForSnapshotClass(initData *ocsv1.StorageCluster, snapshotType SnapshotterType) string {
 	return fmt.Sprintf("%s-%splugin-snapclass", initData.Name, snapshotType)
 }
 
+func generateNameForAdditionalCephBlockPoolSnapshotClass(initData *ocsv1.StorageCluster, poolName string) string {
+	return fmt.Sprintf("%s-%s", generateNameForSnapshotClass(initData, rbdSnapshotter), poolName)
+}
+
+// generateNameForExternalSnapshotClass returns the name of the SnapshotClass
+// of an entry of the external cluster details
+func generateNameForExternalSnapshotClass(initData *ocsv1.StorageCluster, entryName string) string {
+	return fmt.Sprintf("%s-snapclass", generateNameForExternalSC(initData, entryName))
+}
+
+func generateNameForVolumeReplicationClass(initData *ocsv1.StorageCluster) string {
+	return fmt.Sprintf("%s-rbdplugin-replicationclass", initData.Name)
+}
+
 func generateNameForSnapshotClassDriver(initData *ocsv1.StorageCluster, snapshotType SnapshotterType) string {
 	return fmt.Sprintf("%s.%s.csi.ceph.com", initData.Namespace, snapshotType)
 }
@@ -20,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -160,6 +161,7 @@ func createFakeInitializationStorageClusterReconcilerWithPlatform(t *testing.T,
 		serverVersion: &version.Info{},
 		Log:           logf.Log.WithName("controller_storagecluster_test"),
 		platform:      platform,
+		recorder:      record.NewFakeRecorder(1024),
 	}
 }
 
@@ -0,0 +1,420 @@
+package storagecluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// kmsHealthCheckInterval is the interval of the KMS health checks
+	kmsHealthCheckInterval = 5 * time.Minute
+	// kmsHealthCheckTimeout is the timeout of every connection and request
+	// of a KMS health check
+	kmsHealthCheckTimeout = 5 * time.Second
+
+	defaultVaultBackendPath             = "secret"
+	defaultVaultKubernetesAuthMountPath = "kubernetes"
+)
+
+// kmsHealthError is the failure of a KMS health check, and the reason it is
+// reported with on the KMSConnected condition
+type kmsHealthError struct {
+	reason string
+	err    error
+}
+
+func (e *kmsHealthError) Error() string {
+	return e.err.Error()
+}
+
+func newKMSHealthError(reason string, format string, a ...interface{}) *kmsHealthError {
+	return &kmsHealthError{reason: reason, err: fmt.Errorf(format, a...)}
+}
+
+// kmsHealthResult is the result of a KMS health check
+type kmsHealthResult struct {
+	provider  string
+	address   string
+	checkTime metav1.Time
+	// authChecked is false when the check can not authenticate to the KMS
+	// provider, it then stops at the TLS handshake
+	authChecked bool
+	err         *kmsHealthError
+}
+
+// newKMSHealthChecker returns the checker that periodically checks the health
+// of the KMS of every StorageCluster that enables it. It requeues a
+// StorageCluster when the result of its check changes, the reconcile then sets
+// the KMSConnected condition from the last result.
+func newKMSHealthChecker(r *StorageClusterReconciler) *periodicChecker {
+	c := newPeriodicChecker(r, "KMS health check", kmsHealthCheckInterval, kmsHealthCheckTimeout)
+	c.selects = func(sc *ocsv1.StorageCluster) bool {
+		return sc.Spec.Encryption.KeyManagementService.Enable && !sc.Spec.ExternalStorage.Enable
+	}
+	c.run = func(sc *ocsv1.StorageCluster, timeout time.Duration) (interface{}, error) {
+		// a failed check is a result, it is reported on the condition
+		result := r.checkKMSHealth(sc)
+		if result.err != nil {
+			r.Log.Error(result.err, "KMS health check failed", "StorageCluster", sc.Name, "KMSProvider", result.provider)
+		}
+		return result, nil
+	}
+	c.changed = func(previous, current interface{}) bool {
+		return kmsHealthChanged(previous.(*kmsHealthResult), current.(*kmsHealthResult))
+	}
+	return c
+}
+
+// getKMSHealthResult returns the last result of the KMS health check of the
+// StorageCluster, and whether it was checked already
+func getKMSHealthResult(c *periodicChecker, key types.NamespacedName) (kmsHealthResult, bool) {
+	result, found := c.getResult(key)
+	if !found {
+		return kmsHealthResult{}, false
+	}
+	return *result.(*kmsHealthResult), true
+}
+
+// kmsHealthChanged returns whether the KMS that was checked or the outcome of
+// its check changed between two health checks
+func kmsHealthChanged(previous, current *kmsHealthResult) bool {
+	if previous.provider != current.provider || previous.address != current.address ||
+		previous.authChecked != current.authChecked || (previous.err == nil) != (current.err == nil) {
+		return true
+	}
+	return previous.err != nil && previous.err.reason != current.err.reason
+}
+
+// checkKMSHealth checks the health of the KMS of the StorageCluster
+func (r *StorageClusterReconciler) checkKMSHealth(sc *ocsv1.StorageCluster) *kmsHealthResult {
+	result := &kmsHealthResult{checkTime: metav1.Now()}
+	kmsConfigMap, err := getKMSConfigMap(sc, r.Client, nil)
+	if err != nil {
+		result.err = newKMSHealthError(ocsv1.KMSUnreachable, "failed to get the KMS ConfigMap: %v", err)
+		return result
+	}
+	connectionDetails := getKMSConnectionDetails(kmsConfigMap)
+	result.provider = connectionDetails[KMSProviderKey]
+	result.address = connectionDetails[kmsProviderAddressKeyMap[result.provider]]
+	result.authChecked, result.err = r.probeKMS(sc, connectionDetails)
+	return result
+}
+
+// setKMSHealthStatus sets the KMSConnected condition and the KMS status from
+// the last health check of the KMS. A check is requested if the KMS was not
+// checked yet, or if its provider or address changed since.
+func (r *StorageClusterReconciler) setKMSHealthStatus(sc *ocsv1.StorageCluster) {
+	if !sc.Spec.Encryption.KeyManagementService.Enable {
+		sc.Status.KMS = nil
+		conditionsv1.RemoveStatusCondition(&sc.Status.Conditions, ocsv1.ConditionKMSConnected)
+		return
+	}
+	if r.kmsChecker == nil {
+		return
+	}
+
+	kmsConfigMap, err := getKMSConfigMap(sc, r.Client, nil)
+	if err != nil {
+		r.setKMSConnectedCondition(sc, &kmsHealthResult{
+			err: newKMSHealthError(ocsv1.KMSUnreachable, "failed to get the KMS ConfigMap: %v", err),
+		})
+		return
+	}
+	connectionDetails := getKMSConnectionDetails(kmsConfigMap)
+	provider := connectionDetails[KMSProviderKey]
+	address := connectionDetails[kmsProviderAddressKeyMap[provider]]
+
+	result, found := getKMSHealthResult(r.kmsChecker, types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace})
+	if !found || result.provider != provider || result.address != address {
+		r.kmsChecker.requestCheck()
+		return
+	}
+
+	status := sc.Status.KMS
+	if status == nil || status.Provider != provider || status.Address != address {
+		status = &ocsv1.KMSStatus{Provider: provider, Address: address}
+	}
+	checkTime := result.checkTime
+	status.LastCheckTime = &checkTime
+	if result.err == nil {
+		status.LastSuccessTime = &checkTime
+	}
+	status.AuthenticationChecked = result.authChecked
+	sc.Status.KMS = status
+	r.setKMSConnectedCondition(sc, &result)
+}
+
+// setKMSConnectedCondition sets the KMSConnected condition from the result of
+// the KMS health check, and emits an event when its status changes. Its
+// status is Unknown when the KMS is reachable but the authentication to its
+// provider could not be checked.
+func (r *StorageClusterReconciler) setKMSConnectedCondition(sc *ocsv1.StorageCluster, result *kmsHealthResult) {
+	condition := conditionsv1.Condition{
+		Type:    ocsv1.ConditionKMSConnected,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.KMSConnected,
+		Message: ocsv1.KMSConnectedMessage,
+	}
+	eventType := corev1.EventTypeNormal
+	switch {
+	case result.err != nil:
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = result.err.reason
+		condition.Message = result.err.Error()
+		eventType = corev1.EventTypeWarning
+	case !result.authChecked:
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = ocsv1.KMSAuthenticationNotChecked
+		condition.Message = fmt.Sprintf("The %s KMS is reachable, the authentication to it is not checked", result.provider)
+	}
+
+	previous := conditionsv1.FindStatusCondition(sc.Status.Conditions, ocsv1.ConditionKMSConnected)
+	if previous == nil || previous.Status != condition.Status || previous.Reason != condition.Reason {
+		r.recorder.Event(sc, eventType, condition.Reason, condition.Message)
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, condition)
+}
+
+// probeKMS checks that the KMS is reachable and that its TLS handshake
+// succeeds. For Vault it also checks that the operator can authenticate and
+// access the secret engine with the configured credentials, and returns
+// whether the authentication was checked. The authentication to the other
+// providers is not checked.
+func (r *StorageClusterReconciler) probeKMS(sc *ocsv1.StorageCluster, connectionDetails map[string]string) (bool, *kmsHealthError) {
+	provider := connectionDetails[KMSProviderKey]
+	addressKey, ok := kmsProviderAddressKeyMap[provider]
+	if !ok {
+		return false, newKMSHealthError(ocsv1.KMSUnreachable, "unsupported KMS provider %q", provider)
+	}
+	address := connectionDetails[addressKey]
+	if address == "" {
+		return false, newKMSHealthError(ocsv1.KMSUnreachable, "no %s specified for the %s KMS provider", addressKey, provider)
+	}
+	hostPort, err := kmsAddressHostPort(address)
+	if err != nil {
+		return false, newKMSHealthError(ocsv1.KMSUnreachable, "invalid KMS address %q: %v", address, err)
+	}
+
+	dialer := &net.Dialer{Timeout: kmsHealthCheckTimeout}
+	conn, err := dialer.Dial("tcp", hostPort)
+	if err != nil {
+		return false, newKMSHealthError(ocsv1.KMSUnreachable, "failed to connect to the KMS at %s: %v", hostPort, err)
+	}
+	conn.Close()
+
+	var tlsConfig *tls.Config
+	if !strings.HasPrefix(address, "http://") {
+		tlsConfig, err = r.getKMSTLSConfig(sc, connectionDetails)
+		if err != nil {
+			return false, newKMSHealthError(ocsv1.KMSTLSHandshakeFailed, "failed to load the KMS TLS configuration: %v", err)
+		}
+		tlsConn, err := tls.DialWithDialer(dialer, "tcp", hostPort, tlsConfig)
+		if err != nil {
+			return false, newKMSHealthError(ocsv1.KMSTLSHandshakeFailed, "TLS handshake with the KMS at %s failed: %v", hostPort, err)
+		}
+		tlsConn.Close()
+	}
+
+	if provider != VaultKMSProvider {
+		return false, nil
+	}
+	return r.probeVault(sc, connectionDetails, tlsConfig)
+}
+
+// getKMSTLSConfig returns the TLS configuration to connect to the KMS with,
+// using the CA bundle and client certificate of the KMS secrets
+func (r *StorageClusterReconciler) getKMSTLSConfig(sc *ocsv1.StorageCluster, connectionDetails map[string]string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	var caCert, clientCert, clientKey []byte
+	switch connectionDetails[KMSProviderKey] {
+	case VaultKMSProvider:
+		tlsConfig.ServerName = connectionDetails["VAULT_TLS_SERVER_NAME"]
+		tlsConfig.InsecureSkipVerify = connectionDetails["VAULT_SKIP_VERIFY"] == "true"
+		secretData := map[string]*[]byte{
+			"VAULT_CACERT":      &caCert,
+			"VAULT_CLIENT_CERT": &clientCert,
+			"VAULT_CLIENT_KEY":  &clientKey,
+		}
+		for key, data := range secretData {
+			name := connectionDetails[key]
+			if name == "" {
+				continue
+			}
+			secret, err := r.retrieveSecret(name, sc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the secret %q of %s: %v", name, key, err)
+			}
+			if key == "VAULT_CLIENT_KEY" {
+				*data = secret.Data["key"]
+			} else {
+				*data = secret.Data["cert"]
+			}
+		}
+	case KMIPKMSProvider:
+		tlsConfig.ServerName = connectionDetails["KMIP_TLS_SERVER_NAME"]
+		name := connectionDetails["KMIP_SECRET_NAME"]
+		secret, err := r.retrieveSecret(name, sc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the KMIP secret %q: %v", name, err)
+		}
+		caCert = secret.Data["CA_CERT"]
+		clientCert = secret.Data["CLIENT_CERT"]
+		clientKey = secret.Data["CLIENT_KEY"]
+	}
+
+	if len(caCert) != 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("the KMS CA bundle does not contain a PEM encoded certificate")
+		}
+	}
+	if len(clientCert) != 0 || len(clientKey) != 0 {
+		certificate, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KMS client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// probeVault authenticates to Vault, and checks that the secret engine is
+// accessible with the resulting token. A token obtained from the Kubernetes
+// auth is revoked after the check, so that the periodic checks do not leave
+// a token behind each. It returns whether the authentication was checked.
+func (r *StorageClusterReconciler) probeVault(sc *ocsv1.StorageCluster, connectionDetails map[string]string, tlsConfig *tls.Config) (bool, *kmsHealthError) {
+	httpClient := &http.Client{
+		Timeout:   kmsHealthCheckTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	address := strings.TrimSuffix(connectionDetails["VAULT_ADDR"], "/")
+	headers := map[string]string{}
+	if namespace := connectionDetails["VAULT_NAMESPACE"]; namespace != "" {
+		headers["X-Vault-Namespace"] = namespace
+	}
+
+	var token string
+	if getKMSTokenSecretName(connectionDetails) == "" {
+		// Rook uses the token of the service account its pods run with. Unless
+		// it is configured, the authentication can not be checked here.
+		saName := connectionDetails[VaultKubernetesServiceAccountKey]
+		if saName == "" {
+			return false, nil
+		}
+		jwt, err := r.getServiceAccountToken(sc, saName)
+		if err != nil {
+			return true, newKMSHealthError(ocsv1.KMSAuthenticationFailed, "failed to get the token of the service account %q: %v", saName, err)
+		}
+		mountPath := connectionDetails["VAULT_AUTH_KUBERNETES_MOUNT_PATH"]
+		if mountPath == "" {
+			mountPath = defaultVaultKubernetesAuthMountPath
+		}
+		login := struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}{}
+		body, _ := json.Marshal(map[string]string{"role": connectionDetails["VAULT_AUTH_KUBERNETES_ROLE"], "jwt": jwt})
+		err = doVaultRequest(httpClient, http.MethodPost, fmt.Sprintf("%s/v1/auth/%s/login", address, strings.Trim(mountPath, "/")), headers, bytes.NewReader(body), &login)
+		if err != nil {
+			return true, newKMSHealthError(ocsv1.KMSAuthenticationFailed, "Vault Kubernetes auth failed: %v", err)
+		}
+		token = login.Auth.ClientToken
+		// the headers hold the token by the time it is revoked
+		defer func() {
+			err := doVaultRequest(httpClient, http.MethodPost, address+"/v1/auth/token/revoke-self", headers, nil, nil)
+			if err != nil {
+				r.Log.Error(err, "failed to revoke the Vault token of the KMS health check", "StorageCluster", sc.Name)
+			}
+		}()
+	} else {
+		secret, err := r.retrieveSecret(KMSTokenSecretName, sc)
+		if err != nil {
+			return true, newKMSHealthError(ocsv1.KMSAuthenticationFailed, "failed to get the KMS token secret: %v", err)
+		}
+		token = strings.TrimSpace(string(secret.Data["token"]))
+		headers["X-Vault-Token"] = token
+		err = doVaultRequest(httpClient, http.MethodGet, address+"/v1/auth/token/lookup-self", headers, nil, nil)
+		if err != nil {
+			return true, newKMSHealthError(ocsv1.KMSAuthenticationFailed, "Vault token lookup failed: %v", err)
+		}
+	}
+	headers["X-Vault-Token"] = token
+
+	backendPath := strings.Trim(connectionDetails["VAULT_BACKEND_PATH"], "/")
+	if backendPath == "" {
+		backendPath = defaultVaultBackendPath
+	}
+	err := doVaultRequest(httpClient, http.MethodGet, fmt.Sprintf("%s/v1/sys/internal/ui/mounts/%s", address, backendPath), headers, nil, nil)
+	if err != nil {
+		return true, newKMSHealthError(ocsv1.KMSSecretEngineInaccessible, "the Vault secret engine %q is not accessible: %v", backendPath, err)
+	}
+	return true, nil
+}
+
+// getServiceAccountToken returns the API token of the given service account
+func (r *StorageClusterReconciler) getServiceAccountToken(sc *ocsv1.StorageCluster, name string) (string, error) {
+	sa := &corev1.ServiceAccount{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, sa)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range sa.Secrets {
+		secret, err := r.retrieveSecret(ref.Name, sc)
+		if err != nil {
+			continue
+		}
+		if secret.Type == corev1.SecretTypeServiceAccountToken && len(secret.Data[corev1.ServiceAccountTokenKey]) != 0 {
+			return string(secret.Data[corev1.ServiceAccountTokenKey]), nil
+		}
+	}
+	return "", fmt.Errorf("the service account has no token secret")
+}
+
+// doVaultRequest sends a request to the Vault API, and decodes the response
+// into out unless it is nil. Responses other than 2xx are returned as an
+// error with the errors reported by Vault.
+func doVaultRequest(httpClient *http.Client, method, url string, headers map[string]string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		vaultErrors := struct {
+			Errors []string `json:"errors"`
+		}{}
+		_ = json.NewDecoder(resp.Body).Decode(&vaultErrors)
+		if len(vaultErrors.Errors) != 0 {
+			return fmt.Errorf("%s: %s", resp.Status, strings.Join(vaultErrors.Errors, "; "))
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package storagecluster
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// mockVault is a TLS server that emulates the Vault API used by the KMS
+// health check. It accepts the token 's.dummytoken', the Kubernetes auth of
+// the role 'ocs', and grants access to the 'ocs' secret engine. The tokens
+// issued by the Kubernetes auth are valid until they are revoked.
+type mockVault struct {
+	*httptest.Server
+
+	lock         sync.Mutex
+	loginTokens  map[string]bool
+	issuedTokens int
+}
+
+func newMockVault() *mockVault {
+	vault := &mockVault{loginTokens: map[string]bool{}}
+	vault.Server = httptest.NewTLSServer(http.HandlerFunc(vault.serveHTTP))
+	return vault
+}
+
+func (v *mockVault) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	token := req.Header.Get("X-Vault-Token")
+	switch {
+	case req.URL.Path == "/v1/auth/kubernetes/login":
+		login := map[string]string{}
+		_ = json.NewDecoder(req.Body).Decode(&login)
+		if login["role"] != "ocs" || login["jwt"] != "dummy-jwt" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid role name"]}`))
+			return
+		}
+		v.issuedTokens++
+		token = fmt.Sprintf("s.login%d", v.issuedTokens)
+		v.loginTokens[token] = true
+		_, _ = fmt.Fprintf(w, `{"auth":{"client_token":%q}}`, token)
+	case token != "s.dummytoken" && !v.loginTokens[token]:
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+	case req.URL.Path == "/v1/auth/token/revoke-self":
+		delete(v.loginTokens, token)
+		w.WriteHeader(http.StatusNoContent)
+	case req.URL.Path == "/v1/auth/token/lookup-self", req.URL.Path == "/v1/sys/internal/ui/mounts/ocs":
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	default:
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["preflight capability check returned 403"]}`))
+	}
+}
+
+// getLoginTokens returns the number of tokens issued by the Kubernetes auth
+// that were not revoked
+func (v *mockVault) getLoginTokens() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return len(v.loginTokens)
+}
+
+func TestKMSHealthChecker(t *testing.T) {
+	vault := newMockVault()
+	defer vault.Close()
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: vault.Certificate().Raw})
+
+	cases := []struct {
+		label          string
+		connectionData map[string]string
+		tokenSecret    *corev1.Secret
+		status         corev1.ConditionStatus
+		reason         string
+		authChecked    bool
+	}{
+		{
+			label:          "token auth",
+			connectionData: map[string]string{"VAULT_BACKEND_PATH": "ocs"},
+			tokenSecret:    createDummyKMSTokenSecret(),
+			status:         corev1.ConditionTrue,
+			reason:         api.KMSConnected,
+			authChecked:    true,
+		},
+		{
+			label: "Kubernetes auth",
+			connectionData: map[string]string{
+				"VAULT_BACKEND_PATH":             "ocs",
+				VaultAuthMethodKey:               VaultKubernetesAuthMethod,
+				"VAULT_AUTH_KUBERNETES_ROLE":     "ocs",
+				VaultKubernetesServiceAccountKey: "ocs-kms",
+			},
+			status:      corev1.ConditionTrue,
+			reason:      api.KMSConnected,
+			authChecked: true,
+		},
+		{
+			label:          "missing CA bundle",
+			connectionData: map[string]string{"VAULT_BACKEND_PATH": "ocs", "VAULT_CACERT": ""},
+			tokenSecret:    createDummyKMSTokenSecret(),
+			status:         corev1.ConditionFalse,
+			reason:         api.KMSTLSHandshakeFailed,
+		},
+		{
+			label:          "invalid token",
+			connectionData: map[string]string{"VAULT_BACKEND_PATH": "ocs"},
+			tokenSecret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: KMSTokenSecretName},
+				Data:       map[string][]byte{"token": []byte("s.expired")},
+			},
+			status:      corev1.ConditionFalse,
+			reason:      api.KMSAuthenticationFailed,
+			authChecked: true,
+		},
+		{
+			label: "invalid Kubernetes auth role",
+			connectionData: map[string]string{
+				"VAULT_BACKEND_PATH":             "ocs",
+				VaultAuthMethodKey:               VaultKubernetesAuthMethod,
+				"VAULT_AUTH_KUBERNETES_ROLE":     "other",
+				VaultKubernetesServiceAccountKey: "ocs-kms",
+			},
+			status:      corev1.ConditionFalse,
+			reason:      api.KMSAuthenticationFailed,
+			authChecked: true,
+		},
+		{
+			label:          "inaccessible secret engine",
+			connectionData: map[string]string{"VAULT_BACKEND_PATH": "other"},
+			tokenSecret:    createDummyKMSTokenSecret(),
+			status:         corev1.ConditionFalse,
+			reason:         api.KMSSecretEngineInaccessible,
+			authChecked:    true,
+		},
+		{
+			label:          "unreachable KMS",
+			connectionData: map[string]string{"VAULT_ADDR": "https://127.0.0.1:1"},
+			tokenSecret:    createDummyKMSTokenSecret(),
+			status:         corev1.ConditionFalse,
+			reason:         api.KMSUnreachable,
+		},
+		{
+			label: "KMIP is not authenticated",
+			connectionData: map[string]string{
+				KMSProviderKey:     KMIPKMSProvider,
+				"KMIP_ENDPOINT":    strings.TrimPrefix(vault.URL, "https://"),
+				"KMIP_SECRET_NAME": "ocs-kmip",
+			},
+			status: corev1.ConditionUnknown,
+			reason: api.KMSAuthenticationNotChecked,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Case %d: %s\n", i+1, c.label)
+		sc := createDefaultStorageCluster()
+		sc.Spec.Encryption.KeyManagementService.Enable = true
+		kmsCM := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: KMSConfigMapName},
+			Data: map[string]string{
+				KMSProviderKey: VaultKMSProvider,
+				"VAULT_ADDR":   vault.URL,
+				"VAULT_CACERT": "ocs-kms-ca",
+			},
+		}
+		for k, v := range c.connectionData {
+			kmsCM.Data[k] = v
+		}
+		reconciler := createFakeInitializationStorageClusterReconciler(t, &nbv1.NooBaa{})
+		ctxTodo := context.TODO()
+		assert.NoError(t, reconciler.Client.Create(ctxTodo, kmsCM))
+		assert.NoError(t, reconciler.Client.Create(ctxTodo, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "ocs-kms-ca"},
+			Data:       map[string][]byte{"cert": caCert},
+		}))
+		assert.NoError(t, reconciler.Client.Create(ctxTodo, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "ocs-kmip"},
+			Data:       map[string][]byte{"CA_CERT": caCert},
+		}))
+		assert.NoError(t, reconciler.Client.Create(ctxTodo, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "ocs-kms-token-dummy"},
+			Type:       corev1.SecretTypeServiceAccountToken,
+			Data:       map[string][]byte{corev1.ServiceAccountTokenKey: []byte("dummy-jwt")},
+		}))
+		assert.NoError(t, reconciler.Client.Create(ctxTodo, &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "ocs-kms"},
+			Secrets:    []corev1.ObjectReference{{Name: "ocs-kms-token-dummy"}},
+		}))
+		if c.tokenSecret != nil {
+			assert.NoError(t, reconciler.Client.Create(ctxTodo, c.tokenSecret))
+		}
+
+		checker := newKMSHealthChecker(&reconciler)
+		reconciler.kmsChecker = checker
+		// a check is requested while the KMS was not checked yet
+		reconciler.setKMSHealthStatus(sc)
+		assert.Nil(t, conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionKMSConnected))
+		assert.Len(t, checker.requests, 1)
+		<-checker.requests
+
+		// the StorageCluster is requeued after the check
+		sc.Spec.Encryption.KeyManagementService.Enable = true
+		assert.NoError(t, reconciler.Client.Create(ctxTodo, sc))
+		stop := make(chan struct{})
+		checker.check(stop)
+		assert.Len(t, checker.events, 1)
+		<-checker.events
+
+		reconciler.setKMSHealthStatus(sc)
+		condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionKMSConnected)
+		assert.NotNil(t, condition)
+		assert.Equal(t, c.status, condition.Status)
+		assert.Equal(t, c.reason, condition.Reason)
+		assert.NotNil(t, sc.Status.KMS)
+		assert.Equal(t, kmsCM.Data[KMSProviderKey], sc.Status.KMS.Provider)
+		assert.NotNil(t, sc.Status.KMS.LastCheckTime)
+		assert.Equal(t, c.authChecked, sc.Status.KMS.AuthenticationChecked)
+		if c.status != corev1.ConditionFalse {
+			assert.NotNil(t, sc.Status.KMS.LastSuccessTime)
+		} else {
+			assert.Nil(t, sc.Status.KMS.LastSuccessTime)
+		}
+
+		// an event is only emitted when the condition changes
+		recorder := reconciler.recorder.(*record.FakeRecorder)
+		assert.Len(t, recorder.Events, 1)
+		event := <-recorder.Events
+		assert.True(t, strings.Contains(event, c.reason), "unexpected event %q", event)
+
+		// the tokens issued to the check are revoked
+		assert.Equal(t, 0, vault.getLoginTokens())
+
+		// the StorageCluster is not requeued when the result is unchanged
+		checker.check(stop)
+		assert.Equal(t, 0, vault.getLoginTokens())
+		assert.Len(t, checker.events, 0)
+		reconciler.setKMSHealthStatus(sc)
+		assert.Len(t, recorder.Events, 0)
+		assert.Len(t, checker.requests, 0)
+
+		// the condition is removed when the KMS is disabled
+		sc.Spec.Encryption.KeyManagementService.Enable = false
+		reconciler.setKMSHealthStatus(sc)
+		assert.Nil(t, sc.Status.KMS)
+		assert.Nil(t, conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionKMSConnected))
+	}
+}
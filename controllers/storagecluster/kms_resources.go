@@ -2,12 +2,23 @@ package storagecluster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/validation"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -18,15 +29,89 @@ const (
 	// KMSTokenSecretName is the name of the secret which has KMS token details
 	KMSTokenSecretName = "ocs-kms-token"
 	// KMSProviderKey is the key in config map to get the KMS provider name
-	KMSProviderKey = "KMS_PROVIDER"
+	KMSProviderKey = validation.KMSProviderKey
 	// VaultKMSProvider a constant to represent 'vault' KMS provider
-	VaultKMSProvider = "vault"
+	VaultKMSProvider = validation.VaultKMSProvider
+	// KMIPKMSProvider a constant to represent a KMS provider speaking the 'kmip' protocol
+	KMIPKMSProvider = validation.KMIPKMSProvider
+	// AWSKMSProvider a constant to represent 'aws' KMS provider
+	AWSKMSProvider = validation.AWSKMSProvider
+	// AzureKMSProvider a constant to represent 'azure' Key Vault KMS provider
+	AzureKMSProvider = validation.AzureKMSProvider
+	// IBMKeyProtectKMSProvider a constant to represent 'ibmkeyprotect' KMS provider
+	IBMKeyProtectKMSProvider = validation.IBMKeyProtectKMSProvider
+
+	// VaultAuthMethodKey is the key in config map to get the Vault auth method
+	VaultAuthMethodKey = validation.VaultAuthMethodKey
+	// VaultTokenAuthMethod authenticates to Vault with the token in the KMS token secret
+	VaultTokenAuthMethod = validation.VaultTokenAuthMethod
+	// VaultKubernetesAuthMethod authenticates to Vault with a service account token
+	VaultKubernetesAuthMethod = validation.VaultKubernetesAuthMethod
+	// VaultKubernetesServiceAccountKey is the key in config map to get the
+	// service account used for the Vault Kubernetes auth
+	VaultKubernetesServiceAccountKey = validation.VaultKubernetesServiceAccountKey
+
+	// KMSServiceNameKey is the key in config map to get the name of the KMS
+	// configuration in the CSI KMS ConfigMap. It defaults to the KMS provider.
+	KMSServiceNameKey = validation.KMSServiceNameKey
+	// CSIKMSConfigMapName is the name of the configmap which has the KMS
+	// configurations of ceph-csi, keyed by the KMS ID of the StorageClasses
+	CSIKMSConfigMapName = "csi-kms-connection-details"
+
+	// kmsSecretHashAnnotation holds the checksum of the KMS secrets. It is
+	// set on the OSD pods through the CephCluster, so that Rook restarts them
+	// when the secrets rotate, and on the NooBaa to record the secrets its
+	// pods were last restarted with.
+	kmsSecretHashAnnotation = "ocs.openshift.io/kms-secret-hash"
+
+	defaultKMIPPort         = "5696"
+	defaultIBMKeyProtectURL = "https://us-south.kms.cloud.ibm.com"
 )
 
 var (
 	// currently supported KMS providers mapped to their address key
 	kmsProviderAddressKeyMap = map[string]string{
-		VaultKMSProvider: "VAULT_ADDR",
+		VaultKMSProvider:         "VAULT_ADDR",
+		KMIPKMSProvider:          "KMIP_ENDPOINT",
+		AWSKMSProvider:           "AWS_ENDPOINT",
+		AzureKMSProvider:         "AZURE_VAULT_URL",
+		IBMKeyProtectKMSProvider: "IBM_KP_BASE_URL",
+	}
+	// the KMS providers whose address is optional mapped to a function
+	// returning their default address
+	kmsProviderDefaultAddressMap = map[string]func(data map[string]string) string{
+		AWSKMSProvider: func(data map[string]string) string {
+			return fmt.Sprintf("https://kms.%s.amazonaws.com", data["AWS_REGION"])
+		},
+		IBMKeyProtectKMSProvider: func(map[string]string) string {
+			return defaultIBMKeyProtectURL
+		},
+	}
+	// the KMS providers mapped to the KMS type of ceph-csi
+	csiKMSProviderMap = map[string]string{
+		VaultKMSProvider:         "vaulttokens",
+		KMIPKMSProvider:          "kmip",
+		AWSKMSProvider:           "aws-metadata",
+		AzureKMSProvider:         "azure-kv",
+		IBMKeyProtectKMSProvider: "ibmkeyprotect",
+	}
+	// the KMS providers mapped to the keys of their connection details that
+	// ceph-csi reads, the other keys are not passed on to it
+	csiKMSConfigKeys = map[string][]string{
+		VaultKMSProvider: {
+			"VAULT_ADDR", "VAULT_BACKEND", "VAULT_BACKEND_PATH", "VAULT_NAMESPACE", "VAULT_TLS_SERVER_NAME",
+			"VAULT_CACERT", "VAULT_CLIENT_CERT", "VAULT_CLIENT_KEY", "VAULT_SKIP_VERIFY", "VAULT_DESTROY_KEYS",
+			"VAULT_AUTH_PATH", "VAULT_AUTH_NAMESPACE",
+		},
+		KMIPKMSProvider:          {"KMIP_ENDPOINT", "KMIP_SECRET_NAME", "TLS_SERVER_NAME", "READ_TIMEOUT", "WRITE_TIMEOUT"},
+		AWSKMSProvider:           {"AWS_REGION", "AWS_CMK_ARN", "KMS_SECRET_NAME"},
+		AzureKMSProvider:         {"AZURE_VAULT_URL", "AZURE_CLIENT_ID", "AZURE_TENANT_ID", "AZURE_CERT_SECRET_NAME"},
+		IBMKeyProtectKMSProvider: {"IBM_KP_SERVICE_INSTANCE_ID", "IBM_KP_SECRET_NAME", "IBM_KP_BASE_URL", "IBM_KP_TOKEN_URL", "IBM_KP_REGION"},
+	}
+	// the keys of the connection details that ceph-csi reads under another
+	// name, mapped to that name
+	csiKMSConfigKeyMap = map[string]string{
+		"KMIP_TLS_SERVER_NAME": "TLS_SERVER_NAME",
 	}
 )
 
@@ -64,26 +149,293 @@ func getKMSConfigMap(instance *ocsv1.StorageCluster, client client.Client, kmsVa
 	return &kmsConfigMap, err
 }
 
+// getKMSConnectionDetails returns the connection details of the given KMS
+// ConfigMap as they are passed on to Ceph and NooBaa. The values are trimmed,
+// and the defaults of the provider are filled in, so that both get the same
+// address.
+func getKMSConnectionDetails(kmsConfigMap *corev1.ConfigMap) map[string]string {
+	connectionDetails := make(map[string]string, len(kmsConfigMap.Data))
+	for k, v := range kmsConfigMap.Data {
+		connectionDetails[k] = strings.TrimSpace(v)
+	}
+	kmsProviderName := connectionDetails[KMSProviderKey]
+	addressKey, ok := kmsProviderAddressKeyMap[kmsProviderName]
+	if !ok {
+		return connectionDetails
+	}
+	if defaultAddressFunc, ok := kmsProviderDefaultAddressMap[kmsProviderName]; ok && connectionDetails[addressKey] == "" {
+		connectionDetails[addressKey] = defaultAddressFunc(connectionDetails)
+	}
+	if kmsProviderName == KMIPKMSProvider && connectionDetails[addressKey] != "" {
+		if _, _, err := net.SplitHostPort(connectionDetails[addressKey]); err != nil {
+			connectionDetails[addressKey] = net.JoinHostPort(connectionDetails[addressKey], defaultKMIPPort)
+		}
+	}
+	return connectionDetails
+}
+
 // reachKMSProvider function checks whether the provided address is reachable or not.
-// This function won't validate any other cases and only returns an error if the provided
-// KMS provider address is not reachable. All other validations will be done on rook side.
+// This function only returns an error if the KMS provider is not supported, or if
+// its address is missing or not reachable. The required keys of every provider
+// are checked by the spec validation, all other validations will be done on rook side.
 func reachKMSProvider(kmsConfigMap *corev1.ConfigMap) error {
 	if kmsConfigMap == nil {
 		return fmt.Errorf("please provide a valid config map")
 	}
-	kmsProviderName, ok := kmsConfigMap.Data[KMSProviderKey]
+	kmsProviderName := kmsConfigMap.Data[KMSProviderKey]
+	kmsProviderAddressKey, ok := kmsProviderAddressKeyMap[kmsProviderName]
 	if !ok {
-		return nil
+		return fmt.Errorf("unsupported KMS provider %q", kmsProviderName)
+	}
+	kmsAddress := getKMSConnectionDetails(kmsConfigMap)[kmsProviderAddressKey]
+	if kmsAddress == "" {
+		return fmt.Errorf("no %s specified for the %s KMS provider", kmsProviderAddressKey, kmsProviderName)
+	}
+	hostPort, err := kmsAddressHostPort(kmsAddress)
+	if err != nil {
+		return err
+	}
+	return checkEndpointReachable(hostPort, 5*time.Second)
+}
+
+// kmsAddressHostPort returns the host and port to dial for the given KMS
+// address, which is either a URL or a 'host:port' pair. The port of a URL
+// defaults to the one of its scheme.
+func kmsAddressHostPort(address string) (string, error) {
+	if !strings.Contains(address, "://") {
+		return address, nil
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	port := "443"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// getKMSTokenSecretName returns the name of the KMS token secret passed on to
+// Ceph and NooBaa. Vault's Kubernetes auth method does not use a token secret.
+func getKMSTokenSecretName(connectionDetails map[string]string) string {
+	if connectionDetails[KMSProviderKey] == VaultKMSProvider &&
+		strings.TrimSpace(connectionDetails[VaultAuthMethodKey]) == VaultKubernetesAuthMethod {
+		return ""
+	}
+	return KMSTokenSecretName
+}
+
+// getKMSSecretNames returns the names of the secrets used by the given KMS
+// connection details, in order
+func getKMSSecretNames(connectionDetails map[string]string) []string {
+	names := []string{}
+	if tokenSecretName := getKMSTokenSecretName(connectionDetails); tokenSecretName != "" {
+		names = append(names, tokenSecretName)
+	}
+	for _, key := range validation.KMSSecretNameKeys {
+		name := strings.TrimSpace(connectionDetails[key])
+		if name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// kmsSecretDataChecksum returns the checksum of all secrets used by the given
+// KMS ConfigMap. It fails if any of them, or the service account of the Vault
+// Kubernetes auth, is missing.
+func (r *StorageClusterReconciler) kmsSecretDataChecksum(instance *ocsv1.StorageCluster, kmsConfigMap *corev1.ConfigMap) (string, error) {
+	connectionDetails := getKMSConnectionDetails(kmsConfigMap)
+	if saName := connectionDetails[VaultKubernetesServiceAccountKey]; saName != "" && getKMSTokenSecretName(connectionDetails) == "" {
+		sa := &corev1.ServiceAccount{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: saName, Namespace: instance.Namespace}, sa)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the service account %q for the Vault Kubernetes auth: %v", saName, err)
+		}
+	}
+
+	var b strings.Builder
+	for _, name := range getKMSSecretNames(connectionDetails) {
+		secret, err := r.retrieveSecret(name, instance)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the KMS secret %q: %v", name, err)
+		}
+		keys := []string{}
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(&b, "%s\n", name)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "%s=%x\n", key, secret.Data[key])
+		}
+	}
+	return sha512sum([]byte(b.String()))
+}
+
+// sameKMSSecretData returns whether the KMS secrets are unchanged since the
+// last reconcile, and updates the 'KMSSecretHash' if they changed
+func (r *StorageClusterReconciler) sameKMSSecretData(instance *ocsv1.StorageCluster, kmsConfigMap *corev1.ConfigMap) (bool, error) {
+	kmsSecretChecksum, err := r.kmsSecretDataChecksum(instance, kmsConfigMap)
+	if err != nil {
+		return false, err
+	}
+	// if the 'KMSSecretHash' and fetched hash are same, then return true
+	if instance.Status.KMSSecretHash == kmsSecretChecksum {
+		return true, nil
+	}
+	// at this point the checksums are different, so update it
+	instance.Status.KMSSecretHash = kmsSecretChecksum
+	return false, nil
+}
+
+// isKMSResource returns true for the KMS ConfigMap and the secrets it refers
+// to, in the namespace watched by the operator
+func (r *StorageClusterReconciler) isKMSResource(meta metav1.Object, object runtime.Object) bool {
+	if r.watchNamespace != "" && meta.GetNamespace() != r.watchNamespace {
+		return false
+	}
+	switch object.(type) {
+	case *corev1.ConfigMap:
+		return meta.GetName() == KMSConfigMapName
+	case *corev1.Secret:
+		kmsConfigMap := &corev1.ConfigMap{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: KMSConfigMapName, Namespace: meta.GetNamespace()}, kmsConfigMap)
+		return err == nil && contains(getKMSSecretNames(getKMSConnectionDetails(kmsConfigMap)), meta.GetName())
 	}
-	var kmsProviderAddressKey string
-	if kmsProviderAddressKey, ok = kmsProviderAddressKeyMap[kmsProviderName]; !ok {
-		// cannot find an address key specific for this KMS provider
-		// nothing to validate
+	return false
+}
+
+// kmsSecretToStorageClusters maps a KMS ConfigMap or secret to the
+// StorageClusters in its namespace, so that a rotated token or certificate is
+// propagated to Ceph and NooBaa. The events of other ConfigMaps and secrets
+// are filtered out by isKMSResource.
+func (r *StorageClusterReconciler) kmsSecretToStorageClusters(obj handler.MapObject) []reconcile.Request {
+	namespace := obj.Meta.GetNamespace()
+	storageClusters := &ocsv1.StorageClusterList{}
+	if err := r.Client.List(context.TODO(), storageClusters, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "failed to list StorageClusters")
 		return nil
 	}
-	kmsAddress, ok := kmsConfigMap.Data[kmsProviderAddressKey]
+	requests := []reconcile.Request{}
+	for _, sc := range storageClusters.Items {
+		if sc.Spec.Encryption.KeyManagementService.Enable {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// getCSIKMSID returns the KMS ID that the encrypted StorageClass refers to
+// for the given KMS connection details
+func getCSIKMSID(connectionDetails map[string]string) string {
+	if kmsID := connectionDetails[KMSServiceNameKey]; kmsID != "" {
+		return kmsID
+	}
+	return connectionDetails[KMSProviderKey]
+}
+
+// getCSIKMSConfig returns the ceph-csi KMS configuration of the given KMS
+// connection details. Only the keys that ceph-csi reads are copied, and the
+// KMS provider is replaced by its KMS type. With Vault's token auth every
+// tenant namespace provides its own token, with the Kubernetes auth its own
+// service account.
+func getCSIKMSConfig(connectionDetails map[string]string) (string, error) {
+	provider := connectionDetails[KMSProviderKey]
+	kmsType, ok := csiKMSProviderMap[provider]
 	if !ok {
+		return "", fmt.Errorf("unsupported KMS provider %q", provider)
+	}
+	if provider == VaultKMSProvider && getKMSTokenSecretName(connectionDetails) == "" {
+		kmsType = "vaulttenantsa"
+	}
+
+	config := map[string]string{}
+	for k, v := range connectionDetails {
+		if csiKey, ok := csiKMSConfigKeyMap[k]; ok && connectionDetails[csiKey] == "" {
+			k = csiKey
+		}
+		if v != "" && contains(csiKMSConfigKeys[provider], k) {
+			config[k] = v
+		}
+	}
+	config[KMSProviderKey] = kmsType
+	config[KMSServiceNameKey] = getCSIKMSID(connectionDetails)
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ensureCSIKMSConfigMap ensures that the CSI KMS ConfigMap holds the
+// configuration of the KMS under its KMS ID. The configuration of the KMS ID
+// the encrypted StorageClass referred to before is removed, the
+// configurations of other KMS IDs are left untouched, as they may be added by
+// the admin.
+func (r *StorageClusterReconciler) ensureCSIKMSConfigMap(instance *ocsv1.StorageCluster, kmsConfigMap *corev1.ConfigMap) error {
+	connectionDetails := getKMSConnectionDetails(kmsConfigMap)
+	kmsID := getCSIKMSID(connectionDetails)
+	kmsConfig, err := getCSIKMSConfig(connectionDetails)
+	if err != nil {
+		return err
+	}
+	previousKMSID, err := r.getEncryptedStorageClassKMSID(instance)
+	if err != nil {
+		return err
+	}
+
+	found := &corev1.ConfigMap{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName, Namespace: instance.Namespace}, found)
+	if errors.IsNotFound(err) {
+		r.Log.Info("Creating CSI KMS ConfigMap", "KMSID", kmsID)
+		return r.Client.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      CSIKMSConfigMapName,
+				Namespace: instance.Namespace,
+			},
+			Data: map[string]string{kmsID: kmsConfig},
+		})
+	} else if err != nil {
+		return err
+	}
+	_, stale := found.Data[previousKMSID]
+	stale = stale && previousKMSID != kmsID
+	if found.Data[kmsID] == kmsConfig && !stale {
+		return nil
+	}
+	r.Log.Info("Updating CSI KMS ConfigMap", "KMSID", kmsID)
+	if found.Data == nil {
+		found.Data = map[string]string{}
+	}
+	if stale {
+		delete(found.Data, previousKMSID)
+	}
+	found.Data[kmsID] = kmsConfig
+	return r.Client.Update(context.TODO(), found)
+}
+
+// deleteCSIKMSConfig removes the configuration of the given KMS ID from the
+// CSI KMS ConfigMap
+func (r *StorageClusterReconciler) deleteCSIKMSConfig(instance *ocsv1.StorageCluster, kmsID string) error {
+	found := &corev1.ConfigMap{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName, Namespace: instance.Namespace}, found)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, ok := found.Data[kmsID]; !ok {
 		return nil
 	}
-	return checkEndpointReachable(kmsAddress, 5*time.Second)
+	r.Log.Info("Removing the KMS configuration from the CSI KMS ConfigMap", "KMSID", kmsID)
+	delete(found.Data, kmsID)
+	return r.Client.Update(context.TODO(), found)
 }
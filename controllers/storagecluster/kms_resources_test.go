@@ -0,0 +1,188 @@
+package storagecluster
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestGetKMSConnectionDetails(t *testing.T) {
+	cases := []struct {
+		label    string
+		data     map[string]string
+		expected map[string]string
+	}{
+		{
+			label:    "case 1: vault details are passed on",
+			data:     map[string]string{"KMS_PROVIDER": "vault", "VAULT_ADDR": " https://vault.example.com:8200\n", "VAULT_BACKEND_PATH": "ocs"},
+			expected: map[string]string{"KMS_PROVIDER": "vault", "VAULT_ADDR": "https://vault.example.com:8200", "VAULT_BACKEND_PATH": "ocs"},
+		},
+		{
+			label:    "case 2: kmip endpoint without port",
+			data:     map[string]string{"KMS_PROVIDER": "kmip", "KMIP_ENDPOINT": "kmip.example.com", "KMIP_SECRET_NAME": "ocs-kmip"},
+			expected: map[string]string{"KMS_PROVIDER": "kmip", "KMIP_ENDPOINT": "kmip.example.com:5696", "KMIP_SECRET_NAME": "ocs-kmip"},
+		},
+		{
+			label:    "case 3: aws endpoint of the region",
+			data:     map[string]string{"KMS_PROVIDER": "aws", "AWS_REGION": "us-east-2"},
+			expected: map[string]string{"KMS_PROVIDER": "aws", "AWS_REGION": "us-east-2", "AWS_ENDPOINT": "https://kms.us-east-2.amazonaws.com"},
+		},
+		{
+			label:    "case 4: default ibm key protect url",
+			data:     map[string]string{"KMS_PROVIDER": "ibmkeyprotect", "IBM_KP_SERVICE_INSTANCE_ID": "1234"},
+			expected: map[string]string{"KMS_PROVIDER": "ibmkeyprotect", "IBM_KP_SERVICE_INSTANCE_ID": "1234", "IBM_KP_BASE_URL": defaultIBMKeyProtectURL},
+		},
+	}
+
+	for _, c := range cases {
+		actual := getKMSConnectionDetails(&corev1.ConfigMap{Data: c.data})
+		assert.Equalf(t, c.expected, actual, "[%s]: unexpected connection details", c.label)
+	}
+}
+
+func TestKMSAddressHostPort(t *testing.T) {
+	cases := map[string]string{
+		"kmip.example.com:5696":               "kmip.example.com:5696",
+		"https://vault.example.com:8200/":     "vault.example.com:8200",
+		"https://kms.us-east-2.amazonaws.com": "kms.us-east-2.amazonaws.com:443",
+		"http://[fd00::1]":                    "[fd00::1]:80",
+	}
+
+	for address, expected := range cases {
+		actual, err := kmsAddressHostPort(address)
+		assert.NoError(t, err)
+		assert.Equalf(t, expected, actual, "unexpected host and port of %q", address)
+	}
+}
+
+func TestKMSSecretRotation(t *testing.T) {
+	// a KMS endpoint that accepts every connection
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	ctxTodo := context.TODO()
+	sc := createDefaultStorageCluster()
+	sc.Spec.Encryption.KeyManagementService.Enable = true
+	kmsCM := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: KMSConfigMapName},
+		Data: map[string]string{
+			KMSProviderKey: VaultKMSProvider,
+			"VAULT_ADDR":   "http://" + ln.Addr().String(),
+			"VAULT_CACERT": "ocs-kms-ca",
+		},
+	}
+	caSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ocs-kms-ca"},
+		Data:       map[string][]byte{"cert": []byte("first")},
+	}
+	reconciler := createFakeInitializationStorageClusterReconciler(t, &nbv1.NooBaa{})
+	for _, obj := range []runtime.Object{kmsCM, caSecret, createDummyKMSTokenSecret()} {
+		assert.NoError(t, reconciler.Client.Create(ctxTodo, obj))
+	}
+	reconciler.initializeImagesStatus(sc)
+
+	var obj ocsCephCluster
+	assertKMSSecretHash := func() {
+		err := obj.ensureCreated(&reconciler, sc)
+		assert.NoError(t, err)
+		cephCluster := &cephv1.CephCluster{}
+		err = reconciler.Client.Get(ctxTodo, types.NamespacedName{Name: generateNameForCephCluster(sc)}, cephCluster)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, sc.Status.KMSSecretHash)
+		// the hash is set on the OSD pods, so that Rook restarts them
+		assert.Equal(t, sc.Status.KMSSecretHash, cephCluster.Spec.Annotations[cephv1.KeyOSD][kmsSecretHashAnnotation])
+	}
+
+	assertKMSSecretHash()
+	firstHash := sc.Status.KMSSecretHash
+
+	// a rotated CA bundle changes the hash and is propagated
+	caSecret.Data["cert"] = []byte("second")
+	assert.NoError(t, reconciler.Client.Update(ctxTodo, caSecret))
+	assertKMSSecretHash()
+	assert.NotEqual(t, firstHash, sc.Status.KMSSecretHash)
+
+	// the Kubernetes auth method needs its service account, but no token
+	kmsCM.Data[VaultAuthMethodKey] = VaultKubernetesAuthMethod
+	kmsCM.Data["VAULT_AUTH_KUBERNETES_ROLE"] = "ocs"
+	kmsCM.Data[VaultKubernetesServiceAccountKey] = "ocs-kms"
+	assert.NoError(t, reconciler.Client.Update(ctxTodo, kmsCM))
+	assert.Error(t, obj.ensureCreated(&reconciler, sc))
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "ocs-kms"}}
+	assert.NoError(t, reconciler.Client.Create(ctxTodo, sa))
+	assertKMSSecretHash()
+	cephCluster := &cephv1.CephCluster{}
+	err = reconciler.Client.Get(ctxTodo, types.NamespacedName{Name: generateNameForCephCluster(sc)}, cephCluster)
+	assert.NoError(t, err)
+	assert.Empty(t, cephCluster.Spec.Security.KeyManagementService.TokenSecretName)
+	assert.Equal(t, VaultKubernetesAuthMethod, cephCluster.Spec.Security.KeyManagementService.ConnectionDetails[VaultAuthMethodKey])
+
+	// only the KMS secrets trigger a reconcile of the StorageCluster
+	assert.NoError(t, reconciler.Client.Create(ctxTodo, sc))
+	assert.True(t, reconciler.isKMSResource(caSecret, caSecret))
+	assert.True(t, reconciler.isKMSResource(kmsCM, kmsCM))
+	requests := reconciler.kmsSecretToStorageClusters(handler.MapObject{Meta: caSecret, Object: caSecret})
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Name: sc.Name}}}, requests)
+	other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other"}}
+	assert.False(t, reconciler.isKMSResource(other, other))
+	// a ConfigMap named as a KMS secret is not a KMS resource
+	otherCM := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: caSecret.Name}}
+	assert.False(t, reconciler.isKMSResource(otherCM, otherCM))
+	// neither are the ones outside of the watched namespace
+	reconciler.watchNamespace = "openshift-storage"
+	assert.False(t, reconciler.isKMSResource(caSecret, caSecret))
+}
+
+func TestRestartNooBaaOnKMSRotation(t *testing.T) {
+	ctxTodo := context.TODO()
+	sc := createDefaultStorageCluster()
+	sc.Spec.Encryption.KeyManagementService.Enable = true
+	sc.Status.KMSSecretHash = "second"
+	nb := &nbv1.NooBaa{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "noobaa",
+			Annotations: map[string]string{kmsSecretHashAnnotation: "first"},
+		},
+	}
+	core := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "noobaa-core-0", Labels: map[string]string{"noobaa-core": "noobaa"}}}
+	endpoint := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "noobaa-endpoint-1", Labels: map[string]string{"noobaa-s3": "noobaa"}}}
+	db := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "noobaa-db-0", Labels: map[string]string{"noobaa-db": "noobaa"}}}
+	reconciler := createFakeStorageClusterReconciler(t, nb, core, endpoint, db)
+
+	// the pods that read the KMS secrets are restarted once they rotate
+	assert.NoError(t, reconciler.restartNooBaaOnKMSRotation(sc))
+	pods := &corev1.PodList{}
+	assert.NoError(t, reconciler.Client.List(ctxTodo, pods))
+	if assert.Len(t, pods.Items, 1) {
+		assert.Equal(t, db.Name, pods.Items[0].Name)
+	}
+
+	// they are not restarted again with the same secrets
+	nb.Annotations[kmsSecretHashAnnotation] = "second"
+	assert.NoError(t, reconciler.Client.Update(ctxTodo, nb))
+	core.ResourceVersion = ""
+	assert.NoError(t, reconciler.Client.Create(ctxTodo, core))
+	assert.NoError(t, reconciler.restartNooBaaOnKMSRotation(sc))
+	assert.NoError(t, reconciler.Client.List(ctxTodo, pods))
+	assert.Len(t, pods.Items, 2)
+}
@@ -0,0 +1,232 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/validation"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// msgr2SecureMode makes the msgr2 connections authenticated and encrypted
+	msgr2SecureMode = "secure"
+	// msgr2SecureCRCMode prefers the secure mode, and still accepts the crc
+	// mode of the clients that do not use the secure mode yet
+	msgr2SecureCRCMode = "secure crc"
+	// csiSecureMountOption is the kernel client option of the msgr2 secure mode
+	csiSecureMountOption = "ms_mode=secure"
+)
+
+// csiPluginApps are the app labels of the pods of the CSI plugins that mount
+// the volumes with the kernel clients
+var csiPluginApps = []string{"csi-rbdplugin", "csi-cephfsplugin"}
+
+var (
+	// minimum Ceph and kernel versions that support the msgr2 secure mode of
+	// the kernel clients
+	minNetworkEncryptionCephVersion   = [2]int{16, 2}
+	minNetworkEncryptionKernelVersion = [2]int{5, 11}
+
+	// matches the major and minor version at the start of a Ceph version or
+	// an image tag, e.g. "15.2.9-0" or "v16.2.0-20210412"
+	majorMinorVersionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+)
+
+// isNetworkEncryptionEnabled returns whether the msgr2 secure mode is enabled
+func isNetworkEncryptionEnabled(sc *ocsv1.StorageCluster) bool {
+	return !sc.Spec.ExternalStorage.Enable && sc.Spec.Network != nil &&
+		sc.Spec.Network.Encryption != nil && sc.Spec.Network.Encryption.Enable
+}
+
+// isNetworkEncryptionActive returns whether the msgr2 secure mode is enabled
+// and its requirements are met
+func isNetworkEncryptionActive(sc *ocsv1.StorageCluster) bool {
+	return isNetworkEncryptionEnabled(sc) && sc.Status.NetworkEncryptionMode == ocsv1.NetworkEncryptionModeSecure
+}
+
+// newNetworkEncryptionCephConfig returns the ceph.conf options that switch
+// the msgr2 connections to the secure mode when it is active. The daemons
+// only connect in the secure mode, but they keep accepting the crc mode from
+// their clients, so that the clients that connected in the crc mode before
+// keep working until they reconnect.
+func newNetworkEncryptionCephConfig(sc *ocsv1.StorageCluster) map[string]ocsv1.CephConfigSection {
+	if !isNetworkEncryptionActive(sc) {
+		return nil
+	}
+	global := ocsv1.CephConfigSection{}
+	for _, option := range validation.Msgr2ModeOptions {
+		global[option] = msgr2SecureMode
+	}
+	for _, option := range validation.Msgr2ServiceModeOptions {
+		global[option] = msgr2SecureCRCMode
+	}
+	return map[string]ocsv1.CephConfigSection{cephConfigGlobalSection: global}
+}
+
+// validateNetworkEncryption checks that the Ceph version and the kernels of
+// the storage nodes and of the nodes running the CSI plugins support the
+// msgr2 secure mode when it is enabled, and records the connection mode in
+// effect in the status. If they do not, the connections stay in the crc mode
+// and the NetworkEncryptionSupported condition lists the problems, the rest
+// of the cluster is reconciled as usual. The connections also stay in the crc
+// mode, with an Unknown condition, until the Ceph version is known. Once the
+// connections are switched to the secure mode they are never switched back
+// automatically, as that could silently expose the traffic; the condition
+// reports the problems instead. It only returns an error if the requirements
+// can not be checked.
+func (r *StorageClusterReconciler) validateNetworkEncryption(sc *ocsv1.StorageCluster) error {
+	if !isNetworkEncryptionEnabled(sc) {
+		sc.Status.NetworkEncryptionMode = ocsv1.NetworkEncryptionModeCRC
+		conditionsv1.RemoveStatusCondition(&sc.Status.Conditions, ocsv1.ConditionNetworkEncryptionSupported)
+		return nil
+	}
+
+	problems := []string{}
+	cephVersion, err := r.getCephVersion(sc)
+	if err != nil {
+		return err
+	}
+	if cephVersion != "" && !isVersionAtLeast(cephVersion, minNetworkEncryptionCephVersion) {
+		problems = append(problems, fmt.Sprintf("Ceph version %s is older than %d.%d",
+			cephVersion, minNetworkEncryptionCephVersion[0], minNetworkEncryptionCephVersion[1]))
+	}
+
+	nodes, err := r.getNetworkEncryptionNodes(sc)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		kernelVersion := node.Status.NodeInfo.KernelVersion
+		if kernelVersion != "" && !isVersionAtLeast(kernelVersion, minNetworkEncryptionKernelVersion) {
+			problems = append(problems, fmt.Sprintf("kernel version %s of node %s is older than %d.%d", kernelVersion,
+				node.Name, minNetworkEncryptionKernelVersion[0], minNetworkEncryptionKernelVersion[1]))
+		}
+	}
+
+	condition := conditionsv1.Condition{
+		Type:    ocsv1.ConditionNetworkEncryptionSupported,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.NetworkEncryptionSupported,
+		Message: "The msgr2 connections are encrypted",
+	}
+	secure := sc.Status.NetworkEncryptionMode == ocsv1.NetworkEncryptionModeSecure
+	if len(problems) != 0 {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = ocsv1.NetworkEncryptionUnsupported
+		if secure {
+			condition.Message = fmt.Sprintf("Network encryption is not supported, the msgr2 connections stay encrypted and the clients may fail to connect: %s",
+				strings.Join(problems, ", "))
+		} else {
+			condition.Message = fmt.Sprintf("Network encryption is not supported, the msgr2 connections are not encrypted: %s",
+				strings.Join(problems, ", "))
+		}
+	} else if cephVersion == "" && !secure {
+		// switching to the secure mode before the Ceph version is known
+		// could require switching back once the CephCluster reports an
+		// older version
+		condition.Status = corev1.ConditionUnknown
+		condition.Reason = ocsv1.NetworkEncryptionCephVersionUnknown
+		condition.Message = "The Ceph version is not known yet, the msgr2 connections are not encrypted until it is checked"
+	} else {
+		sc.Status.NetworkEncryptionMode = ocsv1.NetworkEncryptionModeSecure
+	}
+	if sc.Status.NetworkEncryptionMode == "" {
+		sc.Status.NetworkEncryptionMode = ocsv1.NetworkEncryptionModeCRC
+	}
+	previous := conditionsv1.FindStatusCondition(sc.Status.Conditions, ocsv1.ConditionNetworkEncryptionSupported)
+	if condition.Status == corev1.ConditionFalse && (previous == nil || previous.Status != condition.Status || previous.Message != condition.Message) {
+		r.Log.Info(condition.Message)
+		r.recorder.Event(sc, corev1.EventTypeWarning, condition.Reason, condition.Message)
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, condition)
+	return nil
+}
+
+// getNetworkEncryptionNodes returns the nodes whose kernel connects to the
+// Ceph cluster: the storage nodes of the StorageCluster, and the nodes
+// running the CSI plugins
+func (r *StorageClusterReconciler) getNetworkEncryptionNodes(sc *ocsv1.StorageCluster) ([]corev1.Node, error) {
+	storageNodes, err := r.getStorageClusterEligibleNodes(sc)
+	if err != nil {
+		return nil, err
+	}
+	nodes := storageNodes.Items
+	found := map[string]bool{}
+	for _, node := range nodes {
+		found[node.Name] = true
+	}
+
+	csiPods := &corev1.PodList{}
+	selector, err := labels.Parse(fmt.Sprintf("app in (%s)", strings.Join(csiPluginApps, ",")))
+	if err != nil {
+		return nil, err
+	}
+	err = r.Client.List(context.TODO(), csiPods, client.InNamespace(sc.Namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range csiPods.Items {
+		nodeName := pod.Spec.NodeName
+		if nodeName == "" || found[nodeName] {
+			continue
+		}
+		found[nodeName] = true
+		node := &corev1.Node{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: nodeName}, node)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, *node)
+	}
+	return nodes, nil
+}
+
+// getCephVersion returns the Ceph version of the image tag, or the version
+// reported by the CephCluster if the image has no version tag. It is empty if
+// neither is known.
+func (r *StorageClusterReconciler) getCephVersion(sc *ocsv1.StorageCluster) (string, error) {
+	image := r.images.Ceph
+	if i := strings.LastIndex(image, ":"); i != -1 && !strings.Contains(image[i:], "/") && !strings.Contains(image, "@") {
+		if tag := image[i+1:]; majorMinorVersionRegexp.MatchString(tag) {
+			return strings.TrimPrefix(tag, "v"), nil
+		}
+	}
+
+	cephCluster := &cephv1.CephCluster{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephCluster(sc), Namespace: sc.Namespace}, cephCluster)
+	if errors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	if cephCluster.Status.CephVersion == nil {
+		return "", nil
+	}
+	return cephCluster.Status.CephVersion.Version, nil
+}
+
+// isVersionAtLeast returns whether the major and minor version at the start
+// of the given version are at least the given minimum. Versions that can not
+// be parsed are accepted, as their requirements can not be checked.
+func isVersionAtLeast(version string, minimum [2]int) bool {
+	match := majorMinorVersionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return true
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return major > minimum[0] || major == minimum[0] && minor >= minimum[1]
+}
@@ -0,0 +1,206 @@
+package storagecluster
+
+import (
+	"strings"
+	"testing"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	"github.com/openshift/ocs-operator/controllers/validation"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestValidateNetworkEncryption(t *testing.T) {
+	newNode := func(name, kernelVersion string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{defaults.NodeAffinityKey: ""}},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{KernelVersion: kernelVersion},
+			},
+		}
+	}
+	// a node that is not a storage node
+	newWorkerNode := func(name, kernelVersion string) *corev1.Node {
+		node := newNode(name, kernelVersion)
+		node.Labels = nil
+		return node
+	}
+	newCSIPod := func(app, nodeName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: app + "-" + nodeName, Labels: map[string]string{"app": app}},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+		}
+	}
+	newCephCluster := func(version string) *cephv1.CephCluster {
+		return &cephv1.CephCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: generateNameForCephCluster(createDefaultStorageCluster())},
+			Status: cephv1.ClusterStatus{
+				CephVersion: &cephv1.ClusterVersion{Version: version},
+			},
+		}
+	}
+
+	cases := []struct {
+		label        string
+		enabled      bool
+		cephImage    string
+		objects      []runtime.Object
+		previousMode string
+		expectedMode string
+		problems     []string
+		// the Ceph version is not known yet
+		unknown bool
+	}{
+		{
+			label:        "disabled",
+			enabled:      false,
+			cephImage:    "quay.io/ceph/ceph:v15.2.9",
+			objects:      []runtime.Object{newNode("node-a", "4.18.0-240.el8.x86_64")},
+			expectedMode: api.NetworkEncryptionModeCRC,
+		},
+		{
+			label:        "supported image tag and kernels",
+			enabled:      true,
+			cephImage:    "quay.io/ceph/ceph:v16.2.0",
+			objects:      []runtime.Object{newNode("node-a", "5.11.0-1.fc34.x86_64"), newNode("node-b", "5.14.0")},
+			expectedMode: api.NetworkEncryptionModeSecure,
+		},
+		{
+			label:     "old image tag and kernel",
+			enabled:   true,
+			cephImage: "quay.io/ceph/ceph:v15.2.9",
+			objects:   []runtime.Object{newNode("node-a", "5.11.0"), newNode("node-b", "4.18.0-240.el8.x86_64")},
+			problems:  []string{"Ceph version 15.2.9", "node node-b"},
+		},
+		{
+			label:        "version of the CephCluster without an image tag",
+			enabled:      true,
+			cephImage:    "quay.io/ceph/ceph@sha256:0123456789abcdef",
+			objects:      []runtime.Object{newNode("node-a", "5.11.0"), newCephCluster("16.2.4-0")},
+			expectedMode: api.NetworkEncryptionModeSecure,
+		},
+		{
+			label:     "old version of the CephCluster",
+			enabled:   true,
+			cephImage: "registry.local:5000/ceph/ceph",
+			objects:   []runtime.Object{newNode("node-a", "5.11.0"), newCephCluster("14.2.11-0")},
+			problems:  []string{"Ceph version 14.2.11-0"},
+		},
+		{
+			label:     "old kernel of a node running the CSI plugins",
+			enabled:   true,
+			cephImage: "quay.io/ceph/ceph:v16.2.0",
+			objects: []runtime.Object{newNode("node-a", "5.11.0"), newWorkerNode("worker-a", "4.18.0"),
+				newCSIPod("csi-rbdplugin", "worker-a")},
+			problems: []string{"node worker-a"},
+		},
+		{
+			label:     "old kernel of a node without storage nor CSI plugins",
+			enabled:   true,
+			cephImage: "quay.io/ceph/ceph:v16.2.0",
+			objects: []runtime.Object{newNode("node-a", "5.11.0"), newWorkerNode("worker-a", "5.11.0"),
+				newWorkerNode("worker-b", "4.18.0"), newCSIPod("csi-cephfsplugin", "worker-a")},
+			expectedMode: api.NetworkEncryptionModeSecure,
+		},
+		{
+			label:        "old kernel after switching to the secure mode",
+			enabled:      true,
+			cephImage:    "quay.io/ceph/ceph:v16.2.0",
+			objects:      []runtime.Object{newNode("node-a", "5.11.0"), newNode("node-b", "4.18.0")},
+			previousMode: api.NetworkEncryptionModeSecure,
+			expectedMode: api.NetworkEncryptionModeSecure,
+			problems:     []string{"node node-b"},
+		},
+		{
+			label:        "no image tag and no CephCluster version yet",
+			enabled:      true,
+			cephImage:    "quay.io/ceph/ceph@sha256:0123456789abcdef",
+			objects:      []runtime.Object{newNode("node-a", "5.11.0")},
+			expectedMode: api.NetworkEncryptionModeCRC,
+			unknown:      true,
+		},
+	}
+
+	for i, c := range cases {
+		t.Logf("Case %d: %s\n", i+1, c.label)
+		sc := createDefaultStorageCluster()
+		sc.Spec.Network = &api.NetworkSpec{Encryption: &api.NetworkEncryptionSpec{Enable: c.enabled}}
+		sc.Status.NetworkEncryptionMode = c.previousMode
+		reconciler := createFakeStorageClusterReconciler(t, c.objects...)
+		reconciler.images.Ceph = c.cephImage
+
+		err := reconciler.validateNetworkEncryption(sc)
+		assert.NoError(t, err)
+		recorder := reconciler.recorder.(*record.FakeRecorder)
+		condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionNetworkEncryptionSupported)
+		if len(c.problems) == 0 {
+			assert.Equal(t, c.expectedMode, sc.Status.NetworkEncryptionMode)
+			assert.Len(t, recorder.Events, 0)
+			if c.unknown {
+				assert.Equal(t, corev1.ConditionUnknown, condition.Status)
+				assert.Equal(t, api.NetworkEncryptionCephVersionUnknown, condition.Reason)
+				assert.Nil(t, newNetworkEncryptionCephConfig(sc))
+			} else if c.enabled {
+				assert.Equal(t, corev1.ConditionTrue, condition.Status)
+			} else {
+				assert.Nil(t, condition)
+			}
+			continue
+		}
+		// the connections stay in their mode, the rest of the cluster is
+		// reconciled
+		if c.previousMode == api.NetworkEncryptionModeSecure {
+			assert.Equal(t, api.NetworkEncryptionModeSecure, sc.Status.NetworkEncryptionMode)
+			assert.NotNil(t, newNetworkEncryptionCephConfig(sc))
+		} else {
+			assert.Equal(t, api.NetworkEncryptionModeCRC, sc.Status.NetworkEncryptionMode)
+			assert.Nil(t, newNetworkEncryptionCephConfig(sc))
+		}
+		if assert.NotNil(t, condition) {
+			assert.Equal(t, corev1.ConditionFalse, condition.Status)
+			assert.Equal(t, api.NetworkEncryptionUnsupported, condition.Reason)
+			for _, problem := range c.problems {
+				assert.Contains(t, condition.Message, problem)
+			}
+		}
+		assert.Len(t, recorder.Events, 1)
+		event := <-recorder.Events
+		assert.True(t, strings.Contains(event, api.NetworkEncryptionUnsupported), "unexpected event %q", event)
+
+		// the event is only emitted when the condition changes
+		assert.NoError(t, reconciler.validateNetworkEncryption(sc))
+		assert.Len(t, recorder.Events, 0)
+	}
+}
+
+func TestNetworkEncryptionSettings(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.Network = &api.NetworkSpec{Encryption: &api.NetworkEncryptionSpec{Enable: true}}
+	sc.Status.NetworkEncryptionMode = api.NetworkEncryptionModeSecure
+
+	config := renderCephConfig(mergeCephConfig(defaultCephConfig, sc.Spec.CephConfig, newNetworkEncryptionCephConfig(sc)))
+	for _, option := range []string{"ms_cluster_mode", "ms_client_mode", "ms_mon_cluster_mode", "ms_mon_client_mode"} {
+		assert.Contains(t, config, option+" = secure\n")
+	}
+	// the clients still connected in the crc mode keep working
+	for _, option := range validation.Msgr2ServiceModeOptions {
+		assert.Contains(t, config, option+" = secure crc\n")
+	}
+
+	rbdSC := newCephBlockPoolStorageClassConfiguration(sc).storageClass
+	assert.Equal(t, csiSecureMountOption, rbdSC.Parameters["mapOptions"])
+	cephfsSC := newCephFilesystemStorageClassConfiguration(sc).storageClass
+	assert.Equal(t, csiSecureMountOption, cephfsSC.Parameters["kernelMountOptions"])
+
+	// the connections are not changed when the encryption is disabled
+	sc.Spec.Network.Encryption.Enable = false
+	assert.Nil(t, newNetworkEncryptionCephConfig(sc))
+	assert.NotContains(t, newCephBlockPoolStorageClassConfiguration(sc).storageClass.Parameters, "mapOptions")
+	assert.NotContains(t, newCephFilesystemStorageClassConfiguration(sc).storageClass.Parameters, "kernelMountOptions")
+}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 
 	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	objectreferencesv1 "github.com/openshift/custom-resource-status/objectreferences/v1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
 	statusutil "github.com/openshift/ocs-operator/controllers/util"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -45,6 +47,16 @@ func (obj *ocsNoobaaSystem) ensureCreated(r *StorageClusterReconciler, sc *ocsv1
 			r.Log.Info("Waiting on ceph cluster to initialize before starting noobaa")
 			return nil
 		}
+		// NooBaa stores its data on the RBD StorageClass
+		storageClass := &storagev1.StorageClass{}
+		err = r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephBlockPoolSC(sc)}, storageClass)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				r.Log.Info("Waiting on the RBD StorageClass to be created before starting noobaa")
+				return nil
+			}
+			return err
+		}
 	} else {
 		if foundCeph.Status.State != cephv1.ClusterStateConnected {
 			r.Log.Info("Waiting for the external ceph cluster to be connected before starting noobaa")
@@ -68,6 +80,10 @@ func (obj *ocsNoobaaSystem) ensureCreated(r *StorageClusterReconciler, sc *ocsv1
 		return err
 	}
 
+	if err := r.restartNooBaaOnKMSRotation(sc); err != nil {
+		return err
+	}
+
 	// Reconcile the noobaa state, creating or updating if needed
 	_, err = controllerutil.CreateOrUpdate(context.TODO(), r.Client, nb, func() error {
 		return r.setNooBaaDesiredState(nb, sc)
@@ -89,7 +105,9 @@ func (obj *ocsNoobaaSystem) ensureCreated(r *StorageClusterReconciler, sc *ocsv1
 		return err
 	}
 
-	statusutil.MapNoobaaNegativeConditions(&r.conditions, nb)
+	var conditions []conditionsv1.Condition
+	statusutil.MapNoobaaNegativeConditions(&conditions, nb)
+	r.setComponentStatus("NooBaa", nb.Name, string(nb.Status.Phase), conditions)
 	return nil
 }
 
@@ -148,13 +166,54 @@ func (r *StorageClusterReconciler) setNooBaaDesiredState(nb *nbv1.NooBaa, sc *oc
 	if kmsConfig, err := getKMSConfigMap(sc, r.Client, nil); err != nil {
 		return err
 	} else if kmsConfig != nil {
-		nb.Spec.Security.KeyManagementService.ConnectionDetails = kmsConfig.Data
-		nb.Spec.Security.KeyManagementService.TokenSecretName = KMSTokenSecretName
+		connectionDetails := getKMSConnectionDetails(kmsConfig)
+		nb.Spec.Security.KeyManagementService.ConnectionDetails = connectionDetails
+		nb.Spec.Security.KeyManagementService.TokenSecretName = getKMSTokenSecretName(connectionDetails)
+		// the hash is updated while reconciling the CephCluster, the NooBaa
+		// records the one its pods were restarted with
+		if nb.Annotations == nil {
+			nb.Annotations = map[string]string{}
+		}
+		nb.Annotations[kmsSecretHashAnnotation] = sc.Status.KMSSecretHash
 	}
 
 	return nil
 }
 
+// restartNooBaaOnKMSRotation restarts the NooBaa core and endpoint pods when
+// the KMS secrets rotated since they were started, as they only read the
+// secrets when they start. The NooBaa records the KMS secret hash its pods
+// were started with.
+func (r *StorageClusterReconciler) restartNooBaaOnKMSRotation(sc *ocsv1.StorageCluster) error {
+	if !sc.Spec.Encryption.KeyManagementService.Enable || sc.Status.KMSSecretHash == "" {
+		return nil
+	}
+	nb := &nbv1.NooBaa{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: "noobaa", Namespace: sc.Namespace}, nb)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	started := nb.Annotations[kmsSecretHashAnnotation]
+	if started == "" || started == sc.Status.KMSSecretHash {
+		return nil
+	}
+
+	r.Log.Info("KMS secrets rotated, restarting the NooBaa pods")
+	for _, labels := range []map[string]string{
+		{"noobaa-core": "noobaa"},
+		{"noobaa-s3": "noobaa"},
+	} {
+		err = r.Client.DeleteAllOf(context.TODO(), &corev1.Pod{}, client.InNamespace(sc.Namespace), client.MatchingLabels(labels))
+		if err != nil {
+			return fmt.Errorf("failed to restart the NooBaa pods: %v", err)
+		}
+	}
+	r.recorder.Event(sc, corev1.EventTypeNormal, ocsv1.KMSSecretsChanged, "KMS secrets rotated, restarted the NooBaa pods")
+	return nil
+}
+
 // ensureDeleted Delete noobaa system in the namespace
 func (obj *ocsNoobaaSystem) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
 	// Delete only if this is being managed by the OCS operator
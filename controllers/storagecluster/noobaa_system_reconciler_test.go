@@ -13,6 +13,7 @@ import (
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -62,6 +63,11 @@ func TestEnsureNooBaaSystem(t *testing.T) {
 		},
 	}
 	cephCluster.Status.State = cephv1.ClusterStateCreated
+	storageClass := storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: defaultStorageClass,
+		},
+	}
 
 	addressableStorageClass := defaultStorageClass
 
@@ -108,7 +114,8 @@ func TestEnsureNooBaaSystem(t *testing.T) {
 	for _, c := range cases {
 		reconciler := getReconciler(t, &v1alpha1.NooBaa{})
 		reconciler.Log = noobaaReconcileTestLogger
-		reconciler.Client.Create(context.TODO(), &cephCluster) //nolint //ignoring err check as causes failure
+		reconciler.Client.Create(context.TODO(), &cephCluster)  //nolint //ignoring err check as causes failure
+		reconciler.Client.Create(context.TODO(), &storageClass) //nolint //ignoring err check as causes failure
 
 		if c.isCreate {
 			err := reconciler.Client.Get(context.TODO(), namespacedName, &c.noobaa)
@@ -130,6 +137,31 @@ func TestEnsureNooBaaSystem(t *testing.T) {
 	}
 }
 
+func TestNooBaaWaitsForRBDStorageClass(t *testing.T) {
+	sc := v1.StorageCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "noobaa",
+			Namespace: "test_ns",
+		},
+	}
+	cephCluster := cephv1.CephCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForCephCluster(&sc),
+			Namespace: sc.Namespace,
+		},
+	}
+	cephCluster.Status.State = cephv1.ClusterStateCreated
+
+	reconciler := getReconciler(t, &v1alpha1.NooBaa{})
+	reconciler.Log = noobaaReconcileTestLogger
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), &cephCluster))
+
+	var obj ocsNoobaaSystem
+	assert.NoError(t, obj.ensureCreated(&reconciler, &sc))
+	err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "noobaa", Namespace: sc.Namespace}, &v1alpha1.NooBaa{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
 func TestNooBaaReconcileStrategy(t *testing.T) {
 	namespacedName := types.NamespacedName{
 		Name:      "noobaa",
@@ -214,6 +246,10 @@ func TestNooBaaReconcileStrategy(t *testing.T) {
 		cephCluster.Status.State = cephv1.ClusterStateCreated
 		err := reconciler.Client.Create(context.TODO(), &cephCluster)
 		assert.NoError(t, err)
+		storageClass := storagev1.StorageClass{}
+		storageClass.Name = generateNameForCephBlockPoolSC(&c.sc)
+		err = reconciler.Client.Create(context.TODO(), &storageClass)
+		assert.NoError(t, err)
 
 		err = obj.ensureCreated(&reconciler, &c.sc)
 		assert.NoError(t, err)
@@ -398,6 +434,10 @@ func getReconciler(t *testing.T, objs ...runtime.Object) StorageClusterReconcile
 	if err != nil {
 		assert.Fail(t, "failed to add openshiftv1 scheme")
 	}
+	err = storagev1.AddToScheme(scheme)
+	if err != nil {
+		assert.Fail(t, "failed to add storagev1 scheme")
+	}
 	client := fake.NewFakeClientWithScheme(scheme, registerObjs...)
 
 	return StorageClusterReconciler{
@@ -416,10 +456,11 @@ func TestNoobaaKMSConfiguration(t *testing.T) {
 	}{
 		{testLabel: "case 1", kmsProvider: "vault", kmsAddress: "http://localhost:3053"},
 		{testLabel: "case 2", kmsProvider: "vault", kmsAddress: "http://localhost:32123"},
-		// ocs-operator is agnostic to KMS Provider, here rook should be throwing error
-		{testLabel: "case 3", kmsProvider: "newKMSProvider", kmsAddress: "http://127.0.0.1:15851"},
+		// unknown KMS providers are rejected
+		{testLabel: "case 3", kmsProvider: "newKMSProvider", kmsAddress: "http://127.0.0.1:15851", failureExpected: true},
 		// invalid test case, with an unreachable KMS address
 		{testLabel: "case 4", kmsProvider: "vault", kmsAddress: "http://unearchable.url.location:3366", failureExpected: true},
+		{testLabel: "case 5", kmsProvider: "kmip", kmsAddress: "127.0.0.1:15852"},
 	}
 	for _, kmsArgs := range allKMSArgs {
 		assertNoobaaKMSConfiguration(t, kmsArgs)
@@ -442,6 +483,10 @@ func assertNoobaaKMSConfiguration(t *testing.T, kmsArgs struct {
 		t.Errorf("Unable to create KMS configmap: %v, %v", err, kmsArgs.testLabel)
 		t.FailNow()
 	}
+	if err := reconciler.Client.Create(ctxTodo, createDummyKMSTokenSecret()); err != nil {
+		t.Errorf("Unable to create KMS token secret: %v", err)
+		t.FailNow()
+	}
 	reconciler.initializeImagesStatus(cr)
 	// start a dummy server, if we are not expecting any errors
 	if !kmsArgs.failureExpected {
@@ -476,6 +521,13 @@ func assertNoobaaKMSConfiguration(t *testing.T, kmsArgs struct {
 		t.FailNow()
 	}
 
+	storageClass := &storagev1.StorageClass{}
+	storageClass.Name = generateNameForCephBlockPoolSC(cr)
+	if err := reconciler.Client.Create(ctxTodo, storageClass); err != nil {
+		t.Errorf("Unable to create the RBD StorageClass: %v", err)
+		t.FailNow()
+	}
+
 	var objNoobaa ocsNoobaaSystem
 
 	err = objNoobaa.ensureCreated(&reconciler, cr)
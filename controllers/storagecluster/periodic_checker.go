@@ -0,0 +1,131 @@
+package storagecluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// periodicChecker periodically runs a check of every StorageCluster it
+// selects, in the background so that the reconcile does not wait on it. It
+// keeps the last result of every StorageCluster, and requeues a
+// StorageCluster when its result changes. The reconcile then sets the status
+// from the last result.
+type periodicChecker struct {
+	reconciler *StorageClusterReconciler
+	// name names the check in the logs
+	name     string
+	interval time.Duration
+	// timeout is passed to every run of the check
+	timeout time.Duration
+	// selects returns whether a StorageCluster is checked
+	selects func(sc *ocsv1.StorageCluster) bool
+	// run checks a StorageCluster. The last result is kept when it fails.
+	run func(sc *ocsv1.StorageCluster, timeout time.Duration) (interface{}, error)
+	// changed returns whether the StorageCluster is requeued for a result
+	changed func(previous, current interface{}) bool
+	// events is the source of the requeues of the StorageClusters
+	events chan event.GenericEvent
+	// requests triggers a check before the interval elapsed
+	requests chan struct{}
+
+	lock    sync.Mutex
+	results map[types.NamespacedName]interface{}
+}
+
+func newPeriodicChecker(r *StorageClusterReconciler, name string, interval, timeout time.Duration) *periodicChecker {
+	return &periodicChecker{
+		reconciler: r,
+		name:       name,
+		interval:   interval,
+		timeout:    timeout,
+		events:     make(chan event.GenericEvent, 16),
+		requests:   make(chan struct{}, 1),
+		results:    map[types.NamespacedName]interface{}{},
+	}
+}
+
+// Start runs the checks until the stop channel is closed. It implements the
+// Runnable interface of the manager.
+func (c *periodicChecker) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.check(stop)
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		case <-c.requests:
+		}
+	}
+}
+
+// requestCheck triggers a check without waiting for the interval, it does not
+// block if a check is already requested
+func (c *periodicChecker) requestCheck() {
+	select {
+	case c.requests <- struct{}{}:
+	default:
+	}
+}
+
+// check checks every selected StorageCluster, and requeues the
+// StorageClusters whose result changed. The results of the StorageClusters
+// that are no longer selected are dropped.
+func (c *periodicChecker) check(stop <-chan struct{}) {
+	storageClusters := &ocsv1.StorageClusterList{}
+	if err := c.reconciler.Client.List(context.TODO(), storageClusters); err != nil {
+		c.reconciler.Log.Error(err, "failed to list StorageClusters for the "+c.name)
+		return
+	}
+
+	checked := map[types.NamespacedName]bool{}
+	for i := range storageClusters.Items {
+		sc := &storageClusters.Items[i]
+		if !c.selects(sc) || !sc.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		key := types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace}
+		checked[key] = true
+		result, err := c.run(sc, c.timeout)
+		if err != nil {
+			c.reconciler.Log.Error(err, c.name+" failed", "StorageCluster", key)
+			continue
+		}
+
+		c.lock.Lock()
+		previous, found := c.results[key]
+		c.results[key] = result
+		c.lock.Unlock()
+		if found && !c.changed(previous, result) {
+			continue
+		}
+		select {
+		case c.events <- event.GenericEvent{Meta: sc, Object: sc}:
+		case <-stop:
+			return
+		}
+	}
+
+	c.lock.Lock()
+	for key := range c.results {
+		if !checked[key] {
+			delete(c.results, key)
+		}
+	}
+	c.lock.Unlock()
+}
+
+// getResult returns the last result of the check of the StorageCluster, and
+// whether it was checked already
+func (c *periodicChecker) getResult(key types.NamespacedName) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result, found := c.results[key]
+	return result, found
+}
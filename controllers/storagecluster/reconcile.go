@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/blang/semver"
@@ -13,6 +12,7 @@ import (
 	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	"github.com/openshift/ocs-operator/controllers/validation"
 	"github.com/openshift/ocs-operator/version"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -20,6 +20,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -37,20 +38,10 @@ type resourceManager interface {
 	ensureDeleted(*StorageClusterReconciler, *ocsv1.StorageCluster) error
 }
 
-type ocsCephConfig struct{}
 type ocsJobTemplates struct{}
 
 const (
-	rookConfigMapName = "rook-config-override"
-	rookConfigData    = `
-[global]
-mon_osd_full_ratio = .85
-mon_osd_backfillfull_ratio = .8
-mon_osd_nearfull_ratio = .75
-mon_max_pg_per_osd = 300
-[osd]
-osd_memory_target_cgroup_limit_ratio = 0.5
-`
+	rookConfigMapName      = "rook-config-override"
 	monCountOverrideEnvVar = "MON_COUNT_OVERRIDE"
 
 	// Name of MetadataPVCTemplate
@@ -85,7 +76,9 @@ osd_memory_target_cgroup_limit_ratio = 0.5
 	EBS StorageClassProvisionerType = "kubernetes.io/aws-ebs"
 )
 
-var storageClusterFinalizer = "storagecluster.ocs.openshift.io"
+// StorageClusterFinalizer is the finalizer used to clean up the resources
+// owned by a StorageCluster before it is deleted
+const StorageClusterFinalizer = "storagecluster.ocs.openshift.io"
 
 var validTopologyLabelKeys = []string{
 	"failure-domain.beta.kubernetes.io",
@@ -95,12 +88,15 @@ var validTopologyLabelKeys = []string{
 }
 
 // +kubebuilder:rbac:groups=ocs.openshift.io,resources=*,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=ceph.rook.io,resources=cephclusters;cephblockpools;cephfilesystems;cephobjectstores;cephobjectstoreusers,verbs=*
+// +kubebuilder:rbac:groups=ceph.rook.io,resources=cephclusters;cephblockpools;cephclients;cephfilesystems;cephobjectstores;cephobjectstoreusers;cephrbdmirrors,verbs=*
 // +kubebuilder:rbac:groups=noobaa.io,resources=noobaas,verbs=*
 // +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=*
+// +kubebuilder:rbac:groups=replication.storage.openshift.io,resources=volumereplicationclasses,verbs=*
 // +kubebuilder:rbac:groups=core,resources=pods;services;endpoints;persistentvolumeclaims;events;configmaps;secrets;nodes,verbs=*
 // +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get
 // +kubebuilder:rbac:groups=apps,resources=deployments;daemonsets;replicasets;statefulsets,verbs=*
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=*
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;prometheusrules,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots;volumesnapshotclasses,verbs=*
 // +kubebuilder:rbac:groups=template.openshift.io,resources=templates,verbs=*
@@ -204,20 +200,6 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		return reconcile.Result{}, nil
 	}
 
-	if !instance.Spec.ExternalStorage.Enable {
-		if err := r.validateStorageDeviceSets(instance); err != nil {
-			r.Log.Error(err, "Failed to validate StorageDeviceSets")
-			return reconcile.Result{}, err
-		}
-	}
-
-	if err := validateArbiterSpec(instance, r.Log); err != nil {
-		instance.Status.Phase = statusutil.PhaseError
-		_ = r.Client.Update(context.TODO(), instance)
-		r.recorder.Event(instance, "Error", "FailedReconcile", err.Error())
-		return reconcile.Result{}, err
-	}
-
 	if instance.Status.Phase != statusutil.PhaseReady &&
 		instance.Status.Phase != statusutil.PhaseClusterExpanding &&
 		instance.Status.Phase != statusutil.PhaseDeleting &&
@@ -234,9 +216,9 @@ func (r *StorageClusterReconciler) reconcilePhases(
 
 	// Check GetDeletionTimestamp to determine if the object is under deletion
 	if instance.GetDeletionTimestamp().IsZero() {
-		if !contains(instance.GetFinalizers(), storageClusterFinalizer) {
+		if !contains(instance.GetFinalizers(), StorageClusterFinalizer) {
 			r.Log.Info("Finalizer not found for storagecluster. Adding finalizer")
-			instance.ObjectMeta.Finalizers = append(instance.ObjectMeta.Finalizers, storageClusterFinalizer)
+			instance.ObjectMeta.Finalizers = append(instance.ObjectMeta.Finalizers, StorageClusterFinalizer)
 			if err := r.Client.Update(context.TODO(), instance); err != nil {
 				r.Log.Info("Update Error", "MetaUpdateErr", "Failed to update storagecluster with finalizer")
 				return reconcile.Result{}, err
@@ -251,14 +233,14 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		// The object is marked for deletion
 		instance.Status.Phase = statusutil.PhaseDeleting
 
-		if contains(instance.GetFinalizers(), storageClusterFinalizer) {
+		if contains(instance.GetFinalizers(), StorageClusterFinalizer) {
 			if err := r.deleteResources(instance); err != nil {
 				r.Log.Info("Uninstall in progress", "Status", err)
 				return reconcile.Result{RequeueAfter: time.Second * time.Duration(1)}, nil
 			}
 			r.Log.Info("Removing finalizer")
 			// Once all finalizers have been removed, the object will be deleted
-			instance.ObjectMeta.Finalizers = remove(instance.ObjectMeta.Finalizers, storageClusterFinalizer)
+			instance.ObjectMeta.Finalizers = remove(instance.ObjectMeta.Finalizers, StorageClusterFinalizer)
 			if err := r.Client.Update(context.TODO(), instance); err != nil {
 				r.Log.Info("Update Error", "MetaUpdateErr", "Failed to remove finalizer from storagecluster")
 				return reconcile.Result{}, err
@@ -268,7 +250,36 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		return reconcile.Result{}, nil
 	}
 
+	// in-memory conditions should start off empty. It will only ever hold
+	// negative conditions (!Available, Degraded, Progressing), aggregated from
+	// the components
+	r.conditions = nil
+	r.components = nil
+	r.managerResults = nil
+
+	if instance.Spec.ExternalStorage.Enable {
+		// the results of the connectivity checker are applied on every
+		// return, so that a failed validation or resource manager does not
+		// leave stale endpoints and conditions behind
+		defer r.setExternalConnectivityStatus(instance)
+	}
+
+	if err := r.validateStorageClusterSpec(instance); err != nil {
+		r.Log.Error(err, "Failed to validate StorageCluster spec")
+		instance.Status.Phase = statusutil.PhaseError
+		return reconcile.Result{}, err
+	}
+
 	if !instance.Spec.ExternalStorage.Enable {
+		// set the KMS health before the CephCluster and NooBaa which depend on
+		// it, so that the KMSConnected condition is set even if they fail
+		r.setKMSHealthStatus(instance)
+
+		if err := r.validateNetworkEncryption(instance); err != nil {
+			r.Log.Error(err, "Failed to check the network encryption requirements")
+			return reconcile.Result{}, err
+		}
+
 		// Get storage node topology labels
 		if err := r.reconcileNodeTopologyMap(instance); err != nil {
 			r.Log.Error(err, "Failed to set node topology map")
@@ -278,58 +289,40 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		if instance.Status.FailureDomain == "" {
 			instance.Status.FailureDomain = determineFailureDomain(instance)
 		}
-	}
-
-	// in-memory conditions should start off empty. It will only ever hold
-	// negative conditions (!Available, Degraded, Progressing)
-	r.conditions = nil
-	// Start with empty r.phase
-	r.phase = ""
-	var objs []resourceManager
-	if !instance.Spec.ExternalStorage.Enable {
-		// list of default ensure functions
-		objs = []resourceManager{
-			&ocsStorageClass{},
-			&ocsSnapshotClass{},
-			&ocsCephObjectStores{},
-			&ocsCephObjectStoreUsers{},
-			&ocsCephBlockPools{},
-			&ocsCephFilesystems{},
-			&ocsCephConfig{},
-			&ocsCephCluster{},
-			&ocsNoobaaSystem{},
-			&ocsJobTemplates{},
-			&ocsQuickStarts{},
-		}
-
 	} else {
-		// for external cluster, we have a different set of ensure functions
-		objs = []resourceManager{
-			&ocsExternalResources{},
-			&ocsCephCluster{},
-			&ocsSnapshotClass{},
-			&ocsNoobaaSystem{},
-			&ocsQuickStarts{},
+		// validate the external cluster details before any resource is
+		// created from them
+		if err := r.validateExternalClusterConfig(instance); err != nil {
+			r.Log.Error(err, "Failed to validate the external cluster details")
+			instance.Status.Phase = statusutil.PhaseError
+			return reconcile.Result{}, err
 		}
 	}
 
-	for _, obj := range objs {
-		err := obj.ensureCreated(r, instance)
-		if r.phase == statusutil.PhaseClusterExpanding {
-			instance.Status.Phase = statusutil.PhaseClusterExpanding
-		} else if instance.Status.Phase != statusutil.PhaseReady &&
-			instance.Status.Phase != statusutil.PhaseConnecting {
-			instance.Status.Phase = statusutil.PhaseProgressing
-		}
-		if err != nil {
-			reason := ocsv1.ReconcileFailed
-			message := fmt.Sprintf("Error while reconciling: %v", err)
-			statusutil.SetErrorCondition(&instance.Status.Conditions, reason, message)
-			instance.Status.Phase = statusutil.PhaseError
-			// don't want to overwrite the actual reconcile failure
-			return reconcile.Result{}, err
+	// Start with empty r.phase, an expansion goes on until the new OSDs of
+	// the StorageDeviceSets are ready
+	r.phase = ""
+	if instance.Status.Phase == statusutil.PhaseClusterExpanding {
+		r.phase = statusutil.PhaseClusterExpanding
+	}
+	err := r.runResourceManagers(instance, getResourceManagerGraph(instance.Spec.ExternalStorage.Enable))
+	// the components reported by the resource managers that ran are written
+	// even if another one failed, the conditions are aggregated from every
+	// component of the status
+	r.setComponentsStatus(instance)
+	r.conditions = statusutil.AggregateComponentConditions(instance.Status.Components)
+	if err != nil {
+		for _, condition := range r.conditions {
+			conditionsv1.SetStatusCondition(&instance.Status.Conditions, condition)
 		}
+		reason := ocsv1.ReconcileFailed
+		message := fmt.Sprintf("Error while reconciling: %v", err)
+		statusutil.SetErrorCondition(&instance.Status.Conditions, reason, message)
+		instance.Status.Phase = statusutil.PhaseError
+		// don't want to overwrite the actual reconcile failure
+		return reconcile.Result{}, err
 	}
+
 	// All component operators are in a happy state.
 	if r.conditions == nil {
 		r.Log.Info("No component operator reported negatively")
@@ -353,11 +346,11 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		// the instance while preserving it's lastTransitionTime.
 		// For example, consider the resource has the Available condition
 		// type with type "False". When reconciling the resource we would
-		// add it to the in-memory representation of OCS's conditions (r.conditions)
-		// and here we are simply writing it back to the server.
-		// One shortcoming is that only one failure of a particular condition can be
-		// captured at one time (ie. if resource1 and resource2 are both reporting !Available,
-		// you will only see resource2q as it updates last).
+		// add it to the status of its component, aggregate it into the
+		// in-memory representation of OCS's conditions (r.conditions)
+		// and here we are simply writing it back to the server. Every
+		// component reporting the same condition is listed in its message, and
+		// in status.components.
 		for _, condition := range r.conditions {
 			conditionsv1.SetStatusCondition(&instance.Status.Conditions, condition)
 		}
@@ -436,83 +429,51 @@ func versionCheck(sc *ocsv1.StorageCluster, reqLogger logr.Logger) error {
 	return nil
 }
 
-// validateStorageDeviceSets checks the StorageDeviceSets of the given
-// StorageCluster for completeness and correctness
-func (r *StorageClusterReconciler) validateStorageDeviceSets(sc *ocsv1.StorageCluster) error {
-	for i, ds := range sc.Spec.StorageDeviceSets {
-		if ds.DataPVCTemplate.Spec.StorageClassName == nil || *ds.DataPVCTemplate.Spec.StorageClassName == "" {
-			return fmt.Errorf("failed to validate StorageDeviceSet %d: no StorageClass specified", i)
-		}
-		if ds.MetadataPVCTemplate != nil {
-			if ds.MetadataPVCTemplate.Spec.StorageClassName == nil || *ds.MetadataPVCTemplate.Spec.StorageClassName == "" {
-				return fmt.Errorf("failed to validate StorageDeviceSet %d: no StorageClass specified for metadataPVCTemplate", i)
-			}
-		}
-		if ds.WalPVCTemplate != nil {
-			if ds.WalPVCTemplate.Spec.StorageClassName == nil || *ds.WalPVCTemplate.Spec.StorageClassName == "" {
-				return fmt.Errorf("failed to validate StorageDeviceSet %d: no StorageClass specified for walPVCTemplate", i)
-			}
-		}
-		if ds.DeviceType != "" {
-			if (DeviceTypeSSD != strings.ToLower(ds.DeviceType)) && (DeviceTypeHDD != strings.ToLower(ds.DeviceType)) && (DeviceTypeNVMe != strings.ToLower(ds.DeviceType)) {
-				return fmt.Errorf("failed to validate DeviceType %q: no Device of this type", ds.DeviceType)
-			}
-		}
-	}
-
-	return nil
-}
+// validateStorageClusterSpec validates the spec of the given StorageCluster,
+// sets the SpecValid condition and emits an event for every invalid field
+func (r *StorageClusterReconciler) validateStorageClusterSpec(sc *ocsv1.StorageCluster) error {
+	allErrs := validation.ValidateStorageCluster(sc)
 
-// ensureCreated ensures that a ConfigMap resource exists with its Spec in
-// the desired state.
-func (obj *ocsCephConfig) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
-	ownerRef := metav1.OwnerReference{
-		UID:        sc.UID,
-		APIVersion: sc.APIVersion,
-		Kind:       sc.Kind,
-		Name:       sc.Name,
-	}
-	cm := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:            rookConfigMapName,
-			Namespace:       sc.Namespace,
-			OwnerReferences: []metav1.OwnerReference{ownerRef},
-		},
-		Data: map[string]string{
-			"config": rookConfigData,
-		},
-	}
-
-	found := &corev1.ConfigMap{}
-	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, found)
-	if err != nil {
+	if sc.Spec.Encryption.KeyManagementService.Enable {
+		kmsConfigMap := &corev1.ConfigMap{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: KMSConfigMapName, Namespace: sc.Namespace}, kmsConfigMap)
 		if errors.IsNotFound(err) {
-			r.Log.Info("Creating Ceph ConfigMap")
-			err = r.Client.Create(context.TODO(), cm)
-			if err != nil {
-				return err
-			}
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "encryption", "kms", "enable"), true,
+				fmt.Sprintf("KMS is enabled but the ConfigMap %q is missing", KMSConfigMapName)))
+		} else if err != nil {
+			return err
+		} else {
+			allErrs = append(allErrs, validation.ValidateKMSConnectionDetails(kmsConfigMap.Data,
+				field.NewPath("configMap").Key(KMSConfigMapName).Child("data"))...)
 		}
-		return err
 	}
 
-	ownerRefFound := false
-	for _, ownerRef := range found.OwnerReferences {
-		if ownerRef.UID == sc.UID {
-			ownerRefFound = true
-		}
-	}
-	val, ok := found.Data["config"]
-	if !ok || val != rookConfigData || !ownerRefFound {
-		r.Log.Info("Updating Ceph ConfigMap")
-		return r.Client.Update(context.TODO(), cm)
+	if len(allErrs) == 0 {
+		conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+			Type:    ocsv1.ConditionSpecValid,
+			Status:  corev1.ConditionTrue,
+			Reason:  ocsv1.SpecValidationSucceeded,
+			Message: ocsv1.SpecValidationSucceededMessage,
+		})
+		return nil
 	}
-	return nil
-}
 
-// ensureDeleted is dummy func for the ocsCephConfig
-func (obj *ocsCephConfig) ensureDeleted(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
-	return nil
+	err := allErrs.ToAggregate()
+	// the errors are only reported again when they change, not on every
+	// reconcile of the invalid spec
+	previous := conditionsv1.FindStatusCondition(sc.Status.Conditions, ocsv1.ConditionSpecValid)
+	if previous == nil || previous.Status != corev1.ConditionFalse || previous.Message != err.Error() {
+		for _, fieldErr := range allErrs {
+			r.recorder.Event(sc, corev1.EventTypeWarning, ocsv1.SpecValidationFailed, fieldErr.Error())
+		}
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+		Type:    ocsv1.ConditionSpecValid,
+		Status:  corev1.ConditionFalse,
+		Reason:  ocsv1.SpecValidationFailed,
+		Message: err.Error(),
+	})
+	return err
 }
 
 func (r *StorageClusterReconciler) isActiveStorageCluster(instance *ocsv1.StorageCluster) (bool, error) {
@@ -738,11 +699,3 @@ func newCleanupJob(sc *ocsv1.StorageCluster) *batchv1.Job {
 
 	return job
 }
-
-func validateArbiterSpec(sc *ocsv1.StorageCluster, reqLogger logr.Logger) error {
-
-	if sc.Spec.Arbiter.Enable && sc.Spec.NodeTopologies.ArbiterLocation == "" {
-		return fmt.Errorf("arbiter is set to enable but no arbiterLocation has been provided in the Spec.NodeTopologies.ArbiterLocation")
-	}
-	return nil
-}
@@ -0,0 +1,156 @@
+package storagecluster
+
+import (
+	"fmt"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// resourceManagerNode is a resource manager in the dependency graph of the
+// reconcile. It only runs once the resource managers it depends on succeeded.
+type resourceManagerNode struct {
+	name      string
+	manager   resourceManager
+	dependsOn []string
+}
+
+// externalResourceManagers are the resource managers of the reconcile in
+// external mode. A resource manager is listed after the resource managers it
+// depends on, TestResourceManagerGraph validates the graph.
+var externalResourceManagers = []resourceManagerNode{
+	{name: "externalResources", manager: &ocsExternalResources{}},
+	// the CephCluster is configured from the external cluster details
+	{name: "cephCluster", manager: &ocsCephCluster{}, dependsOn: []string{"externalResources"}},
+	// the SnapshotClasses of the RADOS namespaces and subvolume groups
+	// refer to the ceph-csi cluster configuration of the external
+	// cluster details
+	{name: "snapshotClasses", manager: &ocsSnapshotClass{}, dependsOn: []string{"externalResources"}},
+	{name: "noobaaSystem", manager: &ocsNoobaaSystem{}, dependsOn: []string{"cephCluster"}},
+	{name: "quickStarts", manager: &ocsQuickStarts{}},
+	{name: "capacity", manager: &ocsCapacity{}, dependsOn: []string{"cephCluster"}},
+}
+
+// internalResourceManagers are the resource managers of the reconcile in
+// internal mode. A resource manager is listed after the resource managers it
+// depends on, TestResourceManagerGraph validates the graph.
+var internalResourceManagers = []resourceManagerNode{
+	{name: "storageClasses", manager: &ocsStorageClass{}},
+	{name: "snapshotClasses", manager: &ocsSnapshotClass{}},
+	{name: "volumeReplicationClasses", manager: &ocsVolumeReplicationClass{}},
+	// the ceph.conf overrides have to exist before the CephCluster
+	{name: "cephConfig", manager: &ocsCephConfig{}},
+	{name: "cephCluster", manager: &ocsCephCluster{}, dependsOn: []string{"cephConfig"}},
+	// the pools, filesystems and object stores are created in the
+	// CephCluster
+	{name: "cephBlockPools", manager: &ocsCephBlockPools{}, dependsOn: []string{"cephCluster"}},
+	{name: "cephFilesystems", manager: &ocsCephFilesystems{}, dependsOn: []string{"cephCluster"}},
+	{name: "cephObjectStores", manager: &ocsCephObjectStores{}, dependsOn: []string{"cephCluster"}},
+	{name: "cephObjectStoreUsers", manager: &ocsCephObjectStoreUsers{}, dependsOn: []string{"cephObjectStores"}},
+	{name: "storageDeviceSets", manager: &ocsStorageDeviceSets{}, dependsOn: []string{"cephCluster"}},
+	{name: "cephRBDMirrors", manager: &ocsCephRBDMirrors{}, dependsOn: []string{"cephCluster"}},
+	// NooBaa waits for the RBD StorageClass it stores its data on by
+	// itself, so that a failure on another StorageClass does not block it
+	{name: "noobaaSystem", manager: &ocsNoobaaSystem{}, dependsOn: []string{"cephCluster"}},
+	{name: "jobTemplates", manager: &ocsJobTemplates{}},
+	{name: "quickStarts", manager: &ocsQuickStarts{}},
+	{name: "capacity", manager: &ocsCapacity{}, dependsOn: []string{"cephCluster"}},
+}
+
+// getResourceManagerGraph returns the resource managers of the reconcile
+func getResourceManagerGraph(external bool) []resourceManagerNode {
+	if external {
+		return externalResourceManagers
+	}
+	return internalResourceManagers
+}
+
+// validateResourceManagerGraph checks that the resource managers have unique
+// names, and that they are listed after the resource managers they depend on
+func validateResourceManagerGraph(nodes []resourceManagerNode) error {
+	listed := map[string]bool{}
+	for _, node := range nodes {
+		if listed[node.name] {
+			return fmt.Errorf("resource manager %q is listed twice", node.name)
+		}
+		for _, dependency := range node.dependsOn {
+			if !listed[dependency] {
+				return fmt.Errorf("resource manager %q depends on %q that is not listed before it", node.name, dependency)
+			}
+		}
+		listed[node.name] = true
+	}
+	return nil
+}
+
+// runResourceManagers runs the resource managers in order. A resource manager
+// whose dependency failed or was skipped is skipped, the others keep running
+// when a sibling fails. The result of every resource manager is recorded in
+// the status, and the errors are returned as a single aggregated error.
+func (r *StorageClusterReconciler) runResourceManagers(instance *ocsv1.StorageCluster, nodes []resourceManagerNode) error {
+	var errs []error
+	// the resource managers that did not succeed, with the reason
+	notSucceeded := map[string]string{}
+	r.managerResults = map[string]bool{}
+	for _, node := range nodes {
+		blocking := []string{}
+		for _, dependency := range node.dependsOn {
+			if _, found := notSucceeded[dependency]; found {
+				blocking = append(blocking, dependency)
+			}
+		}
+		if len(blocking) != 0 {
+			message := fmt.Sprintf("skipped, it depends on %s that did not succeed", strings.Join(blocking, ", "))
+			r.Log.Info("Skipping resource manager", "ResourceManager", node.name, "Dependencies", blocking)
+			notSucceeded[node.name] = message
+			r.managerResults[node.name] = false
+			setResourceManagerStatus(instance, node.name, message)
+			continue
+		}
+
+		err := node.manager.ensureCreated(r, instance)
+		if r.phase == statusutil.PhaseClusterExpanding {
+			instance.Status.Phase = statusutil.PhaseClusterExpanding
+		} else if instance.Status.Phase != statusutil.PhaseReady &&
+			instance.Status.Phase != statusutil.PhaseConnecting {
+			instance.Status.Phase = statusutil.PhaseProgressing
+		}
+		if err != nil {
+			r.Log.Error(err, "Resource manager failed", "ResourceManager", node.name)
+			err = fmt.Errorf("%s: %v", node.name, err)
+			errs = append(errs, err)
+			notSucceeded[node.name] = err.Error()
+			r.managerResults[node.name] = false
+			setResourceManagerStatus(instance, node.name, err.Error())
+			continue
+		}
+		r.managerResults[node.name] = true
+		setResourceManagerStatus(instance, node.name, "")
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// setResourceManagerStatus records the result of a resource manager, the
+// message is empty if it succeeded
+func setResourceManagerStatus(instance *ocsv1.StorageCluster, name string, message string) {
+	var status *ocsv1.ResourceManagerStatus
+	for i := range instance.Status.ResourceManagers {
+		if instance.Status.ResourceManagers[i].Name == name {
+			status = &instance.Status.ResourceManagers[i]
+		}
+	}
+	if status == nil {
+		instance.Status.ResourceManagers = append(instance.Status.ResourceManagers, ocsv1.ResourceManagerStatus{Name: name})
+		status = &instance.Status.ResourceManagers[len(instance.Status.ResourceManagers)-1]
+	}
+	now := metav1.Now()
+	if message == "" {
+		status.LastSuccessTime = &now
+	} else {
+		status.LastFailureTime = &now
+	}
+	status.Message = message
+}
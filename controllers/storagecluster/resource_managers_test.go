@@ -0,0 +1,96 @@
+package storagecluster
+
+import (
+	"fmt"
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResourceManager struct {
+	err    error
+	called bool
+}
+
+func (obj *fakeResourceManager) ensureCreated(r *StorageClusterReconciler, sc *api.StorageCluster) error {
+	obj.called = true
+	return obj.err
+}
+
+func (obj *fakeResourceManager) ensureDeleted(r *StorageClusterReconciler, sc *api.StorageCluster) error {
+	return nil
+}
+
+func TestResourceManagerGraph(t *testing.T) {
+	assert.NoError(t, validateResourceManagerGraph(internalResourceManagers))
+	assert.NoError(t, validateResourceManagerGraph(externalResourceManagers))
+
+	manager := &fakeResourceManager{}
+	err := validateResourceManagerGraph([]resourceManagerNode{
+		{name: "cephCluster", manager: manager},
+		{name: "cephBlockPools", manager: manager, dependsOn: []string{"cephClusters"}},
+	})
+	assert.EqualError(t, err, `resource manager "cephBlockPools" depends on "cephClusters" that is not listed before it`)
+	err = validateResourceManagerGraph([]resourceManagerNode{
+		{name: "cephBlockPools", manager: manager, dependsOn: []string{"cephCluster"}},
+		{name: "cephCluster", manager: manager},
+	})
+	assert.Error(t, err)
+	err = validateResourceManagerGraph([]resourceManagerNode{
+		{name: "cephCluster", manager: manager},
+		{name: "cephCluster", manager: manager},
+	})
+	assert.EqualError(t, err, `resource manager "cephCluster" is listed twice`)
+}
+
+func TestRunResourceManagers(t *testing.T) {
+	failing := &fakeResourceManager{err: fmt.Errorf("failed to create StorageClass")}
+	dependent := &fakeResourceManager{}
+	transitive := &fakeResourceManager{}
+	independent := &fakeResourceManager{}
+	nodes := []resourceManagerNode{
+		{name: "storageClasses", manager: failing},
+		{name: "dependent", manager: dependent, dependsOn: []string{"storageClasses"}},
+		{name: "independent", manager: independent},
+		{name: "transitive", manager: transitive, dependsOn: []string{"dependent", "independent"}},
+	}
+
+	reconciler := createFakeStorageClusterReconciler(t)
+	sc := &api.StorageCluster{}
+	err := reconciler.runResourceManagers(sc, nodes)
+	assert.EqualError(t, err, "storageClasses: failed to create StorageClass")
+
+	// the siblings of a failing resource manager keep running
+	assert.True(t, failing.called)
+	assert.True(t, independent.called)
+	assert.False(t, dependent.called)
+	assert.False(t, transitive.called)
+
+	statuses := map[string]api.ResourceManagerStatus{}
+	for _, status := range sc.Status.ResourceManagers {
+		statuses[status.Name] = status
+	}
+	assert.Len(t, statuses, 4)
+	assert.NotNil(t, statuses["storageClasses"].LastFailureTime)
+	assert.Nil(t, statuses["storageClasses"].LastSuccessTime)
+	assert.Equal(t, "storageClasses: failed to create StorageClass", statuses["storageClasses"].Message)
+	assert.NotNil(t, statuses["dependent"].LastFailureTime)
+	assert.Contains(t, statuses["dependent"].Message, "depends on storageClasses")
+	assert.Contains(t, statuses["transitive"].Message, "depends on dependent")
+	assert.NotNil(t, statuses["independent"].LastSuccessTime)
+	assert.Empty(t, statuses["independent"].Message)
+
+	// the last failure is kept once the resource manager succeeds
+	failing.err = nil
+	err = reconciler.runResourceManagers(sc, nodes)
+	assert.NoError(t, err)
+	assert.True(t, transitive.called)
+	for _, status := range sc.Status.ResourceManagers {
+		assert.NotNil(t, status.LastSuccessTime)
+		assert.Empty(t, status.Message)
+		if status.Name != "independent" {
+			assert.NotNil(t, status.LastFailureTime)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // StorageClassConfiguration provides configuration options for a StorageClass.
@@ -30,22 +31,36 @@ func (obj *ocsStorageClass) ensureCreated(r *StorageClusterReconciler, instance
 		return err
 	}
 
+	if isEncryptedStorageClassEnabled(instance) {
+		kmsConfigMap, err := getKMSConfigMap(instance, r.Client, nil)
+		if err != nil {
+			return err
+		}
+		err = r.ensureCSIKMSConfigMap(instance, kmsConfigMap)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = r.deleteEncryptedStorageClass(instance)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = r.createStorageClasses(scs)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return r.deleteRemovedStorageClasses(scs, client.MatchingLabels{additionalCephBlockPoolLabel: instance.Name}, "of a removed cephBlockPool")
 }
 
 // ensureDeleted deletes the storageClasses that the ocs-operator created
 func (obj *ocsStorageClass) ensureDeleted(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
 
-	sccs, err := r.newStorageClassConfigurations(instance)
-	if err != nil {
-		r.Log.Error(err, fmt.Sprintf("Uninstall: Unable to determine the StorageClass names")) //nolint:gosimple
-		return nil
-	}
+	// the KMS ConfigMap may already be deleted, it is not needed to name
+	// the encrypted StorageClass
+	sccs := r.newStorageClassConfigurationsWithKMSID(instance, "")
 	for _, scc := range sccs {
 		sc := scc.storageClass
 		existing := storagev1.StorageClass{}
@@ -72,6 +87,45 @@ func (obj *ocsStorageClass) ensureDeleted(r *StorageClusterReconciler, instance
 			r.Log.Info(fmt.Sprintf("Uninstall: Error while getting StorageClass %s: %v", sc.Name, err))
 		}
 	}
+
+	if instance.Spec.ExternalStorage.Enable {
+		err := r.deleteRemovedExternalStorageClasses(instance, nil)
+		if err != nil {
+			r.Log.Error(err, "Uninstall: Ignoring error deleting the StorageClasses of the external cluster details")
+		}
+	}
+	return nil
+}
+
+// deleteRemovedExternalStorageClasses deletes the StorageClasses of the
+// external cluster details that are not in the given configurations
+func (r *StorageClusterReconciler) deleteRemovedExternalStorageClasses(instance *ocsv1.StorageCluster, sccs []StorageClassConfiguration) error {
+	return r.deleteRemovedStorageClasses(sccs, client.MatchingLabels{externalClusterDetailsLabel: instance.Name}, "of the external cluster details")
+}
+
+// deleteRemovedStorageClasses deletes the StorageClasses with the given
+// labels that are not in the desired configurations. The origin describes the
+// StorageClasses in the logs.
+func (r *StorageClusterReconciler) deleteRemovedStorageClasses(sccs []StorageClassConfiguration, labels client.MatchingLabels, origin string) error {
+	desired := map[string]bool{}
+	for _, scc := range sccs {
+		desired[scc.storageClass.Name] = true
+	}
+	existing := &storagev1.StorageClassList{}
+	err := r.Client.List(context.TODO(), existing, labels)
+	if err != nil {
+		return err
+	}
+	for i := range existing.Items {
+		sc := &existing.Items[i]
+		if desired[sc.Name] || sc.DeletionTimestamp != nil {
+			continue
+		}
+		r.Log.Info(fmt.Sprintf("deleting StorageClass %q %s", sc.Name, origin))
+		if err = r.Client.Delete(context.TODO(), sc); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -113,18 +167,41 @@ func (r *StorageClusterReconciler) createStorageClasses(sccs []StorageClassConfi
 				if err != nil {
 					return err
 				}
+			} else if missingLabels(existing.Labels, sc.Labels) {
+				// the labels can be updated in place
+				if existing.Labels == nil {
+					existing.Labels = map[string]string{}
+				}
+				for k, v := range sc.Labels {
+					existing.Labels[k] = v
+				}
+				r.Log.Info(fmt.Sprintf("Updating the labels of StorageClass %s", sc.Name))
+				err = r.Client.Update(context.TODO(), existing)
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
 	return nil
 }
 
+// missingLabels returns true if some of the desired labels are not set
+func missingLabels(existing, desired map[string]string) bool {
+	for k, v := range desired {
+		if existing[k] != v {
+			return true
+		}
+	}
+	return false
+}
+
 // newCephFilesystemStorageClassConfiguration generates configuration options for a Ceph Filesystem StorageClass.
 func newCephFilesystemStorageClassConfiguration(initData *ocsv1.StorageCluster) StorageClassConfiguration {
 	persistentVolumeReclaimDelete := corev1.PersistentVolumeReclaimDelete
 	allowVolumeExpansion := true
 	managementSpec := initData.Spec.ManagedResources.CephFilesystems
-	return StorageClassConfiguration{
+	scc := StorageClassConfiguration{
 		storageClass: &storagev1.StorageClass{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: generateNameForCephFilesystemSC(initData),
@@ -150,6 +227,14 @@ func newCephFilesystemStorageClassConfiguration(initData *ocsv1.StorageCluster)
 		reconcileStrategy: ReconcileStrategy(managementSpec.ReconcileStrategy),
 		disable:           managementSpec.DisableStorageClass,
 	}
+	if managementSpec.ErasureCoded != nil {
+		// the erasure coded pool is the second data pool of the filesystem
+		scc.storageClass.Parameters["pool"] = generateNameForCephFilesystemDataPool(initData, 1)
+	}
+	if isNetworkEncryptionActive(initData) {
+		scc.storageClass.Parameters["kernelMountOptions"] = csiSecureMountOption
+	}
+	return scc
 }
 
 // newCephBlockPoolStorageClassConfiguration generates configuration options for a Ceph Block Pool StorageClass.
@@ -157,7 +242,7 @@ func newCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster) S
 	persistentVolumeReclaimDelete := corev1.PersistentVolumeReclaimDelete
 	allowVolumeExpansion := true
 	managementSpec := initData.Spec.ManagedResources.CephBlockPools
-	return StorageClassConfiguration{
+	scc := StorageClassConfiguration{
 		storageClass: &storagev1.StorageClass{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: generateNameForCephBlockPoolSC(initData),
@@ -186,6 +271,82 @@ func newCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster) S
 		reconcileStrategy: ReconcileStrategy(managementSpec.ReconcileStrategy),
 		disable:           managementSpec.DisableStorageClass,
 	}
+	if isNetworkEncryptionActive(initData) {
+		scc.storageClass.Parameters["mapOptions"] = csiSecureMountOption
+	}
+	return scc
+}
+
+// newAdditionalCephBlockPoolStorageClassConfiguration generates configuration options for the StorageClass of a
+// user-defined Ceph Block Pool.
+func newAdditionalCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster, pool ocsv1.AdditionalCephBlockPool) StorageClassConfiguration {
+	scc := newCephBlockPoolStorageClassConfiguration(initData)
+	scc.storageClass.Name = generateNameForAdditionalCephBlockPoolSC(initData, pool.Name)
+	scc.storageClass.Labels = map[string]string{additionalCephBlockPoolLabel: initData.Name}
+	scc.storageClass.Annotations["description"] = fmt.Sprintf("Provides RWO Filesystem volumes, and RWO and RWX Block volumes from the %s pool", pool.Name)
+	scc.storageClass.Parameters["pool"] = generateNameForAdditionalCephBlockPool(initData, pool.Name)
+	return scc
+}
+
+// newEncryptedCephBlockPoolStorageClassConfiguration generates configuration options for the RBD StorageClass whose
+// volumes are encrypted with keys from the KMS of the given KMS ID.
+func newEncryptedCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster, kmsID string) StorageClassConfiguration {
+	scc := newCephBlockPoolStorageClassConfiguration(initData)
+	scc.storageClass.Name = generateNameForEncryptedCephBlockPoolSC(initData)
+	scc.storageClass.Annotations["description"] = "Provides RWO Filesystem volumes, and RWO and RWX Block volumes, encrypted with per-volume keys from the KMS"
+	scc.storageClass.Parameters["encrypted"] = "true"
+	scc.storageClass.Parameters["encryptionKMSID"] = kmsID
+	// the StorageClass is enabled through the encryption settings
+	scc.disable = false
+	return scc
+}
+
+// isEncryptedStorageClassEnabled returns whether the encrypted RBD StorageClass should be created
+func isEncryptedStorageClassEnabled(initData *ocsv1.StorageCluster) bool {
+	return initData.Spec.Encryption.StorageClass && initData.Spec.Encryption.KeyManagementService.Enable &&
+		!initData.Spec.ExternalStorage.Enable
+}
+
+// getEncryptedStorageClassKMSID returns the KMS ID the existing encrypted RBD
+// StorageClass refers to, or an empty string if it does not exist
+func (r *StorageClusterReconciler) getEncryptedStorageClassKMSID(initData *ocsv1.StorageCluster) (string, error) {
+	existing := &storagev1.StorageClass{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForEncryptedCephBlockPoolSC(initData)}, existing)
+	if errors.IsNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return existing.Parameters["encryptionKMSID"], nil
+}
+
+// deleteEncryptedStorageClass deletes the encrypted RBD StorageClass and the
+// CSI KMS configuration it refers to, once the KMS or the encrypted
+// StorageClass is disabled. The volumes already provisioned keep their keys
+// in the KMS.
+func (r *StorageClusterReconciler) deleteEncryptedStorageClass(initData *ocsv1.StorageCluster) error {
+	if ReconcileStrategy(initData.Spec.ManagedResources.CephBlockPools.ReconcileStrategy) == ReconcileStrategyIgnore {
+		return nil
+	}
+	existing := &storagev1.StorageClass{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForEncryptedCephBlockPoolSC(initData)}, existing)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if kmsID := existing.Parameters["encryptionKMSID"]; kmsID != "" {
+		if err := r.deleteCSIKMSConfig(initData, kmsID); err != nil {
+			return err
+		}
+	}
+	r.Log.Info(fmt.Sprintf("Encrypted StorageClass is disabled, deleting StorageClass %s", existing.Name))
+	err = r.Client.Delete(context.TODO(), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
 }
 
 // newCephOBCStorageClassConfiguration generates configuration options for a Ceph Object Store StorageClass.
@@ -214,12 +375,32 @@ func newCephOBCStorageClassConfiguration(initData *ocsv1.StorageCluster) Storage
 }
 
 // newStorageClassConfigurations returns the StorageClassConfiguration instances that should be created
-// on first run.
+// on first run. The encrypted StorageClass refers to the KMS ID of the KMS ConfigMap.
 func (r *StorageClusterReconciler) newStorageClassConfigurations(initData *ocsv1.StorageCluster) ([]StorageClassConfiguration, error) {
+	kmsID := ""
+	if isEncryptedStorageClassEnabled(initData) {
+		kmsConfigMap, err := getKMSConfigMap(initData, r.Client, nil)
+		if err != nil {
+			return nil, err
+		}
+		kmsID = getCSIKMSID(getKMSConnectionDetails(kmsConfigMap))
+	}
+	return r.newStorageClassConfigurationsWithKMSID(initData, kmsID), nil
+}
+
+// newStorageClassConfigurationsWithKMSID returns the StorageClassConfiguration instances, with the encrypted
+// StorageClass referring to the given KMS ID. The KMS ID is not needed to name the StorageClasses.
+func (r *StorageClusterReconciler) newStorageClassConfigurationsWithKMSID(initData *ocsv1.StorageCluster, kmsID string) []StorageClassConfiguration {
 	ret := []StorageClassConfiguration{
 		newCephFilesystemStorageClassConfiguration(initData),
 		newCephBlockPoolStorageClassConfiguration(initData),
 	}
+	for _, pool := range getAdditionalCephBlockPools(initData) {
+		ret = append(ret, newAdditionalCephBlockPoolStorageClassConfiguration(initData, pool))
+	}
+	if isEncryptedStorageClassEnabled(initData) {
+		ret = append(ret, newEncryptedCephBlockPoolStorageClassConfiguration(initData, kmsID))
+	}
 	// OBC storageclass will be returned only in TWO conditions,
 	// a. either 'externalStorage' is enabled
 	// OR
@@ -228,5 +409,5 @@ func (r *StorageClusterReconciler) newStorageClassConfigurations(initData *ocsv1
 	if initData.Spec.ExternalStorage.Enable || err == nil && !avoidObjectStore(platform) {
 		ret = append(ret, newCephOBCStorageClassConfiguration(initData))
 	}
-	return ret, nil
+	return ret
 }
@@ -2,12 +2,17 @@ package storagecluster
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
 	configv1 "github.com/openshift/api/config/v1"
 	api "github.com/openshift/ocs-operator/api/v1"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -81,3 +86,121 @@ func assertStorageClasses(t *testing.T, reconciler StorageClusterReconciler, cr
 	assert.Equal(t, expected[1].storageClass.ReclaimPolicy, actualSc2.ReclaimPolicy)
 	assert.Equal(t, expected[1].storageClass.Parameters, actualSc2.Parameters)
 }
+
+func TestEncryptedStorageClass(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.Encryption.StorageClass = true
+	sc.Spec.Encryption.KeyManagementService.Enable = true
+	kmsCM := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: KMSConfigMapName},
+		Data: map[string]string{
+			KMSProviderKey:       VaultKMSProvider,
+			KMSServiceNameKey:    "vault-tenants",
+			"VAULT_ADDR":         "https://vault.example.com:8200",
+			"VAULT_BACKEND_PATH": "ocs",
+			"VAULT_CACERT":       "",
+			// not read by ceph-csi
+			"VAULT_AUTH_KUBERNETES_ROLE": "ocs",
+		},
+	}
+	// KMS configurations added by the admin are preserved
+	csiKMSCM := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: CSIKMSConfigMapName},
+		Data:       map[string]string{"other": `{"KMS_PROVIDER":"vaulttokens"}`},
+	}
+	reconciler := createFakeStorageClusterReconciler(t, kmsCM, csiKMSCM)
+
+	var obj ocsStorageClass
+	assertEncryptedStorageClass := func(expectedKMSType string) {
+		err := obj.ensureCreated(&reconciler, sc)
+		assert.NoError(t, err)
+
+		actual := &storagev1.StorageClass{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-encrypted"}, actual)
+		assert.NoError(t, err)
+		assert.Equal(t, "true", actual.Parameters["encrypted"])
+		assert.Equal(t, "vault-tenants", actual.Parameters["encryptionKMSID"])
+		assert.Equal(t, generateNameForCephBlockPool(sc), actual.Parameters["pool"])
+
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName}, csiKMSCM)
+		assert.NoError(t, err)
+		assert.Contains(t, csiKMSCM.Data, "other")
+		kmsConfig := map[string]string{}
+		assert.NoError(t, json.Unmarshal([]byte(csiKMSCM.Data["vault-tenants"]), &kmsConfig))
+		assert.Equal(t, map[string]string{
+			KMSProviderKey:       expectedKMSType,
+			KMSServiceNameKey:    "vault-tenants",
+			"VAULT_ADDR":         "https://vault.example.com:8200",
+			"VAULT_BACKEND_PATH": "ocs",
+		}, kmsConfig)
+	}
+
+	assertEncryptedStorageClass("vaulttokens")
+
+	// tenants use their own service account with the Kubernetes auth
+	kmsCM.Data[VaultAuthMethodKey] = VaultKubernetesAuthMethod
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), kmsCM))
+	err := obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName}, csiKMSCM)
+	assert.NoError(t, err)
+	assert.Contains(t, csiKMSCM.Data["vault-tenants"], `"KMS_PROVIDER":"vaulttenantsa"`)
+
+	// the configuration of the previous KMS ID is removed
+	kmsCM.Data[KMSServiceNameKey] = "vault-ocs"
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), kmsCM))
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	csiKMSCM = &corev1.ConfigMap{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName}, csiKMSCM)
+	assert.NoError(t, err)
+	assert.NotContains(t, csiKMSCM.Data, "vault-tenants")
+	assert.Contains(t, csiKMSCM.Data, "vault-ocs")
+	assert.Contains(t, csiKMSCM.Data, "other")
+
+	// the encrypted StorageClass is only created with the KMS
+	sc.Spec.Encryption.KeyManagementService.Enable = false
+	sccs, err := reconciler.newStorageClassConfigurations(sc)
+	assert.NoError(t, err)
+	for _, scc := range sccs {
+		assert.NotEqual(t, "ocsinit-ceph-rbd-encrypted", scc.storageClass.Name)
+	}
+
+	// the encrypted StorageClass and its KMS configuration are deleted once
+	// the KMS is disabled
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd-encrypted"}, &storagev1.StorageClass{})
+	assert.True(t, errors.IsNotFound(err))
+	csiKMSCM = &corev1.ConfigMap{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName}, csiKMSCM)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"other": `{"KMS_PROVIDER":"vaulttokens"}`}, csiKMSCM.Data)
+}
+
+func TestDeleteEncryptedStorageClassWithoutKMSConfigMap(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.Encryption.StorageClass = true
+	sc.Spec.Encryption.KeyManagementService.Enable = true
+	kmsCM := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: KMSConfigMapName},
+		Data: map[string]string{
+			KMSProviderKey:    VaultKMSProvider,
+			KMSServiceNameKey: "vault-tenants",
+			"VAULT_ADDR":      "https://vault.example.com:8200",
+		},
+	}
+	reconciler := createFakeStorageClusterReconciler(t, kmsCM)
+
+	var obj ocsStorageClass
+	assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+
+	// the KMS ConfigMap is deleted first on uninstall, every StorageClass
+	// is deleted nonetheless
+	assert.NoError(t, reconciler.Client.Delete(context.TODO(), kmsCM))
+	assert.NoError(t, obj.ensureDeleted(&reconciler, sc))
+	for _, name := range []string{"ocsinit-ceph-rbd", "ocsinit-ceph-rbd-encrypted", "ocsinit-cephfs"} {
+		err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name}, &storagev1.StorageClass{})
+		assert.Truef(t, errors.IsNotFound(err), "StorageClass %s is not deleted", name)
+	}
+}
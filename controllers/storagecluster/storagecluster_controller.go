@@ -10,6 +10,7 @@ import (
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/util"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/version"
@@ -17,10 +18,13 @@ import (
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 var (
@@ -77,12 +81,62 @@ type StorageClusterReconciler struct {
 	Scheme        *runtime.Scheme
 	serverVersion *version.Info
 	conditions    []conditionsv1.Condition
-	phase         string
-	monitoringIP  string
-	nodeCount     int
-	platform      *Platform
-	images        ImageMap
-	recorder      record.EventRecorder
+	// components holds the status of the child resources in this reconcile
+	components []ocsv1.ComponentStatus
+	// managerResults holds whether each resource manager of this reconcile
+	// succeeded
+	managerResults map[string]bool
+	phase          string
+	nodeCount      int
+	platform       *Platform
+	images         ImageMap
+	recorder       record.EventRecorder
+	// externalChecker probes the endpoints of the external clusters, it is
+	// nil in tests
+	externalChecker *periodicChecker
+	// kmsChecker checks the health of the KMS of the StorageClusters, it is
+	// nil in tests
+	kmsChecker *periodicChecker
+	// poolUsage reads the usage of the pools in the background, it is nil in
+	// tests
+	poolUsage *periodicChecker
+	// watchNamespace is the namespace watched by the operator, empty if it
+	// watches all namespaces
+	watchNamespace string
+}
+
+// newNamespacedCache returns the cache of the namespace watched by the
+// operator, and makes the reconciler read through it. The StorageClusters and
+// the ConfigMaps, secrets, pods and PVCs they depend on are all in that
+// namespace, while the manager cache also serves the controllers that watch
+// every namespace, like the SnapshotSchedule one. The pods, PVCs, ConfigMaps
+// and secrets of the other namespaces are then neither watched nor cached
+// for the StorageClusters. It
+// returns the manager cache if the operator watches all namespaces.
+func (r *StorageClusterReconciler) newNamespacedCache(mgr ctrl.Manager) (cache.Cache, error) {
+	if r.watchNamespace == "" {
+		return mgr.GetCache(), nil
+	}
+	namespacedCache, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: r.watchNamespace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.Add(namespacedCache); err != nil {
+		return nil, err
+	}
+	r.Client = &client.DelegatingClient{
+		Reader: &client.DelegatingReader{
+			CacheReader:  namespacedCache,
+			ClientReader: mgr.GetAPIReader(),
+		},
+		Writer:       mgr.GetClient(),
+		StatusClient: mgr.GetClient(),
+	}
+	return namespacedCache, nil
 }
 
 // SetupWithManager sets up a controller with manager
@@ -97,6 +151,12 @@ func (r *StorageClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	r.platform = &Platform{}
 	r.recorder = mgr.GetEventRecorderFor("controller_storagecluster")
+	// the operator watches all namespaces if WATCH_NAMESPACE is not set
+	r.watchNamespace, _ = util.GetWatchNamespace()
+	namespacedCache, err := r.newNamespacedCache(mgr)
+	if err != nil {
+		return err
+	}
 
 	// Compose a predicate that is an OR of the specified predicates
 	scPredicate := util.ComposePredicates(
@@ -104,6 +164,12 @@ func (r *StorageClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		util.MetadataChangedPredicate{},
 	)
 
+	// the PVCs owned by the StorageCluster are watched through the namespaced
+	// cache like the OSD ones, instead of the cluster-wide one of Owns
+	pvcOwnerHandler := &handler.EnqueueRequestForOwner{
+		OwnerType:    &ocsv1.StorageCluster{},
+		IsController: true,
+	}
 	pvcPredicate := predicate.Funcs{
 		DeleteFunc: func(e event.DeleteEvent) bool {
 			// Evaluates to false if the object has been confirmed deleted.
@@ -111,10 +177,74 @@ func (r *StorageClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		},
 	}
 
+	// the KMS ConfigMap and secrets are not owned by the StorageCluster, but
+	// their changes have to be propagated to Ceph and NooBaa
+	kmsHandler := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.kmsSecretToStorageClusters),
+	}
+	kmsPredicate := predicate.NewPredicateFuncs(r.isKMSResource)
+
+	// the external cluster details secret is not owned by the StorageCluster,
+	// but its changes have to be propagated to the external resources
+	externalSecretHandler := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.externalSecretToStorageClusters),
+	}
+	externalSecretPredicate := predicate.NewPredicateFuncs(r.isExternalClusterDetailsSecret)
+
+	// the ceph-csi cluster configuration is owned by Rook, but the entries
+	// of the external cluster details have to be added back when Rook
+	// rewrites it
+	csiConfigHandler := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.csiConfigToStorageClusters),
+	}
+	csiConfigPredicate := predicate.NewPredicateFuncs(r.isCSIConfigMap)
+
+	// the OSD pods and PVCs are owned by the CephCluster, but the status of
+	// the StorageDeviceSets follows them
+	osdHandler := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.osdToStorageClusters),
+	}
+	osdPredicate := r.newOSDPredicate()
+
+	// the connectivity checker of the external clusters runs in the
+	// background and requeues the StorageClusters whose endpoints became
+	// reachable or unreachable
+	r.externalChecker = newExternalConnectivityChecker(r)
+	if err := mgr.Add(r.externalChecker); err != nil {
+		return err
+	}
+
+	// the KMS health checker runs in the background as well, and requeues
+	// the StorageClusters whose KMS health changed
+	r.kmsChecker = newKMSHealthChecker(r)
+	if err := mgr.Add(r.kmsChecker); err != nil {
+		return err
+	}
+
+	// the usage of the pools is read from the mgr in the background as well,
+	// and requeues the StorageClusters whose usage changed
+	r.poolUsage = newPoolUsageCollector(r)
+	if err := mgr.Add(r.poolUsage); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ocsv1.StorageCluster{}, builder.WithPredicates(scPredicate)).
 		Owns(&cephv1.CephCluster{}).
+		Owns(&cephv1.CephBlockPool{}, builder.WithPredicates(newCephBlockPoolPredicate())).
+		Owns(&cephv1.CephObjectStore{}).
+		Owns(&cephv1.CephRBDMirror{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Owns(&nbv1.NooBaa{}).
-		Owns(&corev1.PersistentVolumeClaim{}, builder.WithPredicates(pvcPredicate)).
+		Owns(&batchv1.Job{}).
+		Watches(source.NewKindWithCache(&corev1.ConfigMap{}, namespacedCache), kmsHandler, builder.WithPredicates(kmsPredicate)).
+		Watches(source.NewKindWithCache(&corev1.Secret{}, namespacedCache), kmsHandler, builder.WithPredicates(kmsPredicate)).
+		Watches(source.NewKindWithCache(&corev1.Secret{}, namespacedCache), externalSecretHandler, builder.WithPredicates(externalSecretPredicate)).
+		Watches(source.NewKindWithCache(&corev1.ConfigMap{}, namespacedCache), csiConfigHandler, builder.WithPredicates(csiConfigPredicate)).
+		Watches(source.NewKindWithCache(&corev1.PersistentVolumeClaim{}, namespacedCache), pvcOwnerHandler, builder.WithPredicates(pvcPredicate)).
+		Watches(source.NewKindWithCache(&corev1.Pod{}, namespacedCache), osdHandler, builder.WithPredicates(osdPredicate)).
+		Watches(source.NewKindWithCache(&corev1.PersistentVolumeClaim{}, namespacedCache), osdHandler, builder.WithPredicates(osdPredicate)).
+		Watches(&source.Channel{Source: r.externalChecker.events}, &handler.EnqueueRequestForObject{}).
+		Watches(&source.Channel{Source: r.kmsChecker.events}, &handler.EnqueueRequestForObject{}).
+		Watches(&source.Channel{Source: r.poolUsage.events}, &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
@@ -17,6 +17,7 @@ import (
 	rookCephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	v1 "github.com/rook/rook/pkg/apis/rook.io/v1"
 	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -24,7 +25,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	k8sVersion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -32,6 +35,7 @@ import (
 	api "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
 	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	"github.com/openshift/ocs-operator/controllers/validation"
 	"github.com/openshift/ocs-operator/version"
 )
 
@@ -620,7 +624,7 @@ func TestNonWatchedReconcileWithTheCephClusterType(t *testing.T) {
 	err = reconciler.Client.Get(context.TODO(), mockStorageClusterRequest.NamespacedName, actual)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, actual.Status.Conditions)
-	assert.Len(t, actual.Status.Conditions, 5)
+	assert.Len(t, actual.Status.Conditions, 6)
 
 	assertExpectedCondition(t, actual.Status.Conditions)
 }
@@ -754,7 +758,7 @@ func TestStorageDeviceSets(t *testing.T) {
 
 	for _, tc := range testcases {
 		tc.storageCluster.Spec.StorageDeviceSets = tc.deviceSets
-		err := reconciler.validateStorageDeviceSets(tc.storageCluster)
+		err := reconciler.validateStorageClusterSpec(tc.storageCluster)
 		if tc.expectedError == nil {
 			assert.NoError(t, err)
 			continue
@@ -764,6 +768,28 @@ func TestStorageDeviceSets(t *testing.T) {
 	}
 }
 
+func TestStorageClusterSpecValidationEvents(t *testing.T) {
+	reconciler := createFakeStorageClusterReconciler(t)
+	recorder := reconciler.recorder.(*record.FakeRecorder)
+	sc := &api.StorageCluster{}
+	sc.Spec.StorageDeviceSets = []api.StorageDeviceSet{{Name: "mock-sds", Count: 3, Portable: true}}
+
+	assert.Error(t, reconciler.validateStorageClusterSpec(sc))
+	assert.NotEmpty(t, recorder.Events)
+	for len(recorder.Events) != 0 {
+		<-recorder.Events
+	}
+
+	// the same errors are not reported again on the next reconcile
+	assert.Error(t, reconciler.validateStorageClusterSpec(sc))
+	assert.Empty(t, recorder.Events)
+
+	// new errors are reported
+	sc.Spec.StorageDeviceSets[0].Count = -1
+	assert.Error(t, reconciler.validateStorageClusterSpec(sc))
+	assert.NotEmpty(t, recorder.Events)
+}
+
 func TestStorageClusterInitConditions(t *testing.T) {
 	cc := &rookCephv1.CephCluster{}
 	mockCephCluster.DeepCopyInto(cc)
@@ -782,7 +808,7 @@ func TestStorageClusterInitConditions(t *testing.T) {
 	err = reconciler.Client.Get(context.TODO(), mockStorageClusterRequest.NamespacedName, actual)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, actual.Status.Conditions)
-	assert.Len(t, actual.Status.Conditions, 5)
+	assert.Len(t, actual.Status.Conditions, 6)
 
 	assertExpectedCondition(t, actual.Status.Conditions)
 }
@@ -856,6 +882,7 @@ func assertExpectedCondition(t *testing.T, conditions []conditionsv1.Condition)
 		conditionsv1.ConditionProgressing: corev1.ConditionTrue,
 		conditionsv1.ConditionDegraded:    corev1.ConditionFalse,
 		conditionsv1.ConditionUpgradeable: corev1.ConditionUnknown,
+		api.ConditionSpecValid:            corev1.ConditionTrue,
 	}
 	for cType, status := range expectedConditions {
 		found := assertCondition(conditions, cType, status)
@@ -884,6 +911,7 @@ func createFakeStorageClusterReconciler(t *testing.T, obj ...runtime.Object) Sto
 		serverVersion: &k8sVersion.Info{},
 		Log:           logf.Log.WithName("controller_storagecluster_test"),
 		platform:      &Platform{platform: configv1.NonePlatformType},
+		recorder:      record.NewFakeRecorder(1024),
 	}
 }
 
@@ -900,6 +928,10 @@ func createFakeScheme(t *testing.T) *runtime.Scheme {
 	if err != nil {
 		assert.Fail(t, "failed to add storagev1 scheme")
 	}
+	err = batchv1.AddToScheme(scheme)
+	if err != nil {
+		assert.Fail(t, "failed to add batchv1 scheme")
+	}
 	err = rookCephv1.AddToScheme(scheme)
 	if err != nil {
 		assert.Fail(t, "failed to add rookCephv1 scheme")
@@ -984,11 +1016,13 @@ func TestStorageClusterOnMultus(t *testing.T) {
 	for _, c := range cases {
 		c.cr = createDefaultStorageCluster()
 		if c.testCase != "default" {
-			c.cr.Spec.Network = &v1.NetworkSpec{
-				Provider: networkProvider,
-				Selectors: map[string]string{
-					"public":  c.publicNW,
-					"cluster": c.clusterNW,
+			c.cr.Spec.Network = &api.NetworkSpec{
+				NetworkSpec: v1.NetworkSpec{
+					Provider: networkProvider,
+					Selectors: map[string]string{
+						"public":  c.publicNW,
+						"cluster": c.clusterNW,
+					},
 				},
 			}
 		}
@@ -996,7 +1030,7 @@ func TestStorageClusterOnMultus(t *testing.T) {
 		_ = reconciler.Client.Create(context.TODO(), c.cr)
 		result, err := reconciler.Reconcile(request)
 		if c.testCase != "default" {
-			validMultus := validateMultusSelectors(c.cr.Spec.Network.Selectors)
+			validMultus := validation.ValidateNetwork(c.cr.Spec.Network, field.NewPath("spec", "network")).ToAggregate()
 			if validMultus != nil {
 				assert.Error(t, err)
 			} else {
@@ -1018,7 +1052,7 @@ func assertCephClusterNetwork(t assert.TestingT, reconciler StorageClusterReconc
 		assert.Equal(t, "", cephCluster.Spec.Network.NetworkSpec.Provider)
 		assert.Nil(t, cephCluster.Spec.Network.NetworkSpec.Selectors)
 	} else {
-		assert.Equal(t, *cr.Spec.Network, cephCluster.Spec.Network.NetworkSpec)
+		assert.Equal(t, cr.Spec.Network.NetworkSpec, cephCluster.Spec.Network.NetworkSpec)
 	}
 }
 
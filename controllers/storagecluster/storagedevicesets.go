@@ -0,0 +1,337 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	rook "github.com/rook/rook/pkg/apis/rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// osdAppLabelValue is the app label of the OSD pods created by Rook
+	osdAppLabelValue = "rook-ceph-osd"
+	// deviceSetLabelKey is set by Rook on the PVCs and the OSD pods of a
+	// StorageClassDeviceSet to its name
+	deviceSetLabelKey = "ceph.rook.io/DeviceSet"
+	// deviceSetPVCIDLabelKey is set by Rook on the PVCs of a
+	// StorageClassDeviceSet to "<set>-<template>-<index>"
+	deviceSetPVCIDLabelKey = "ceph.rook.io/DeviceSetPVCId"
+	// osdPVCLabelKey is set by Rook on an OSD pod to the name of its data PVC
+	osdPVCLabelKey = "ceph.rook.io/pvc"
+	// defaultDataPVCTemplateName is the name Rook gives to an unnamed data
+	// PVC template
+	defaultDataPVCTemplateName = "data"
+)
+
+// ocsStorageDeviceSets reports the OSDs and PVCs of the StorageDeviceSets in
+// the status of the StorageCluster
+type ocsStorageDeviceSets struct{}
+
+// ensureCreated sets the status of the StorageDeviceSets. While the cluster is
+// expanding, it keeps the phase at PhaseClusterExpanding until every OSD of
+// the StorageDeviceSets is ready.
+func (obj *ocsStorageDeviceSets) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	err := r.Client.List(context.TODO(), pvcs, client.InNamespace(sc.Namespace), client.HasLabels{deviceSetLabelKey})
+	if err != nil {
+		return fmt.Errorf("failed to list the PVCs of the StorageDeviceSets: %v", err)
+	}
+	pods := &corev1.PodList{}
+	err = r.Client.List(context.TODO(), pods, client.InNamespace(sc.Namespace), client.MatchingLabels{"app": osdAppLabelValue})
+	if err != nil {
+		return fmt.Errorf("failed to list the OSD pods: %v", err)
+	}
+
+	statuses := newStorageDeviceSetStatuses(sc, newStorageClassDeviceSets(sc, r.serverVersion), pvcs.Items, pods.Items)
+	for i := range statuses {
+		for j := range statuses[i].ReplicaSets {
+			replicaSet := &statuses[i].ReplicaSets[j]
+			if len(replicaSet.FailureDomainValues) != 0 || replicaSet.FailureDomainKey == "" {
+				continue
+			}
+			replicaSet.FailureDomainValues = r.getOSDFailureDomains(replicaSet.Name, replicaSet.FailureDomainKey, pods.Items)
+		}
+	}
+	if len(statuses) == 0 {
+		statuses = nil
+	}
+	sc.Status.StorageDeviceSets = statuses
+
+	if r.phase == statusutil.PhaseClusterExpanding && storageDeviceSetsReady(statuses) {
+		r.Log.Info("All the OSDs of the StorageDeviceSets are ready, the expansion is complete")
+		r.phase = ""
+	}
+	return nil
+}
+
+// ensureDeleted is dummy func for the ocsStorageDeviceSets
+func (obj *ocsStorageDeviceSets) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	return nil
+}
+
+// newStorageDeviceSetStatuses returns the status of every StorageDeviceSet
+// from the Rook StorageClassDeviceSets it is expanded into, and from the PVCs
+// and OSD pods Rook created for them. Only the failure domains a replica is
+// pinned to are set.
+func newStorageDeviceSetStatuses(sc *ocsv1.StorageCluster, sets []rook.StorageClassDeviceSet, pvcs []corev1.PersistentVolumeClaim, pods []corev1.Pod) []ocsv1.StorageDeviceSetStatus {
+	// the OSD pods of each StorageClassDeviceSet, by the name of their PVC
+	osdPods := map[string]map[string]*corev1.Pod{}
+	for i := range pods {
+		pod := &pods[i]
+		setName := pod.Labels[deviceSetLabelKey]
+		if setName == "" {
+			continue
+		}
+		if osdPods[setName] == nil {
+			osdPods[setName] = map[string]*corev1.Pod{}
+		}
+		osdPods[setName][pod.Labels[osdPVCLabelKey]] = pod
+	}
+
+	statuses := []ocsv1.StorageDeviceSetStatus{}
+	for _, ds := range sc.Spec.StorageDeviceSets {
+		status := ocsv1.StorageDeviceSetStatus{
+			Name:        ds.Name,
+			Encrypted:   sc.Spec.Encryption.Enable,
+			FailingPVCs: []string{},
+		}
+		if ds.Config.Encrypted != nil {
+			status.Encrypted = *ds.Config.Encrypted
+		}
+		failureDomainKey := getDeviceSetFailureDomainKey(sc, ds)
+		dataTemplateName := ds.DataPVCTemplate.Name
+		if dataTemplateName == "" {
+			dataTemplateName = defaultDataPVCTemplateName
+		}
+
+		for _, set := range getDeviceSetReplicas(ds, sets) {
+			replicaSet := ocsv1.StorageDeviceSetReplicaStatus{
+				Name:             set.Name,
+				DesiredOSDs:      set.Count,
+				FailureDomainKey: failureDomainKey,
+			}
+			if key, value := getPinnedFailureDomain(set.Placement); key != "" {
+				replicaSet.FailureDomainKey = key
+				replicaSet.FailureDomainValues = []string{value}
+			}
+
+			for _, pvc := range pvcs {
+				if pvc.Labels[deviceSetLabelKey] != set.Name ||
+					!strings.HasPrefix(pvc.Labels[deviceSetPVCIDLabelKey], fmt.Sprintf("%s-%s-", set.Name, dataTemplateName)) {
+					continue
+				}
+				switch pvc.Status.Phase {
+				case corev1.ClaimBound:
+					status.BoundPVCs++
+				case corev1.ClaimLost:
+					status.FailingPVCs = append(status.FailingPVCs, pvc.Name)
+					continue
+				default:
+					status.PendingPVCs++
+					continue
+				}
+				pod, found := osdPods[set.Name][pvc.Name]
+				if !found {
+					continue
+				}
+				if isPodReady(pod) {
+					replicaSet.ReadyOSDs++
+				} else {
+					status.FailingPVCs = append(status.FailingPVCs, pvc.Name)
+				}
+			}
+
+			status.DesiredOSDs += replicaSet.DesiredOSDs
+			status.ReadyOSDs += replicaSet.ReadyOSDs
+			status.ReplicaSets = append(status.ReplicaSets, replicaSet)
+		}
+
+		sort.Strings(status.FailingPVCs)
+		if len(status.FailingPVCs) == 0 {
+			status.FailingPVCs = nil
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// getDeviceSetReplicas returns the Rook StorageClassDeviceSets a
+// StorageDeviceSet is expanded into, named "<name>-<index>"
+func getDeviceSetReplicas(ds ocsv1.StorageDeviceSet, sets []rook.StorageClassDeviceSet) []rook.StorageClassDeviceSet {
+	replicas := []rook.StorageClassDeviceSet{}
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s-%d", ds.Name, i)
+		found := false
+		for _, set := range sets {
+			if set.Name == name {
+				replicas = append(replicas, set)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return replicas
+		}
+	}
+}
+
+// getDeviceSetFailureDomainKey returns the node label of the failure domain
+// the OSDs of a StorageDeviceSet are spread across
+func getDeviceSetFailureDomainKey(sc *ocsv1.StorageCluster, ds ocsv1.StorageDeviceSet) string {
+	topologyKey := ds.TopologyKey
+	if topologyKey == "" {
+		topologyKey = determineFailureDomain(sc)
+	}
+	if sc.Status.NodeTopologies != nil {
+		topologyKey, _ = sc.Status.NodeTopologies.GetKeyValues(topologyKey)
+	}
+	return topologyKey
+}
+
+// getPinnedFailureDomain returns the failure domain a replica of a
+// StorageDeviceSet is pinned to by setTopologyForAffinity, if any
+func getPinnedFailureDomain(placement rook.Placement) (string, string) {
+	if placement.NodeAffinity == nil || placement.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return "", ""
+	}
+	for _, term := range placement.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, requirement := range term.MatchExpressions {
+			if requirement.Operator == corev1.NodeSelectorOpIn && len(requirement.Values) == 1 {
+				return requirement.Key, requirement.Values[0]
+			}
+		}
+	}
+	return "", ""
+}
+
+// getOSDFailureDomains returns the failure domains of the nodes the ready OSDs
+// of a Rook StorageClassDeviceSet run on
+func (r *StorageClusterReconciler) getOSDFailureDomains(setName, failureDomainKey string, pods []corev1.Pod) []string {
+	values := []string{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Labels[deviceSetLabelKey] != setName || pod.Spec.NodeName == "" || !isPodReady(pod) {
+			continue
+		}
+		node := &corev1.Node{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: pod.Spec.NodeName}, node)
+		if err != nil {
+			r.Log.Error(err, "Failed to get the node of the OSD", "Pod", pod.Name, "Node", pod.Spec.NodeName)
+			continue
+		}
+		if value, found := node.Labels[failureDomainKey]; found && !contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// storageDeviceSetsReady returns true if every OSD of the StorageDeviceSets is
+// ready
+func storageDeviceSetsReady(statuses []ocsv1.StorageDeviceSetStatus) bool {
+	for _, status := range statuses {
+		if status.ReadyOSDs < status.DesiredOSDs {
+			return false
+		}
+	}
+	return true
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// isOSDResource returns whether the object is an OSD pod or a PVC of a
+// StorageDeviceSet in the watched namespace
+func (r *StorageClusterReconciler) isOSDResource(meta metav1.Object, object runtime.Object) bool {
+	if r.watchNamespace != "" && meta.GetNamespace() != r.watchNamespace {
+		return false
+	}
+	if _, found := meta.GetLabels()[deviceSetLabelKey]; !found {
+		return false
+	}
+	switch object.(type) {
+	case *corev1.Pod:
+		return meta.GetLabels()["app"] == osdAppLabelValue
+	case *corev1.PersistentVolumeClaim:
+		return true
+	}
+	return false
+}
+
+// osdStatusChanged returns whether an update of an OSD pod or of a PVC of a
+// StorageDeviceSet changes the status of the StorageDeviceSets
+func osdStatusChanged(oldObject, newObject runtime.Object) bool {
+	switch newObj := newObject.(type) {
+	case *corev1.Pod:
+		oldObj, ok := oldObject.(*corev1.Pod)
+		return !ok || isPodReady(oldObj) != isPodReady(newObj) || oldObj.Spec.NodeName != newObj.Spec.NodeName
+	case *corev1.PersistentVolumeClaim:
+		oldObj, ok := oldObject.(*corev1.PersistentVolumeClaim)
+		return !ok || oldObj.Status.Phase != newObj.Status.Phase
+	}
+	return false
+}
+
+// newOSDPredicate filters the events of the pods and PVCs, so that only the
+// creation, deletion, and the readiness and phase changes of the OSD pods and
+// the PVCs of the StorageDeviceSets requeue the StorageClusters
+func (r *StorageClusterReconciler) newOSDPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return r.isOSDResource(e.Meta, e.Object)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return r.isOSDResource(e.Meta, e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return r.isOSDResource(e.MetaNew, e.ObjectNew) && osdStatusChanged(e.ObjectOld, e.ObjectNew)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// osdToStorageClusters maps the PVCs and the pods of the OSDs to the
+// StorageClusters of their namespace, so that the status of the
+// StorageDeviceSets follows them. The events of other pods and PVCs are
+// filtered out by the predicate of newOSDPredicate.
+func (r *StorageClusterReconciler) osdToStorageClusters(obj handler.MapObject) []reconcile.Request {
+	storageClusters := &ocsv1.StorageClusterList{}
+	if err := r.Client.List(context.TODO(), storageClusters, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list StorageClusters")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, sc := range storageClusters.Items {
+		if !sc.Spec.ExternalStorage.Enable {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace},
+			})
+		}
+	}
+	return requests
+}
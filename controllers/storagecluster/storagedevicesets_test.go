@@ -0,0 +1,159 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func createOSDPVC(name, setName, pvcID string, phase corev1.PersistentVolumeClaimPhase) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "storage-test-ns",
+			Labels: map[string]string{
+				deviceSetLabelKey:      setName,
+				deviceSetPVCIDLabelKey: pvcID,
+			},
+		},
+		Status: corev1.PersistentVolumeClaimStatus{Phase: phase},
+	}
+}
+
+func createOSDPod(name, setName, pvcName string, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "storage-test-ns",
+			Labels: map[string]string{
+				"app":             osdAppLabelValue,
+				deviceSetLabelKey: setName,
+				osdPVCLabelKey:    pvcName,
+			},
+		},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		},
+	}
+}
+
+func TestEnsureStorageDeviceSets(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Namespace = "storage-test-ns"
+	sc.Spec.StorageDeviceSets = []api.StorageDeviceSet{
+		{
+			Name:            "mock-sds",
+			Count:           1,
+			Replica:         3,
+			DataPVCTemplate: mockDataPVCTemplate,
+		},
+	}
+	sc.Spec.Encryption.Enable = true
+
+	objects := []runtime.Object{
+		createOSDPVC("mock-sds-0-data-0abcd", "mock-sds-0", "mock-sds-0-data-0", corev1.ClaimBound),
+		createOSDPVC("mock-sds-0-metadata-0abcd", "mock-sds-0", "mock-sds-0-metadata-0", corev1.ClaimPending),
+		createOSDPVC("mock-sds-1-data-0abcd", "mock-sds-1", "mock-sds-1-data-0", corev1.ClaimBound),
+		createOSDPVC("mock-sds-2-data-0abcd", "mock-sds-2", "mock-sds-2-data-0", corev1.ClaimPending),
+		createOSDPod("rook-ceph-osd-0", "mock-sds-0", "mock-sds-0-data-0abcd", corev1.ConditionTrue),
+		createOSDPod("rook-ceph-osd-1", "mock-sds-1", "mock-sds-1-data-0abcd", corev1.ConditionFalse),
+	}
+	reconciler := createFakeStorageClusterReconciler(t, objects...)
+	reconciler.phase = statusutil.PhaseClusterExpanding
+
+	var obj ocsStorageDeviceSets
+	err := obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	if assert.Len(t, sc.Status.StorageDeviceSets, 1) {
+		status := sc.Status.StorageDeviceSets[0]
+		assert.Equal(t, "mock-sds", status.Name)
+		assert.Equal(t, 3, status.DesiredOSDs)
+		assert.Equal(t, 1, status.ReadyOSDs)
+		assert.Equal(t, 2, status.BoundPVCs)
+		assert.Equal(t, 1, status.PendingPVCs)
+		assert.Equal(t, []string{"mock-sds-1-data-0abcd"}, status.FailingPVCs)
+		assert.True(t, status.Encrypted)
+		assert.Equal(t, []api.StorageDeviceSetReplicaStatus{
+			{Name: "mock-sds-0", DesiredOSDs: 1, ReadyOSDs: 1, FailureDomainKey: zoneTopologyLabel, FailureDomainValues: []string{"zone1"}},
+			{Name: "mock-sds-1", DesiredOSDs: 1, ReadyOSDs: 0, FailureDomainKey: zoneTopologyLabel, FailureDomainValues: []string{"zone2"}},
+			{Name: "mock-sds-2", DesiredOSDs: 1, ReadyOSDs: 0, FailureDomainKey: zoneTopologyLabel, FailureDomainValues: []string{"zone3"}},
+		}, status.ReplicaSets)
+	}
+	// the expansion goes on until the new OSDs are ready
+	assert.Equal(t, statusutil.PhaseClusterExpanding, reconciler.phase)
+
+	pvc := createOSDPVC("mock-sds-2-data-0abcd", "mock-sds-2", "mock-sds-2-data-0", corev1.ClaimBound)
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), pvc))
+	pod := createOSDPod("rook-ceph-osd-1", "mock-sds-1", "mock-sds-1-data-0abcd", corev1.ConditionTrue)
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), pod))
+	pod = createOSDPod("rook-ceph-osd-2", "mock-sds-2", "mock-sds-2-data-0abcd", corev1.ConditionTrue)
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), pod))
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	status := sc.Status.StorageDeviceSets[0]
+	assert.Equal(t, 3, status.ReadyOSDs)
+	assert.Equal(t, 3, status.BoundPVCs)
+	assert.Equal(t, 0, status.PendingPVCs)
+	assert.Nil(t, status.FailingPVCs)
+	assert.Equal(t, "", reconciler.phase)
+}
+
+func TestGetOSDFailureDomains(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "node1",
+			Labels: map[string]string{"topology.rook.io/rack": "rack1"},
+		},
+	}
+	ready := createOSDPod("rook-ceph-osd-0", "mock-sds-0", "mock-sds-0-data-0abcd", corev1.ConditionTrue)
+	ready.Spec.NodeName = node.Name
+	notReady := createOSDPod("rook-ceph-osd-1", "mock-sds-0", "mock-sds-0-data-1abcd", corev1.ConditionFalse)
+	notReady.Spec.NodeName = "node2"
+	reconciler := createFakeStorageClusterReconciler(t, node)
+
+	values := reconciler.getOSDFailureDomains("mock-sds-0", "topology.rook.io/rack", []corev1.Pod{*ready, *notReady})
+	assert.Equal(t, []string{"rack1"}, values)
+	values = reconciler.getOSDFailureDomains("mock-sds-1", "topology.rook.io/rack", []corev1.Pod{*ready, *notReady})
+	assert.Nil(t, values)
+}
+
+func TestOSDPredicate(t *testing.T) {
+	reconciler := createFakeStorageClusterReconciler(t)
+	reconciler.watchNamespace = "storage-test-ns"
+	osdPredicate := reconciler.newOSDPredicate()
+
+	pod := createOSDPod("rook-ceph-osd-0", "mock-sds-0", "mock-sds-0-data-0abcd", corev1.ConditionFalse)
+	ready := createOSDPod("rook-ceph-osd-0", "mock-sds-0", "mock-sds-0-data-0abcd", corev1.ConditionTrue)
+	assert.True(t, osdPredicate.Create(event.CreateEvent{Meta: pod, Object: pod}))
+	assert.True(t, osdPredicate.Delete(event.DeleteEvent{Meta: pod, Object: pod}))
+	// only the readiness changes of the OSD pods are followed
+	assert.True(t, osdPredicate.Update(event.UpdateEvent{MetaOld: pod, ObjectOld: pod, MetaNew: ready, ObjectNew: ready}))
+	relabeled := ready.DeepCopy()
+	relabeled.Annotations = map[string]string{"foo": "bar"}
+	assert.False(t, osdPredicate.Update(event.UpdateEvent{MetaOld: ready, ObjectOld: ready, MetaNew: relabeled, ObjectNew: relabeled}))
+
+	// the other pods, and the pods of other namespaces are ignored
+	other := pod.DeepCopy()
+	other.Labels["app"] = "rook-ceph-mon"
+	assert.False(t, osdPredicate.Create(event.CreateEvent{Meta: other, Object: other}))
+	other = pod.DeepCopy()
+	other.Namespace = "other-ns"
+	assert.False(t, osdPredicate.Create(event.CreateEvent{Meta: other, Object: other}))
+
+	// only the phase changes of the PVCs of the StorageDeviceSets are followed
+	pending := createOSDPVC("mock-sds-0-data-0abcd", "mock-sds-0", "mock-sds-0-data-0", corev1.ClaimPending)
+	bound := createOSDPVC("mock-sds-0-data-0abcd", "mock-sds-0", "mock-sds-0-data-0", corev1.ClaimBound)
+	assert.True(t, osdPredicate.Create(event.CreateEvent{Meta: pending, Object: pending}))
+	assert.True(t, osdPredicate.Update(event.UpdateEvent{MetaOld: pending, ObjectOld: pending, MetaNew: bound, ObjectNew: bound}))
+	assert.False(t, osdPredicate.Update(event.UpdateEvent{MetaOld: bound, ObjectOld: bound, MetaNew: bound, ObjectNew: bound}))
+	unlabeled := bound.DeepCopy()
+	delete(unlabeled.Labels, deviceSetLabelKey)
+	assert.False(t, osdPredicate.Create(event.CreateEvent{Meta: unlabeled, Object: unlabeled}))
+}
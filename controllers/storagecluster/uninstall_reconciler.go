@@ -267,7 +267,7 @@ func (r *StorageClusterReconciler) reconcileUninstallAnnotations(sc *ocsv1.Stora
 	return nil
 }
 
-// deleteResources is the function where the storageClusterFinalizer is handled
+// deleteResources is the function where the StorageClusterFinalizer is handled
 // Every function that is called within this function should be idempotent
 func (r *StorageClusterReconciler) deleteResources(sc *ocsv1.StorageCluster) error {
 
@@ -293,8 +293,10 @@ func (r *StorageClusterReconciler) deleteResources(sc *ocsv1.StorageCluster) err
 		&ocsCephObjectStoreUsers{},
 		&ocsCephObjectStores{},
 		&ocsCephFilesystems{},
+		&ocsCephRBDMirrors{},
 		&ocsCephBlockPools{},
 		&ocsSnapshotClass{},
+		&ocsVolumeReplicationClass{},
 		&ocsStorageClass{},
 	}
 
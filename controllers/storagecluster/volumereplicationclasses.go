@@ -0,0 +1,191 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// VolumeReplicationClass is provided by the volume replication operator, which
+// is not vendored, so it is handled as an unstructured object
+var volumeReplicationClassGVK = schema.GroupVersionKind{
+	Group:   "replication.storage.openshift.io",
+	Version: "v1alpha1",
+	Kind:    "VolumeReplicationClass",
+}
+
+// secret name and namespace for the volume replication class
+const (
+	replicationSecretName      = "replication.storage.openshift.io/replication-secret-name"
+	replicationSecretNamespace = "replication.storage.openshift.io/replication-secret-namespace"
+)
+
+type ocsVolumeReplicationClass struct{}
+
+// VolumeReplicationClassConfiguration provides configuration options for a VolumeReplicationClass.
+type VolumeReplicationClassConfiguration struct {
+	volumeReplicationClass *unstructured.Unstructured
+	reconcileStrategy      ReconcileStrategy
+	disable                bool
+}
+
+// newVolumeReplicationClass returns the RBD VolumeReplicationClass
+func newVolumeReplicationClass(instance *ocsv1.StorageCluster) *unstructured.Unstructured {
+	spec := instance.Spec.ManagedResources.CephBlockPools.VolumeReplicationClass
+	mirroringMode := spec.MirroringMode
+	if mirroringMode == "" {
+		mirroringMode = defaults.VolumeReplicationMirroringMode
+	}
+	parameters := map[string]interface{}{
+		"mirroringMode":            mirroringMode,
+		replicationSecretName:      generateNameForSnapshotClassSecret(rbdSnapshotter),
+		replicationSecretNamespace: instance.Namespace,
+	}
+	// the scheduling interval only applies to snapshot based mirroring
+	if mirroringMode == defaults.VolumeReplicationMirroringMode {
+		schedulingInterval := spec.SchedulingInterval
+		if schedulingInterval == "" {
+			schedulingInterval = defaults.VolumeReplicationSchedulingInterval
+		}
+		parameters["schedulingInterval"] = schedulingInterval
+	}
+
+	vrc := &unstructured.Unstructured{}
+	vrc.SetGroupVersionKind(volumeReplicationClassGVK)
+	vrc.SetName(generateNameForVolumeReplicationClass(instance))
+	vrc.Object["spec"] = map[string]interface{}{
+		"provisioner": generateNameForSnapshotClassDriver(instance, rbdSnapshotter),
+		"parameters":  parameters,
+	}
+	return vrc
+}
+
+// newVolumeReplicationClassConfigurations generates configuration options for the VolumeReplicationClasses.
+func newVolumeReplicationClassConfigurations(instance *ocsv1.StorageCluster) []VolumeReplicationClassConfiguration {
+	managementSpec := instance.Spec.ManagedResources.CephBlockPools
+	return []VolumeReplicationClassConfiguration{
+		{
+			volumeReplicationClass: newVolumeReplicationClass(instance),
+			reconcileStrategy:      ReconcileStrategy(managementSpec.ReconcileStrategy),
+			// replication classes are useless without mirrored pools
+			disable: managementSpec.DisableVolumeReplicationClass || !instance.Spec.Mirroring.Enabled,
+		},
+	}
+}
+
+func (r *StorageClusterReconciler) createVolumeReplicationClasses(vrccs []VolumeReplicationClassConfiguration) error {
+	for _, vrcc := range vrccs {
+		if vrcc.reconcileStrategy == ReconcileStrategyIgnore {
+			continue
+		}
+		if vrcc.disable {
+			if err := r.deleteDisabledVolumeReplicationClass(vrcc.volumeReplicationClass); err != nil {
+				return err
+			}
+			continue
+		}
+
+		vrc := vrcc.volumeReplicationClass
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(volumeReplicationClassGVK)
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: vrc.GetName()}, existing)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				r.Log.Info(fmt.Sprintf("not creating VolumeReplicationClass %q because the VolumeReplicationClass CRD is not installed", vrc.GetName()))
+				continue
+			}
+			if errors.IsNotFound(err) {
+				r.Log.Info(fmt.Sprintf("creating VolumeReplicationClass %q", vrc.GetName()))
+				err = r.Client.Create(context.TODO(), vrc)
+				if err != nil {
+					r.Log.Error(err, fmt.Sprintf("failed to create VolumeReplicationClass %q", vrc.GetName()))
+					return err
+				}
+				continue
+			}
+			r.Log.Error(err, fmt.Sprintf("failed to 'Get' VolumeReplicationClass %q", vrc.GetName()))
+			return err
+		}
+		if vrcc.reconcileStrategy == ReconcileStrategyInit {
+			continue
+		}
+		if existing.GetDeletionTimestamp() != nil {
+			return fmt.Errorf("failed to restore volumereplicationclass %q because it is marked for deletion", existing.GetName())
+		}
+		if !reflect.DeepEqual(vrc.Object["spec"], existing.Object["spec"]) {
+			r.Log.Info(fmt.Sprintf("VolumeReplicationClass %q needs to be updated", existing.GetName()))
+			existing.Object["spec"] = vrc.Object["spec"]
+			if err := r.Client.Update(context.TODO(), existing); err != nil {
+				r.Log.Error(err, fmt.Sprintf("VolumeReplicationClass %q updation failed", existing.GetName()))
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteDisabledVolumeReplicationClass deletes a VolumeReplicationClass once
+// it is disabled or mirroring is turned off
+func (r *StorageClusterReconciler) deleteDisabledVolumeReplicationClass(vrc *unstructured.Unstructured) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(volumeReplicationClassGVK)
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: vrc.GetName()}, existing)
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if existing.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	r.Log.Info(fmt.Sprintf("VolumeReplicationClass is disabled, deleting VolumeReplicationClass %s", existing.GetName()))
+	err = r.Client.Delete(context.TODO(), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ensureCreated ensures that the VolumeReplicationClasses are created
+func (obj *ocsVolumeReplicationClass) ensureCreated(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
+	return r.createVolumeReplicationClasses(newVolumeReplicationClassConfigurations(instance))
+}
+
+// ensureDeleted deletes the VolumeReplicationClasses that the ocs-operator created
+func (obj *ocsVolumeReplicationClass) ensureDeleted(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
+	vrccs := newVolumeReplicationClassConfigurations(instance)
+	for _, vrcc := range vrccs {
+		vrc := vrcc.volumeReplicationClass
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(volumeReplicationClassGVK)
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: vrc.GetName()}, existing)
+
+		switch {
+		case err == nil:
+			if existing.GetDeletionTimestamp() != nil {
+				r.Log.Info(fmt.Sprintf("Uninstall: VolumeReplicationClass %s is already marked for deletion", existing.GetName()))
+				break
+			}
+
+			r.Log.Info(fmt.Sprintf("Uninstall: Deleting VolumeReplicationClass %s", vrc.GetName()))
+			err = r.Client.Delete(context.TODO(), existing)
+			if err != nil {
+				r.Log.Error(err, fmt.Sprintf("Uninstall: Ignoring error deleting the VolumeReplicationClass %s", existing.GetName()))
+			}
+		case errors.IsNotFound(err), meta.IsNoMatchError(err):
+			r.Log.Info(fmt.Sprintf("Uninstall: VolumeReplicationClass %s not found, nothing to do", vrc.GetName()))
+		default:
+			r.Log.Info(fmt.Sprintf("Uninstall: Error while getting VolumeReplicationClass %s: %v", vrc.GetName(), err))
+		}
+	}
+	return nil
+}
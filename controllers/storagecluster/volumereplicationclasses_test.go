@@ -0,0 +1,85 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+)
+
+func getVolumeReplicationClass(t *testing.T, reconciler StorageClusterReconciler) (*unstructured.Unstructured, error) {
+	vrc := &unstructured.Unstructured{}
+	vrc.SetGroupVersionKind(volumeReplicationClassGVK)
+	err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-rbdplugin-replicationclass"}, vrc)
+	return vrc, err
+}
+
+func TestVolumeReplicationClasses(t *testing.T) {
+	reconciler := createFakeStorageClusterReconciler(t)
+	sc := createDefaultStorageCluster()
+	sc.Namespace = "openshift-storage"
+
+	// no VolumeReplicationClass without mirroring
+	var obj ocsVolumeReplicationClass
+	err := obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	_, err = getVolumeReplicationClass(t, reconciler)
+	assert.True(t, errors.IsNotFound(err))
+
+	sc.Spec.Mirroring.Enabled = true
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	vrc, err := getVolumeReplicationClass(t, reconciler)
+	assert.NoError(t, err)
+	provisioner, _, _ := unstructured.NestedString(vrc.Object, "spec", "provisioner")
+	assert.Equal(t, "openshift-storage.rbd.csi.ceph.com", provisioner)
+	parameters, _, _ := unstructured.NestedStringMap(vrc.Object, "spec", "parameters")
+	assert.Equal(t, map[string]string{
+		"mirroringMode":      "snapshot",
+		"schedulingInterval": "5m",
+		"replication.storage.openshift.io/replication-secret-name":      "rook-csi-rbd-provisioner",
+		"replication.storage.openshift.io/replication-secret-namespace": "openshift-storage",
+	}, parameters)
+
+	// a change of the schedule is applied to the existing class
+	sc.Spec.ManagedResources.CephBlockPools.VolumeReplicationClass = api.VolumeReplicationClassSpec{SchedulingInterval: "1h"}
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	vrc, err = getVolumeReplicationClass(t, reconciler)
+	assert.NoError(t, err)
+	schedulingInterval, _, _ := unstructured.NestedString(vrc.Object, "spec", "parameters", "schedulingInterval")
+	assert.Equal(t, "1h", schedulingInterval)
+
+	// the class is deleted once it is disabled, and created again once it
+	// is enabled
+	sc.Spec.ManagedResources.CephBlockPools.DisableVolumeReplicationClass = true
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	_, err = getVolumeReplicationClass(t, reconciler)
+	assert.True(t, errors.IsNotFound(err))
+	sc.Spec.ManagedResources.CephBlockPools.DisableVolumeReplicationClass = false
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	_, err = getVolumeReplicationClass(t, reconciler)
+	assert.NoError(t, err)
+
+	// and so it is once mirroring is turned off
+	sc.Spec.Mirroring.Enabled = false
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+	_, err = getVolumeReplicationClass(t, reconciler)
+	assert.True(t, errors.IsNotFound(err))
+	sc.Spec.Mirroring.Enabled = true
+	err = obj.ensureCreated(&reconciler, sc)
+	assert.NoError(t, err)
+
+	err = obj.ensureDeleted(&reconciler, sc)
+	assert.NoError(t, err)
+	_, err = getVolumeReplicationClass(t, reconciler)
+	assert.True(t, errors.IsNotFound(err))
+}
@@ -11,6 +11,7 @@ import (
 	snapapi "github.com/kubernetes-csi/external-snapshotter/v2/pkg/apis/volumesnapshot/v1beta1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // SnapshotterType represents a snapshotter type
@@ -70,15 +71,98 @@ func newCephBlockPoolSnapshotClassConfiguration(instance *ocsv1.StorageCluster)
 	}
 }
 
+func newAdditionalCephBlockPoolSnapshotClassConfiguration(instance *ocsv1.StorageCluster, pool ocsv1.AdditionalCephBlockPool) SnapshotClassConfiguration {
+	vsc := newVolumeSnapshotClass(instance, rbdSnapshotter)
+	vsc.Name = generateNameForAdditionalCephBlockPoolSnapshotClass(instance, pool.Name)
+	vsc.Labels = map[string]string{additionalCephBlockPoolLabel: instance.Name}
+	return SnapshotClassConfiguration{
+		snapshotClass:     vsc,
+		reconcileStrategy: ReconcileStrategy(instance.Spec.ManagedResources.CephBlockPools.ReconcileStrategy),
+		disable:           instance.Spec.ManagedResources.CephBlockPools.DisableSnapshotClass,
+	}
+}
+
 // newSnapshotClassConfigurations generates configuration options for Ceph SnapshotClasses.
 func newSnapshotClassConfigurations(instance *ocsv1.StorageCluster) []SnapshotClassConfiguration {
 	vsccs := []SnapshotClassConfiguration{
 		newCephFilesystemSnapshotClassConfiguration(instance),
 		newCephBlockPoolSnapshotClassConfiguration(instance),
 	}
+	for _, pool := range getAdditionalCephBlockPools(instance) {
+		vsccs = append(vsccs, newAdditionalCephBlockPoolSnapshotClassConfiguration(instance, pool))
+	}
+	return vsccs
+}
+
+// newExternalSnapshotClassConfigurations generates configuration options for
+// the SnapshotClasses of the StorageClass entries of the external cluster
+// details that are isolated in a RADOS namespace or a subvolume group. They
+// refer to the ceph-csi clusterID of their entry, like its StorageClass.
+func newExternalSnapshotClassConfigurations(instance *ocsv1.StorageCluster, resources []ExternalResource) []SnapshotClassConfiguration {
+	vsccs := []SnapshotClassConfiguration{}
+	for _, resource := range resources {
+		if resource.Kind != "StorageClass" {
+			continue
+		}
+		clusterID := getExternalCSIClusterID(instance, resource)
+		if clusterID == "" {
+			continue
+		}
+		var vscc SnapshotClassConfiguration
+		if isExternalRBDStorageClass(resource.Name) {
+			vscc = newCephBlockPoolSnapshotClassConfiguration(instance)
+			vscc.reconcileStrategy = ReconcileStrategy(instance.Spec.ManagedResources.CephBlockPools.ReconcileStrategy)
+			vscc.disable = instance.Spec.ManagedResources.CephBlockPools.DisableSnapshotClass
+		} else if isExternalCephFSStorageClass(resource.Name) {
+			vscc = newCephFilesystemSnapshotClassConfiguration(instance)
+		} else {
+			continue
+		}
+		vsc := vscc.snapshotClass
+		vsc.Name = generateNameForExternalSnapshotClass(instance, resource.Name)
+		vsc.Labels = map[string]string{externalClusterDetailsLabel: instance.Name}
+		vsc.Parameters["clusterID"] = clusterID
+		// an entry with its own provisioner secret snapshots with it as well
+		if secretName := resource.Data["csi.storage.k8s.io/provisioner-secret-name"]; secretName != "" {
+			vsc.Parameters[snapshotterSecretName] = secretName
+		}
+		vsccs = append(vsccs, vscc)
+	}
 	return vsccs
 }
 
+// deleteRemovedExternalSnapshotClasses deletes the SnapshotClasses of the
+// external cluster details that are not in the given configurations
+func (r *StorageClusterReconciler) deleteRemovedExternalSnapshotClasses(instance *ocsv1.StorageCluster, vsccs []SnapshotClassConfiguration) error {
+	return r.deleteRemovedSnapshotClasses(vsccs, client.MatchingLabels{externalClusterDetailsLabel: instance.Name}, "of the external cluster details")
+}
+
+// deleteRemovedSnapshotClasses deletes the SnapshotClasses with the given
+// labels that are not in the desired configurations. The origin describes the
+// SnapshotClasses in the logs.
+func (r *StorageClusterReconciler) deleteRemovedSnapshotClasses(vsccs []SnapshotClassConfiguration, labels client.MatchingLabels, origin string) error {
+	desired := map[string]bool{}
+	for _, vscc := range vsccs {
+		desired[vscc.snapshotClass.Name] = true
+	}
+	existing := &snapapi.VolumeSnapshotClassList{}
+	err := r.Client.List(context.TODO(), existing, labels)
+	if err != nil {
+		return err
+	}
+	for i := range existing.Items {
+		vsc := &existing.Items[i]
+		if desired[vsc.Name] || vsc.DeletionTimestamp != nil {
+			continue
+		}
+		r.Log.Info(fmt.Sprintf("deleting SnapshotClass %q %s", vsc.Name, origin))
+		if err = r.Client.Delete(context.TODO(), vsc); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *StorageClusterReconciler) createSnapshotClasses(vsccs []SnapshotClassConfiguration) error {
 
 	for _, vscc := range vsccs {
@@ -106,16 +190,22 @@ func (r *StorageClusterReconciler) createSnapshotClasses(vsccs []SnapshotClassCo
 			}
 		}
 		if vscc.reconcileStrategy == ReconcileStrategyInit {
-			return nil
+			continue
 		}
 		if existing.DeletionTimestamp != nil {
 			return fmt.Errorf("failed to restore snapshotclass %q because it is marked for deletion", existing.Name)
 		}
 		// if there is a mis-match in the parameters of existing vs created resources,
-		if !reflect.DeepEqual(vsc.Parameters, existing.Parameters) {
+		if !reflect.DeepEqual(vsc.Parameters, existing.Parameters) || missingLabels(existing.Labels, vsc.Labels) {
 			// we have to update the existing SnapshotClass
 			r.Log.Info(fmt.Sprintf("SnapshotClass %q needs to be updated", existing.Name))
 			existing.ObjectMeta.OwnerReferences = vsc.ObjectMeta.OwnerReferences
+			for k, v := range vsc.Labels {
+				if existing.Labels == nil {
+					existing.Labels = map[string]string{}
+				}
+				existing.Labels[k] = v
+			}
 			vsc.ObjectMeta = existing.ObjectMeta
 			if err := r.Client.Update(context.TODO(), vsc); err != nil {
 				r.Log.Error(err, fmt.Sprintf("SnapshotClass %q updation failed", existing.Name))
@@ -134,6 +224,24 @@ func (obj *ocsSnapshotClass) ensureCreated(r *StorageClusterReconciler, instance
 	if err != nil {
 		return nil
 	}
+	if err = r.deleteRemovedSnapshotClasses(vsccs, client.MatchingLabels{additionalCephBlockPoolLabel: instance.Name}, "of a removed cephBlockPool"); err != nil {
+		return err
+	}
+
+	if instance.Spec.ExternalStorage.Enable {
+		data, err := r.retrieveExternalSecretData(instance)
+		if err != nil {
+			return err
+		}
+		externalVSCCs := newExternalSnapshotClassConfigurations(instance, data)
+		if err = r.createSnapshotClasses(externalVSCCs); err != nil {
+			return err
+		}
+		if err = r.deleteRemovedExternalSnapshotClasses(instance, externalVSCCs); err != nil {
+			r.Log.Error(err, "could not delete the SnapshotClasses removed from the external cluster details")
+			return err
+		}
+	}
 
 	return nil
 }
@@ -168,5 +276,12 @@ func (obj *ocsSnapshotClass) ensureDeleted(r *StorageClusterReconciler, instance
 			r.Log.Info(fmt.Sprintf("Uninstall: Error while getting SnapshotClass %s: %v", sc.Name, err))
 		}
 	}
+
+	if instance.Spec.ExternalStorage.Enable {
+		err := r.deleteRemovedExternalSnapshotClasses(instance, nil)
+		if err != nil {
+			r.Log.Error(err, "Uninstall: Ignoring error deleting the SnapshotClasses of the external cluster details")
+		}
+	}
 	return nil
 }
@@ -1,8 +1,11 @@
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strings"
 )
 
 // WatchNamespaceEnvVar is the constant for env variable WATCH_NAMESPACE
@@ -18,3 +21,16 @@ func GetWatchNamespace() (string, error) {
 	}
 	return ns, nil
 }
+
+// ShortenName returns the name as it is if it fits in maxLength, or else
+// truncated and followed by a hash of the full name, so that distinct long
+// names stay distinct
+func ShortenName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:10]
+	prefix := strings.TrimRight(name[:maxLength-len(hash)-1], "-._")
+	return prefix + "-" + hash
+}
@@ -38,6 +38,9 @@ const (
 	ExternalClusterUnknownReason = "ExternalClusterStateUnknownCondition"
 	// ExternalClusterErrorReason indicates an error state
 	ExternalClusterErrorReason = "ExternalClusterStateError"
+	// MultipleComponentsReason is used when several components report the
+	// same negative condition with different reasons
+	MultipleComponentsReason = "MultipleComponents"
 )
 
 // SetProgressingCondition sets the ProgressingCondition to True and other conditions to
@@ -278,3 +281,65 @@ func MapNoobaaNegativeConditions(conditions *[]conditionsv1.Condition, found *nb
 	}
 
 }
+
+// MapCephObjectStoreNegativeConditions maps the phase of a CephObjectStore resource into ocs status conditions.
+// This will only look for negative conditions: Degraded, Progressing
+func MapCephObjectStoreNegativeConditions(conditions *[]conditionsv1.Condition, found *cephv1.CephObjectStore) {
+	var phase cephv1.ConditionType
+	var message string
+	if found.Status != nil {
+		phase = found.Status.Phase
+		message = found.Status.Message
+	}
+	switch phase {
+	case cephv1.ConditionReady, cephv1.ConditionConnected:
+		// no-op. Ready isn't a negative case
+	case cephv1.ConditionFailure:
+		setStatusConditionIfNotPresent(conditions, conditionsv1.Condition{
+			Type:    conditionsv1.ConditionDegraded,
+			Status:  corev1.ConditionTrue,
+			Reason:  "CephObjectStoreFailure",
+			Message: fmt.Sprintf("CephObjectStore failure: %v", message),
+		})
+	default:
+		setStatusConditionIfNotPresent(conditions, conditionsv1.Condition{
+			Type:    conditionsv1.ConditionProgressing,
+			Status:  corev1.ConditionTrue,
+			Reason:  "CephObjectStoreInitializing",
+			Message: fmt.Sprintf("Waiting on CephObjectStore %s to be ready", found.Name),
+		})
+	}
+}
+
+// AggregateComponentConditions merges the negative conditions of the
+// components into a single condition per type, whose message lists every
+// component that reports it. It returns nil if no component reports a
+// negative condition.
+func AggregateComponentConditions(components []ocsv1.ComponentStatus) []conditionsv1.Condition {
+	var aggregated []conditionsv1.Condition
+	for _, component := range components {
+		for _, condition := range component.Conditions {
+			message := fmt.Sprintf("%s %s: %s", component.Kind, component.Name, condition.Message)
+			found := false
+			for i := range aggregated {
+				if aggregated[i].Type != condition.Type {
+					continue
+				}
+				found = true
+				if aggregated[i].Reason != condition.Reason {
+					aggregated[i].Reason = MultipleComponentsReason
+				}
+				aggregated[i].Message += "; " + message
+			}
+			if !found {
+				aggregated = append(aggregated, conditionsv1.Condition{
+					Type:    condition.Type,
+					Status:  condition.Status,
+					Reason:  condition.Reason,
+					Message: message,
+				})
+			}
+		}
+	}
+	return aggregated
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"testing"
+
+	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAggregateComponentConditions(t *testing.T) {
+	cephCluster := &cephv1.CephCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "ocsinit-cephcluster"},
+		Status:     cephv1.ClusterStatus{State: cephv1.ClusterStateError, Message: "mons down"},
+	}
+	var cephClusterConditions []conditionsv1.Condition
+	MapCephClusterNegativeConditions(&cephClusterConditions, cephCluster)
+
+	var noobaaConditions []conditionsv1.Condition
+	MapNoobaaNegativeConditions(&noobaaConditions, &nbv1.NooBaa{Status: nbv1.NooBaaStatus{Phase: nbv1.SystemPhaseRejected}})
+
+	objectStore := &cephv1.CephObjectStore{ObjectMeta: metav1.ObjectMeta{Name: "ocsinit-cephobjectstore"}}
+	var objectStoreConditions []conditionsv1.Condition
+	MapCephObjectStoreNegativeConditions(&objectStoreConditions, objectStore)
+	objectStore.Status = &cephv1.ObjectStoreStatus{Phase: cephv1.ConditionReady}
+	var readyObjectStoreConditions []conditionsv1.Condition
+	MapCephObjectStoreNegativeConditions(&readyObjectStoreConditions, objectStore)
+	assert.Empty(t, readyObjectStoreConditions)
+
+	assert.Nil(t, AggregateComponentConditions(nil))
+	assert.Nil(t, AggregateComponentConditions([]ocsv1.ComponentStatus{{Kind: "CephObjectStore", Name: "ocsinit-cephobjectstore"}}))
+
+	conditions := AggregateComponentConditions([]ocsv1.ComponentStatus{
+		{Kind: "CephCluster", Name: "ocsinit-cephcluster", Conditions: cephClusterConditions},
+		{Kind: "NooBaa", Name: "noobaa", Conditions: noobaaConditions},
+		{Kind: "CephObjectStore", Name: "ocsinit-cephobjectstore", Conditions: objectStoreConditions},
+	})
+
+	// every component reporting a condition is listed in its message
+	degraded := conditionsv1.FindStatusCondition(conditions, conditionsv1.ConditionDegraded)
+	if assert.NotNil(t, degraded) {
+		assert.Equal(t, corev1.ConditionTrue, degraded.Status)
+		assert.Equal(t, MultipleComponentsReason, degraded.Reason)
+		assert.Contains(t, degraded.Message, "CephCluster ocsinit-cephcluster: CephCluster error: mons down")
+		assert.Contains(t, degraded.Message, "NooBaa noobaa: ")
+	}
+	available := conditionsv1.FindStatusCondition(conditions, conditionsv1.ConditionAvailable)
+	if assert.NotNil(t, available) {
+		assert.Equal(t, corev1.ConditionFalse, available.Status)
+		assert.Equal(t, "ClusterStateError", available.Reason)
+	}
+	progressing := conditionsv1.FindStatusCondition(conditions, conditionsv1.ConditionProgressing)
+	if assert.NotNil(t, progressing) {
+		assert.Equal(t, "CephObjectStoreInitializing", progressing.Reason)
+		assert.Contains(t, progressing.Message, "CephObjectStore ocsinit-cephobjectstore: ")
+	}
+}
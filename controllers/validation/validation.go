@@ -0,0 +1,660 @@
+// Package validation contains the validation of the StorageCluster spec. All
+// validators collect every problem they find into a field.ErrorList, so that
+// the reconciler and the admission webhook can report them all at once.
+package validation
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	publicNetworkSelectorKey  = "public"
+	clusterNetworkSelectorKey = "cluster"
+
+	// KMSProviderKey is the key of the KMS connection details that holds the
+	// KMS provider
+	KMSProviderKey = "KMS_PROVIDER"
+	// KMSServiceNameKey is the key of the KMS connection details that holds
+	// the name of the KMS configuration of ceph-csi
+	KMSServiceNameKey = "KMS_SERVICE_NAME"
+	// VaultKMSProvider is the 'vault' KMS provider
+	VaultKMSProvider = "vault"
+	// KMIPKMSProvider is the KMS provider speaking the 'kmip' protocol
+	KMIPKMSProvider = "kmip"
+	// AWSKMSProvider is the 'aws' KMS provider
+	AWSKMSProvider = "aws"
+	// AzureKMSProvider is the 'azure' Key Vault KMS provider
+	AzureKMSProvider = "azure"
+	// IBMKeyProtectKMSProvider is the 'ibmkeyprotect' KMS provider
+	IBMKeyProtectKMSProvider = "ibmkeyprotect"
+
+	// VaultAuthMethodKey is the key of the KMS connection details that holds
+	// the Vault auth method
+	VaultAuthMethodKey = "VAULT_AUTH_METHOD"
+	// VaultTokenAuthMethod authenticates to Vault with the token in the KMS
+	// token secret
+	VaultTokenAuthMethod = "token"
+	// VaultKubernetesAuthMethod authenticates to Vault with a service account
+	// token
+	VaultKubernetesAuthMethod = "kubernetes"
+	// VaultKubernetesServiceAccountKey is the key of the KMS connection
+	// details that holds the service account of the Vault Kubernetes auth
+	VaultKubernetesServiceAccountKey = "VAULT_AUTH_KUBERNETES_SERVICE_ACCOUNT"
+
+	vaultAddressKey        = "VAULT_ADDR"
+	kmipEndpointKey        = "KMIP_ENDPOINT"
+	vaultKubernetesRoleKey = "VAULT_AUTH_KUBERNETES_ROLE"
+	vaultClientCertKey     = "VAULT_CLIENT_CERT"
+	vaultClientKeyKey      = "VAULT_CLIENT_KEY"
+)
+
+var (
+	supportedDeviceTypes      = []string{"ssd", "hdd", "nvme"}
+	supportedNetworkSelectors = []string{publicNetworkSelectorKey, clusterNetworkSelectorKey}
+	supportedCompressionModes = []string{"none", "passive", "aggressive", "force"}
+	supportedMirroringModes   = []string{"image", "pool"}
+	supportedVaultAuthMethods = []string{VaultTokenAuthMethod, VaultKubernetesAuthMethod}
+	// Msgr2ModeOptions are the ceph.conf options of the msgr2 connection
+	// modes of the daemons, the clients and the connections to the mons. They
+	// are set by the network encryption.
+	Msgr2ModeOptions = []string{
+		"ms_cluster_mode",
+		"ms_service_mode",
+		"ms_client_mode",
+		"ms_mon_cluster_mode",
+		"ms_mon_service_mode",
+		"ms_mon_client_mode",
+	}
+	// Msgr2ServiceModeOptions are the options of Msgr2ModeOptions that set the
+	// modes the daemons and the mons accept from their clients
+	Msgr2ServiceModeOptions = []string{
+		"ms_service_mode",
+		"ms_mon_service_mode",
+	}
+	// cephConfigOptionReplacer maps the separators Ceph accepts in option
+	// names to the canonical underscore
+	cephConfigOptionReplacer = strings.NewReplacer(" ", "_", "-", "_")
+	// KMSSecretNameKeys are the keys of the KMS connection details that hold
+	// the name of a secret
+	KMSSecretNameKeys = []string{"VAULT_CACERT", vaultClientCertKey, vaultClientKeyKey, "KMIP_SECRET_NAME"}
+
+	// kmsProviderRequiredKeys maps the supported KMS providers to the keys
+	// their connection details need. The credentials are in the KMS token
+	// secret and not part of the connection details.
+	kmsProviderRequiredKeys = map[string][]string{
+		VaultKMSProvider:         {vaultAddressKey},
+		KMIPKMSProvider:          {kmipEndpointKey, "KMIP_SECRET_NAME"},
+		AWSKMSProvider:           {"AWS_REGION"},
+		AzureKMSProvider:         {"AZURE_VAULT_URL", "AZURE_CLIENT_ID", "AZURE_TENANT_ID"},
+		IBMKeyProtectKMSProvider: {"IBM_KP_SERVICE_INSTANCE_ID"},
+	}
+	// kmsProviderURLKeys maps the supported KMS providers to the keys that
+	// must hold an absolute URL when they are set
+	kmsProviderURLKeys = map[string][]string{
+		VaultKMSProvider:         {vaultAddressKey},
+		AWSKMSProvider:           {"AWS_ENDPOINT"},
+		AzureKMSProvider:         {"AZURE_VAULT_URL"},
+		IBMKeyProtectKMSProvider: {"IBM_KP_BASE_URL", "IBM_KP_TOKEN_URL"},
+	}
+)
+
+// ValidateStorageCluster validates the spec of the given StorageCluster and
+// returns every problem found
+func ValidateStorageCluster(sc *ocsv1.StorageCluster) field.ErrorList {
+	specPath := field.NewPath("spec")
+	allErrs := field.ErrorList{}
+
+	if sc.Spec.ExternalStorage.Enable {
+		allErrs = append(allErrs, ValidateExternalStorage(sc, specPath)...)
+	} else {
+		allErrs = append(allErrs, ValidateStorageDeviceSets(sc.Spec.StorageDeviceSets, specPath.Child("storageDeviceSets"))...)
+		allErrs = append(allErrs, ValidateCephConfig(sc.Spec.CephConfig, specPath.Child("cephConfig"))...)
+		allErrs = append(allErrs, ValidateAdditionalCephBlockPools(sc,
+			specPath.Child("managedResources", "cephBlockPools", "additionalPools"))...)
+		allErrs = append(allErrs, ValidateErasureCodedPool(sc, sc.Spec.ManagedResources.CephFilesystems.ErasureCoded,
+			specPath.Child("managedResources", "cephFilesystems", "erasureCoded"))...)
+		allErrs = append(allErrs, ValidateErasureCodedPool(sc, sc.Spec.ManagedResources.CephObjectStores.ErasureCoded,
+			specPath.Child("managedResources", "cephObjectStores", "erasureCoded"))...)
+	}
+	allErrs = append(allErrs, ValidateMirroring(sc, specPath.Child("mirroring"))...)
+	allErrs = append(allErrs, ValidateEncryption(sc, specPath.Child("encryption"))...)
+	allErrs = append(allErrs, ValidateArbiter(sc, specPath)...)
+	allErrs = append(allErrs, ValidateNetwork(sc.Spec.Network, specPath.Child("network"))...)
+	allErrs = append(allErrs, ValidateNetworkEncryption(sc, specPath)...)
+
+	return allErrs
+}
+
+// ValidateStorageDeviceSets checks the StorageDeviceSets for completeness and
+// correctness
+func ValidateStorageDeviceSets(deviceSets []ocsv1.StorageDeviceSet, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := map[string]bool{}
+	// the device classes by their lower case name. Ceph device classes are
+	// case sensitive, but the pools of the device classes are named after
+	// their lower case name.
+	deviceClasses := map[string]string{}
+
+	for i, ds := range deviceSets {
+		idxPath := fldPath.Index(i)
+
+		if names[ds.Name] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), ds.Name))
+		}
+		names[ds.Name] = true
+
+		allErrs = append(allErrs, validateDeviceSetCount(ds, idxPath)...)
+
+		if !hasStorageClassName(&ds.DataPVCTemplate) {
+			allErrs = append(allErrs, field.Required(idxPath.Child("dataPVCTemplate", "spec", "storageClassName"),
+				"no StorageClass specified"))
+		}
+		if ds.MetadataPVCTemplate != nil && !hasStorageClassName(ds.MetadataPVCTemplate) {
+			allErrs = append(allErrs, field.Required(idxPath.Child("metadataPVCTemplate", "spec", "storageClassName"),
+				"no StorageClass specified for metadataPVCTemplate"))
+		}
+		if ds.WalPVCTemplate != nil && !hasStorageClassName(ds.WalPVCTemplate) {
+			allErrs = append(allErrs, field.Required(idxPath.Child("walPVCTemplate", "spec", "storageClassName"),
+				"no StorageClass specified for walPVCTemplate"))
+		}
+		if ds.DeviceType != "" && !contains(supportedDeviceTypes, strings.ToLower(ds.DeviceType)) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("deviceType"), ds.DeviceType, supportedDeviceTypes))
+		}
+
+		allErrs = append(allErrs, validateDeviceSetConfig(ds, idxPath.Child("config"))...)
+
+		deviceClass, deviceClassPath := ds.DeviceType, idxPath.Child("deviceType")
+		if ds.Config.CrushDeviceClass != "" {
+			deviceClass, deviceClassPath = ds.Config.CrushDeviceClass, idxPath.Child("config", "crushDeviceClass")
+		}
+		if deviceClass != "" {
+			if other, found := deviceClasses[strings.ToLower(deviceClass)]; found && other != deviceClass {
+				allErrs = append(allErrs, field.Invalid(deviceClassPath, deviceClass,
+					fmt.Sprintf("conflicts with the device class %q of another StorageDeviceSet, device classes must not only differ in case", other)))
+			} else {
+				deviceClasses[strings.ToLower(deviceClass)] = deviceClass
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateDeviceSetCount makes sure the count of a StorageDeviceSet can be
+// spread evenly across its replicas. When the replica is not set, the count
+// is divided by the default replica while generating the
+// StorageClassDeviceSets, so it has to be a multiple of it.
+func validateDeviceSetCount(ds ocsv1.StorageDeviceSet, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if ds.Count < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("count"), ds.Count, "must be at least 1"))
+	} else if ds.Replica == 0 && ds.Count%defaults.DeviceSetReplica != 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("count"), ds.Count,
+			fmt.Sprintf("must be a multiple of %d when replica is not set", defaults.DeviceSetReplica)))
+	}
+	if ds.Replica < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("replica"), ds.Replica, "must not be negative"))
+	}
+	return allErrs
+}
+
+// validateDeviceSetConfig checks the Ceph OSD config options of a StorageDeviceSet
+func validateDeviceSetConfig(ds ocsv1.StorageDeviceSet, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	config := ds.Config
+	if config.OSDsPerDevice < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("osdsPerDevice"), config.OSDsPerDevice, "must not be negative"))
+	} else if config.OSDsPerDevice > 1 && (ds.MetadataPVCTemplate != nil || ds.WalPVCTemplate != nil) {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("osdsPerDevice"),
+			"multiple OSDs per device are not supported with a metadataPVCTemplate or walPVCTemplate"))
+	}
+	// the device class is part of the name of the pool created for it
+	if config.CrushDeviceClass != "" {
+		for _, msg := range validation.IsDNS1123Label(config.CrushDeviceClass) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("crushDeviceClass"), config.CrushDeviceClass, msg))
+		}
+	}
+	if config.DatabaseSizeMB < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("databaseSizeMB"), config.DatabaseSizeMB, "must not be negative"))
+	}
+	if config.WalSizeMB < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("walSizeMB"), config.WalSizeMB, "must not be negative"))
+	}
+	return allErrs
+}
+
+func hasStorageClassName(pvc *corev1.PersistentVolumeClaim) bool {
+	return pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != ""
+}
+
+// ValidateArbiter makes sure an arbiter location is provided when the arbiter
+// is enabled
+func ValidateArbiter(sc *ocsv1.StorageCluster, specPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if sc.Spec.Arbiter.Enable && (sc.Spec.NodeTopologies == nil || sc.Spec.NodeTopologies.ArbiterLocation == "") {
+		allErrs = append(allErrs, field.Required(specPath.Child("nodeTopologies", "arbiterLocation"),
+			"arbiterLocation must be provided when the arbiter is enabled"))
+	}
+	return allErrs
+}
+
+// ValidateNetwork checks the multus network selectors, if multus is used
+func ValidateNetwork(network *ocsv1.NetworkSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if network == nil || !network.IsMultus() {
+		return allErrs
+	}
+
+	selectorsPath := fldPath.Child("selectors")
+	for _, key := range sortedKeys(network.Selectors) {
+		if !contains(supportedNetworkSelectors, key) {
+			allErrs = append(allErrs, field.NotSupported(selectorsPath.Key(key), key, supportedNetworkSelectors))
+		}
+	}
+	if network.Selectors[publicNetworkSelectorKey] == "" {
+		allErrs = append(allErrs, field.Required(selectorsPath.Key(publicNetworkSelectorKey),
+			"public network selector values can't be empty"))
+	}
+	return allErrs
+}
+
+// ValidateNetworkEncryption makes sure the msgr2 secure mode is only enabled
+// for an internal Ceph cluster, and that the ceph.conf overrides do not
+// change the msgr2 connection modes it sets
+func ValidateNetworkEncryption(sc *ocsv1.StorageCluster, specPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	network := sc.Spec.Network
+	if network == nil || network.Encryption == nil || !network.Encryption.Enable {
+		return allErrs
+	}
+	if sc.Spec.ExternalStorage.Enable {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("network", "encryption", "enable"),
+			"network encryption cannot be managed for an external CephCluster"))
+		return allErrs
+	}
+	cephConfigPath := specPath.Child("cephConfig")
+	sections := []string{}
+	for section := range sc.Spec.CephConfig {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		for _, name := range sortedKeys(sc.Spec.CephConfig[section]) {
+			if contains(Msgr2ModeOptions, NormalizeCephConfigOption(name)) {
+				allErrs = append(allErrs, field.Forbidden(cephConfigPath.Key(section).Key(name),
+					"the msgr2 connection modes are set by the network encryption"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// ValidateExternalStorage makes sure the options that only apply to an
+// internal Ceph cluster are not set in external mode
+func ValidateExternalStorage(sc *ocsv1.StorageCluster, specPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if len(sc.Spec.StorageDeviceSets) != 0 {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("storageDeviceSets"),
+			"StorageDeviceSets should not be initialized in an external CephCluster"))
+	}
+	if sc.Spec.Arbiter.Enable {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("arbiter", "enable"),
+			"arbiter cannot be enabled in an external CephCluster"))
+	}
+	if len(sc.Spec.CephConfig) != 0 {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("cephConfig"),
+			"ceph.conf overrides cannot be applied to an external CephCluster"))
+	}
+	if len(sc.Spec.ManagedResources.CephBlockPools.AdditionalPools) != 0 {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("managedResources", "cephBlockPools", "additionalPools"),
+			"additional CephBlockPools cannot be created in an external CephCluster"))
+	}
+	if sc.Spec.ManagedResources.CephFilesystems.ErasureCoded != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("managedResources", "cephFilesystems", "erasureCoded"),
+			"erasure coded pools cannot be created in an external CephCluster"))
+	}
+	if sc.Spec.ManagedResources.CephObjectStores.ErasureCoded != nil {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("managedResources", "cephObjectStores", "erasureCoded"),
+			"erasure coded pools cannot be created in an external CephCluster"))
+	}
+	return allErrs
+}
+
+// ValidateAdditionalCephBlockPools checks the user-defined CephBlockPools. The
+// pool name is part of the names of the generated resources, so it has to be a
+// unique DNS label, which is not used by the pool of a device class either.
+func ValidateAdditionalCephBlockPools(sc *ocsv1.StorageCluster, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := map[string]bool{}
+	deviceClassPools := getDeviceClassPoolNames(sc.Spec.StorageDeviceSets)
+
+	for i, pool := range sc.Spec.ManagedResources.CephBlockPools.AdditionalPools {
+		idxPath := fldPath.Index(i)
+
+		if pool.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), "no pool name specified"))
+		} else {
+			for _, msg := range validation.IsDNS1123Label(pool.Name) {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("name"), pool.Name, msg))
+			}
+			if names[pool.Name] {
+				allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), pool.Name))
+			}
+			names[pool.Name] = true
+			if deviceClass, found := deviceClassPools[pool.Name]; found {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("name"), pool.Name,
+					fmt.Sprintf("conflicts with the pool of the device class %q", deviceClass)))
+			}
+		}
+		if pool.CompressionMode != "" && !contains(supportedCompressionModes, pool.CompressionMode) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("compressionMode"), pool.CompressionMode, supportedCompressionModes))
+		}
+		if strings.ContainsAny(pool.DeviceClass, " \t\n") {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("deviceClass"), pool.DeviceClass, "must not contain whitespace"))
+		}
+	}
+
+	return allErrs
+}
+
+// getDeviceClassPoolNames returns the device classes of the StorageDeviceSets
+// by the name of their pool. A pool is only created for each device class when
+// there are more than one, and it is named after the lower case device class.
+func getDeviceClassPoolNames(deviceSets []ocsv1.StorageDeviceSet) map[string]string {
+	pools := map[string]string{}
+	for _, ds := range deviceSets {
+		deviceClass := ds.DeviceType
+		if ds.Config.CrushDeviceClass != "" {
+			deviceClass = ds.Config.CrushDeviceClass
+		}
+		if deviceClass != "" {
+			pools[strings.ToLower(deviceClass)] = deviceClass
+		}
+	}
+	if len(pools) < 2 {
+		return map[string]string{}
+	}
+	return pools
+}
+
+// ValidateErasureCodedPool checks the chunk counts of an erasure coded data
+// pool. Whether there are enough failure domains for all chunks depends on the
+// node topology and is checked by the reconciler.
+func ValidateErasureCodedPool(sc *ocsv1.StorageCluster, ec *ocsv1.ErasureCodedPoolSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if ec == nil {
+		return allErrs
+	}
+	if sc.Spec.Arbiter.Enable {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "erasure coded pools are not supported when the arbiter is enabled"))
+	}
+	if ec.DataChunks < 2 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("dataChunks"), ec.DataChunks, "must be at least 2"))
+	}
+	if ec.CodingChunks < 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("codingChunks"), ec.CodingChunks, "must be at least 1"))
+	}
+	return allErrs
+}
+
+// ValidateMirroring checks the RBD mirroring settings
+func ValidateMirroring(sc *ocsv1.StorageCluster, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	mirroring := sc.Spec.Mirroring
+	if !mirroring.Enabled {
+		return allErrs
+	}
+	if sc.Spec.ExternalStorage.Enable {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("enabled"),
+			"mirroring cannot be managed for an external CephCluster"))
+	}
+	if mirroring.Mode != "" && !contains(supportedMirroringModes, mirroring.Mode) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("mode"), mirroring.Mode, supportedMirroringModes))
+	}
+	if mirroring.DaemonCount < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("daemonCount"), mirroring.DaemonCount, "must not be negative"))
+	}
+	names := map[string]bool{}
+	for i, name := range mirroring.PeerSecretNames {
+		if name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("peerSecretNames").Index(i), "no Secret name specified"))
+		} else if names[name] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Child("peerSecretNames").Index(i), name))
+		}
+		names[name] = true
+	}
+	return allErrs
+}
+
+// ValidateEncryption checks the settings of the encrypted RBD StorageClass
+func ValidateEncryption(sc *ocsv1.StorageCluster, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	encryption := sc.Spec.Encryption
+	if !encryption.StorageClass {
+		return allErrs
+	}
+	if sc.Spec.ExternalStorage.Enable {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("storageClass"),
+			"the encrypted StorageClass cannot be managed for an external CephCluster"))
+	}
+	if !encryption.KeyManagementService.Enable {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("storageClass"), true,
+			"the encrypted StorageClass requires the KMS to be enabled"))
+	}
+	if name := encryption.StorageClassName; name != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("storageClassName"), name, msg))
+		}
+	}
+	return allErrs
+}
+
+// ValidateCephConfig makes sure the ceph.conf overrides can be rendered
+// without changing the structure of the resulting ceph.conf. Sections and
+// options whose names only differ in the characters Ceph treats alike are
+// rejected, as only one of them could be rendered.
+func ValidateCephConfig(cephConfig map[string]ocsv1.CephConfigSection, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	sections := []string{}
+	for section := range cephConfig {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	seenSections := map[string]bool{}
+	for _, section := range sections {
+		sectionPath := fldPath.Key(section)
+		if strings.TrimSpace(section) == "" || strings.ContainsAny(section, "[]\n") {
+			allErrs = append(allErrs, field.Invalid(sectionPath, section, "must be a valid ceph.conf section name"))
+		}
+		if seenSections[strings.TrimSpace(section)] {
+			allErrs = append(allErrs, field.Duplicate(sectionPath, section))
+		}
+		seenSections[strings.TrimSpace(section)] = true
+		options := cephConfig[section]
+		seenOptions := map[string]bool{}
+		for _, name := range sortedKeys(options) {
+			if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "=[]#;\n") {
+				allErrs = append(allErrs, field.Invalid(sectionPath.Key(name), name, "must be a valid ceph.conf option name"))
+			}
+			if seenOptions[NormalizeCephConfigOption(name)] {
+				allErrs = append(allErrs, field.Duplicate(sectionPath.Key(name), name))
+			}
+			seenOptions[NormalizeCephConfigOption(name)] = true
+			if strings.Contains(options[name], "\n") {
+				allErrs = append(allErrs, field.Invalid(sectionPath.Key(name), options[name], "must be a single line"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// ValidateKMSConnectionDetails checks the KMS connection details that are
+// passed on to Ceph and NooBaa
+func ValidateKMSConnectionDetails(data map[string]string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	provider := data[KMSProviderKey]
+	if provider == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Key(KMSProviderKey), "no KMS provider specified"))
+		return allErrs
+	}
+	requiredKeys, ok := kmsProviderRequiredKeys[provider]
+	if !ok {
+		supportedProviders := []string{}
+		for name := range kmsProviderRequiredKeys {
+			supportedProviders = append(supportedProviders, name)
+		}
+		sort.Strings(supportedProviders)
+		allErrs = append(allErrs, field.NotSupported(fldPath.Key(KMSProviderKey), provider, supportedProviders))
+		return allErrs
+	}
+
+	for _, key := range requiredKeys {
+		if strings.TrimSpace(data[key]) == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Key(key), fmt.Sprintf("required by the %s KMS provider", provider)))
+		}
+	}
+	for _, key := range kmsProviderURLKeys[provider] {
+		if value := strings.TrimSpace(data[key]); value != "" {
+			allErrs = append(allErrs, validateURL(value, fldPath.Key(key))...)
+		}
+	}
+	if provider == KMIPKMSProvider {
+		if endpoint := strings.TrimSpace(data[kmipEndpointKey]); endpoint != "" {
+			allErrs = append(allErrs, validateHostPort(endpoint, fldPath.Key(kmipEndpointKey))...)
+		}
+	}
+	if provider == VaultKMSProvider {
+		allErrs = append(allErrs, validateVaultAuth(data, fldPath)...)
+	}
+	if kmsID := strings.TrimSpace(data[KMSServiceNameKey]); kmsID != "" {
+		for _, msg := range validation.IsConfigMapKey(kmsID) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(KMSServiceNameKey), kmsID, msg))
+		}
+	}
+	for _, key := range KMSSecretNameKeys {
+		if name := strings.TrimSpace(data[key]); name != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(name) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(key), name, msg))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateVaultAuth checks the auth method and the TLS client certificate of
+// the Vault connection details
+func validateVaultAuth(data map[string]string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	authMethod := strings.TrimSpace(data[VaultAuthMethodKey])
+	if authMethod != "" && !contains(supportedVaultAuthMethods, authMethod) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Key(VaultAuthMethodKey), authMethod, supportedVaultAuthMethods))
+	}
+	if authMethod == VaultKubernetesAuthMethod {
+		if strings.TrimSpace(data[vaultKubernetesRoleKey]) == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Key(vaultKubernetesRoleKey), "required by the Vault Kubernetes auth method"))
+		}
+		if sa := strings.TrimSpace(data[VaultKubernetesServiceAccountKey]); sa != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(sa) {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(VaultKubernetesServiceAccountKey), sa, msg))
+			}
+		}
+	}
+	// a client certificate is useless without its key and vice versa
+	hasCert := strings.TrimSpace(data[vaultClientCertKey]) != ""
+	hasKey := strings.TrimSpace(data[vaultClientKeyKey]) != ""
+	if hasCert && !hasKey {
+		allErrs = append(allErrs, field.Required(fldPath.Key(vaultClientKeyKey), "required with "+vaultClientCertKey))
+	} else if hasKey && !hasCert {
+		allErrs = append(allErrs, field.Required(fldPath.Key(vaultClientCertKey), "required with "+vaultClientKeyKey))
+	}
+	return allErrs
+}
+
+func validateURL(address string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if address == "" {
+		allErrs = append(allErrs, field.Required(fldPath, "no address specified"))
+		return allErrs
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, address, err.Error()))
+	} else if u.Scheme == "" || u.Host == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath, address, "must be an absolute URL"))
+	}
+	return allErrs
+}
+
+// validateHostPort checks that the given address is a host with an optional
+// port, as the KMIP protocol is not spoken over HTTP
+func validateHostPort(address string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	host := address
+	if strings.Contains(address, "://") {
+		allErrs = append(allErrs, field.Invalid(fldPath, address, "must be a host with an optional port, not a URL"))
+		return allErrs
+	}
+	if strings.Contains(address, ":") {
+		var port string
+		var err error
+		host, port, err = net.SplitHostPort(address)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath, address, err.Error()))
+			return allErrs
+		}
+		for _, msg := range validation.IsValidPortNum(atoi(port)) {
+			allErrs = append(allErrs, field.Invalid(fldPath, address, msg))
+		}
+	}
+	if host == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath, address, "no host specified"))
+	}
+	return allErrs
+}
+
+// atoi returns the given number, or -1 if it is not one
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// NormalizeCephConfigOption returns the canonical name of a ceph.conf option.
+// Ceph treats spaces, dashes and underscores in option names alike, so an
+// override has to use the same name as the default it replaces.
+func NormalizeCephConfigOption(name string) string {
+	return cephConfigOptionReplacer.Replace(strings.TrimSpace(name))
+}
+
+// sortedKeys returns the keys of the given map in order, so that the errors
+// are always reported in the same order
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
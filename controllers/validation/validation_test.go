@@ -0,0 +1,381 @@
+package validation
+
+import (
+	"testing"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	rook "github.com/rook/rook/pkg/apis/rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func mockPVCTemplate(storageClassName string) corev1.PersistentVolumeClaim {
+	return corev1.PersistentVolumeClaim{
+		Spec: corev1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClassName,
+		},
+	}
+}
+
+func mockStorageCluster() *ocsv1.StorageCluster {
+	return &ocsv1.StorageCluster{
+		Spec: ocsv1.StorageClusterSpec{
+			StorageDeviceSets: []ocsv1.StorageDeviceSet{
+				{
+					Name:            "mock-sds",
+					Count:           3,
+					DataPVCTemplate: mockPVCTemplate("gp2"),
+				},
+			},
+		},
+	}
+}
+
+func errorFields(allErrs field.ErrorList) []string {
+	fields := []string{}
+	for _, err := range allErrs {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
+
+func TestValidateStorageCluster(t *testing.T) {
+	cases := []struct {
+		label          string
+		modify         func(sc *ocsv1.StorageCluster)
+		expectedFields []string
+	}{
+		{
+			label:          "case 1: valid StorageCluster",
+			modify:         func(sc *ocsv1.StorageCluster) {},
+			expectedFields: []string{},
+		},
+		{
+			label: "case 2: every invalid device set is reported",
+			modify: func(sc *ocsv1.StorageCluster) {
+				metadataPVCTemplate := corev1.PersistentVolumeClaim{}
+				sc.Spec.StorageDeviceSets = append(sc.Spec.StorageDeviceSets,
+					ocsv1.StorageDeviceSet{
+						Name:                "mock-sds",
+						Count:               4,
+						DataPVCTemplate:     corev1.PersistentVolumeClaim{},
+						MetadataPVCTemplate: &metadataPVCTemplate,
+						DeviceType:          "floppy",
+					},
+					ocsv1.StorageDeviceSet{
+						Name:            "mock-sds-2",
+						Count:           2,
+						Replica:         2,
+						DataPVCTemplate: corev1.PersistentVolumeClaim{},
+					},
+				)
+			},
+			expectedFields: []string{
+				"spec.storageDeviceSets[1].name",
+				"spec.storageDeviceSets[1].count",
+				"spec.storageDeviceSets[1].dataPVCTemplate.spec.storageClassName",
+				"spec.storageDeviceSets[1].metadataPVCTemplate.spec.storageClassName",
+				"spec.storageDeviceSets[1].deviceType",
+				"spec.storageDeviceSets[2].dataPVCTemplate.spec.storageClassName",
+			},
+		},
+		{
+			label: "case 3: arbiter without arbiterLocation",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.Arbiter.Enable = true
+			},
+			expectedFields: []string{"spec.nodeTopologies.arbiterLocation"},
+		},
+		{
+			label: "case 4: multus without public network",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.Network = &ocsv1.NetworkSpec{
+					NetworkSpec: rook.NetworkSpec{
+						Provider: "multus",
+						Selectors: map[string]string{
+							"cluster": "cluster-network",
+							"storage": "storage-network",
+						},
+					},
+				}
+			},
+			expectedFields: []string{
+				"spec.network.selectors[storage]",
+				"spec.network.selectors[public]",
+			},
+		},
+		{
+			label: "case 5: external mode with device sets, arbiter and ceph.conf overrides",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.ExternalStorage.Enable = true
+				sc.Spec.Arbiter.Enable = true
+				sc.Spec.NodeTopologies = &ocsv1.NodeTopologyMap{ArbiterLocation: "zone-a"}
+				sc.Spec.CephConfig = map[string]ocsv1.CephConfigSection{"global": {"debug_ms": "1"}}
+			},
+			expectedFields: []string{
+				"spec.storageDeviceSets",
+				"spec.arbiter.enable",
+				"spec.cephConfig",
+			},
+		},
+		{
+			label: "case 6: ceph.conf overrides that would break the rendered config",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.CephConfig = map[string]ocsv1.CephConfigSection{
+					"global":   {"debug_ms": "1", "a=b": "1", "debug_osd": "1\n[mon]"},
+					"osd]\n[x": {},
+				}
+			},
+			expectedFields: []string{
+				"spec.cephConfig[global][a=b]",
+				"spec.cephConfig[global][debug_osd]",
+				"spec.cephConfig[osd]\n[x]",
+			},
+		},
+		{
+			label: "case 7: invalid device set config",
+			modify: func(sc *ocsv1.StorageCluster) {
+				metadataPVCTemplate := mockPVCTemplate("gp2")
+				sc.Spec.StorageDeviceSets[0].MetadataPVCTemplate = &metadataPVCTemplate
+				sc.Spec.StorageDeviceSets[0].Config = ocsv1.StorageDeviceSetConfig{
+					OSDsPerDevice:    2,
+					CrushDeviceClass: "fast ssd",
+					DatabaseSizeMB:   -1,
+					WalSizeMB:        -1,
+				}
+			},
+			expectedFields: []string{
+				"spec.storageDeviceSets[0].config.osdsPerDevice",
+				"spec.storageDeviceSets[0].config.crushDeviceClass",
+				"spec.storageDeviceSets[0].config.databaseSizeMB",
+				"spec.storageDeviceSets[0].config.walSizeMB",
+			},
+		},
+		{
+			label: "case 8: invalid additional CephBlockPools",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []ocsv1.AdditionalCephBlockPool{
+					{Name: "ssd", DeviceClass: "ssd", CompressionMode: "aggressive"},
+					{Name: "ssd"},
+					{Name: "Archive", CompressionMode: "zstd"},
+					{DeviceClass: "fast ssd"},
+				}
+			},
+			expectedFields: []string{
+				"spec.managedResources.cephBlockPools.additionalPools[1].name",
+				"spec.managedResources.cephBlockPools.additionalPools[2].name",
+				"spec.managedResources.cephBlockPools.additionalPools[2].compressionMode",
+				"spec.managedResources.cephBlockPools.additionalPools[3].name",
+				"spec.managedResources.cephBlockPools.additionalPools[3].deviceClass",
+			},
+		},
+		{
+			label: "case 9: invalid erasure coded pools",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.ManagedResources.CephFilesystems.ErasureCoded = &ocsv1.ErasureCodedPoolSpec{DataChunks: 1, CodingChunks: 0}
+				sc.Spec.ManagedResources.CephObjectStores.ErasureCoded = &ocsv1.ErasureCodedPoolSpec{DataChunks: 4, CodingChunks: 2}
+				sc.Spec.Arbiter.Enable = true
+				sc.Spec.NodeTopologies = &ocsv1.NodeTopologyMap{ArbiterLocation: "zone-a"}
+			},
+			expectedFields: []string{
+				"spec.managedResources.cephFilesystems.erasureCoded",
+				"spec.managedResources.cephFilesystems.erasureCoded.dataChunks",
+				"spec.managedResources.cephFilesystems.erasureCoded.codingChunks",
+				"spec.managedResources.cephObjectStores.erasureCoded",
+			},
+		},
+		{
+			label: "case 10: invalid mirroring settings",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.Mirroring = ocsv1.MirroringSpec{
+					Enabled:         true,
+					Mode:            "journal",
+					DaemonCount:     -1,
+					PeerSecretNames: []string{"peer-a", "", "peer-a"},
+				}
+			},
+			expectedFields: []string{
+				"spec.mirroring.mode",
+				"spec.mirroring.daemonCount",
+				"spec.mirroring.peerSecretNames[1]",
+				"spec.mirroring.peerSecretNames[2]",
+			},
+		},
+		{
+			label: "case 11: encrypted StorageClass without KMS",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.Encryption.StorageClass = true
+				sc.Spec.Encryption.StorageClassName = "Encrypted_RBD"
+			},
+			expectedFields: []string{
+				"spec.encryption.storageClass",
+				"spec.encryption.storageClassName",
+			},
+		},
+		{
+			label: "case 12: network encryption with conflicting ceph.conf overrides",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.Network = &ocsv1.NetworkSpec{Encryption: &ocsv1.NetworkEncryptionSpec{Enable: true}}
+				sc.Spec.CephConfig = map[string]ocsv1.CephConfigSection{
+					"global": {"ms cluster mode": "crc", "debug_ms": "1"},
+					"osd":    {"ms-service-mode": "crc"},
+				}
+			},
+			expectedFields: []string{
+				"spec.cephConfig[global][ms cluster mode]",
+				"spec.cephConfig[osd][ms-service-mode]",
+			},
+		},
+		{
+			label: "case 13: network encryption in external mode",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.ExternalStorage.Enable = true
+				sc.Spec.StorageDeviceSets = nil
+				sc.Spec.Network = &ocsv1.NetworkSpec{Encryption: &ocsv1.NetworkEncryptionSpec{Enable: true}}
+			},
+			expectedFields: []string{"spec.network.encryption.enable"},
+		},
+		{
+			label: "case 14: device classes that only differ in case",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.StorageDeviceSets[0].DeviceType = "ssd"
+				sc.Spec.StorageDeviceSets = append(sc.Spec.StorageDeviceSets,
+					ocsv1.StorageDeviceSet{Name: "mock-sds-2", Count: 3, DeviceType: "SSD", DataPVCTemplate: mockPVCTemplate("gp2")},
+					ocsv1.StorageDeviceSet{Name: "mock-sds-3", Count: 3, DeviceType: "ssd", DataPVCTemplate: mockPVCTemplate("gp2")},
+				)
+			},
+			expectedFields: []string{"spec.storageDeviceSets[1].deviceType"},
+		},
+		{
+			label: "case 15: ceph.conf names that only differ in the characters Ceph treats alike",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.CephConfig = map[string]ocsv1.CephConfigSection{
+					" global": {"debug_osd": "1"},
+					"global":  {"debug ms": "1", "debug-ms": "2", "debug_ms": "3"},
+				}
+			},
+			expectedFields: []string{
+				"spec.cephConfig[global]",
+				"spec.cephConfig[global][debug-ms]",
+				"spec.cephConfig[global][debug_ms]",
+			},
+		},
+		{
+			label: "case 16: additional pool named like the pool of a device class",
+			modify: func(sc *ocsv1.StorageCluster) {
+				sc.Spec.StorageDeviceSets[0].DeviceType = "ssd"
+				sc.Spec.StorageDeviceSets = append(sc.Spec.StorageDeviceSets,
+					ocsv1.StorageDeviceSet{Name: "mock-sds-2", Count: 3, DeviceType: "hdd", DataPVCTemplate: mockPVCTemplate("gp2")},
+				)
+				sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []ocsv1.AdditionalCephBlockPool{
+					{Name: "ssd"},
+					{Name: "fast"},
+				}
+			},
+			expectedFields: []string{"spec.managedResources.cephBlockPools.additionalPools[0].name"},
+		},
+	}
+
+	for _, c := range cases {
+		sc := mockStorageCluster()
+		c.modify(sc)
+		allErrs := ValidateStorageCluster(sc)
+		assert.Equalf(t, c.expectedFields, errorFields(allErrs), "[%s]: unexpected validation errors: %v", c.label, allErrs)
+	}
+}
+
+func TestValidateKMSConnectionDetails(t *testing.T) {
+	fldPath := field.NewPath("data")
+	cases := []struct {
+		label          string
+		data           map[string]string
+		expectedFields []string
+	}{
+		{
+			label:          "case 1: valid vault connection details",
+			data:           map[string]string{"KMS_PROVIDER": "vault", "VAULT_ADDR": "https://vault.example.com:8200"},
+			expectedFields: []string{},
+		},
+		{
+			label:          "case 2: missing provider",
+			data:           map[string]string{"VAULT_ADDR": "https://vault.example.com:8200"},
+			expectedFields: []string{"data[KMS_PROVIDER]"},
+		},
+		{
+			label:          "case 3: relative vault address",
+			data:           map[string]string{"KMS_PROVIDER": "vault", "VAULT_ADDR": "vault.example.com"},
+			expectedFields: []string{"data[VAULT_ADDR]"},
+		},
+		{
+			label:          "case 4: unknown providers are rejected",
+			data:           map[string]string{"KMS_PROVIDER": "newKMSProvider"},
+			expectedFields: []string{"data[KMS_PROVIDER]"},
+		},
+		{
+			label:          "case 5: valid kmip connection details",
+			data:           map[string]string{"KMS_PROVIDER": "kmip", "KMIP_ENDPOINT": "kmip.example.com:5696", "KMIP_SECRET_NAME": "ocs-kmip"},
+			expectedFields: []string{},
+		},
+		{
+			label:          "case 6: kmip endpoint given as URL and missing secret",
+			data:           map[string]string{"KMS_PROVIDER": "kmip", "KMIP_ENDPOINT": "https://kmip.example.com:5696"},
+			expectedFields: []string{"data[KMIP_SECRET_NAME]", "data[KMIP_ENDPOINT]"},
+		},
+		{
+			label:          "case 7: aws without region",
+			data:           map[string]string{"KMS_PROVIDER": "aws", "AWS_ENDPOINT": "kms.us-east-1.amazonaws.com"},
+			expectedFields: []string{"data[AWS_REGION]", "data[AWS_ENDPOINT]"},
+		},
+		{
+			label:          "case 8: incomplete azure connection details",
+			data:           map[string]string{"KMS_PROVIDER": "azure", "AZURE_VAULT_URL": "https://ocs.vault.azure.net", "AZURE_CLIENT_ID": "client"},
+			expectedFields: []string{"data[AZURE_TENANT_ID]"},
+		},
+		{
+			label:          "case 9: valid ibm key protect connection details",
+			data:           map[string]string{"KMS_PROVIDER": "ibmkeyprotect", "IBM_KP_SERVICE_INSTANCE_ID": "1234"},
+			expectedFields: []string{},
+		},
+		{
+			label: "case 10: valid vault kubernetes auth with TLS secrets",
+			data: map[string]string{
+				"KMS_PROVIDER":                          "vault",
+				"VAULT_ADDR":                            "https://vault.example.com:8200",
+				"VAULT_AUTH_METHOD":                     "kubernetes",
+				"VAULT_AUTH_KUBERNETES_ROLE":            "ocs",
+				"VAULT_AUTH_KUBERNETES_SERVICE_ACCOUNT": "ocs-kms",
+				"VAULT_CACERT":                          "ocs-kms-ca",
+				"VAULT_CLIENT_CERT":                     "ocs-kms-client-cert",
+				"VAULT_CLIENT_KEY":                      "ocs-kms-client-key",
+			},
+			expectedFields: []string{},
+		},
+		{
+			label: "case 11: incomplete vault kubernetes auth and TLS secrets",
+			data: map[string]string{
+				"KMS_PROVIDER":      "vault",
+				"VAULT_ADDR":        "https://vault.example.com:8200",
+				"VAULT_AUTH_METHOD": "kubernetes",
+				"VAULT_CACERT":      "Invalid_Name",
+				"VAULT_CLIENT_CERT": "ocs-kms-client-cert",
+			},
+			expectedFields: []string{"data[VAULT_AUTH_KUBERNETES_ROLE]", "data[VAULT_CLIENT_KEY]", "data[VAULT_CACERT]"},
+		},
+		{
+			label:          "case 12: unknown vault auth method",
+			data:           map[string]string{"KMS_PROVIDER": "vault", "VAULT_ADDR": "https://vault.example.com:8200", "VAULT_AUTH_METHOD": "approle"},
+			expectedFields: []string{"data[VAULT_AUTH_METHOD]"},
+		},
+		{
+			label:          "case 13: invalid KMS service name",
+			data:           map[string]string{"KMS_PROVIDER": "vault", "VAULT_ADDR": "https://vault.example.com:8200", "KMS_SERVICE_NAME": "my vault"},
+			expectedFields: []string{"data[KMS_SERVICE_NAME]"},
+		},
+	}
+
+	for _, c := range cases {
+		allErrs := ValidateKMSConnectionDetails(c.data, fldPath)
+		assert.Equalf(t, c.expectedFields, errorFields(allErrs), "[%s]: unexpected validation errors: %v", c.label, allErrs)
+	}
+}
@@ -22,6 +22,8 @@ require (
 	github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring v0.43.0
 	github.com/prometheus/client_golang v1.8.0
 	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.14.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rook/rook v1.5.0-alpha.0.0.20201209235452-8c0f70cf3709
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.6.1
@@ -32,6 +32,7 @@ import (
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/ocsinitialization"
 	"github.com/openshift/ocs-operator/controllers/persistentvolume"
+	"github.com/openshift/ocs-operator/controllers/snapshotschedule"
 	"github.com/openshift/ocs-operator/controllers/storagecluster"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
@@ -135,6 +136,15 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "PersistentVolume")
 		os.Exit(1)
 	}
+
+	if err = (&snapshotschedule.SnapshotScheduleReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("SnapshotSchedule"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SnapshotSchedule")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	// Create OCSInitialization CR if it's not present
@@ -0,0 +1,159 @@
+package collectors
+
+import (
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/metrics/internal/options"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const (
+	// component within the project/exporter
+	kmsSubsystem = "kms"
+)
+
+var _ prometheus.Collector = &StorageClusterCollector{}
+
+// StorageClusterCollector is a custom collector for StorageCluster Custom Resource
+type StorageClusterCollector struct {
+	KMSHealthStatus         *prometheus.Desc
+	KMSLastSuccessTimestamp *prometheus.Desc
+	Informer                cache.SharedIndexInformer
+	AllowedNamespaces       []string
+}
+
+// NewStorageClusterCollector constructs a collector
+func NewStorageClusterCollector(opts *options.Options) *StorageClusterCollector {
+	client, err := newOCSRESTClient(opts.Kubeconfig)
+	if err != nil {
+		klog.Error(err)
+	}
+
+	lw := cache.NewListWatchFromClient(client, "storageclusters", metav1.NamespaceAll, fields.Everything())
+	sharedIndexInformer := cache.NewSharedIndexInformer(lw, &ocsv1.StorageCluster{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	return &StorageClusterCollector{
+		KMSHealthStatus: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsSubsystem, "health_status"),
+			`Health Status of the KMS. 0=Connected, 1=Unknown & 2=Failure`,
+			[]string{"name", "namespace", "kms_provider"},
+			nil,
+		),
+		KMSLastSuccessTimestamp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsSubsystem, "last_success_timestamp_seconds"),
+			`Unix timestamp of the last successful health check of the KMS`,
+			[]string{"name", "namespace", "kms_provider"},
+			nil,
+		),
+		Informer:          sharedIndexInformer,
+		AllowedNamespaces: opts.AllowedNamespaces,
+	}
+}
+
+// newOCSRESTClient returns a REST client for the ocs.openshift.io/v1 API
+func newOCSRESTClient(kubeconfig *rest.Config) (*rest.RESTClient, error) {
+	scheme := runtime.NewScheme()
+	if err := ocsv1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	config := rest.CopyConfig(kubeconfig)
+	config.GroupVersion = &ocsv1.GroupVersion
+	config.APIPath = "/apis"
+	config.NegotiatedSerializer = serializer.NewCodecFactory(scheme).WithoutConversion()
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	return rest.RESTClientFor(config)
+}
+
+// Run starts StorageCluster informer
+func (c *StorageClusterCollector) Run(stopCh <-chan struct{}) {
+	go c.Informer.Run(stopCh)
+}
+
+// Describe implements prometheus.Collector interface
+func (c *StorageClusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ds := []*prometheus.Desc{
+		c.KMSHealthStatus,
+		c.KMSLastSuccessTimestamp,
+	}
+
+	for _, d := range ds {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector interface
+func (c *StorageClusterCollector) Collect(ch chan<- prometheus.Metric) {
+	storageClusters := getAllStorageClusters(c.Informer.GetIndexer(), c.AllowedNamespaces)
+
+	if len(storageClusters) > 0 {
+		c.collectKMSHealth(storageClusters, ch)
+	}
+}
+
+func getAllStorageClusters(indexer cache.Indexer, namespaces []string) (storageClusters []*ocsv1.StorageCluster) {
+	var objs []interface{}
+	if len(namespaces) == 0 {
+		objs = indexer.List()
+	}
+	for _, namespace := range namespaces {
+		tempObjs, err := indexer.ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			klog.Errorf("couldn't list StorageClusters in namespace %s. %v", namespace, err)
+			continue
+		}
+		objs = append(objs, tempObjs...)
+	}
+	for _, obj := range objs {
+		if storageCluster, ok := obj.(*ocsv1.StorageCluster); ok {
+			storageClusters = append(storageClusters, storageCluster)
+		}
+	}
+	return
+}
+
+func (c *StorageClusterCollector) collectKMSHealth(storageClusters []*ocsv1.StorageCluster, ch chan<- prometheus.Metric) {
+	for _, storageCluster := range storageClusters {
+		condition := conditionsv1.FindStatusCondition(storageCluster.Status.Conditions, ocsv1.ConditionKMSConnected)
+		if condition == nil || storageCluster.Status.KMS == nil {
+			// the KMS is disabled, or it has not been checked yet
+			continue
+		}
+		kmsProvider := storageCluster.Status.KMS.Provider
+
+		var value float64
+		switch condition.Status {
+		case corev1.ConditionTrue:
+			value = 0
+		case corev1.ConditionUnknown:
+			value = 1
+		case corev1.ConditionFalse:
+			value = 2
+		default:
+			klog.Errorf("KMSConnected condition of StorageCluster %s/%s in unexpected status %q", storageCluster.Namespace, storageCluster.Name, condition.Status)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.KMSHealthStatus,
+			prometheus.GaugeValue, value,
+			storageCluster.Name,
+			storageCluster.Namespace,
+			kmsProvider)
+
+		if lastSuccessTime := storageCluster.Status.KMS.LastSuccessTime; lastSuccessTime != nil {
+			ch <- prometheus.MustNewConstMetric(c.KMSLastSuccessTimestamp,
+				prometheus.GaugeValue, float64(lastSuccessTime.Unix()),
+				storageCluster.Name,
+				storageCluster.Namespace,
+				kmsProvider)
+		}
+	}
+}
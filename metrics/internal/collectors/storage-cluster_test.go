@@ -0,0 +1,116 @@
+package collectors
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/metrics/internal/options"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	mockStorageCluster1 = ocsv1.StorageCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mockStorageCluster-1",
+			Namespace: "openshift-storage",
+		},
+	}
+	mockStorageCluster2 = ocsv1.StorageCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mockStorageCluster-2",
+			Namespace: "default",
+		},
+	}
+)
+
+func getMockStorageClusterCollector(t *testing.T, mockOpts *options.Options) (mockStorageClusterCollector *StorageClusterCollector) {
+	setKubeConfig(t)
+	mockStorageClusterCollector = NewStorageClusterCollector(mockOpts)
+	assert.NotNil(t, mockStorageClusterCollector)
+	return
+}
+
+func TestGetAllStorageClusters(t *testing.T) {
+	storageClusterCollector := getMockStorageClusterCollector(t, mockOpts)
+	assert.NotNil(t, storageClusterCollector.Informer)
+
+	for _, obj := range []*ocsv1.StorageCluster{&mockStorageCluster1, &mockStorageCluster2} {
+		err := storageClusterCollector.Informer.GetStore().Add(obj)
+		assert.Nil(t, err)
+	}
+
+	// only the StorageClusters in the allowed namespaces are returned
+	gotStorageClusters := getAllStorageClusters(storageClusterCollector.Informer.GetIndexer(), storageClusterCollector.AllowedNamespaces)
+	assert.Equal(t, []*ocsv1.StorageCluster{&mockStorageCluster1}, gotStorageClusters)
+
+	gotStorageClusters = getAllStorageClusters(storageClusterCollector.Informer.GetIndexer(), nil)
+	assert.Len(t, gotStorageClusters, 2)
+}
+
+func TestCollectKMSHealth(t *testing.T) {
+	storageClusterCollector := getMockStorageClusterCollector(t, mockOpts)
+	lastSuccessTime := metav1.NewTime(time.Unix(1615370700, 0))
+
+	newStorageCluster := func(name string, status corev1.ConditionStatus) *ocsv1.StorageCluster {
+		sc := mockStorageCluster1.DeepCopy()
+		sc.Name = name
+		sc.Status.KMS = &ocsv1.KMSStatus{Provider: "vault", LastSuccessTime: &lastSuccessTime}
+		conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+			Type:   ocsv1.ConditionKMSConnected,
+			Status: status,
+		})
+		return sc
+	}
+	objConnected := newStorageCluster("connected", corev1.ConditionTrue)
+	objUnknown := newStorageCluster("unknown", corev1.ConditionUnknown)
+	objFailure := newStorageCluster("failure", corev1.ConditionFalse)
+	objFailure.Status.KMS.LastSuccessTime = nil
+	objDisabled := mockStorageCluster1.DeepCopy()
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		storageClusterCollector.collectKMSHealth([]*ocsv1.StorageCluster{objConnected, objUnknown, objFailure, objDisabled}, ch)
+		close(ch)
+	}()
+
+	healthStatus := map[string]float64{}
+	lastSuccess := map[string]float64{}
+	metric := dto.Metric{}
+	for m := range ch {
+		metric.Reset()
+		err := m.Write(&metric)
+		assert.Nil(t, err)
+		labels := map[string]string{}
+		for _, label := range metric.GetLabel() {
+			labels[*label.Name] = *label.Value
+		}
+		assert.Equal(t, "vault", labels["kms_provider"])
+		if assert.Contains(t, []string{"health_status", "last_success_timestamp_seconds"}, metricName(m)) {
+			if metricName(m) == "health_status" {
+				healthStatus[labels["name"]] = *metric.Gauge.Value
+			} else {
+				lastSuccess[labels["name"]] = *metric.Gauge.Value
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{"connected": 0, "unknown": 1, "failure": 2}, healthStatus)
+	assert.Equal(t, map[string]float64{"connected": 1615370700, "unknown": 1615370700}, lastSuccess)
+}
+
+// metricName returns the name of the given KMS metric without its prefix
+func metricName(m prometheus.Metric) string {
+	for _, name := range []string{"health_status", "last_success_timestamp_seconds"} {
+		if strings.Contains(m.Desc().String(), "ocs_kms_"+name) {
+			return name
+		}
+	}
+	return ""
+}
@@ -20,6 +20,38 @@
               severity_level: 'error',
             },
           },
+          {
+            alert: 'KMSServerConnectionAlert',
+            expr: |||
+              ocs_kms_health_status{%(ocsExporterSelector)s} > 1
+            ||| % $._config,
+            'for': $._config.kmsServerConnectionAlertTime,
+            labels: {
+              severity: 'critical',
+            },
+            annotations: {
+              message: 'Storage Cluster KMS Server is in un-connected state. Please check KMS config.',
+              description: 'Storage Cluster KMS Server is in un-connected state for more than %s. Please check KMS config.' % $._config.kmsServerConnectionAlertTime,
+              storage_type: $._config.cephStorageType,
+              severity_level: 'error',
+            },
+          },
+          {
+            alert: 'KMSServerHealthCheckStale',
+            expr: |||
+              time() - ocs_kms_last_success_timestamp_seconds{%(ocsExporterSelector)s} > %(kmsHealthCheckStaleSeconds)s
+            ||| % $._config,
+            'for': $._config.kmsHealthCheckStaleAlertTime,
+            labels: {
+              severity: 'warning',
+            },
+            annotations: {
+              message: 'Storage Cluster KMS Server has not been reachable for a long time.',
+              description: 'The last successful health check of the Storage Cluster KMS Server is more than %s seconds old. Please check KMS config.' % $._config.kmsHealthCheckStaleSeconds,
+              storage_type: $._config.cephStorageType,
+              severity_level: 'warning',
+            },
+          },
         ],
       },
     ],
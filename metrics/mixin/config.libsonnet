@@ -5,9 +5,15 @@
 
     // Duration to raise various Alerts
     clusterObjectStoreStateAlertTime: '15s',
+    kmsServerConnectionAlertTime: '5m',
+    kmsHealthCheckStaleAlertTime: '5m',
+
+    // The KMS is checked every 5m, so alert if it was not reachable for 3 checks
+    kmsHealthCheckStaleSeconds: 900,
 
     // Constants
     objectStorageType: 'RGW',
+    cephStorageType: 'ceph',
 
     // We build alerts for the presence of all these jobs.
     jobs: {
@@ -18,12 +18,14 @@ import (
 	ocsversion "github.com/openshift/ocs-operator/version"
 	"github.com/operator-framework/api/pkg/lib/version"
 	csvv1 "github.com/operator-framework/api/pkg/operators/v1alpha1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbac "k8s.io/api/rbac/v1"
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 var (
@@ -57,6 +59,7 @@ var (
 	// List of APIs which should be exposed in Console
 	exposedAPIs = []string{
 		"storageclusters.ocs.openshift.io",
+		"snapshotschedules.ocs.openshift.io",
 		"backingstores.noobaa.io",
 		"bucketclasses.noobaa.io",
 	}
@@ -506,6 +509,16 @@ func generateUnifiedCSV() *csvv1.ClusterServiceVersion {
 		case "storageclusterinitializations.ocs.openshift.io":
 			ocsCSV.Spec.CustomResourceDefinitions.Owned[i].DisplayName = "StorageCluster Initialization"
 			ocsCSV.Spec.CustomResourceDefinitions.Owned[i].Description = "StorageCluster Initialization represents a set of tasks the OCS operator wants to implement for every StorageCluster it encounters."
+		case "snapshotschedules.ocs.openshift.io":
+			ocsCSV.Spec.CustomResourceDefinitions.Owned[i].DisplayName = "Snapshot Schedule"
+			ocsCSV.Spec.CustomResourceDefinitions.Owned[i].Description = "Snapshot Schedule periodically takes VolumeSnapshots of the selected PersistentVolumeClaims and deletes the snapshots beyond its retention."
+			ocsCSV.Spec.CustomResourceDefinitions.Owned[i].Resources = []csvv1.APIResourceReference{
+				{
+					Name:    "volumesnapshots.snapshot.storage.k8s.io",
+					Kind:    "VolumeSnapshot",
+					Version: "v1beta1",
+				},
+			}
 		}
 	}
 
@@ -516,6 +529,14 @@ func generateUnifiedCSV() *csvv1.ClusterServiceVersion {
 	}
 	templateStrategySpec.DeploymentSpecs = append(templateStrategySpec.DeploymentSpecs, metricExporterStrategySpec)
 
+	// Add admission webhook deployment to CSV
+	webhookStrategySpec := csvv1.StrategyDeploymentSpec{
+		Name: "ocs-webhook",
+		Spec: getWebhookDeployment(),
+	}
+	templateStrategySpec.DeploymentSpecs = append(templateStrategySpec.DeploymentSpecs, webhookStrategySpec)
+	ocsCSV.Spec.WebhookDefinitions = getWebhookDefinitions("ocs-webhook")
+
 	// Add tolerations to deployments
 	for i := range templateStrategySpec.DeploymentSpecs {
 		d := &templateStrategySpec.DeploymentSpecs[i]
@@ -530,6 +551,11 @@ func generateUnifiedCSV() *csvv1.ClusterServiceVersion {
 				Resources: []string{"*"},
 				Verbs:     []string{"*"},
 			},
+			{
+				APIGroups: []string{"ocs.openshift.io"},
+				Resources: []string{"storageclusters"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
 		},
 	})
 	fmt.Println(templateStrategySpec.DeploymentSpecs)
@@ -1012,6 +1038,96 @@ func getMetricsExporterDeployment() appsv1.DeploymentSpec {
 	return deployment
 }
 
+func getWebhookDeployment() appsv1.DeploymentSpec {
+	replica := int32(1)
+	runAsNonRoot := true
+	deployment := appsv1.DeploymentSpec{
+		Replicas: &replica,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"app.kubernetes.io/component": "ocs-webhook",
+				"app.kubernetes.io/name":      "ocs-webhook",
+			},
+		},
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					"app.kubernetes.io/component": "ocs-webhook",
+					"app.kubernetes.io/name":      "ocs-webhook",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:    "ocs-webhook",
+						Image:   *ocsContainerImage,
+						Command: []string{"/usr/local/bin/ocs-webhook"},
+						Args:    []string{"--port=9443"},
+						Ports: []corev1.ContainerPort{
+							{
+								ContainerPort: 9443,
+							},
+						},
+						SecurityContext: &corev1.SecurityContext{
+							RunAsNonRoot: &runAsNonRoot,
+						},
+					},
+				},
+				ServiceAccountName: "ocs-operator",
+			},
+		},
+	}
+	return deployment
+}
+
+func getWebhookDefinitions(deploymentName string) []csvv1.WebhookDescription {
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	targetPort := intstr.FromInt(9443)
+	mutatePath := "/mutate"
+	validatePath := "/validate"
+	rules := []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: []admissionregistrationv1.OperationType{
+				admissionregistrationv1.Create,
+				admissionregistrationv1.Update,
+			},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{"ocs.openshift.io"},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"storageclusters"},
+			},
+		},
+	}
+
+	return []csvv1.WebhookDescription{
+		{
+			GenerateName:            "mstoragecluster.ocs.openshift.io",
+			Type:                    csvv1.MutatingAdmissionWebhook,
+			DeploymentName:          deploymentName,
+			ContainerPort:           443,
+			TargetPort:              &targetPort,
+			Rules:                   rules,
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1beta1"},
+			WebhookPath:             &mutatePath,
+		},
+		{
+			GenerateName:            "vstoragecluster.ocs.openshift.io",
+			Type:                    csvv1.ValidatingAdmissionWebhook,
+			DeploymentName:          deploymentName,
+			ContainerPort:           443,
+			TargetPort:              &targetPort,
+			Rules:                   rules,
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1beta1"},
+			WebhookPath:             &validatePath,
+		},
+	}
+}
+
 func main() {
 	flag.Parse()
 
@@ -0,0 +1,80 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/storagecluster"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// StorageClusterMutator sets the finalizer and the default uninstall
+// annotations on a StorageCluster at admission time, so that the reconciler
+// does not have to update the CR before its first reconcile
+type StorageClusterMutator struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &StorageClusterMutator{}
+var _ admission.DecoderInjector = &StorageClusterMutator{}
+
+// InjectDecoder injects the decoder into the StorageClusterMutator
+func (m *StorageClusterMutator) InjectDecoder(d *admission.Decoder) error {
+	m.decoder = d
+	return nil
+}
+
+// Handle mutates the StorageCluster in the admission request
+func (m *StorageClusterMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sc := &ocsv1.StorageCluster{}
+	if err := m.decoder.Decode(req, sc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	mutated := sc.DeepCopy()
+	setDefaultFinalizer(mutated)
+	setDefaultUninstallAnnotations(mutated)
+
+	marshaled, err := json.Marshal(mutated)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// setDefaultFinalizer adds the StorageCluster finalizer unless the
+// StorageCluster is already being deleted
+func setDefaultFinalizer(sc *ocsv1.StorageCluster) {
+	if !sc.GetDeletionTimestamp().IsZero() {
+		return
+	}
+	if !contains(sc.GetFinalizers(), storagecluster.StorageClusterFinalizer) {
+		sc.SetFinalizers(append(sc.GetFinalizers(), storagecluster.StorageClusterFinalizer))
+	}
+}
+
+// setDefaultUninstallAnnotations sets the uninstall annotations to their
+// defaults when they are missing or hold an unrecognized value
+func setDefaultUninstallAnnotations(sc *ocsv1.StorageCluster) {
+	v, found := sc.GetAnnotations()[storagecluster.UninstallModeAnnotation]
+	if !found || (v != string(storagecluster.UninstallModeGraceful) && v != string(storagecluster.UninstallModeForced)) {
+		metav1.SetMetaDataAnnotation(&sc.ObjectMeta, storagecluster.UninstallModeAnnotation, string(storagecluster.UninstallModeGraceful))
+	}
+
+	v, found = sc.GetAnnotations()[storagecluster.CleanupPolicyAnnotation]
+	if !found || (v != string(storagecluster.CleanupPolicyDelete) && v != string(storagecluster.CleanupPolicyRetain)) {
+		metav1.SetMetaDataAnnotation(&sc.ObjectMeta, storagecluster.CleanupPolicyAnnotation, string(storagecluster.CleanupPolicyDelete))
+	}
+}
+
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package hooks
+
+import (
+	"context"
+	"testing"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/storagecluster"
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStorageClusterMutator(t *testing.T) {
+	m := &StorageClusterMutator{}
+	assert.NoError(t, m.InjectDecoder(createTestDecoder(t)))
+
+	// a StorageCluster without finalizer and annotations gets both
+	sc := createTestStorageCluster()
+	resp := m.Handle(context.TODO(), createTestRequest(t, admissionv1beta1.Create, sc, nil))
+	assert.True(t, resp.Allowed)
+	paths := map[string]bool{}
+	for _, p := range resp.Patches {
+		paths[p.Path] = true
+	}
+	assert.True(t, paths["/metadata/finalizers"], "expected the finalizer to be added")
+	assert.True(t, paths["/metadata/annotations"], "expected the uninstall annotations to be added")
+
+	// a fully defaulted StorageCluster is left untouched
+	sc.SetFinalizers([]string{storagecluster.StorageClusterFinalizer})
+	sc.SetAnnotations(map[string]string{
+		storagecluster.UninstallModeAnnotation: string(storagecluster.UninstallModeForced),
+		storagecluster.CleanupPolicyAnnotation: string(storagecluster.CleanupPolicyRetain),
+	})
+	resp = m.Handle(context.TODO(), createTestRequest(t, admissionv1beta1.Update, sc, sc))
+	assert.True(t, resp.Allowed)
+	assert.Empty(t, resp.Patches)
+}
+
+func TestSetDefaultUninstallAnnotations(t *testing.T) {
+	sc := &ocsv1.StorageCluster{}
+	sc.SetAnnotations(map[string]string{
+		storagecluster.UninstallModeAnnotation: "bogus",
+		storagecluster.CleanupPolicyAnnotation: string(storagecluster.CleanupPolicyRetain),
+	})
+	setDefaultUninstallAnnotations(sc)
+	assert.Equal(t, string(storagecluster.UninstallModeGraceful), sc.GetAnnotations()[storagecluster.UninstallModeAnnotation])
+	assert.Equal(t, string(storagecluster.CleanupPolicyRetain), sc.GetAnnotations()[storagecluster.CleanupPolicyAnnotation])
+}
+
+func TestSetDefaultFinalizer(t *testing.T) {
+	sc := &ocsv1.StorageCluster{}
+	now := metav1.Now()
+	sc.SetDeletionTimestamp(&now)
+	setDefaultFinalizer(sc)
+	assert.Empty(t, sc.GetFinalizers())
+
+	sc.SetDeletionTimestamp(nil)
+	setDefaultFinalizer(sc)
+	setDefaultFinalizer(sc)
+	assert.Equal(t, []string{storagecluster.StorageClusterFinalizer}, sc.GetFinalizers())
+}
@@ -0,0 +1,133 @@
+package hooks
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	"github.com/openshift/ocs-operator/controllers/validation"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// reconcileStrategyManage is the MultiCloudGateway reconcile strategy under
+// which the NooBaa system is owned by the ocs-operator
+const reconcileStrategyManage = "manage"
+
+// StorageClusterValidator rejects StorageCluster create and update requests
+// that the reconciler would otherwise only refuse after the CR is stored
+type StorageClusterValidator struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &StorageClusterValidator{}
+var _ admission.DecoderInjector = &StorageClusterValidator{}
+
+// InjectDecoder injects the decoder into the StorageClusterValidator
+func (v *StorageClusterValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle validates the StorageCluster in the admission request
+func (v *StorageClusterValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sc := &ocsv1.StorageCluster{}
+	if err := v.decoder.Decode(req, sc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// never block the removal of the finalizer on a StorageCluster under deletion
+	if !sc.GetDeletionTimestamp().IsZero() {
+		return admission.Allowed("")
+	}
+
+	allErrs := validation.ValidateStorageCluster(sc)
+
+	if req.Operation == admissionv1beta1.Update {
+		oldSc := &ocsv1.StorageCluster{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldSc); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		allErrs = append(allErrs, validateDeviceSetReplicaUpdate(oldSc, sc)...)
+		allErrs = append(allErrs, validateMultiCloudGatewayUpdate(oldSc, sc)...)
+		allErrs = append(allErrs, validateErasureCodedUpdate(oldSc, sc)...)
+	}
+
+	if len(allErrs) != 0 {
+		return admission.Denied(allErrs.ToAggregate().Error())
+	}
+	return admission.Allowed("")
+}
+
+// validateDeviceSetReplicaUpdate makes sure the replica of an existing
+// StorageDeviceSet is not changed, as Rook cannot reshape the device sets
+// that are already backing OSDs
+func validateDeviceSetReplicaUpdate(oldSc, sc *ocsv1.StorageCluster) field.ErrorList {
+	allErrs := field.ErrorList{}
+	oldReplicas := map[string]int{}
+	for _, ds := range oldSc.Spec.StorageDeviceSets {
+		oldReplicas[ds.Name] = effectiveReplica(ds)
+	}
+	for i, ds := range sc.Spec.StorageDeviceSets {
+		oldReplica, ok := oldReplicas[ds.Name]
+		if !ok {
+			continue
+		}
+		if replica := effectiveReplica(ds); replica != oldReplica {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "storageDeviceSets").Index(i).Child("replica"),
+				"replica cannot be changed once the StorageDeviceSet is created"))
+		}
+	}
+	return allErrs
+}
+
+// effectiveReplica returns the replica that the ocs-operator uses for the given StorageDeviceSet
+func effectiveReplica(ds ocsv1.StorageDeviceSet) int {
+	if ds.Replica == 0 {
+		return defaults.DeviceSetReplica
+	}
+	return ds.Replica
+}
+
+// validateMultiCloudGatewayUpdate makes sure the MultiCloudGateway reconcile
+// strategy is not moved away from "manage" once the NooBaa system is owned by
+// the ocs-operator
+func validateMultiCloudGatewayUpdate(oldSc, sc *ocsv1.StorageCluster) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if isManagedMultiCloudGateway(oldSc) && !isManagedMultiCloudGateway(sc) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "multiCloudGateway", "reconcileStrategy"),
+			"reconcileStrategy cannot be changed from \"manage\""))
+	}
+	return allErrs
+}
+
+// validateErasureCodedUpdate makes sure the erasure coded data pools of the
+// CephFilesystems and CephObjectStores are not added, removed or changed on
+// an existing StorageCluster, as Rook cannot convert the pools of the
+// filesystems and object stores that are already created
+func validateErasureCodedUpdate(oldSc, sc *ocsv1.StorageCluster) field.ErrorList {
+	allErrs := field.ErrorList{}
+	managedResources := field.NewPath("spec", "managedResources")
+	if !reflect.DeepEqual(oldSc.Spec.ManagedResources.CephFilesystems.ErasureCoded, sc.Spec.ManagedResources.CephFilesystems.ErasureCoded) {
+		allErrs = append(allErrs, field.Forbidden(managedResources.Child("cephFilesystems", "erasureCoded"),
+			"erasureCoded cannot be changed once the StorageCluster is created"))
+	}
+	if !reflect.DeepEqual(oldSc.Spec.ManagedResources.CephObjectStores.ErasureCoded, sc.Spec.ManagedResources.CephObjectStores.ErasureCoded) {
+		allErrs = append(allErrs, field.Forbidden(managedResources.Child("cephObjectStores", "erasureCoded"),
+			"erasureCoded cannot be changed once the StorageCluster is created"))
+	}
+	return allErrs
+}
+
+// isManagedMultiCloudGateway returns true if the ocs-operator manages the NooBaa system.
+// An empty reconcile strategy is the same as "manage".
+func isManagedMultiCloudGateway(sc *ocsv1.StorageCluster) bool {
+	if sc.Spec.MultiCloudGateway == nil {
+		return true
+	}
+	reconcileStrategy := sc.Spec.MultiCloudGateway.ReconcileStrategy
+	return reconcileStrategy == "" || reconcileStrategy == reconcileStrategyManage
+}
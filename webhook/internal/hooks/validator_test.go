@@ -0,0 +1,210 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func createTestDecoder(t *testing.T) *admission.Decoder {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, ocsv1.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	assert.NoError(t, err)
+	return decoder
+}
+
+func createTestRequest(t *testing.T, op admissionv1beta1.Operation, sc, oldSc *ocsv1.StorageCluster) admission.Request {
+	req := admission.Request{
+		AdmissionRequest: admissionv1beta1.AdmissionRequest{
+			Operation: op,
+		},
+	}
+	raw, err := json.Marshal(sc)
+	assert.NoError(t, err)
+	req.Object = runtime.RawExtension{Raw: raw}
+	if oldSc != nil {
+		raw, err = json.Marshal(oldSc)
+		assert.NoError(t, err)
+		req.OldObject = runtime.RawExtension{Raw: raw}
+	}
+	return req
+}
+
+func createTestStorageCluster() *ocsv1.StorageCluster {
+	storageClassName := "gp2"
+	return &ocsv1.StorageCluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: ocsv1.GroupVersion.String(),
+			Kind:       "StorageCluster",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ocsinit",
+			Namespace: "openshift-storage",
+		},
+		Spec: ocsv1.StorageClusterSpec{
+			StorageDeviceSets: []ocsv1.StorageDeviceSet{
+				{
+					Name:  "mock-sds",
+					Count: 3,
+					DataPVCTemplate: corev1.PersistentVolumeClaim{
+						Spec: corev1.PersistentVolumeClaimSpec{
+							StorageClassName: &storageClassName,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestStorageClusterValidator(t *testing.T) {
+	cases := []struct {
+		label   string
+		op      admissionv1beta1.Operation
+		modify  func(sc, oldSc *ocsv1.StorageCluster)
+		allowed bool
+	}{
+		{
+			label:   "case 1: valid StorageCluster is allowed on create",
+			op:      admissionv1beta1.Create,
+			modify:  func(sc, oldSc *ocsv1.StorageCluster) {},
+			allowed: true,
+		},
+		{
+			label: "case 2: arbiter without arbiterLocation is denied",
+			op:    admissionv1beta1.Create,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				sc.Spec.Arbiter.Enable = true
+			},
+			allowed: false,
+		},
+		{
+			label: "case 3: arbiter with arbiterLocation is allowed",
+			op:    admissionv1beta1.Create,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				sc.Spec.Arbiter.Enable = true
+				sc.Spec.NodeTopologies = &ocsv1.NodeTopologyMap{ArbiterLocation: "zone-a"}
+			},
+			allowed: true,
+		},
+		{
+			label: "case 4: changing the replica of an existing device set is denied",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				sc.Spec.StorageDeviceSets[0].Replica = 2
+			},
+			allowed: false,
+		},
+		{
+			label: "case 5: setting the default replica explicitly is allowed",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				sc.Spec.StorageDeviceSets[0].Replica = 3
+			},
+			allowed: true,
+		},
+		{
+			label: "case 6: adding a device set with a different replica is allowed",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				sc.Spec.StorageDeviceSets = append(sc.Spec.StorageDeviceSets,
+					ocsv1.StorageDeviceSet{Name: "mock-sds-2", Count: 1, Replica: 2, DataPVCTemplate: sc.Spec.StorageDeviceSets[0].DataPVCTemplate})
+			},
+			allowed: true,
+		},
+		{
+			label: "case 7: moving MCG reconcileStrategy away from manage is denied",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				oldSc.Spec.MultiCloudGateway = &ocsv1.MultiCloudGatewaySpec{ReconcileStrategy: "manage"}
+				sc.Spec.MultiCloudGateway = &ocsv1.MultiCloudGatewaySpec{ReconcileStrategy: "ignore"}
+			},
+			allowed: false,
+		},
+		{
+			label: "case 8: moving MCG reconcileStrategy to manage is allowed",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				oldSc.Spec.MultiCloudGateway = &ocsv1.MultiCloudGatewaySpec{ReconcileStrategy: "ignore"}
+				sc.Spec.MultiCloudGateway = &ocsv1.MultiCloudGatewaySpec{ReconcileStrategy: "manage"}
+			},
+			allowed: true,
+		},
+		{
+			label: "case 9: every invalid field is reported",
+			op:    admissionv1beta1.Create,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				sc.Spec.StorageDeviceSets[0].Count = 4
+				sc.Spec.StorageDeviceSets[0].DataPVCTemplate.Spec.StorageClassName = nil
+			},
+			allowed: false,
+		},
+		{
+			label: "case 10: StorageCluster under deletion is allowed",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				now := metav1.Now()
+				sc.SetDeletionTimestamp(&now)
+				sc.Spec.StorageDeviceSets[0].Replica = 2
+			},
+			allowed: true,
+		},
+		{
+			label: "case 11: adding an erasure coded CephFilesystem data pool is denied",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				sc.Spec.ManagedResources.CephFilesystems.ErasureCoded = &ocsv1.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}
+			},
+			allowed: false,
+		},
+		{
+			label: "case 12: removing the erasure coded CephObjectStore data pool is denied",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				oldSc.Spec.ManagedResources.CephObjectStores.ErasureCoded = &ocsv1.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}
+			},
+			allowed: false,
+		},
+		{
+			label: "case 13: changing the chunks of an erasure coded data pool is denied",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				oldSc.Spec.ManagedResources.CephObjectStores.ErasureCoded = &ocsv1.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}
+				sc.Spec.ManagedResources.CephObjectStores.ErasureCoded = &ocsv1.ErasureCodedPoolSpec{DataChunks: 4, CodingChunks: 2}
+			},
+			allowed: false,
+		},
+		{
+			label: "case 14: keeping the erasure coded data pools is allowed",
+			op:    admissionv1beta1.Update,
+			modify: func(sc, oldSc *ocsv1.StorageCluster) {
+				oldSc.Spec.ManagedResources.CephFilesystems.ErasureCoded = &ocsv1.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}
+				sc.Spec.ManagedResources.CephFilesystems.ErasureCoded = &ocsv1.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}
+			},
+			allowed: true,
+		},
+	}
+
+	v := &StorageClusterValidator{}
+	assert.NoError(t, v.InjectDecoder(createTestDecoder(t)))
+
+	for _, c := range cases {
+		sc := createTestStorageCluster()
+		oldSc := createTestStorageCluster()
+		c.modify(sc, oldSc)
+		if c.op != admissionv1beta1.Update {
+			oldSc = nil
+		}
+		resp := v.Handle(context.TODO(), createTestRequest(t, c.op, sc, oldSc))
+		assert.Equalf(t, c.allowed, resp.Allowed, "[%s]: unexpected admission result: %v", c.label, resp.Result)
+	}
+}
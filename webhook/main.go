@@ -0,0 +1,83 @@
+/*
+Copyright 2020 Red Hat OpenShift Container Storage.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"os"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/webhook/internal/hooks"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	// the certificate and key names used by OLM when it mounts the webhook serving certificate
+	certName = "apiserver.crt"
+	keyName  = "apiserver.key"
+)
+
+var (
+	scheme   = apiruntime.NewScheme()
+	setupLog = ctrl.Log.WithName("webhook")
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(ocsv1.AddToScheme(scheme))
+}
+
+func main() {
+	var isDevelopmentEnv bool
+	var port int
+	var certDir string
+	flag.BoolVar(&isDevelopmentEnv, "development", false, "Enable/Disable running the webhook server in development environment")
+	flag.IntVar(&port, "port", 9443, "The port the webhook server binds to.")
+	flag.StringVar(&certDir, "cert-dir", "/apiserver.local.config/certificates",
+		"The directory containing the webhook serving certificate and key.")
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseDevMode(isDevelopmentEnv)))
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:             scheme,
+		MetricsBindAddress: "0",
+		Port:               port,
+		CertDir:            certDir,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to start manager")
+		os.Exit(1)
+	}
+
+	hookServer := mgr.GetWebhookServer()
+	hookServer.CertName = certName
+	hookServer.KeyName = keyName
+	hookServer.Register("/mutate", &webhook.Admission{Handler: &hooks.StorageClusterMutator{}})
+	hookServer.Register("/validate", &webhook.Admission{Handler: &hooks.StorageClusterValidator{}})
+
+	setupLog.Info("starting webhook server", "port", port)
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		setupLog.Error(err, "problem running webhook server")
+		os.Exit(1)
+	}
+}